@@ -226,6 +226,8 @@ type UserClient interface {
 	BotUserChecker() (func(candidate string) bool, error)
 	BotUserCheckerWithContext(ctx context.Context) (func(candidate string) bool, error)
 	Email() (string, error)
+	CreateGist(description, content string) (string, error)
+	RateLimit() (RateLimits, error)
 }
 
 // ProjectClient interface for project related API actions
@@ -869,6 +871,22 @@ func IsNotFound(err error) bool {
 	return false
 }
 
+// NewServerError returns an error like the ones for requests failing with the
+// 5xx status code, which may be useful for tests
+func NewServerError(code int) error {
+	return requestError{
+		StatusCode:  code,
+		ErrorString: fmt.Sprintf("status code %d", code),
+	}
+}
+
+// IsServerError returns whether err is from a request that failed with a 5xx
+// status code, which is usually worth retrying later.
+func IsServerError(err error) bool {
+	var requestErr requestError
+	return errors.As(err, &requestErr) && requestErr.StatusCode >= http.StatusInternalServerError
+}
+
 // Make a request with retries. If ret is not nil, unmarshal the response body
 // into it. Returns an error if the exit code is not one of the provided codes.
 func (c *client) request(r *request, ret interface{}) (int, error) {
@@ -1249,6 +1267,27 @@ func (c *client) Email() (string, error) {
 	return c.userData.Email, nil
 }
 
+// RateLimit returns the remaining quotas of the authenticated identity.
+// Checking them does not count against any of them.
+//
+// See https://docs.github.com/en/rest/rate-limit/rate-limit#get-rate-limit-status-for-the-authenticated-user
+func (c *client) RateLimit() (RateLimits, error) {
+	return c.RateLimitWithContext(context.Background())
+}
+
+func (c *client) RateLimitWithContext(ctx context.Context) (RateLimits, error) {
+	durationLogger := c.log("RateLimit")
+	defer durationLogger()
+
+	var limits RateLimits
+	_, err := c.requestWithContext(ctx, &request{
+		method:    http.MethodGet,
+		path:      "/rate_limit",
+		exitCodes: []int{200},
+	}, &limits)
+	return limits, err
+}
+
 // IsMember returns whether or not the user is a member of the org.
 //
 // See https://developer.github.com/v3/orgs/members/#check-membership
@@ -1778,6 +1817,10 @@ func (c *client) CreateCommentReaction(org, repo string, id int, reaction string
 //
 // See https://developer.github.com/v3/issues/#create-an-issue
 func (c *client) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	return c.CreateIssueWithContext(context.Background(), org, repo, title, body, milestone, labels, assignees)
+}
+
+func (c *client) CreateIssueWithContext(ctx context.Context, org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
 	durationLogger := c.log("CreateIssue", org, repo, title)
 	defer durationLogger()
 
@@ -1797,7 +1840,7 @@ func (c *client) CreateIssue(org, repo, title, body string, milestone int, label
 	var resp struct {
 		Num int `json:"number"`
 	}
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		// allow the description and draft fields
 		// https://developer.github.com/changes/2019-02-14-draft-pull-requests/
 		accept:      "application/vnd.github+json, application/vnd.github.shadow-cat-preview",
@@ -1813,6 +1856,52 @@ func (c *client) CreateIssue(org, repo, title, body string, milestone int, label
 	return resp.Num, nil
 }
 
+// DryRunGistURL is the URL CreateGist returns in dry mode, where no gist is
+// created.
+const DryRunGistURL = "https://gist.github.com/dry-run"
+
+// CreateGist creates a secret gist owned by the authenticated user, holding
+// content as a single Markdown file, and returns the gist's URL.
+//
+// See https://docs.github.com/en/rest/gists/gists#create-a-gist
+func (c *client) CreateGist(description, content string) (string, error) {
+	return c.CreateGistWithContext(context.Background(), description, content)
+}
+
+func (c *client) CreateGistWithContext(ctx context.Context, description, content string) (string, error) {
+	durationLogger := c.log("CreateGist", description)
+	defer durationLogger()
+
+	if c.dry {
+		// The dry-run request returns no body to read the URL from.
+		return DryRunGistURL, nil
+	}
+	type gistFile struct {
+		Content string `json:"content"`
+	}
+	data := struct {
+		Description string              `json:"description,omitempty"`
+		Public      bool                `json:"public"`
+		Files       map[string]gistFile `json:"files"`
+	}{
+		Description: description,
+		Files:       map[string]gistFile{"content.md": {Content: content}},
+	}
+	var resp struct {
+		HTMLURL string `json:"html_url"`
+	}
+	_, err := c.requestWithContext(ctx, &request{
+		method:      http.MethodPost,
+		path:        "/gists",
+		requestBody: &data,
+		exitCodes:   []int{201},
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.HTMLURL, nil
+}
+
 // CreateIssueReaction responds emotionally to org/repo#id
 //
 // See https://developer.github.com/v3/reactions/#create-reaction-for-an-issue
@@ -2027,11 +2116,15 @@ func (c *client) GetPullRequests(org, repo string) ([]PullRequest, error) {
 //
 // See https://developer.github.com/v3/pulls/#get-a-single-pull-request
 func (c *client) GetPullRequest(org, repo string, number int) (*PullRequest, error) {
+	return c.GetPullRequestWithContext(context.Background(), org, repo, number)
+}
+
+func (c *client) GetPullRequestWithContext(ctx context.Context, org, repo string, number int) (*PullRequest, error) {
 	durationLogger := c.log("GetPullRequest", org, repo, number)
 	defer durationLogger()
 
 	var pr PullRequest
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		// allow the description and draft fields
 		// https://developer.github.com/changes/2018-02-22-label-description-search-preview/
 		// https://developer.github.com/changes/2019-02-14-draft-pull-requests/
@@ -2130,11 +2223,15 @@ func (c *client) EditPullRequest(org, repo string, number int, pr *PullRequest)
 //
 // See https://developer.github.com/v3/issues/#get-a-single-issue
 func (c *client) GetIssue(org, repo string, number int) (*Issue, error) {
+	return c.GetIssueWithContext(context.Background(), org, repo, number)
+}
+
+func (c *client) GetIssueWithContext(ctx context.Context, org, repo string, number int) (*Issue, error) {
 	durationLogger := c.log("GetIssue", org, repo, number)
 	defer durationLogger()
 
 	var i Issue
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		// allow emoji
 		// https://developer.github.com/changes/2018-02-22-label-description-search-preview/
 		accept:    "application/vnd.github.symmetra-preview+json",
@@ -2150,6 +2247,10 @@ func (c *client) GetIssue(org, repo string, number int) (*Issue, error) {
 //
 // See https://developer.github.com/v3/issues/#edit-an-issue
 func (c *client) EditIssue(org, repo string, number int, issue *Issue) (*Issue, error) {
+	return c.EditIssueWithContext(context.Background(), org, repo, number, issue)
+}
+
+func (c *client) EditIssueWithContext(ctx context.Context, org, repo string, number int, issue *Issue) (*Issue, error) {
 	durationLogger := c.log("EditIssue", org, repo, number)
 	defer durationLogger()
 
@@ -2166,7 +2267,7 @@ func (c *client) EditIssue(org, repo string, number int, issue *Issue) (*Issue,
 		State: issue.State,
 	}
 	var ret Issue
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		method:      http.MethodPatch,
 		path:        fmt.Sprintf("/repos/%s/%s/issues/%d", org, repo, number),
 		org:         org,
@@ -2363,6 +2464,10 @@ func (c *client) ListPullRequestComments(org, repo string, number int) ([]Review
 //
 // See https://developer.github.com/v3/pulls/reviews/#list-reviews-on-a-pull-request
 func (c *client) ListReviews(org, repo string, number int) ([]Review, error) {
+	return c.ListReviewsWithContext(context.Background(), org, repo, number)
+}
+
+func (c *client) ListReviewsWithContext(ctx context.Context, org, repo string, number int) ([]Review, error) {
 	durationLogger := c.log("ListReviews", org, repo, number)
 	defer durationLogger()
 
@@ -2371,7 +2476,8 @@ func (c *client) ListReviews(org, repo string, number int) ([]Review, error) {
 	}
 	path := fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", org, repo, number)
 	var reviews []Review
-	err := c.readPaginatedResults(
+	err := c.readPaginatedResultsWithContext(
+		ctx,
 		path,
 		acceptNone,
 		org,
@@ -2435,11 +2541,15 @@ func (c *client) ListStatuses(org, repo, ref string) ([]Status, error) {
 //
 // See https://developer.github.com/v3/repos/#get
 func (c *client) GetRepo(owner, name string) (FullRepo, error) {
+	return c.GetRepoWithContext(context.Background(), owner, name)
+}
+
+func (c *client) GetRepoWithContext(ctx context.Context, owner, name string) (FullRepo, error) {
 	durationLogger := c.log("GetRepo", owner, name)
 	defer durationLogger()
 
 	var repo FullRepo
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		method:    http.MethodGet,
 		path:      fmt.Sprintf("/repos/%s/%s", owner, name),
 		org:       owner,
@@ -2677,10 +2787,14 @@ func (c *client) UpdateBranchProtection(org, repo, branch string, config BranchP
 //
 // See https://developer.github.com/v3/issues/labels/#create-a-label
 func (c *client) AddRepoLabel(org, repo, label, description, color string) error {
+	return c.AddRepoLabelWithContext(context.Background(), org, repo, label, description, color)
+}
+
+func (c *client) AddRepoLabelWithContext(ctx context.Context, org, repo, label, description, color string) error {
 	durationLogger := c.log("AddRepoLabel", org, repo, label, description, color)
 	defer durationLogger()
 
-	_, err := c.request(&request{
+	_, err := c.requestWithContext(ctx, &request{
 		method:      http.MethodPost,
 		path:        fmt.Sprintf("/repos/%s/%s/labels", org, repo),
 		accept:      "application/vnd.github.symmetra-preview+json", // allow the description field -- https://developer.github.com/changes/2018-02-22-label-description-search-preview/
@@ -2731,11 +2845,16 @@ func (c *client) DeleteRepoLabel(org, repo, label string) error {
 //
 // See https://developer.github.com/v3/repos/statuses/#get-the-combined-status-for-a-specific-ref
 func (c *client) GetCombinedStatus(org, repo, ref string) (*CombinedStatus, error) {
+	return c.GetCombinedStatusWithContext(context.Background(), org, repo, ref)
+}
+
+func (c *client) GetCombinedStatusWithContext(ctx context.Context, org, repo, ref string) (*CombinedStatus, error) {
 	durationLogger := c.log("GetCombinedStatus", org, repo, ref)
 	defer durationLogger()
 
 	var combinedStatus CombinedStatus
-	err := c.readPaginatedResults(
+	err := c.readPaginatedResultsWithContext(
+		ctx,
 		fmt.Sprintf("/repos/%s/%s/commits/%s/status", org, repo, ref),
 		"",
 		org,
@@ -2752,12 +2871,13 @@ func (c *client) GetCombinedStatus(org, repo, ref string) (*CombinedStatus, erro
 }
 
 // getLabels is a helper function that retrieves a paginated list of labels from a github URI path.
-func (c *client) getLabels(path, org string) ([]Label, error) {
+func (c *client) getLabels(ctx context.Context, path, org string) ([]Label, error) {
 	var labels []Label
 	if c.fake {
 		return labels, nil
 	}
-	err := c.readPaginatedResults(
+	err := c.readPaginatedResultsWithContext(
+		ctx,
 		path,
 		"application/vnd.github.symmetra-preview+json", // allow the description field -- https://developer.github.com/changes/2018-02-22-label-description-search-preview/
 		org,
@@ -2778,10 +2898,14 @@ func (c *client) getLabels(path, org string) ([]Label, error) {
 //
 // See https://developer.github.com/v3/issues/labels/#list-all-labels-for-this-repository
 func (c *client) GetRepoLabels(org, repo string) ([]Label, error) {
+	return c.GetRepoLabelsWithContext(context.Background(), org, repo)
+}
+
+func (c *client) GetRepoLabelsWithContext(ctx context.Context, org, repo string) ([]Label, error) {
 	durationLogger := c.log("GetRepoLabels", org, repo)
 	defer durationLogger()
 
-	return c.getLabels(fmt.Sprintf("/repos/%s/%s/labels", org, repo), org)
+	return c.getLabels(ctx, fmt.Sprintf("/repos/%s/%s/labels", org, repo), org)
 }
 
 // GetIssueLabels returns the list of labels currently on issue org/repo#number.
@@ -2791,7 +2915,7 @@ func (c *client) GetIssueLabels(org, repo string, number int) ([]Label, error) {
 	durationLogger := c.log("GetIssueLabels", org, repo, number)
 	defer durationLogger()
 
-	return c.getLabels(fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number), org)
+	return c.getLabels(context.Background(), fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number), org)
 }
 
 // AddLabel adds label to org/repo#number, returning an error on a bad response code.
@@ -3046,7 +3170,7 @@ func prepareReviewersBody(logins []string, org string) (map[string][]string, err
 	return body, utilerrors.NewAggregate(errors)
 }
 
-func (c *client) tryRequestReview(org, repo string, number int, logins []string) (int, error) {
+func (c *client) tryRequestReview(ctx context.Context, org, repo string, number int, logins []string) (int, error) {
 	durationLogger := c.log("RequestReview", org, repo, number, logins)
 	defer durationLogger()
 
@@ -3057,7 +3181,7 @@ func (c *client) tryRequestReview(org, repo string, number int, logins []string)
 		// let RequestReview handle retries and alerting for each login.
 		return http.StatusUnprocessableEntity, err
 	}
-	return c.request(&request{
+	return c.requestWithContext(ctx, &request{
 		method:      http.MethodPost,
 		path:        fmt.Sprintf("/repos/%s/%s/pulls/%d/requested_reviewers", org, repo, number),
 		org:         org,
@@ -3075,12 +3199,16 @@ func (c *client) tryRequestReview(org, repo string, number int, logins []string)
 //
 // See https://developer.github.com/v3/pulls/review_requests/#create-a-review-request
 func (c *client) RequestReview(org, repo string, number int, logins []string) error {
-	statusCode, err := c.tryRequestReview(org, repo, number, logins)
+	return c.RequestReviewWithContext(context.Background(), org, repo, number, logins)
+}
+
+func (c *client) RequestReviewWithContext(ctx context.Context, org, repo string, number int, logins []string) error {
+	statusCode, err := c.tryRequestReview(ctx, org, repo, number, logins)
 	if err != nil && statusCode == http.StatusUnprocessableEntity /*422*/ {
 		// Failed to set all members of 'logins' as reviewers, try individually.
 		missing := MissingUsers{action: "request a PR review from", apiErr: err}
 		for _, user := range logins {
-			statusCode, err = c.tryRequestReview(org, repo, number, []string{user})
+			statusCode, err = c.tryRequestReview(ctx, org, repo, number, []string{user})
 			if err != nil && statusCode == http.StatusUnprocessableEntity /*422*/ {
 				// User is not a contributor, or team not in org.
 				missing.Users = append(missing.Users, user)
@@ -3151,10 +3279,14 @@ func (c *client) UnrequestReview(org, repo string, number int, logins []string)
 //
 // See https://developer.github.com/v3/issues/#edit-an-issue
 func (c *client) CloseIssue(org, repo string, number int) error {
+	return c.CloseIssueWithContext(context.Background(), org, repo, number)
+}
+
+func (c *client) CloseIssueWithContext(ctx context.Context, org, repo string, number int) error {
 	durationLogger := c.log("CloseIssue", org, repo, number)
 	defer durationLogger()
 
-	return c.closeIssue(org, repo, number, "completed")
+	return c.closeIssue(ctx, org, repo, number, "completed")
 }
 
 // CloseIssueAsNotPlanned closes the existing, open issue provided
@@ -3166,11 +3298,11 @@ func (c *client) CloseIssueAsNotPlanned(org, repo string, number int) error {
 	durationLogger := c.log("CloseIssueAsNotPlanned", org, repo, number)
 	defer durationLogger()
 
-	return c.closeIssue(org, repo, number, "not_planned")
+	return c.closeIssue(context.Background(), org, repo, number, "not_planned")
 }
 
-func (c *client) closeIssue(org, repo string, number int, reason string) error {
-	_, err := c.request(&request{
+func (c *client) closeIssue(ctx context.Context, org, repo string, number int, reason string) error {
+	_, err := c.requestWithContext(ctx, &request{
 		method:      http.MethodPatch,
 		path:        fmt.Sprintf("/repos/%s/%s/issues/%d", org, repo, number),
 		org:         org,
@@ -3411,6 +3543,10 @@ func (c *client) FindIssues(query, sort string, asc bool) ([]Issue, error) {
 //
 // See https://help.github.com/articles/searching-issues-and-pull-requests/ for details.
 func (c *client) FindIssuesWithOrg(org, query, sort string, asc bool) ([]Issue, error) {
+	return c.FindIssuesWithOrgWithContext(context.Background(), org, query, sort, asc)
+}
+
+func (c *client) FindIssuesWithOrgWithContext(ctx context.Context, org, query, sort string, asc bool) ([]Issue, error) {
 	loggerName := "FindIssuesWithOrg"
 	if org == "" {
 		loggerName = "FindIssues"
@@ -3430,7 +3566,8 @@ func (c *client) FindIssuesWithOrg(org, query, sort string, asc bool) ([]Issue,
 			values["order"] = []string{"asc"}
 		}
 	}
-	err := c.readPaginatedResultsWithValues(
+	err := c.readPaginatedResultsWithValuesWithContext(
+		ctx,
 		fmt.Sprintf("/search/issues"),
 		values,
 		acceptNone,
@@ -4394,6 +4531,10 @@ func (c *client) ListRepoTeams(org, repo string) ([]Team, error) {
 //
 // See https://developer.github.com/v3/issues/events/
 func (c *client) ListIssueEvents(org, repo string, num int) ([]ListedIssueEvent, error) {
+	return c.ListIssueEventsWithContext(context.Background(), org, repo, num)
+}
+
+func (c *client) ListIssueEventsWithContext(ctx context.Context, org, repo string, num int) ([]ListedIssueEvent, error) {
 	durationLogger := c.log("ListIssueEvents", org, repo, num)
 	defer durationLogger()
 
@@ -4402,7 +4543,8 @@ func (c *client) ListIssueEvents(org, repo string, num int) ([]ListedIssueEvent,
 	}
 	path := fmt.Sprintf("/repos/%s/%s/issues/%d/events", org, repo, num)
 	var events []ListedIssueEvent
-	err := c.readPaginatedResults(
+	err := c.readPaginatedResultsWithContext(
+		ctx,
 		path,
 		acceptNone,
 		org,
@@ -4848,11 +4990,16 @@ func (c *client) GetTeamBySlug(slug string, org string) (*Team, error) {
 //
 // See https://docs.github.com/en/rest/checks/runs#list-check-runs-for-a-git-reference
 func (c *client) ListCheckRuns(org, repo, ref string) (*CheckRunList, error) {
+	return c.ListCheckRunsWithContext(context.Background(), org, repo, ref)
+}
+
+func (c *client) ListCheckRunsWithContext(ctx context.Context, org, repo, ref string) (*CheckRunList, error) {
 	durationLogger := c.log("ListCheckRuns", org, repo, ref)
 	defer durationLogger()
 
 	var checkRunList CheckRunList
-	if err := c.readPaginatedResults(
+	if err := c.readPaginatedResultsWithContext(
+		ctx,
 		fmt.Sprintf("/repos/%s/%s/commits/%s/check-runs", org, repo, ref),
 		"",
 		org,
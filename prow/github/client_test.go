@@ -287,6 +287,84 @@ func TestCreateComment(t *testing.T) {
 	}
 }
 
+func TestCreateGist(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/gists" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var g struct {
+			Description string `json:"description"`
+			Public      bool   `json:"public"`
+			Files       map[string]struct {
+				Content string `json:"content"`
+			} `json:"files"`
+		}
+		if err := json.Unmarshal(b, &g); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if g.Description != "desc" || g.Public || len(g.Files) != 1 || g.Files["content.md"].Content != "hello" {
+			t.Errorf("Wrong gist: %s", b)
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"html_url": "https://gist.github.com/k8s/1"}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	url, err := c.CreateGist("desc", "hello")
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if url != "https://gist.github.com/k8s/1" {
+		t.Errorf("Wrong URL: %s", url)
+	}
+}
+
+func TestCreateGistDryRun(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request in dry mode: %s %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	c.dry = true
+	url, err := c.CreateGist("desc", "hello")
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if url != DryRunGistURL {
+		t.Errorf("Wrong URL: %s", url)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/rate_limit" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"resources": {"core": {"limit": 5000, "remaining": 4990, "used": 10, "reset": 1691591363}, "search": {"limit": 30, "remaining": 29, "used": 1, "reset": 1691591091}}}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	limits, err := c.RateLimit()
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if expected := (RateLimit{Limit: 5000, Remaining: 4990, Used: 10, Reset: 1691591363}); limits.Resources.Core != expected {
+		t.Errorf("Wrong core limit: %+v", limits.Resources.Core)
+	}
+	if limits.Resources.Search.Remaining != 29 {
+		t.Errorf("Wrong search limit: %+v", limits.Resources.Search)
+	}
+}
+
 func TestCreateCommentCensored(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -1077,6 +1155,48 @@ func TestIsNotFound_nested(t *testing.T) {
 
 }
 
+func TestIsServerError(t *testing.T) {
+	testCases := []struct {
+		name        string
+		err         error
+		expectMatch bool
+	}{
+		{
+			name:        "bad gateway",
+			err:         NewServerError(http.StatusBadGateway),
+			expectMatch: true,
+		},
+		{
+			name:        "nested",
+			err:         fmt.Errorf("wrapping: %w", NewServerError(http.StatusInternalServerError)),
+			expectMatch: true,
+		},
+		{
+			name:        "forbidden",
+			err:         requestError{StatusCode: http.StatusForbidden},
+			expectMatch: false,
+		},
+		{
+			name:        "not found",
+			err:         NewNotFound(),
+			expectMatch: false,
+		},
+		{
+			name:        "other error",
+			err:         errors.New("status code 502"),
+			expectMatch: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if result := IsServerError(tc.err); result != tc.expectMatch {
+				t.Errorf("expected match: %t, got match: %t", tc.expectMatch, result)
+			}
+		})
+	}
+}
+
 func TestAssignIssue(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -3067,6 +3187,12 @@ func TestAllMethodsThatDoRequestSetOrgHeader(t *testing.T) {
 		"AcceptUserRepoInvitation",
 		// Bound to user, not org specific
 		"ListCurrentUserOrgInvitations",
+		// Bound to user, not org specific
+		"CreateGist",
+		"CreateGistWithContext",
+		// Bound to user, not org specific
+		"RateLimit",
+		"RateLimitWithContext",
 	)
 
 	clientMethods := getCallForAllClientMethodsThroughReflection(
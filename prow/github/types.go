@@ -129,6 +129,19 @@ type Reaction struct {
 	Content string `json:"content"`
 }
 
+// Reactions summarizes the reactions to an issue or comment.
+type Reactions struct {
+	TotalCount int `json:"total_count"`
+	PlusOne    int `json:"+1"`
+	MinusOne   int `json:"-1"`
+	Laugh      int `json:"laugh"`
+	Hooray     int `json:"hooray"`
+	Confused   int `json:"confused"`
+	Heart      int `json:"heart"`
+	Rocket     int `json:"rocket"`
+	Eyes       int `json:"eyes"`
+}
+
 // Status is used to set a commit status line.
 type Status struct {
 	State       string `json:"state"`
@@ -271,6 +284,9 @@ type PullRequest struct {
 	// background job was started to compute it. When the job is complete, the response
 	// will include a non-null value for the mergeable attribute.
 	Mergable *bool `json:"mergeable,omitempty"`
+	// MergeableState is GitHub's detailed mergeability, e.g. "clean" or "dirty"
+	// when the pull request has merge conflicts.
+	MergeableState string `json:"mergeable_state,omitempty"`
 	// If the PR doesn't have any milestone, `milestone` is null and is unmarshaled to nil.
 	Milestone         *Milestone `json:"milestone,omitempty"`
 	Commits           int        `json:"commits"`
@@ -338,6 +354,10 @@ type Repo struct {
 	HasProjects   bool   `json:"has_projects"`
 	HasWiki       bool   `json:"has_wiki"`
 	NodeID        string `json:"node_id"`
+	// StargazersCount and ForksCount are how many users starred and forked
+	// the repository.
+	StargazersCount int `json:"stargazers_count"`
+	ForksCount      int `json:"forks_count"`
 	// Permissions reflect the permission level for the requester, so
 	// on a repository GET call this will be for the user whose token
 	// is being used, if listing a team's repos this will be for the
@@ -369,6 +389,9 @@ type FullRepo struct {
 	AllowRebaseMerge         bool   `json:"allow_rebase_merge,omitempty"`
 	SquashMergeCommitTitle   string `json:"squash_merge_commit_title,omitempty"`
 	SquashMergeCommitMessage string `json:"squash_merge_commit_message,omitempty"`
+	// SubscribersCount is how many users watch the repository. The
+	// watchers_count field, despite its name, counts stargazers.
+	SubscribersCount int `json:"subscribers_count,omitempty"`
 }
 
 // RepoRequest contains metadata used in requests to create or update a Repo.
@@ -852,9 +875,17 @@ type Issue struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 	Milestone   Milestone `json:"milestone"`
 	StateReason string    `json:"state_reason"`
+	Reactions   Reactions `json:"reactions"`
 
 	// This will be non-nil if it is a pull request.
 	PullRequest *struct{} `json:"pull_request,omitempty"`
+
+	// RepositoryURL is the API URL of the repository, e.g. in search results.
+	RepositoryURL string `json:"repository_url,omitempty"`
+
+	// Draft is only set for pull requests, and only by some endpoints such
+	// as search.
+	Draft *bool `json:"draft,omitempty"`
 }
 
 // IsAssignee checks if a user is assigned to the issue.
@@ -890,6 +921,7 @@ func (i Issue) HasLabel(labelToFind string) bool {
 // IssueComment represents general info about an issue comment.
 type IssueComment struct {
 	ID        int       `json:"id,omitempty"`
+	NodeID    string    `json:"node_id,omitempty"`
 	Body      string    `json:"body"`
 	User      User      `json:"user,omitempty"`
 	HTMLURL   string    `json:"html_url,omitempty"`
@@ -1623,3 +1655,21 @@ type Workflow struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// RateLimit is the quota of one API resource for the authenticated identity.
+type RateLimit struct {
+	Limit     int `json:"limit"`
+	Remaining int `json:"remaining"`
+	Used      int `json:"used"`
+	// Reset is when the quota resets, in Unix seconds.
+	Reset int64 `json:"reset"`
+}
+
+// RateLimits are the quotas of the authenticated identity by API resource.
+type RateLimits struct {
+	Resources struct {
+		Core    RateLimit `json:"core"`
+		Search  RateLimit `json:"search"`
+		GraphQL RateLimit `json:"graphql"`
+	} `json:"resources"`
+}
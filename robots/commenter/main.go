@@ -16,29 +16,44 @@ limitations under the License.
 
 // Commenter provides a way to --query for issues and append a --comment to matches.
 //
-// The --token determines who interacts with github.
+// The --token, or the GitHub App of --github-app-id installed in each org
+// searched, determines who interacts with github.
 // By default commenter runs in dry mode, add --confirm to make it leave comments.
 // The --updated, --include-closed, --ceiling options provide minor safeguards
 // around leaving excessive comments.
+// Add --provider=gitlab to comment on issues of a GitLab instance instead.
+// Add --close-after-comment-if-not-updated to also record in a
+// --scheduled-actions-file that the issues should be closed if nobody updates
+// them, which a later --run-scheduled-actions run does.
+// Add --escalate to warn with --comment and, on later runs, escalate the
+// issues warned at least --escalation-after ago with --escalation-comment.
+// Add --rollup-repo and --rollup-title to list the matches in a single issue
+// instead of commenting on each, rendering --comment once with .Issues, or in
+// one issue per repo or org with --rollup-by.
+// Add --stale-warn-label to warn only issues without that label and add it,
+// and --stale-close-label as well in a later run to close the warned issues
+// that nobody updated since.
+// Leave --comment empty to only apply actions such as --label-add, or pass it
+// more than once to comment on each issue with one of the variants at random.
+//
+// A single run exits with 0 on success, 1 on setup or search failures or when
+// no comment could be posted, 2 when only some comments could be posted, and
+// 3 when it did not start because fewer than --min-rate-limit requests were
+// left, and 4 when its searches matched nothing with --fail-on-zero-matches.
 package main
 
 import (
-	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
-	"net/url"
-	"regexp"
+	"os"
 	"strconv"
-	"strings"
-	"text/template"
 	"time"
 
-	"k8s.io/test-infra/prow/config/secret"
 	"k8s.io/test-infra/prow/flagutil"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/robots/commenter/pkg/commenter"
 )
 
 const (
@@ -54,216 +69,287 @@ const (
 		.Issue.HTMLURL
 		.Issue.Assignees - list of assigned .Users
 		.Issue.Labels - list of applied labels (.Name)
+			as the search returned them, or fetched again with --fetch-full-issue
+		.IsPR - whether it is a pull request, e.g. {{if .IsPR}}your change{{else}}this issue{{end}}
+		.PR - the pull request, set for every one with --fetch-pr-details, and otherwise
+			only by the flags below that need it
+		.PR.Head.Ref and .PR.Base.Ref - the branch a pull request is from and the one it targets
+		.PR.AuthorAssociation - e.g. FIRST_TIME_CONTRIBUTOR or MEMBER
+		.PR.MergeableState - pull request mergeability, set with --comment-if-pr-has-conflicts or --pr-mergeable
+		.PR.Commits - number of commits, set with --pr-min-commits or --pr-max-commits
+		.DaysSinceUpdate - whole days since the issue was last updated, -1 if unknown
+		.DaysSinceCreation - whole days since the issue was opened, -1 if unknown
+		.MinInactivity - the --updated value in whole days
+		.LabelVars - label names with a --label-variable-prefix, keyed by the prefix
+			without a trailing / or : (e.g. {{.LabelVars.area}} is storage for area/storage)
+		.Issues - with --rollup-repo, the issues listed, each with the fields above
+		.Now - the time of the comment, e.g. {{.Now.Format "2006-01-02"}}
+		.Quarter - the quarter of .Now, e.g. 2024-Q3
+		.LastComments - with --fetch-comments, the newest comments, newest first, each with
+			.Author, .CreatedAt, .IsBot and .Body cut to 1000 bytes, e.g.
+			{{range .LastComments}}{{if not .IsBot}}@{{.Author}} said: {{.Body}}{{break}}{{end}}{{end}}
+	Functions, taking strings, users such as .Issue.Assignees or labels such as .Issue.Labels:
+		markdownList - a bulleted list, e.g. {{markdownList .Issue.Labels}}
+		mentionAll - comma-separated @mentions, put in code spans so that nobody is notified
+			if the first argument is true, e.g. {{mentionAll false .Issue.Assignees}}
+		markdownTable - a table of a header and rows made with list, e.g.
+			{{markdownTable (list "Org" "Repo") (list .Org .Repo)}}
+		codeBlock - a fenced code block in a language, e.g. {{codeBlock "yaml" "key: value"}}
+	--label-add and --escalation-label-add values are rendered the same way.
 `
 )
 
-func flagOptions() options {
-	o := options{
-		endpoint: flagutil.NewStrings(github.DefaultAPIEndpoint),
+func flagOptions() commenter.Config {
+	o, err := parseOptions(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
-	flag.StringVar(&o.query, "query", "", "See https://help.github.com/articles/searching-issues-and-pull-requests/")
-	flag.DurationVar(&o.updated, "updated", 2*time.Hour, "Filter to issues unmodified for at least this long if set")
-	flag.BoolVar(&o.includeArchived, "include-archived", false, "Match archived issues if set")
-	flag.BoolVar(&o.includeClosed, "include-closed", false, "Match closed issues if set")
-	flag.BoolVar(&o.includeLocked, "include-locked", false, "Match locked issues if set")
-	flag.BoolVar(&o.confirm, "confirm", false, "Mutate github if set")
-	flag.StringVar(&o.comment, "comment", "", "Append the following comment to matching issues")
-	flag.BoolVar(&o.useTemplate, "template", false, templateHelp)
-	flag.IntVar(&o.ceiling, "ceiling", 3, "Maximum number of issues to modify, 0 for infinite")
-	flag.Var(&o.endpoint, "endpoint", "GitHub's API endpoint")
-	flag.StringVar(&o.graphqlEndpoint, "graphql-endpoint", github.DefaultGraphQLEndpoint, "GitHub's GraphQL API Endpoint")
-	flag.StringVar(&o.token, "token", "", "Path to github token")
-	flag.BoolVar(&o.random, "random", false, "Choose random issues to comment on from the query")
-	flag.Parse()
 	return o
 }
 
-type meta struct {
-	Number int
-	Org    string
-	Repo   string
-	Issue  github.Issue
-}
-
-type options struct {
-	ceiling         int
-	comment         string
-	includeArchived bool
-	includeClosed   bool
-	includeLocked   bool
-	useTemplate     bool
-	query           string
-	endpoint        flagutil.Strings
-	graphqlEndpoint string
-	token           string
-	updated         time.Duration
-	confirm         bool
-	random          bool
-}
-
-func parseHTMLURL(url string) (string, string, int, error) {
-	// Example: https://github.com/batterseapower/pinyin-toolkit/issues/132
-	re := regexp.MustCompile(`.+/(.+)/(.+)/(issues|pull)/(\d+)$`)
-	mat := re.FindStringSubmatch(url)
-	if mat == nil {
-		return "", "", 0, fmt.Errorf("failed to parse: %s", url)
-	}
-	n, err := strconv.Atoi(mat[4])
-	if err != nil {
-		return "", "", 0, err
+// parseOptions registers the flags on fs and parses args into options.
+func parseOptions(fs *flag.FlagSet, args []string) (commenter.Config, error) {
+	o := commenter.Config{
+		Endpoint:          flagutil.NewStrings(github.DefaultAPIEndpoint),
+		AllowedIssueTypes: flagutil.NewStrings("Bug", "Feature", "Task"),
 	}
-	return mat[1], mat[2], n, nil
-}
-
-func makeQuery(query string, includeArchived, includeClosed, includeLocked bool, minUpdated time.Duration) (string, error) {
-	// GitHub used to allow \n but changed it at some point to result in no results at all
-	query = strings.ReplaceAll(query, "\n", " ")
-	parts := []string{query}
-	if !includeArchived {
-		if strings.Contains(query, "archived:true") {
-			return "", errors.New("archived:true requires --include-archived")
+	fs.StringVar(&o.Query, "query", "", "See https://help.github.com/articles/searching-issues-and-pull-requests/")
+	fs.DurationVar(&o.Updated, "updated", 2*time.Hour, "Filter to issues unmodified for at least this long if set")
+	fs.BoolVar(&o.IncludeArchived, "include-archived", false, "Match archived issues if set")
+	fs.BoolVar(&o.IncludeClosed, "include-closed", false, "Match closed issues if set")
+	fs.BoolVar(&o.IncludeLocked, "include-locked", false, "Match locked issues if set")
+	fs.BoolVar(&o.Confirm, "confirm", false, "Mutate github if set")
+	fs.Var(&o.Comment, "comment", "Append the following comment to matching issues, or leave it empty to only apply actions such as --label-add. When passed more than once, each issue gets one of the comments at random, marked with which one")
+	fs.BoolVar(&o.UseTemplate, "template", false, templateHelp)
+	fs.IntVar(&o.Ceiling, "ceiling", 3, "Maximum number of issues to modify, 0 for infinite")
+	fs.Var(&o.Endpoint, "endpoint", "GitHub's API endpoint")
+	fs.StringVar(&o.GraphQLEndpoint, "graphql-endpoint", github.DefaultGraphQLEndpoint, "GitHub's GraphQL API Endpoint")
+	fs.StringVar(&o.Token, "token", "", "Path to github token")
+	fs.StringVar(&o.GitHubAppID, "github-app-id", "", "ID of the GitHub App to authenticate as instead of --token, as its installation in each org of --org. Requires --github-app-private-key-path")
+	fs.StringVar(&o.GitHubAppPrivateKeyPath, "github-app-private-key-path", "", "Path to the private key of the --github-app-id app")
+	fs.BoolVar(&o.Random, "random", false, "Choose random issues to comment on from the query")
+	fs.Int64Var(&o.Seed, "seed", 0, "Seed for --random, --random-weighted and choosing among --comment variants, 0 to seed from the current time")
+	fs.StringVar(&o.PRClosesIssue, "pr-closes-issue", "", "Only comment on pull requests whose body closes this org/repo#number issue with a closing keyword such as Fixes")
+	fs.BoolVar(&o.OnlyIssues, "only-issues", false, "Only match issues, adding is:issue to the query")
+	fs.BoolVar(&o.OnlyPRs, "only-prs", false, "Only match pull requests, adding is:pr to the query")
+	fs.BoolVar(&o.RequireWriteAccess, "require-write-access", false, "Skip issues in repos where the --token lacks push access")
+	fs.IntVar(&o.MinRepo.Stars, "require-repo-min-stars", 0, "Skip issues in repos with fewer stars")
+	fs.IntVar(&o.MinRepo.Watchers, "require-repo-min-watchers", 0, "Skip issues in repos with fewer watchers")
+	fs.IntVar(&o.MinRepo.Forks, "require-repo-min-forks", 0, "Skip issues in repos with fewer forks")
+	fs.IntVar(&o.Workers, "workers", 1, "Number of issues to comment on concurrently")
+	fs.DurationVar(&o.Delay, "delay", 0, "Time each worker waits after commenting on an issue")
+	fs.StringVar(&o.Marker, "marker", "", "Embed this identifier in each comment as a hidden HTML comment")
+	fs.BoolVar(&o.SkipDuplicates, "skip-duplicates", false, "Skip issues that already have an identical comment")
+	fs.StringVar(&o.IssuesFile, "issues-file", "", "Comment on the issue or pull request URLs in this file, one per line or - for stdin, instead of searching with --query")
+	fs.StringVar(&o.SingleIssue, "single-issue", "", "Comment on this issue or pull request URL instead of searching with --query")
+	fs.BoolVar(&o.OnlyConflicted, "comment-if-pr-has-conflicts", false, "Only comment on pull requests with merge conflicts")
+	fs.DurationVar(&o.Quiet.Comment, "no-comment-within", 0, "Skip issues with a comment newer than this")
+	fs.DurationVar(&o.Quiet.Label, "no-label-change-within", 0, "Skip issues with labels added or removed more recently than this")
+	fs.DurationVar(&o.Quiet.Assignment, "no-assignment-change-within", 0, "Skip issues with assignees added or removed more recently than this")
+	fs.DurationVar(&o.AwaitingAuthorSince, "awaiting-author-response-since", 0, "Only comment on issues whose latest comment is from someone other than the author and at least this old")
+	fs.DurationVar(&o.Interval, "interval", 0, "Repeat the search and comment run this often until interrupted, 0 to run once")
+	fs.BoolVar(&o.IncludeLinkedPRs, "comment-include-linked-prs", false, "List pull requests that reference the issue at the end of the comment")
+	fs.BoolVar(&o.SkipMilestoned, "skip-milestoned", false, "Skip issues in any milestone")
+	fs.BoolVar(&o.OnlyMilestoned, "only-milestoned", false, "Only comment on issues in a milestone")
+	fs.BoolVar(&o.SkipCrossRepoDuplicates, "skip-cross-repo-duplicates", false, "Skip issues with the same title, ignoring case and punctuation, as an issue in another repo already commented on in this run")
+	fs.BoolVar(&o.SkipWithLinkedPR, "skip-with-linked-pr", false, "Skip issues referenced by an open pull request")
+	fs.IntVar(&o.MaxLinkedPRs, "max-linked-prs", 5, "Maximum number of the most recent linked pull requests to list")
+	fs.StringVar(&o.IssueType, "set-issue-type", "", "Set the issue type of each issue commented on, one of --allowed-issue-types")
+	fs.Var(&o.AllowedIssueTypes, "allowed-issue-types", "Issue type --set-issue-type accepts, can be passed multiple times")
+	fs.IntVar(&o.CommentMaxLength, "comment-max-length", commenter.MaxCommentLength, "Longest comment to post in bytes, longer ones are truncated unless --comment-overflow-to-gist or --no-truncate is set")
+	fs.BoolVar(&o.OverflowToGist, "comment-overflow-to-gist", false, "Store comments longer than --comment-max-length in a gist and post a shortened comment linking to it")
+	fs.Var(&o.LabelPrefixes, "label-variable-prefix", "Expose the rest of label names with this prefix to templates as .LabelVars, can be passed multiple times")
+	fs.BoolVar(&o.RecheckUpdated, "recheck-updated", false, "Fetch each issue right before commenting and skip it if it was updated after the --updated cutoff")
+	fs.StringVar(&o.StateFile, "state-file", "", "Path to a JSON file of issues already commented on, which are skipped and added to")
+	fs.BoolVar(&o.StateReset, "state-reset", false, "Start from an empty --state-file if it cannot be parsed")
+	fs.Float64Var(&o.SamplePercent, "sample-percent", 100, "Percentage (0-100) of matching issues to comment on, still capped by --ceiling")
+	fs.StringVar(&o.Sort, "sort", "", "Sort search results by this field, e.g. updated or created (default updated when --updated is set)")
+	fs.BoolVar(&o.SortAsc, "sort-asc", false, "Sort search results in ascending order (default true when --updated is set)")
+	fs.BoolVar(&o.NewestFirst, "newest-first", false, "Target the most recently updated issues, shorthand for --updated=0 --sort=updated --sort-asc=false")
+	fs.IntVar(&o.MinReactions.PlusOne, "min-thumbs-up", 0, "Only comment on issues with at least this many thumbs up reactions")
+	fs.IntVar(&o.MinReactions.Heart, "min-hearts", 0, "Only comment on issues with at least this many heart reactions")
+	fs.IntVar(&o.MinReactions.Rocket, "min-rockets", 0, "Only comment on issues with at least this many rocket reactions")
+	fs.IntVar(&o.MaxBotComments, "max-bot-comments-per-issue", 0, "Skip issues that already have this many comments from the --token user, 0 for unlimited")
+	fs.StringVar(&o.Provider, "provider", "github", "Where the issues live, github or gitlab")
+	fs.StringVar(&o.GitLabBaseURL, "gitlab-base-url", "", "URL of the GitLab instance, e.g. https://gitlab.example.com, with --provider=gitlab")
+	fs.StringVar(&o.GitLabTokenPath, "gitlab-token-path", "", "Path to a GitLab personal access token, with --provider=gitlab")
+	fs.Var(&o.AddLabels, "label-add", "Add this label to each issue commented on, rendered like the comment with --template, can be passed multiple times")
+	fs.BoolVar(&o.LabelSync, "label-sync", false, "Check that every matching repo has the --label-add labels before commenting, skipping repos missing any")
+	fs.BoolVar(&o.LabelCreate, "label-create", false, "Create the --label-add labels missing from a repo with --label-sync")
+	fs.StringVar(&o.BodyRegex, "body-regex", "", "Only comment on issues whose body matches this regular expression, case-sensitive unless it starts with (?i)")
+	fs.StringVar(&o.TitleRegex, "title-regex", "", "Only comment on issues whose title matches this regular expression, case-sensitive unless it starts with (?i)")
+	fs.BoolVar(&o.RegexCaseInsensitive, "regex-case-insensitive", false, "Match --body-regex and --title-regex ignoring case")
+	fs.BoolVar(&o.BodyRegexSkipCode, "body-regex-skip-code-blocks", false, "Ignore fenced code blocks and inline code in issue bodies when matching --body-regex")
+	fs.StringVar(&o.SpamUserList, "spam-user-list", "", "Skip issues opened by the logins in this file, one per line, reread on every run")
+	fs.StringVar(&o.SpamDomain, "spam-domain-filter", "", "Skip issues opened by users with a public email address in this domain or its subdomains")
+	fs.IntVar(&o.MinCommits, "pr-min-commits", 0, "Only comment on pull requests with at least this many commits, skipping issues")
+	fs.IntVar(&o.MaxCommits, "pr-max-commits", 0, "Only comment on pull requests with at most this many commits, skipping issues, 0 for unlimited")
+	fs.BoolVar(&o.UseGraphQL, "use-graphql", false, "Search and comment over the GraphQL API, which fetches the issue fields in fewer calls")
+	fs.StringVar(&o.SummaryMarkdown, "summary-markdown", "", "Write a Markdown checklist of the issues processed, with the comment for each, to this file or - for stdout after every run")
+	fs.StringVar(&o.ExportMetricsFile, "export-metrics-file", "", "Write the age, comment and reaction rates of every issue processed, and their averages, to this JSON file after every run; lists the comments on each issue")
+	fs.IntVar(&o.MinRateLimit, "min-rate-limit", 0, "Fail a run that would start with fewer core API requests left than this, and pause it whenever it dips below")
+	fs.BoolVar(&o.WaitForRateLimit, "wait-for-rate-limit", false, "Wait for the rate limit to reset rather than failing a run below --min-rate-limit")
+	fs.IntVar(&o.RateLimitCheckEvery, "rate-limit-check-every", 25, "Check the rate limit against --min-rate-limit after this many comments, 0 to only check before the run")
+	fs.StringVar(&o.TestModeRedirectTo, "test-mode-redirect-to", "", "Post every comment on an issue of this org/repo instead of the matched issue, without pruning, labelling or anything else touching the matched issues, to try out templates")
+	fs.IntVar(&o.TestIssueNumber, "test-issue-number", 1, "The issue of --test-mode-redirect-to to post on")
+	fs.StringVar(&o.SlackWebhookFile, "slack-webhook-file", "", "Path to a Slack incoming webhook URL to post a summary of every run to")
+	fs.IntVar(&o.SlackMaxIssues, "slack-max-issues", 10, "List at most this many of the issues commented on in the --slack-webhook-file summary")
+	fs.BoolVar(&o.Escalate, "escalate", false, "Post --escalation-comment instead on issues the bot warned with the --marker at least --escalation-after ago, skipping those warned more recently")
+	fs.DurationVar(&o.EscalationAfter, "escalation-after", 0, "How long a --escalate warning stands before it is escalated")
+	fs.StringVar(&o.EscalationComment, "escalation-comment", "", "Comment escalated issues get with --escalate, a template like --comment if --template is set")
+	fs.BoolVar(&o.EscalationClose, "escalation-close", false, "Close the issues escalated with --escalate")
+	fs.Var(&o.EscalationLabels, "escalation-label-add", "Add this label to the issues escalated with --escalate, can be passed multiple times")
+	fs.StringVar(&o.RollupRepo, "rollup-repo", "", "List the matching issues in a single issue of this org/repo instead of commenting on each, rendering --comment once with .Issues")
+	fs.StringVar(&o.RollupTitle, "rollup-title", "", "Title of the --rollup-repo issue, which is updated if open and created otherwise")
+	fs.Var(&o.RollupBy, "rollup-by", "List the matching issues of each repo or org in a --rollup-repo issue of its own, titled --rollup-title followed by the repo or org (repo or org)")
+	fs.StringVar(&o.StaleWarnLabel, "stale-warn-label", "", "Only comment on issues without this label and add it, or with --stale-close-label only on issues with it")
+	fs.StringVar(&o.StaleCloseLabel, "stale-close-label", "", "Close the issues with --stale-warn-label not updated for --updated after commenting, adding this label")
+	fs.DurationVar(&o.CloseAfter, "close-after-comment-if-not-updated", 0, "Schedule closing each issue commented on unless it is updated within this duration, in --scheduled-actions-file")
+	fs.StringVar(&o.ScheduledActionsFile, "scheduled-actions-file", "", "Path to a JSON file of actions scheduled by --close-after-comment-if-not-updated")
+	fs.BoolVar(&o.RunScheduledActions, "run-scheduled-actions", false, "Instead of commenting, execute the due actions of --scheduled-actions-file")
+	fs.BoolVar(&o.ConfirmEach, "confirm-each", false, "Show every comment and ask on the terminal whether to post it, implying --confirm for those approved")
+	fs.DurationVar(&o.MinAuthorAge, "author-account-age-min", 0, "Only comment on issues whose author signed up at least this long ago")
+	fs.DurationVar(&o.MaxAuthorAge, "author-account-age-max", 0, "Only comment on issues whose author signed up at most this long ago, 0 for unlimited")
+	fs.DurationVar(&o.MaxDuration, "max-duration", 0, "Stop commenting after this long, finishing the comment in flight, 0 for unlimited")
+	fs.StringVar(&o.DeploymentEnvironment, "require-deployment-environment", "", "Only comment on pull requests whose head commit was deployed to this environment, skipping issues")
+	fs.StringVar(&o.ProjectColumn, "project-column-filter", "", "Only comment on issues and pull requests with a card in a classic project column of this name, e.g. To Do")
+	fs.BoolVar(&o.AllChecksPassed, "all-checks-passed", false, "Only comment on pull requests whose head commit has check runs that all succeeded, ignoring skipped ones, skipping issues")
+	fs.StringVar(&o.DeploymentState, "require-deployment-state", "", "Only comment when the latest deployment to --require-deployment-environment has this status, e.g. success")
+	fs.IntVar(&o.ExcerptLength, "comment-include-body-excerpt-length", 0, "Quote up to this many characters of the issue body, without markdown, above the comment, 0 to disable")
+	fs.Var(&o.Prune, "prune-previous", "Delete the earlier comments of the bot with the --marker before commenting, or hide them with --prune-previous=minimize")
+	fs.BoolVar(&o.MinimizePrevious, "minimize-previous", false, "Hide the earlier comments of the bot with the --marker before commenting, the same as --prune-previous=minimize")
+	fs.StringVar(&o.MinimizeClassifier, "minimize-classifier", "outdated", "Reason given when hiding earlier comments, e.g. outdated or resolved")
+	fs.IntVar(&o.PruneMax, "prune-previous-max", 5, "Prune at most this many earlier comments per issue with --prune-previous")
+	fs.IntVar(&o.MinReviews, "pr-min-reviews", 0, "Only comment on pull requests with at least this many --pr-review-state reviews, skipping issues")
+	fs.IntVar(&o.MaxReviews, "pr-max-reviews", -1, "Only comment on pull requests with at most this many --pr-review-state reviews, skipping issues, -1 for unlimited")
+	fs.StringVar(&o.ReviewState, "pr-review-state", "", "Count only reviews in this state, e.g. approved or changes_requested, instead of every submitted review")
+	fs.BoolVar(&o.EmailIssueAuthor, "email-issue-author", false, "Also email each comment to the author of the issue, if their email is public")
+	fs.StringVar(&o.SMTPConfig, "smtp-config", "", "Path to a YAML file with the host, port, from, username and password_file of the SMTP server for --email-issue-author")
+	fs.StringVar(&o.EmailTemplateFile, "email-template-file", "", "Path to a golang text/template to email with --email-issue-author instead of the comment, with the same fields as --template")
+	fs.StringVar(&o.AuditLog, "audit-log", "", "Append a JSON line for every comment, label or other change attempted to this file")
+	fs.StringVar(&o.Org, "org", "", "Comma-separated list of orgs to search in turn, applying --ceiling across all of them")
+	fs.StringVar(&o.HeaderFile, "header-file", "", "Put the contents of this file above every comment, a golang text/template with the same fields as --template")
+	fs.StringVar(&o.FooterFile, "footer-file", "", "Put the contents of this file below every comment, e.g. how to mute the bot, a golang text/template with the same fields as --template; --skip-duplicates ignores it")
+	fs.BoolVar(&o.ActionsRunLink, "github-actions-run-link", false, "When running in GitHub Actions, end every comment with a link to the workflow run")
+	fs.BoolVar(&o.SuggestQuery, "suggest-query-improvements", false, "Log advice on common mistakes in the final --query, such as repeated qualifiers or searches too broad for the 1000 results GitHub returns, without changing it")
+	fs.IntVar(&o.Retries, "retries", 0, "Retry comments that failed with a server error or a broken connection up to this many times at the end of the run")
+	fs.DurationVar(&o.RetryDelay, "retry-delay", 10*time.Second, "How long to wait before the first --retries attempt, growing by as much before each later one")
+	fs.DurationVar(&o.UpdatedMax, "updated-max", 0, "Filter to issues modified within this long if set, together with --updated searching an activity window such as 2h to 720h ago")
+	fs.DurationVar(&o.CreatedBefore, "created-before", 0, "Filter to issues created at least this long ago if set, regardless of activity")
+	fs.DurationVar(&o.CreatedAfter, "created-after", 0, "Filter to issues created at most this long ago if set")
+	fs.Var(&o.IncludeRepos, "include-repo", "Only comment on issues in repos matching this org/repo glob, e.g. kubernetes-sigs/*, can be passed multiple times")
+	fs.Var(&o.ExcludeRepos, "exclude-repo", "Skip issues in repos matching this org/repo glob, e.g. kubernetes/website, can be passed multiple times")
+	fs.IntVar(&o.CeilingPerOrg, "ceiling-per-org", 0, "Maximum number of issues to modify in each org, moving on to the next once reached without charging --ceiling for the rest, 0 for infinite")
+	fs.BoolVar(&o.RandomWeighted, "random-weighted", false, "Choose random issues to comment on from the query like --random, favouring those inactive for longest")
+	fs.BoolVar(&o.SkipDrafts, "skip-drafts", false, "Skip draft pull requests, fetching those whose search result leaves out the draft flag")
+	fs.Var(&o.PRStatus, "pr-status", "Only comment on pull requests whose head commit's combined statuses and check runs are failing, passing or pending, skipping issues")
+	fs.Func("pr-mergeable", "Only comment on pull requests that can (true) or cannot (false) be merged cleanly, skipping issues", func(value string) error {
+		mergeable, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("must be true or false")
 		}
-		parts = append(parts, "archived:false")
-	} else if strings.Contains(query, "archived:false") {
-		return "", errors.New("archived:false conflicts with --include-archived")
+		o.PRMergeable = &mergeable
+		return nil
+	})
+	fs.BoolVar(&o.FetchPRDetails, "fetch-pr-details", false, "Fetch every matching pull request for --template to use as .PR, leaving issues alone")
+	fs.StringVar(&o.IgnoreMarker, "ignore-marker", "<!-- commenter: ignore -->", "Skip issues whose body contains this text, letting maintainers opt issues out without a label, empty to comment regardless")
+	fs.BoolVar(&o.ValidateOnly, "validate-only", false, "Only run the final --query and log how many issues it matches and the first few, without needing a --comment or changing anything")
+	fs.StringVar(&o.OutputCSV, "output-csv", "", "Write a CSV row for each issue processed, with its labels, dates and what was done to it, to this file after every run")
+	fs.StringVar(&o.ReportWebhookFile, "report-webhook-url-file", "", "Path to a webhook URL to POST a JSON report of every run to")
+	fs.Var(&o.ReportWebhookHeaders, "report-webhook-header", "Send this 'Name: value' header with the --report-webhook-url-file report, e.g. for auth, can be passed multiple times")
+	fs.StringVar(&o.RequestReviewers, "request-reviewers", "", "Comma-separated logins and org/team slugs to request a review from on each pull request commented on, skipping issues")
+	fs.BoolVar(&o.ReRequestExisting, "re-request-existing", false, "Request a review again from those who reviewed or were requested on each pull request commented on, skipping issues")
+	fs.Var(&o.TransitionLabels, "transition-label", "Move each issue commented on from one label to another given as from:to, putting the first back if adding the second fails and skipping issues without it, can be passed multiple times")
+	fs.StringVar(&o.OrgsConfig, "orgs-config", "", "Search the repos an orgs.yaml of peribolos lists, or whole orgs listing none, skipping archived repos")
+	fs.StringVar(&o.ProwConfig, "prow-config", "", "Search the orgs and repos of the Tide queries of this Prow config, without the repos they exclude")
+	fs.StringVar(&o.OrgsConfigFilter, "orgs-config-filter", "", "Only search the orgs and org/repo names of --orgs-config and --prow-config matching this regex")
+	fs.StringVar(&o.LastRunFile, "last-run-file", "", "Only search the issues that went stale since the last successful run recorded in this file, instead of all those unmodified for --updated, and record this run once it succeeds")
+	fs.BoolVar(&o.LastRunAdvanceOnPartial, "last-run-advance-on-partial", false, "Record a run in the --last-run-file even when it fails on some issues, which are then not searched again")
+	fs.IntVar(&o.FetchComments, "fetch-comments", 0, "Expose the newest this many comments of each issue commented on to templates as .LastComments, listing them once the issue passes the filters")
+	fs.BoolVar(&o.FetchFullIssue, "fetch-full-issue", false, "Fetch each issue again once it passes the filters, so that templates see its current labels and assignees rather than those of the search result")
+	fs.DurationVar(&o.UpdatedWithin, "updated-within", 0, "Target the issues modified within this long, newest first, such as 24h to welcome fresh activity, instead of those unmodified for --updated")
+	fs.Func("updated-before", "Filter to issues last modified at or before this RFC3339 time, such as 2024-03-01T00:00:00Z, instead of --updated", func(value string) error {
+		t, err := time.Parse(time.RFC3339, value)
+		o.UpdatedBefore = t
+		return err
+	})
+	fs.Func("updated-after", "Filter to issues last modified at or after this RFC3339 time, instead of --updated-max", func(value string) error {
+		t, err := time.Parse(time.RFC3339, value)
+		o.UpdatedAfter = t
+		return err
+	})
+	fs.BoolVar(&o.FailOnZeroMatches, "fail-on-zero-matches", false, "Fail the run with its own exit code when the searches match no issues, which usually means a broken query")
+	fs.IntVar(&o.WarnBelow, "warn-below", 0, "Log a warning when the searches match fewer than this many issues, without failing the run")
+	fs.DurationVar(&o.GitHubCallTimeout, "github-call-timeout", commenter.DefaultCallTimeout, "Cancel a GitHub call after this long, including the client's own retries, retrying the comment with --retries. Searches get this long for each page. 0 waits forever")
+	fs.BoolVar(&o.NoTruncate, "no-truncate", false, "Fail issues whose comment is longer than --comment-max-length instead of truncating it")
+	fs.BoolVar(&o.SplitQuery, "split-query", false, "Split a --query too long for GitHub into several searches over its exclusion terms, commenting on issues matching all of them")
+	if err := fs.Parse(args); err != nil {
+		return o, err
 	}
-	if !includeClosed {
-		if strings.Contains(query, "is:closed") {
-			return "", errors.New("is:closed requires --include-closed")
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if set["updated-before"] || set["updated-after"] {
+		switch {
+		case set["updated"] && o.Updated != 0:
+			return o, fmt.Errorf("--updated-before and --updated-after conflict with --updated=%s", o.Updated)
+		case set["updated-within"]:
+			return o, errors.New("--updated-before and --updated-after conflict with --updated-within")
+		case set["updated-after"] && set["updated-max"]:
+			return o, errors.New("--updated-after conflicts with --updated-max")
+		case o.Query == "":
+			return o, errors.New("--updated-before and --updated-after require --query")
 		}
-		parts = append(parts, "is:open")
-	} else if strings.Contains(query, "is:open") {
-		return "", errors.New("is:open conflicts with --include-closed")
-	}
-	if !includeLocked {
-		if strings.Contains(query, "is:locked") {
-			return "", errors.New("is:locked requires --include-locked")
+		// The absolute cutoffs replace the default --updated.
+		o.Updated = 0
+		if set["updated-before"] && !set["sort"] {
+			// Oldest first like --updated.
+			o.Sort = "updated"
+			if !set["sort-asc"] {
+				o.SortAsc = true
+			}
 		}
-		parts = append(parts, "is:unlocked")
-	} else if strings.Contains(query, "is:unlocked") {
-		return "", errors.New("is:unlocked conflicts with --include-locked")
-	}
-	if minUpdated != 0 {
-		latest := time.Now().Add(-minUpdated)
-		parts = append(parts, "updated:<="+latest.Format(time.RFC3339))
-	}
-	return strings.Join(parts, " "), nil
-}
-
-type client interface {
-	CreateComment(owner, repo string, number int, comment string) error
-	FindIssues(query, sort string, asc bool) ([]github.Issue, error)
-}
-
-func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	o := flagOptions()
-
-	if o.query == "" {
-		log.Fatal("empty --query")
 	}
-	if o.token == "" {
-		log.Fatal("empty --token")
-	}
-	if o.comment == "" {
-		log.Fatal("empty --comment")
-	}
-
-	if err := secret.Add(o.token); err != nil {
-		log.Fatalf("Error starting secrets agent: %v", err)
-	}
-
-	var err error
-	for _, ep := range o.endpoint.Strings() {
-		_, err = url.ParseRequestURI(ep)
-		if err != nil {
-			log.Fatalf("Invalid --endpoint URL %q: %v.", ep, err)
+	if set["updated-within"] {
+		switch {
+		case o.UpdatedWithin <= 0:
+			return o, fmt.Errorf("--updated-within=%s must be positive", o.UpdatedWithin)
+		case set["updated"] && o.Updated != 0:
+			return o, fmt.Errorf("--updated-within conflicts with --updated=%s", o.Updated)
+		case set["updated-max"]:
+			return o, errors.New("--updated-within conflicts with --updated-max")
+		case o.Query == "":
+			return o, errors.New("--updated-within requires --query")
 		}
-	}
-
-	var c client
-	if o.confirm {
-		c, err = github.NewClient(secret.GetTokenGenerator(o.token), secret.Censor, o.graphqlEndpoint, o.endpoint.Strings()...)
-	} else {
-		c, err = github.NewDryRunClient(secret.GetTokenGenerator(o.token), secret.Censor, o.graphqlEndpoint, o.endpoint.Strings()...)
-	}
-	if err != nil {
-		log.Fatalf("Failed to construct GitHub client: %v", err)
-	}
-
-	query, err := makeQuery(o.query, o.includeArchived, o.includeClosed, o.includeLocked, o.updated)
-	if err != nil {
-		log.Fatalf("Bad query %q: %v", o.query, err)
-	}
-	sort := ""
-	asc := false
-	if o.updated > 0 {
-		sort = "updated"
-		asc = true
-	}
-	commenter := makeCommenter(o.comment, o.useTemplate)
-	if err := run(c, query, sort, asc, o.random, commenter, o.ceiling); err != nil {
-		log.Fatalf("Failed run: %v", err)
-	}
-}
-
-func makeCommenter(comment string, useTemplate bool) func(meta) (string, error) {
-	if !useTemplate {
-		return func(_ meta) (string, error) {
-			return comment, nil
+		o.Updated = 0
+		o.UpdatedMax = o.UpdatedWithin
+		if !set["sort"] {
+			// Newest first unless --sort-asc, so that the --ceiling picks
+			// the freshest issues.
+			o.Sort = "updated"
 		}
 	}
-	t := template.Must(template.New("comment").Parse(comment))
-	return func(m meta) (string, error) {
-		out := bytes.Buffer{}
-		err := t.Execute(&out, m)
-		return out.String(), err
-	}
-}
-
-func run(c client, query, sort string, asc, random bool, commenter func(meta) (string, error), ceiling int) error {
-	log.Printf("Searching: %s", query)
-	issues, err := c.FindIssues(query, sort, asc)
-	if err != nil {
-		return fmt.Errorf("search failed: %w", err)
-	}
-	problems := []string{}
-	log.Printf("Found %d matches", len(issues))
-	if random {
-		rand.Shuffle(len(issues), func(i, j int) {
-			issues[i], issues[j] = issues[j], issues[i]
-		})
-
-	}
-	for n, i := range issues {
-		if ceiling > 0 && n == ceiling {
-			log.Printf("Stopping at --ceiling=%d of %d results", n, len(issues))
-			break
+	if o.NewestFirst {
+		for _, name := range []string{"updated", "sort", "sort-asc"} {
+			if set[name] {
+				return o, fmt.Errorf("--newest-first conflicts with --%s", name)
+			}
 		}
-		log.Printf("Matched %s (%s)", i.HTMLURL, i.Title)
-		org, repo, number, err := parseHTMLURL(i.HTMLURL)
-		if err != nil {
-			msg := fmt.Sprintf("Failed to parse %s: %v", i.HTMLURL, err)
-			log.Print(msg)
-			problems = append(problems, msg)
-		}
-		comment, err := commenter(meta{Number: number, Org: org, Repo: repo, Issue: i})
-		if err != nil {
-			msg := fmt.Sprintf("Failed to create comment for %s/%s#%d: %v", org, repo, number, err)
-			log.Print(msg)
-			problems = append(problems, msg)
-			continue
+		o.Updated = 0
+		o.Sort = "updated"
+		o.SortAsc = false
+	} else if o.Sort == "" && o.Updated > 0 {
+		// Oldest first, so that the --ceiling picks the stalest issues.
+		o.Sort = "updated"
+		if !set["sort-asc"] {
+			o.SortAsc = true
 		}
-		if err := c.CreateComment(org, repo, number, comment); err != nil {
-			msg := fmt.Sprintf("Failed to apply comment to %s/%s#%d: %v", org, repo, number, err)
-			log.Print(msg)
-			problems = append(problems, msg)
-			continue
-		}
-		log.Printf("Commented on %s", i.HTMLURL)
-	}
-	if len(problems) > 0 {
-		return fmt.Errorf("encoutered %d failures: %v", len(problems), problems)
 	}
-	return nil
+	return o, nil
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	os.Exit(commenter.Execute(flagOptions()))
 }
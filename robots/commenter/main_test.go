@@ -1,400 +1,147 @@
-/*
-Copyright 2017 The Kubernetes Authors.
-
-Licensed under the Apache License, Version 2.0 (the "License");
-you may not use this file except in compliance with the License.
-You may obtain a copy of the License at
-
-    http://www.apache.org/licenses/LICENSE-2.0
-
-Unless required by applicable law or agreed to in writing, software
-distributed under the License is distributed on an "AS IS" BASIS,
-WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-See the License for the specific language governing permissions and
-limitations under the License.
-*/
-
 package main
 
 import (
-	"errors"
-	"fmt"
-	"strconv"
-	"strings"
+	"flag"
+	"io"
 	"testing"
 	"time"
-
-	"k8s.io/test-infra/prow/github"
 )
 
-func TestParseHTMLURL(t *testing.T) {
-	cases := []struct {
-		name string
-		url  string
-		org  string
-		repo string
-		num  int
-		fail bool
-	}{
-		{
-			name: "normal issue",
-			url:  "https://github.com/org/repo/issues/1234",
-			org:  "org",
-			repo: "repo",
-			num:  1234,
-		},
-		{
-			name: "normal pull",
-			url:  "https://github.com/pull-org/pull-repo/pull/5555",
-			org:  "pull-org",
-			repo: "pull-repo",
-			num:  5555,
-		},
-		{
-			name: "different host",
-			url:  "ftp://gitlab.whatever/org/repo/issues/6666",
-			org:  "org",
-			repo: "repo",
-			num:  6666,
-		},
-		{
-			name: "string issue",
-			url:  "https://github.com/org/repo/issues/future",
-			fail: true,
-		},
-		{
-			name: "weird issue",
-			url:  "https://gubernator.k8s.io/build/kubernetes-jenkins/logs/ci-kubernetes-e2e-gci-gce/11947/",
-			fail: true,
-		},
-	}
-
-	for _, tc := range cases {
-		org, repo, num, err := parseHTMLURL(tc.url)
-		if err != nil && !tc.fail {
-			t.Errorf("%s: should not have produced error: %v", tc.name, err)
-		} else if err == nil && tc.fail {
-			t.Errorf("%s: failed to produce an error", tc.name)
-		} else {
-			if org != tc.org {
-				t.Errorf("%s: org %s != expected %s", tc.name, org, tc.org)
-			}
-			if repo != tc.repo {
-				t.Errorf("%s: repo %s != expected %s", tc.name, repo, tc.repo)
-			}
-			if num != tc.num {
-				t.Errorf("%s: num %d != expected %d", tc.name, num, tc.num)
-			}
-		}
-	}
-}
-
-func TestMakeQuery(t *testing.T) {
+func TestParseOptionsSort(t *testing.T) {
 	cases := []struct {
-		name       string
-		query      string
-		archived   bool
-		closed     bool
-		locked     bool
-		dur        time.Duration
-		expected   []string
-		unexpected []string
-		err        bool
+		name    string
+		args    []string
+		updated time.Duration
+		// within is the --updated-max that --updated-within sets.
+		within time.Duration
+		sort   string
+		asc    bool
+		err    bool
 	}{
 		{
-			name:       "basic query",
-			query:      "hello world",
-			expected:   []string{"hello world", "is:open", "archived:false"},
-			unexpected: []string{"updated:", "openhello", "worldis"},
+			name:    "defaults sort the stalest first",
+			updated: 2 * time.Hour,
+			sort:    "updated",
+			asc:     true,
 		},
 		{
-			name:       "basic archived",
-			query:      "hello world",
-			archived:   true,
-			expected:   []string{"hello world", "is:open", "is:unlocked"},
-			unexpected: []string{"archived:false"},
+			name: "no updated filter does not sort",
+			args: []string{"--updated=0"},
 		},
 		{
-			name:       "basic closed",
-			query:      "hello world",
-			closed:     true,
-			expected:   []string{"hello world", "archived:false", "is:unlocked"},
-			unexpected: []string{"is:open"},
+			name:    "explicit sort",
+			args:    []string{"--sort=created"},
+			updated: 2 * time.Hour,
+			sort:    "created",
 		},
 		{
-			name:       "basic locked",
-			query:      "hello world",
-			locked:     true,
-			expected:   []string{"hello world", "is:open", "archived:false"},
-			unexpected: []string{"is:unlocked"},
+			name:    "explicit descending order",
+			args:    []string{"--sort-asc=false"},
+			updated: 2 * time.Hour,
+			sort:    "updated",
 		},
 		{
-			name:     "basic duration",
-			query:    "hello",
-			dur:      1 * time.Hour,
-			expected: []string{"hello", "updated:<"},
+			name: "newest first",
+			args: []string{"--newest-first"},
+			sort: "updated",
 		},
 		{
-			name:       "weird characters not escaped",
-			query:      "oh yeah!@#$&*()",
-			expected:   []string{"!", "@", "#", " "},
-			unexpected: []string{"%", "+"},
+			name: "newest first conflicts with updated",
+			args: []string{"--newest-first", "--updated=1h"},
+			err:  true,
 		},
 		{
-			name:     "linebreaks are replaced by whitespaces",
-			query:    "label:foo\nlabel:bar",
-			expected: []string{"label:foo label:bar"},
+			name: "newest first conflicts with sort",
+			args: []string{"--newest-first", "--sort=created"},
+			err:  true,
 		},
 		{
-			name:   "include closed with is:open query errors",
-			query:  "hello is:open",
-			closed: true,
-			err:    true,
+			name: "newest first conflicts with sort-asc",
+			args: []string{"--sort-asc", "--newest-first"},
+			err:  true,
 		},
 		{
-			name:     "archived:false with include-archived errors",
-			query:    "hello archived:false",
-			archived: true,
-			err:      true,
+			name:   "updated within sorts the newest first",
+			args:   []string{"--query=is:issue", "--updated-within=24h"},
+			within: 24 * time.Hour,
+			sort:   "updated",
 		},
 		{
-			name:  "archived:true without includeArchived errors",
-			query: "hello archived:true",
-			err:   true,
+			name:   "updated within with no --updated",
+			args:   []string{"--query=is:issue", "--updated=0", "--updated-within=24h"},
+			within: 24 * time.Hour,
+			sort:   "updated",
 		},
 		{
-			name:  "is:closed without includeClosed errors",
-			query: "hello is:closed",
-			err:   true,
+			name:   "updated within with an explicit sort",
+			args:   []string{"--query=is:issue", "--updated-within=24h", "--sort=created", "--sort-asc"},
+			within: 24 * time.Hour,
+			sort:   "created",
+			asc:    true,
 		},
 		{
-			name:  "is:locked without includeLocked errors",
-			query: "hello is:locked",
-			err:   true,
+			name: "updated within conflicts with updated",
+			args: []string{"--query=is:issue", "--updated=2h", "--updated-within=24h"},
+			err:  true,
 		},
 		{
-			name:   "is:unlocked with includeLocked errors",
-			query:  "hello is:unlocked",
-			locked: true,
-			err:    true,
+			name: "updated within conflicts with updated-max",
+			args: []string{"--query=is:issue", "--updated-max=48h", "--updated-within=24h"},
+			err:  true,
 		},
-	}
-
-	for _, tc := range cases {
-		actual, err := makeQuery(tc.query, tc.archived, tc.closed, tc.locked, tc.dur)
-		if err != nil && !tc.err {
-			t.Errorf("%s: unexpected error: %v", tc.name, err)
-		} else if err == nil && tc.err {
-			t.Errorf("%s: failed to raise an error", tc.name)
-		}
-		for _, e := range tc.expected {
-			if !strings.Contains(actual, e) {
-				t.Errorf("%s: could not find %s in %s", tc.name, e, actual)
-			}
-		}
-		for _, u := range tc.unexpected {
-			if strings.Contains(actual, u) {
-				t.Errorf("%s: should not have found %s in %s", tc.name, u, actual)
-			}
-		}
-	}
-}
-
-func makeIssue(owner, repo string, number int, title string) github.Issue {
-	return github.Issue{
-		HTMLURL: fmt.Sprintf("fake://localhost/%s/%s/pull/%d", owner, repo, number),
-		Title:   title,
-	}
-}
-
-type fakeClient struct {
-	comments []int
-	issues   []github.Issue
-}
-
-// Fakes Creating a client, using the same signature as github.Client
-func (c *fakeClient) CreateComment(owner, repo string, number int, comment string) error {
-	if strings.Contains(comment, "error") || repo == "error" {
-		return errors.New(comment)
-	}
-	c.comments = append(c.comments, number)
-	return nil
-}
-
-// Fakes searching for issues, using the same signature as github.Client
-func (c *fakeClient) FindIssues(query, sort string, asc bool) ([]github.Issue, error) {
-	if strings.Contains(query, "error") {
-		return nil, errors.New(query)
-	}
-	ret := []github.Issue{}
-	for _, i := range c.issues {
-		if strings.Contains(i.Title, query) {
-			ret = append(ret, i)
-		}
-	}
-	return ret, nil
-}
-
-func TestRun(t *testing.T) {
-	manyIssues := []github.Issue{}
-	manyComments := []int{}
-	for i := 0; i < 100; i++ {
-		manyIssues = append(manyIssues, makeIssue("o", "r", i, "many "+strconv.Itoa(i)))
-		manyComments = append(manyComments, i)
-	}
-
-	cases := []struct {
-		name     string
-		query    string
-		comment  string
-		template bool
-		ceiling  int
-		client   fakeClient
-		expected []int
-		err      bool
-	}{
 		{
-			name:     "find all",
-			query:    "many",
-			comment:  "found you",
-			client:   fakeClient{issues: manyIssues},
-			expected: manyComments,
+			name: "updated within must be positive",
+			args: []string{"--query=is:issue", "--updated-within=0"},
+			err:  true,
 		},
 		{
-			name:     "find first 10",
-			query:    "many",
-			ceiling:  10,
-			comment:  "hey",
-			client:   fakeClient{issues: manyIssues},
-			expected: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+			name: "updated before sorts the stalest first",
+			args: []string{"--query=is:issue", "--updated-before=2024-03-01T00:00:00Z"},
+			sort: "updated",
+			asc:  true,
 		},
 		{
-			name:    "find none",
-			query:   "none",
-			comment: "this should not happen",
-			client:  fakeClient{issues: manyIssues},
+			name: "updated after with no --updated",
+			args: []string{"--query=is:issue", "--updated=0", "--updated-after=2024-03-01T00:00:00+01:00"},
 		},
 		{
-			name:    "search error",
-			query:   "this search should error",
-			comment: "comment",
-			client:  fakeClient{issues: manyIssues},
-			err:     true,
+			name: "updated before conflicts with updated",
+			args: []string{"--query=is:issue", "--updated=1h", "--updated-before=2024-03-01T00:00:00Z"},
+			err:  true,
 		},
 		{
-			name:    "comment error",
-			query:   "problematic",
-			comment: "rolo tomassi",
-			client: fakeClient{issues: []github.Issue{
-				makeIssue("o", "r", 1, "problematic this should work"),
-				makeIssue("o", "error", 2, "problematic expect an error"),
-				makeIssue("o", "r", 3, "problematic works as well"),
-			}},
-			err:      true,
-			expected: []int{1, 3},
+			name: "updated after conflicts with updated-max",
+			args: []string{"--query=is:issue", "--updated-max=1h", "--updated-after=2024-03-01T00:00:00Z"},
+			err:  true,
 		},
 		{
-			name:     "template comment",
-			query:    "67",
-			client:   fakeClient{issues: manyIssues},
-			comment:  "https://gubernator.k8s.io/pr/{{.Org}}/{{.Repo}}/{{.Number}}",
-			template: true,
-			expected: []int{67},
+			name: "updated before must be RFC3339",
+			args: []string{"--query=is:issue", "--updated-before=2024-03-01"},
+			err:  true,
 		},
 		{
-			name:     "bad template errors",
-			query:    "67",
-			client:   fakeClient{issues: manyIssues},
-			comment:  "Bad {{.UnknownField}}",
-			template: true,
-			err:      true,
+			name: "updated within requires a query",
+			args: []string{"--updated-within=24h"},
+			err:  true,
 		},
 	}
 
 	for _, tc := range cases {
-		ignoreSorting := ""
-		ignoreOrder := false
-		err := run(&tc.client, tc.query, ignoreSorting, ignoreOrder, false, makeCommenter(tc.comment, tc.template), tc.ceiling)
-		if tc.err && err == nil {
-			t.Errorf("%s: failed to received an error", tc.name)
-			continue
-		}
-		if !tc.err && err != nil {
-			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		fs := flag.NewFlagSet(tc.name, flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		o, err := parseOptions(fs, tc.args)
+		if err != nil {
+			if !tc.err {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
 			continue
 		}
-		if len(tc.expected) != len(tc.client.comments) {
-			t.Errorf("%s: expected comments %v != actual %v", tc.name, tc.expected, tc.client.comments)
+		if tc.err {
+			t.Errorf("%s: failed to receive an error", tc.name)
 			continue
 		}
-		missing := []int{}
-		for _, e := range tc.expected {
-			found := false
-			for _, cmt := range tc.client.comments {
-				if cmt == e {
-					found = true
-					break
-				}
-			}
-			if !found {
-				missing = append(missing, e)
-			}
-		}
-		if len(missing) > 0 {
-			t.Errorf("%s: missing %v from actual comments %v", tc.name, missing, tc.client.comments)
-		}
-	}
-}
-
-func TestMakeCommenter(t *testing.T) {
-	m := meta{
-		Number: 10,
-		Org:    "org",
-		Repo:   "repo",
-		Issue: github.Issue{
-			Number:  10,
-			HTMLURL: "url",
-			Title:   "title",
-		},
-	}
-	cases := []struct {
-		name     string
-		comment  string
-		template bool
-		expected string
-		err      bool
-	}{
-		{
-			name:     "string works",
-			comment:  "hello world {{.Number}} {{.Invalid}}",
-			expected: "hello world {{.Number}} {{.Invalid}}",
-		},
-		{
-			name:     "template works",
-			comment:  "N={{.Number}} R={{.Repo}} O={{.Org}} U={{.Issue.HTMLURL}} T={{.Issue.Title}}",
-			template: true,
-			expected: "N=10 R=repo O=org U=url T=title",
-		},
-		{
-			name:     "bad template errors",
-			comment:  "Bad {{.UnknownField}} Template",
-			expected: "Bad ",
-			template: true,
-			err:      true,
-		},
-	}
-
-	for _, tc := range cases {
-		c := makeCommenter(tc.comment, tc.template)
-		actual, err := c(m)
-		if actual != tc.expected {
-			t.Errorf("%s: expected '%s' != actual '%s'", tc.name, tc.expected, actual)
-		}
-		if err != nil && !tc.err {
-			t.Errorf("%s: unexpected err: %v", tc.name, err)
-		}
-		if err == nil && tc.err {
-			t.Errorf("%s: failed to raise an exception", tc.name)
+		if o.Updated != tc.updated || o.UpdatedMax != tc.within || o.Sort != tc.sort || o.SortAsc != tc.asc {
+			t.Errorf("%s: expected updated=%s updated-max=%s sort=%q asc=%t, got updated=%s updated-max=%s sort=%q asc=%t", tc.name, tc.updated, tc.within, tc.sort, tc.asc, o.Updated, o.UpdatedMax, o.Sort, o.SortAsc)
 		}
 	}
 }
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	auditComment         = "comment"
+	auditAddLabels       = "add-labels"
+	auditCreateLabel     = "create-label"
+	auditIssueType       = "set-issue-type"
+	auditGist            = "create-gist"
+	auditClose           = "close"
+	auditDeleteComment   = "delete-comment"
+	auditMinimizeComment = "minimize-comment"
+	auditEmail           = "email"
+	auditCreateIssue     = "create-issue"
+	auditEditIssue       = "edit-issue"
+	auditRequestReview   = "request-review"
+	auditRemoveLabel     = "remove-label"
+)
+
+// auditEntry is a line of the --audit-log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Org    string    `json:"org"`
+	Repo   string    `json:"repo"`
+	// Number is unset for actions on a repo.
+	Number int `json:"number,omitempty"`
+	// BodySHA256 is the hex SHA-256 of the body sent, if any.
+	BodySHA256 string `json:"body_sha256,omitempty"`
+	// Detail is what the action applied, e.g. the labels or issue type.
+	Detail string `json:"detail,omitempty"`
+	DryRun bool   `json:"dry_run"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AuditLog appends an entry for every attempted mutation to a file, syncing
+// after each one so that a crashed run still leaves a trail. A nil AuditLog
+// records nothing.
+type AuditLog struct {
+	sync.Mutex
+	f      *os.File
+	dryRun bool
+}
+
+// OpenAuditLog opens path for appending, creating it if needed.
+func OpenAuditLog(path string, dryRun bool) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{f: f, dryRun: dryRun}, nil
+}
+
+// record appends an entry for action on target, which failed if err is set.
+// Failing to write the entry is logged rather than failing the action.
+func (a *AuditLog) record(action string, target IssueRef, body, detail string, err error) {
+	if a == nil {
+		return
+	}
+	e := auditEntry{
+		Time:   time.Now().UTC(),
+		Action: action,
+		Org:    target.Org,
+		Repo:   target.Repo,
+		Number: target.Number,
+		Detail: detail,
+		DryRun: a.dryRun,
+	}
+	if body != "" {
+		sum := sha256.Sum256([]byte(body))
+		e.BodySHA256 = hex.EncodeToString(sum[:])
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to encode audit entry for %s: %v", target, err)
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	if _, err := a.f.Write(append(b, '\n')); err != nil {
+		log.Printf("Failed to write audit entry for %s: %v", target, err)
+		return
+	}
+	if err := a.f.Sync(); err != nil {
+		log.Printf("Failed to sync the audit log: %v", err)
+	}
+}
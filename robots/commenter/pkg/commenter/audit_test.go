@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "audited"),
+		makeIssue("o", "error", 2, "audited"),
+	}}
+	// Consecutive runs append to the same log.
+	for _, dryRun := range []bool{true, false} {
+		audit, err := OpenAuditLog(path, dryRun)
+		if err != nil {
+			t.Fatalf("failed to open the audit log: %v", err)
+		}
+		_, err = Run(context.Background(), &c, Options{
+			Searches:      unscoped("audited"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hello", false),
+			AddLabels:     []string{"a", "b"},
+			Safeguards:    SafeguardOptions{Marker: "m", Audit: audit},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("failed to parse %q: %v", scanner.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("missing time in %q", scanner.Text())
+		}
+		e.Time = time.Time{}
+		entries = append(entries, e)
+	}
+
+	sum := sha256.Sum256([]byte(withMarker("hello", "m")))
+	hash := hex.EncodeToString(sum[:])
+	var expected []auditEntry
+	for _, dryRun := range []bool{true, false} {
+		expected = append(expected,
+			auditEntry{Action: auditComment, Org: "o", Repo: "r", Number: 1, BodySHA256: hash, DryRun: dryRun},
+			auditEntry{Action: auditAddLabels, Org: "o", Repo: "r", Number: 1, Detail: "a,b", DryRun: dryRun},
+			auditEntry{Action: auditComment, Org: "o", Repo: "error", Number: 2, BodySHA256: hash, DryRun: dryRun, Error: withMarker("hello", "m")},
+		)
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries\n%+v\ngot\n%+v", expected, entries)
+	}
+}
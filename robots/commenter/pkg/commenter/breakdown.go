@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// RepoResult counts the matched issues of a single repo by outcome, like
+// Result does for the whole run.
+type RepoResult struct {
+	// Repo is org/repo.
+	Repo      string
+	Matched   int
+	Commented int
+	Skipped   int
+	Failed    int
+}
+
+// repoBreakdown counts the matched issues of each repo, sorted by the number
+// commented on. Those dropped before processing count as skipped, unless
+// sampling or the ceiling left them over, and those whose repo is unknown are
+// left out.
+func repoBreakdown(matched, leftOver []github.Issue, processed []IssueResult) []RepoResult {
+	counts := map[string]*RepoResult{}
+	repoOf := map[string]string{}
+	for _, i := range matched {
+		ref, _, err := issueRef(i)
+		if err != nil {
+			continue
+		}
+		key := ref.Org + "/" + ref.Repo
+		if counts[key] == nil {
+			counts[key] = &RepoResult{Repo: key}
+		}
+		counts[key].Matched++
+		repoOf[i.HTMLURL] = key
+	}
+	// dropped starts out as every matched issue and ends up as those the
+	// filters in Run skipped.
+	dropped := map[string]int{}
+	for key, r := range counts {
+		dropped[key] = r.Matched
+	}
+	done := map[string]bool{}
+	for _, i := range processed {
+		key, ok := repoOf[i.URL]
+		if !ok {
+			continue
+		}
+		done[i.URL] = true
+		dropped[key]--
+		r := counts[key]
+		switch i.Outcome {
+		case OutcomeSkipped, OutcomeDuplicate, OutcomeStopped:
+			r.Skipped++
+		case OutcomeCommented:
+			r.Commented++
+		case OutcomeFailed, OutcomeInvalid:
+			r.Failed++
+		}
+	}
+	for _, i := range leftOver {
+		if key, ok := repoOf[i.HTMLURL]; ok && !done[i.HTMLURL] {
+			done[i.HTMLURL] = true
+			dropped[key]--
+		}
+	}
+	var repos []RepoResult
+	for key, r := range counts {
+		r.Skipped += dropped[key]
+		repos = append(repos, *r)
+	}
+	sort.Slice(repos, func(a, b int) bool {
+		if repos[a].Commented != repos[b].Commented {
+			return repos[a].Commented > repos[b].Commented
+		}
+		return repos[a].Repo < repos[b].Repo
+	})
+	return repos
+}
+
+// repoTable renders repos as an aligned table ending in their totals.
+func repoTable(repos []RepoResult) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tMATCHED\tCOMMENTED\tSKIPPED\tFAILED")
+	var total RepoResult
+	for _, r := range repos {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", r.Repo, r.Matched, r.Commented, r.Skipped, r.Failed)
+		total.Matched += r.Matched
+		total.Commented += r.Commented
+		total.Skipped += r.Skipped
+		total.Failed += r.Failed
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\n", total.Matched, total.Commented, total.Skipped, total.Failed)
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRepoTable(t *testing.T) {
+	repos := []RepoResult{
+		{Repo: "kubernetes/kubernetes", Matched: 120, Commented: 40, Skipped: 78, Failed: 2},
+		{Repo: "o/r", Matched: 3, Commented: 1, Skipped: 2},
+	}
+	expected := "" +
+		"REPO                   MATCHED  COMMENTED  SKIPPED  FAILED\n" +
+		"kubernetes/kubernetes  120      40         78       2\n" +
+		"o/r                    3        1          2        0\n" +
+		"TOTAL                  123      41         80       2\n"
+	if actual := repoTable(repos); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+}
+
+func TestRunRepoBreakdown(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "a", 1, "breakdown"),
+		makeIssue("o", "b", 2, "breakdown"),
+		makeIssue("o", "b", 3, "breakdown skip"),
+		makeIssue("o", "b", 4, "breakdown"),
+		makeIssue("o", "error", 5, "breakdown"),
+		makeIssue("o", "a", 6, "breakdown"),
+		makeIssue("o", "c", 7, "breakdown"),
+	}}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("breakdown"),
+		SamplePercent: 100,
+		Ceiling:       5,
+		Commenter:     MakeCommenter("ping", false),
+		TitleRegex:    regexp.MustCompile(`^breakdown$`),
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// o/c#7 is left over by the ceiling, so it only counts as matched, and
+	// repos with as many comments are sorted by name.
+	expected := []RepoResult{
+		{Repo: "o/a", Matched: 2, Commented: 2},
+		{Repo: "o/b", Matched: 3, Commented: 2, Skipped: 1},
+		{Repo: "o/c", Matched: 1},
+		{Repo: "o/error", Matched: 1, Failed: 1},
+	}
+	if !reflect.DeepEqual(res.Repos, expected) {
+		t.Errorf("expected %+v, got %+v", expected, res.Repos)
+	}
+	if !strings.Contains(logs.String(), "  TOTAL    7        4          1        1\n") {
+		t.Errorf("expected the table in the logs, got:\n%s", logs.String())
+	}
+}
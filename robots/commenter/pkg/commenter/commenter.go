@@ -0,0 +1,2352 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package commenter comments on the GitHub or GitLab issues matching a
+// search, as the commenter robot does.
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	githubql "github.com/shurcooL/githubv4"
+	"k8s.io/utils/clock"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// Meta is what --comment templates are rendered with.
+type Meta struct {
+	Number int
+	Org    string
+	Repo   string
+	Issue  github.Issue
+	// PR is only set when the pull request had to be fetched, as it is for
+	// every pull request with --fetch-pr-details.
+	PR *github.PullRequest
+	// IsPR is set for pull requests, fetched or not.
+	IsPR bool
+	// LabelVars maps each --label-variable-prefix to the rest of the matching label names.
+	LabelVars map[string]string
+	// DaysSinceUpdate and DaysSinceCreation are the whole days since the
+	// issue's timestamps, or unknownDays when it lacks them.
+	DaysSinceUpdate   int
+	DaysSinceCreation int
+	// MinInactivity is --updated in whole days.
+	MinInactivity int
+	// Now is when the Meta was made, for dated labels and comments.
+	Now time.Time
+	// Issues is only set when rendering a roll-up, to the issues it lists.
+	Issues []Meta
+	// LastComments are the newest comments, newest first, with
+	// --fetch-comments.
+	LastComments []Comment
+}
+
+// unknownDays is rendered for the days since a missing timestamp.
+const unknownDays = -1
+
+// setAges computes the template fields derived from the time.
+func (m *Meta) setAges(now time.Time, minInactivity time.Duration) {
+	m.DaysSinceUpdate = daysSince(m.Issue.UpdatedAt, now)
+	m.DaysSinceCreation = daysSince(m.Issue.CreatedAt, now)
+	m.MinInactivity = int(minInactivity / (24 * time.Hour))
+	m.Now = now
+}
+
+// Quarter returns the quarter of Now, such as 2024-Q3.
+func (m Meta) Quarter() string {
+	return fmt.Sprintf("%d-Q%d", m.Now.Year(), (int(m.Now.Month())-1)/3+1)
+}
+
+// daysSince returns the whole days from t to now, or unknownDays if t is unset.
+func daysSince(t, now time.Time) int {
+	if t.IsZero() {
+		return unknownDays
+	}
+	return int(now.Sub(t) / (24 * time.Hour))
+}
+
+// IssueRef identifies a single issue or pull request.
+type IssueRef struct {
+	Org    string
+	Repo   string
+	Number int
+	// IsPR is set when parsed from a pull request URL. Issues and pull
+	// requests share their numbers, so sameIssue ignores it.
+	IsPR bool
+}
+
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Org, r.Repo, r.Number)
+}
+
+// ParseHTMLURL extracts the issue reference from an issue or pull request URL.
+// The org and repo are the two path segments before /issues/ or /pull/, so
+// GitHub Enterprise hosts served under a path prefix parse as well. Query
+// strings, fragments such as #issuecomment-1 and trailing slashes are
+// ignored. GitLab URLs, which separate the project from the issue with /-/,
+// are handed to parseGitLabURL.
+func ParseHTMLURL(raw string) (IssueRef, error) {
+	// Example: https://github.com/batterseapower/pinyin-toolkit/issues/132
+	u, err := url.Parse(raw)
+	if err != nil {
+		return IssueRef{}, fmt.Errorf("failed to parse %s: %w", raw, err)
+	}
+	if strings.Contains(u.Path, "/-/") {
+		return parseGitLabURL(raw, u.Path)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	k := len(parts) - 2
+	if k < 2 || (parts[k] != "issues" && parts[k] != "pull") || parts[k-2] == "" || parts[k-1] == "" {
+		return IssueRef{}, fmt.Errorf("failed to parse: %s", raw)
+	}
+	n, err := strconv.Atoi(parts[k+1])
+	if err != nil {
+		return IssueRef{}, fmt.Errorf("failed to parse %s: %w", raw, err)
+	}
+	if n < 0 {
+		return IssueRef{}, fmt.Errorf("failed to parse %s: %d is not an issue number", raw, n)
+	}
+	return IssueRef{Org: parts[k-2], Repo: parts[k-1], Number: n, IsPR: parts[k] == "pull"}, nil
+}
+
+// issueRef identifies i by the number and repository in the API response,
+// which stay right when a repo is renamed or an issue transferred. Clients
+// that do not set the repository, such as the GraphQL and GitLab ones, fall
+// back to parsing the HTML URL, and fromURL is set.
+func issueRef(i github.Issue) (ref IssueRef, fromURL bool, err error) {
+	if org, repo, ok := repoFromAPIURL(i.RepositoryURL); ok && i.Number > 0 {
+		return IssueRef{Org: org, Repo: repo, Number: i.Number, IsPR: i.IsPullRequest()}, false, nil
+	}
+	ref, err = ParseHTMLURL(i.HTMLURL)
+	return ref, true, err
+}
+
+// repoFromAPIURL returns the org and repo of a repository API URL such as
+// https://api.github.com/repos/org/repo.
+func repoFromAPIURL(raw string) (org, repo string, ok bool) {
+	if raw == "" {
+		return "", "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	n := len(parts)
+	if n < 3 || parts[n-3] != "repos" || parts[n-2] == "" || parts[n-1] == "" {
+		return "", "", false
+	}
+	return parts[n-2], parts[n-1], true
+}
+
+// markPullRequest marks i as a pull request if its URL is that of one, for
+// clients whose results do not tell pull requests apart.
+func markPullRequest(i *github.Issue) {
+	if ref, err := ParseHTMLURL(i.HTMLURL); err == nil && ref.IsPR && i.PullRequest == nil {
+		i.PullRequest = &struct{}{}
+	}
+}
+
+// kind returns what i is for logs, "issue" or "pull request".
+func kind(i github.Issue) string {
+	if ref, err := ParseHTMLURL(i.HTMLURL); i.IsPullRequest() || err == nil && ref.IsPR {
+		return "pull request"
+	}
+	return "issue"
+}
+
+// ParseIssueRef parses a reference of the form org/repo#number.
+func ParseIssueRef(s string) (IssueRef, error) {
+	repoPath, num, ok := strings.Cut(s, "#")
+	org, repo, slash := strings.Cut(repoPath, "/")
+	if !ok || !slash || org == "" || repo == "" || strings.Contains(repo, "/") {
+		return IssueRef{}, fmt.Errorf("%q is not of the form org/repo#number", s)
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 1 {
+		return IssueRef{}, fmt.Errorf("%q has no valid issue number", s)
+	}
+	return IssueRef{Org: org, Repo: repo, Number: n}, nil
+}
+
+// closingKeywordRe matches a GitHub closing keyword and the issue it closes,
+// as #number, org/repo#number or an issue URL.
+var closingKeywordRe = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+([\w.-]+/[\w.-]+#\d+|#\d+|https?://\S+/issues/\d+)`)
+
+// closedIssues returns the issues that the body of the pull request pr
+// closes with a closing keyword. Bare #number references are to pr's repo.
+func closedIssues(body string, pr IssueRef) []IssueRef {
+	var refs []IssueRef
+	for _, m := range closingKeywordRe.FindAllStringSubmatch(body, -1) {
+		target := m[1]
+		var ref IssueRef
+		var err error
+		switch {
+		case strings.HasPrefix(target, "#"):
+			ref, err = ParseIssueRef(pr.Org + "/" + pr.Repo + target)
+		case strings.Contains(target, "://"):
+			ref, err = ParseHTMLURL(target)
+		default:
+			ref, err = ParseIssueRef(target)
+		}
+		if err == nil {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// closesIssue returns whether the body of the pull request pr closes target.
+func closesIssue(body string, pr, target IssueRef) bool {
+	for _, ref := range closedIssues(body, pr) {
+		if sameIssue(ref, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameIssue returns whether a and b refer to the same issue, ignoring the
+// case of the org and repo as GitHub does.
+func sameIssue(a, b IssueRef) bool {
+	return strings.EqualFold(a.Org, b.Org) && strings.EqualFold(a.Repo, b.Repo) && a.Number == b.Number
+}
+
+const (
+	// maxQueryLength is the longest search query GitHub accepts.
+	maxQueryLength = 256
+	// maxQueryOperators is the most AND, OR and NOT operators GitHub accepts in a search query.
+	maxQueryOperators = 5
+)
+
+// IssueKind restricts the matches to issues or to pull requests.
+type IssueKind string
+
+const (
+	AnyKind    IssueKind = ""
+	OnlyIssues IssueKind = "issue"
+	OnlyPRs    IssueKind = "pr"
+)
+
+// matches returns whether i is of the kind.
+func (k IssueKind) matches(i github.Issue) bool {
+	switch k {
+	case OnlyIssues:
+		return !i.IsPullRequest()
+	case OnlyPRs:
+		return i.IsPullRequest()
+	}
+	return true
+}
+
+// findQualifier returns the first of qualifiers that is a term of query, or "".
+func findQualifier(query string, qualifiers ...string) string {
+	for _, term := range queryTerms(query) {
+		for _, q := range qualifiers {
+			if strings.EqualFold(term, q) {
+				return term
+			}
+		}
+	}
+	return ""
+}
+
+// FindQualifierKey returns the first term of query, excluded or not, that
+// qualifies one of keys such as "org:", or "".
+func FindQualifierKey(query string, keys ...string) string {
+	for _, term := range queryTerms(query) {
+		for _, k := range keys {
+			if strings.HasPrefix(strings.ToLower(strings.TrimPrefix(term, "-")), k) {
+				return term
+			}
+		}
+	}
+	return ""
+}
+
+// findState returns the first term of query that asks for the state
+// qualifier, either itself or as the exclusion of its opposite, or "".
+// Qualifiers in quotes or other words are not terms of their own.
+func findState(query, qualifier, opposite string) string {
+	return findQualifier(query, qualifier, "-"+opposite)
+}
+
+// queryTime formats t for a search qualifier, in UTC so that queries do not
+// depend on the zone of the machine.
+func queryTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// QueryOptions are the safeguards that MakeQuery adds to a query.
+type QueryOptions struct {
+	Query           string
+	IncludeArchived bool
+	IncludeClosed   bool
+	IncludeLocked   bool
+	Kind            IssueKind
+	// MinUpdated and MaxUpdated, if set, bound how long ago the issues were
+	// last updated, unless overridden by the absolute UpdatedBefore and
+	// UpdatedAfter.
+	MinUpdated    time.Duration
+	MaxUpdated    time.Duration
+	UpdatedBefore time.Time
+	UpdatedAfter  time.Time
+	// CreatedBefore and CreatedAfter, if set, bound how long ago the issues
+	// were created.
+	CreatedBefore time.Duration
+	CreatedAfter  time.Duration
+	// Split spreads queries too long for GitHub over several ones.
+	Split bool
+	// Clock tells the time the durations are relative to, the real time if
+	// unset.
+	Clock clock.PassiveClock
+}
+
+// MakeQuery adds the safeguard qualifiers of o to o.Query. Queries too long
+// for GitHub fail unless o.Split is set, in which case the exclusion terms of
+// the query are spread over several queries that each fit and whose results
+// must all be intersected.
+func MakeQuery(o QueryOptions) ([]string, error) {
+	query := o.Query
+	// GitHub used to allow \n but changed it at some point to result in no results at all
+	query = strings.ReplaceAll(query, "\n", " ")
+	var parts []string
+	if !o.IncludeArchived {
+		if q := findState(query, "archived:true", "archived:false"); q != "" {
+			return nil, fmt.Errorf("%s requires --include-archived", q)
+		}
+		parts = append(parts, "archived:false")
+	} else if q := findState(query, "archived:false", "archived:true"); q != "" {
+		return nil, fmt.Errorf("%s conflicts with --include-archived", q)
+	}
+	if !o.IncludeClosed {
+		if q := findState(query, "is:closed", "is:open"); q != "" {
+			return nil, fmt.Errorf("%s requires --include-closed", q)
+		}
+		parts = append(parts, "is:open")
+	} else if q := findState(query, "is:open", "is:closed"); q != "" {
+		return nil, fmt.Errorf("%s conflicts with --include-closed", q)
+	}
+	if !o.IncludeLocked {
+		if q := findState(query, "is:locked", "is:unlocked"); q != "" {
+			return nil, fmt.Errorf("%s requires --include-locked", q)
+		}
+		parts = append(parts, "is:unlocked")
+	} else if q := findState(query, "is:unlocked", "is:locked"); q != "" {
+		return nil, fmt.Errorf("%s conflicts with --include-locked", q)
+	}
+	switch o.Kind {
+	case OnlyIssues:
+		if q := findQualifier(query, "is:pr", "type:pr"); q != "" {
+			return nil, fmt.Errorf("%s conflicts with --only-issues", q)
+		}
+		parts = append(parts, "is:issue")
+	case OnlyPRs:
+		if q := findQualifier(query, "is:issue", "type:issue"); q != "" {
+			return nil, fmt.Errorf("%s conflicts with --only-prs", q)
+		}
+		parts = append(parts, "is:pr")
+	}
+	now := time.Now()
+	if o.Clock != nil {
+		now = o.Clock.Now()
+	}
+	var earliest, latest time.Time
+	switch {
+	case !o.UpdatedAfter.IsZero():
+		earliest = o.UpdatedAfter
+	case o.MaxUpdated != 0:
+		earliest = now.Add(-o.MaxUpdated)
+	}
+	switch {
+	case !o.UpdatedBefore.IsZero():
+		latest = o.UpdatedBefore
+	case o.MinUpdated != 0:
+		latest = now.Add(-o.MinUpdated)
+	}
+	if !earliest.IsZero() {
+		if !latest.IsZero() && !earliest.Before(latest) {
+			if o.UpdatedAfter.IsZero() && o.UpdatedBefore.IsZero() {
+				return nil, fmt.Errorf("--updated-max=%s must be longer than --updated=%s", o.MaxUpdated, o.MinUpdated)
+			}
+			return nil, fmt.Errorf("no time is updated after %s and before %s", queryTime(earliest), queryTime(latest))
+		}
+		flag := "--updated-max"
+		if !o.UpdatedAfter.IsZero() {
+			flag = "--updated-after"
+		}
+		if term := FindQualifierKey(query, "updated:"); term != "" {
+			return nil, fmt.Errorf("%s conflicts with %s", term, flag)
+		}
+	}
+	switch {
+	case !earliest.IsZero() && !latest.IsZero():
+		parts = append(parts, "updated:"+queryTime(earliest)+".."+queryTime(latest))
+	case !earliest.IsZero():
+		// Up to now, including what is updated by the time it runs.
+		parts = append(parts, "updated:>="+queryTime(earliest))
+	case !latest.IsZero():
+		parts = append(parts, "updated:<="+queryTime(latest))
+	}
+	if o.CreatedBefore != 0 || o.CreatedAfter != 0 {
+		if term := FindQualifierKey(query, "created:"); term != "" {
+			return nil, fmt.Errorf("%s conflicts with --created-before and --created-after", term)
+		}
+		earliest, latest := now.Add(-o.CreatedAfter), now.Add(-o.CreatedBefore)
+		switch {
+		case o.CreatedBefore == 0:
+			parts = append(parts, "created:>="+queryTime(earliest))
+		case o.CreatedAfter == 0:
+			parts = append(parts, "created:<="+queryTime(latest))
+		case o.CreatedAfter <= o.CreatedBefore:
+			return nil, fmt.Errorf("--created-after=%s must be longer than --created-before=%s", o.CreatedAfter, o.CreatedBefore)
+		default:
+			parts = append(parts, "created:"+queryTime(earliest)+".."+queryTime(latest))
+		}
+	}
+	full := strings.Join(append([]string{query}, parts...), " ")
+	if n := countOperators(full); n > maxQueryOperators {
+		return nil, fmt.Errorf("query has %d AND/OR/NOT operators, exceeding GitHub's limit of %d", n, maxQueryOperators)
+	}
+	if n := utf8.RuneCountInString(full); n > maxQueryLength {
+		if !o.Split {
+			return nil, fmt.Errorf("query is %d characters, exceeding GitHub's limit of %d (see --split-query)", n, maxQueryLength)
+		}
+		return splitQuery(query, parts)
+	}
+	return []string{full}, nil
+}
+
+// splitQuery spreads the exclusion terms of query over as few queries as
+// possible, each of which repeats the other terms and the qualifiers.
+func splitQuery(query string, qualifiers []string) ([]string, error) {
+	var common, exclusions []string
+	for _, term := range queryTerms(query) {
+		if len(term) > 1 && strings.HasPrefix(term, "-") {
+			exclusions = append(exclusions, term)
+		} else {
+			common = append(common, term)
+		}
+	}
+	join := func(excluded []string) string {
+		terms := append([]string{}, common...)
+		terms = append(terms, excluded...)
+		return strings.Join(append(terms, qualifiers...), " ")
+	}
+	base := utf8.RuneCountInString(join(nil))
+	room := maxQueryLength - base
+	if len(exclusions) == 0 || room <= 0 {
+		return nil, fmt.Errorf("query is %d characters without its exclusion terms, exceeding GitHub's limit of %d", base, maxQueryLength)
+	}
+	var queries, current []string
+	used := 0
+	for _, term := range exclusions {
+		n := utf8.RuneCountInString(term) + 1
+		if n > room {
+			return nil, fmt.Errorf("exclusion %s does not fit in a query limited to %d characters", term, maxQueryLength)
+		}
+		if used+n > room {
+			queries = append(queries, join(current))
+			current, used = nil, 0
+		}
+		current = append(current, term)
+		used += n
+	}
+	return append(queries, join(current)), nil
+}
+
+// queryTerms splits query on whitespace outside of double quotes.
+func queryTerms(query string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// countOperators returns the number of AND, OR and NOT operators in query.
+func countOperators(query string) int {
+	n := 0
+	for _, term := range queryTerms(query) {
+		switch term {
+		case "AND", "OR", "NOT":
+			n++
+		}
+	}
+	return n
+}
+
+type Client interface {
+	CreateComment(owner, repo string, number int, comment string) error
+	FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error)
+	GetIssue(org, repo string, number int) (*github.Issue, error)
+	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
+	GetRepo(owner, name string) (github.FullRepo, error)
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+	QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error
+	MutateWithGitHubAppsSupport(ctx context.Context, m interface{}, input githubql.Input, vars map[string]interface{}, org string) error
+	CreateGist(description, content string) (string, error)
+	BotUserChecker() (func(candidate string) bool, error)
+	AddLabels(org, repo string, number int, labels ...string) error
+	GetRepoLabels(org, repo string) ([]github.Label, error)
+	AddRepoLabel(org, repo, label, description, color string) error
+	CloseIssue(org, repo string, number int) error
+	DeleteComment(org, repo string, id int) error
+	ListReviews(org, repo string, number int) ([]github.Review, error)
+	ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error)
+	RateLimit() (github.RateLimits, error)
+	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+	ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error)
+	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+	EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error)
+	RequestReview(org, repo string, number int, logins []string) error
+	RemoveLabel(org, repo string, number int, label string) error
+}
+
+func MakeCommenter(comment string, useTemplate bool) func(Meta) (string, error) {
+	if !useTemplate {
+		return func(_ Meta) (string, error) {
+			return comment, nil
+		}
+	}
+	t := template.Must(newTemplate("comment").Parse(comment))
+	return func(m Meta) (string, error) {
+		out := bytes.Buffer{}
+		err := t.Execute(&out, m)
+		return out.String(), err
+	}
+}
+
+// WithHeaderFooter returns a commenter that puts header above and footer
+// below every comment of commenter, either of which may be empty. Both are
+// templates rendered with the Meta of the comment. The footer is set apart
+// so that duplicate checks ignore it.
+func WithHeaderFooter(commenter func(Meta) (string, error), header, footer string) (func(Meta) (string, error), error) {
+	h, err := newTemplate("header").Parse(header)
+	if err != nil {
+		return nil, fmt.Errorf("bad header: %w", err)
+	}
+	f, err := newTemplate("footer").Parse(footer)
+	if err != nil {
+		return nil, fmt.Errorf("bad footer: %w", err)
+	}
+	return func(m Meta) (string, error) {
+		comment, err := commenter(m)
+		if err != nil {
+			return "", err
+		}
+		var top, bottom bytes.Buffer
+		if err := h.Execute(&top, m); err != nil {
+			return "", fmt.Errorf("failed to render the header: %w", err)
+		}
+		if err := f.Execute(&bottom, m); err != nil {
+			return "", fmt.Errorf("failed to render the footer: %w", err)
+		}
+		if top.Len() > 0 {
+			comment = strings.TrimRight(top.String(), "\n") + "\n\n" + comment
+		}
+		return withFooter(comment, strings.TrimRight(bottom.String(), "\n")), nil
+	}, nil
+}
+
+// Options controls which of the matching issues Run comments on and how.
+type Options struct {
+	// Searches are run in turn and the issues they find are combined.
+	Searches []OrgSearch
+	// IssueURLs, if set, are fetched instead of searching.
+	IssueURLs []string
+	Sort      string
+	Asc       bool
+	Random    bool
+	Rand      *rand.Rand
+	Ceiling   int
+	// SamplePercent is the percentage (0-100) of matches to keep after shuffling.
+	SamplePercent float64
+	// Commenter renders the comment for each issue. If nil, the issues get
+	// the labels, closing and the rest that follow a comment without one.
+	Commenter func(Meta) (string, error)
+	// Kind skips pull requests or issues that the search let through.
+	Kind IssueKind
+	// RequireWriteAccess skips issues in repos the client cannot push to.
+	RequireWriteAccess bool
+	// MinRepo skips issues in repos with fewer stars, watchers or forks.
+	MinRepo RepoThresholds
+	// Workers is the number of issues processed concurrently.
+	Workers int
+	// Delay is how long each worker waits after processing an issue.
+	Delay time.Duration
+	// Safeguards are applied to every comment.
+	Safeguards SafeguardOptions
+	// PullRequests are the filters that look at pull requests.
+	PullRequests PRFilterOptions
+	// prStatusCalls counts the API calls made for PullRequests.PRStatus.
+	prStatusCalls *int64
+	// Milestoned, if set, keeps only issues whose being in a milestone matches it.
+	Milestoned *bool
+	// State, if set, skips issues commented on by earlier runs and records new ones.
+	State *ProcessedState
+	// Quiet skips issues with comments, label or assignee changes newer than
+	// its windows.
+	Quiet QuietWindows
+	// AwaitingAuthorSince, if set, only comments on issues waiting at least this
+	// long for the author to respond to someone else's comment.
+	AwaitingAuthorSince time.Duration
+	// SkipWithLinkedPR skips issues that an open pull request references.
+	SkipWithLinkedPR bool
+	// MaxLinkedPRs, if set, lists up to this many linked pull requests in the comment.
+	MaxLinkedPRs int
+	// IssueType, if set, is applied to every issue commented on.
+	IssueType string
+	// Confirm allows mutations the dry-run client does not intercept, such as GraphQL ones.
+	Confirm bool
+	// OverflowToGist moves comments that are too long into a gist.
+	OverflowToGist bool
+	// LabelPrefixes are the label prefixes exposed to templates as Meta.LabelVars.
+	LabelPrefixes []string
+	// MinInactivity is exposed to templates as Meta.MinInactivity.
+	MinInactivity time.Duration
+	// ExcerptLength, if set, quotes up to this many characters of the issue
+	// body above the comment.
+	ExcerptLength int
+	// Prune, if set, removes up to PruneMax earlier comments of the bot with
+	// the marker before commenting.
+	Prune    PruneMode
+	PruneMax int
+	// Classifier is the reason given when Prune minimizes comments.
+	Classifier githubql.ReportedContentClassifiers
+	// Summary, if set, collects what happened to each issue processed.
+	Summary *SummaryLog
+	// Metrics, if set, collects the health of each issue processed.
+	Metrics *MetricsLog
+	// Redirect, if set, posts every comment on that issue instead, leaving
+	// the matched issues untouched.
+	Redirect *IssueRef
+	// RateLimit, if set, keeps the run from starting or going on while the
+	// rate limit is too low.
+	RateLimit *RateGuard
+	// Email, if set, emails the author of each issue commented on.
+	Email *Emailer
+	// RecheckCutoff, if set, skips issues updated after it according to a
+	// fresh fetch right before commenting.
+	RecheckCutoff time.Time
+	// MinReactions skips issues with fewer thumbs up, heart or rocket reactions.
+	MinReactions github.Reactions
+	// MaxBotComments, if set, skips issues with at least this many comments from the bot.
+	MaxBotComments int
+	// isBot is set by Run when MaxBotComments, Prune, Metrics or Escalation is.
+	isBot func(candidate string) bool
+	// SkipCrossRepoDuplicates skips issues whose title matches one in another
+	// repo commented on earlier in the Run, tracked in titles by Run.
+	SkipCrossRepoDuplicates bool
+	titles                  *titleIndex
+	// AddLabels are added to every issue commented on.
+	AddLabels []string
+	// TemplateLabels renders AddLabels as templates with the Meta of each
+	// issue, failing the issue when a rendered label is not a valid name.
+	TemplateLabels bool
+	// LabelSync skips repos missing any of AddLabels, unless LabelCreate
+	// creates them first.
+	LabelSync   bool
+	LabelCreate bool
+	// BodyRegex, if set, skips issues whose body does not match it, ignoring
+	// code when SkipCodeBlocks is set.
+	BodyRegex      *regexp.Regexp
+	SkipCodeBlocks bool
+	// TitleRegex, if set, skips issues whose title does not match it.
+	TitleRegex *regexp.Regexp
+	// ClosesIssue, if set, skips everything but pull requests whose body
+	// closes that issue.
+	ClosesIssue *IssueRef
+	// SpamUserList, if set, is a file of logins whose issues are skipped,
+	// read on every run.
+	SpamUserList string
+	// SpamDomain, if set, skips issues by users with an email address in it.
+	SpamDomain string
+	// Schedule, if set, queues closing every issue commented on.
+	Schedule *ScheduleQueue
+	// Prompt, if set, confirms every comment before posting it.
+	Prompt Prompter
+	// MinAuthorAge and MaxAuthorAge, if set, skip issues whose author's
+	// account is younger or older.
+	MinAuthorAge time.Duration
+	MaxAuthorAge time.Duration
+	// Logger gets what Run reports, the standard logger if unset. The parts
+	// with their own constructors, such as clients and the audit log, log
+	// wherever those are told to.
+	Logger *log.Logger
+	// Clock tells Run the time, the real time if unset.
+	Clock clock.PassiveClock
+	// ProjectColumn, if set, skips issues without a card in a classic project
+	// column of that name, ignoring case.
+	ProjectColumn string
+	// Close closes every issue commented on, after adding AddLabels.
+	Close bool
+	// Rollup, if set, collects the issues that pass the filters instead of
+	// commenting on them, and Run lists them in a single issue at the end.
+	Rollup *Rollup
+	// Escalation, if set, escalates the issues warned by an earlier run with
+	// the marker and skips those warned too recently.
+	Escalation *Escalation
+	// Retries, if set, makes up to this many more attempts at comments that
+	// failed with a server error or a broken connection, after every issue
+	// has been processed. Attempt n waits n times RetryDelay first.
+	Retries    int
+	RetryDelay time.Duration
+	retries    *retryQueue
+	// Repos, if set, skips issues in the repos it filters out.
+	Repos *RepoFilter
+	// CeilingPerOrg caps the issues modified in each org, 0 for infinite.
+	// Issues of an org past it are left over without taking up the Ceiling.
+	CeilingPerOrg int
+	// RandomWeighted shuffles the issues with Rand like Random, but favours
+	// the ones inactive for longest.
+	RandomWeighted bool
+	// FetchPRDetails sets the PR of the Meta of every pull request, leaving
+	// issues alone.
+	FetchPRDetails bool
+	// IgnoreMarker, if set, skips issues whose body contains it.
+	IgnoreMarker string
+	// RequestReviewers are requested to review the pull requests commented
+	// on, as logins or org/team slugs. ReRequestExisting requests a review
+	// again from those who reviewed or are requested already. Issues are left
+	// alone with a warning.
+	RequestReviewers  []string
+	ReRequestExisting bool
+	// TransitionLabels move the issues commented on from one label to
+	// another, skipping those without the From label.
+	TransitionLabels []LabelTransition
+	// FetchComments sets the LastComments of the Meta of every issue that
+	// passes the filters to its newest FetchComments comments.
+	FetchComments int
+	// FetchFullIssue fetches every issue that passes the filters again and
+	// sets the Issue of its Meta to it, as search results may carry stale
+	// labels and assignees. fullIssueFetches counts the fetches.
+	FetchFullIssue   bool
+	fullIssueFetches *int64
+	// FailOnZeroMatches fails the run with ErrZeroMatches when the searches
+	// match no issues, and WarnBelow warns when they match fewer than it.
+	FailOnZeroMatches bool
+	WarnBelow         int
+	// variants records the comment variant used for each issue, for the
+	// commenters of MakeVariantCommenter.
+	variants *variantLog
+}
+
+// defaultMergeableDelay is how long GitHub usually takes to compute the
+// mergeability of a pull request.
+const defaultMergeableDelay = 3 * time.Second
+
+// sampleSize returns how many of total issues to keep for the given percentage, rounding up.
+func sampleSize(total int, percent float64) int {
+	n := int(math.Ceil(float64(total) * percent / 100))
+	if n > total {
+		return total
+	}
+	return n
+}
+
+// RepoThresholds are the least stars, watchers and forks a repo needs.
+type RepoThresholds struct {
+	Stars    int
+	Watchers int
+	Forks    int
+}
+
+// shortfall describes why r falls below t, or returns "" if it does not.
+func (t RepoThresholds) shortfall(r github.FullRepo) string {
+	switch {
+	case r.StargazersCount < t.Stars:
+		return fmt.Sprintf("%d stars, fewer than %d", r.StargazersCount, t.Stars)
+	case r.SubscribersCount < t.Watchers:
+		return fmt.Sprintf("%d watchers, fewer than %d", r.SubscribersCount, t.Watchers)
+	case r.ForksCount < t.Forks:
+		return fmt.Sprintf("%d forks, fewer than %d", r.ForksCount, t.Forks)
+	}
+	return ""
+}
+
+// filterRepos drops issues in repos that keep rejects, getting each repo
+// only once. Issues in repos that cannot be fetched are dropped as well, and
+// issues with unparsable URLs are kept so that the caller reports them, and
+// the failures are returned for the caller to log.
+func filterRepos(c Client, issues []github.Issue, keep func(key string, r github.FullRepo) bool) ([]github.Issue, []string) {
+	var problems []string
+	decided := map[string]bool{}
+	var kept []github.Issue
+	for _, i := range issues {
+		ref, _, err := issueRef(i)
+		if err != nil {
+			kept = append(kept, i)
+			continue
+		}
+		org, repo := ref.Org, ref.Repo
+		key := org + "/" + repo
+		ok, checked := decided[key]
+		if !checked {
+			r, err := c.GetRepo(org, repo)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("Failed to get %s: %v", key, err))
+			} else {
+				ok = keep(key, r)
+			}
+			decided[key] = ok
+		}
+		if ok {
+			kept = append(kept, i)
+		}
+	}
+	return kept, problems
+}
+
+// filterAuthorAge drops issues whose author's account is younger than
+// minAge or, when maxAge is set, older than it, looking up each author only
+// once. Issues whose author cannot be looked up are dropped as well, and the
+// failures are returned for the caller to log.
+func filterAuthorAge(ctx context.Context, c Client, issues []github.Issue, minAge, maxAge time.Duration, now time.Time, logger *log.Logger) ([]github.Issue, []string) {
+	var problems []string
+	created := map[string]time.Time{}
+	failed := map[string]bool{}
+	var kept []github.Issue
+	for _, i := range issues {
+		ref, _, err := issueRef(i)
+		if err != nil {
+			kept = append(kept, i)
+			continue
+		}
+		login := github.NormLogin(i.User.Login)
+		if failed[login] {
+			continue
+		}
+		t, ok := created[login]
+		if !ok {
+			if t, err = userCreated(ctx, c, ref.Org, i.User.Login); err != nil {
+				problems = append(problems, fmt.Sprintf("Failed to get the account of %s: %v", i.User.Login, err))
+				failed[login] = true
+				continue
+			}
+			created[login] = t
+		}
+		switch age := now.Sub(t); {
+		case age < minAge:
+			logger.Printf("Skipping %s: author %s signed up %s ago, less than %s", i.HTMLURL, i.User.Login, age.Round(time.Hour), minAge)
+		case maxAge > 0 && age > maxAge:
+			logger.Printf("Skipping %s: author %s signed up %s ago, more than %s", i.HTMLURL, i.User.Login, age.Round(time.Hour), maxAge)
+		default:
+			kept = append(kept, i)
+		}
+	}
+	return kept, problems
+}
+
+// problemList collects per-issue failures from concurrent workers.
+type problemList struct {
+	sync.Mutex
+	logger *log.Logger
+	msgs   []string
+}
+
+// add logs the formatted message and records it as a problem.
+func (p *problemList) add(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	p.logger.Print(msg)
+	p.Lock()
+	defer p.Unlock()
+	p.msgs = append(p.msgs, msg)
+}
+
+// addAll logs and records each of msgs as a problem.
+func (p *problemList) addAll(msgs ...string) {
+	for _, msg := range msgs {
+		p.logger.Print(msg)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.msgs = append(p.msgs, msgs...)
+}
+
+// sorted returns the recorded problems in a deterministic order.
+func (p *problemList) sorted() []string {
+	p.Lock()
+	defer p.Unlock()
+	out := append([]string(nil), p.msgs...)
+	sort.Strings(out)
+	return out
+}
+
+// Outcome is what processIssue did with an issue.
+type Outcome int
+
+const (
+	// OutcomeSkipped issues were filtered out and do not count toward the ceiling.
+	OutcomeSkipped Outcome = iota
+	// OutcomeDuplicate issues already had the comment.
+	OutcomeDuplicate
+	OutcomeCommented
+	OutcomeFailed
+	// OutcomeInvalid issues could not be processed at all and, like skipped
+	// ones, do not count toward the ceiling.
+	OutcomeInvalid
+	// OutcomeStopped issues were skipped by quitting --confirm-each, which
+	// stops the run.
+	OutcomeStopped
+	// outcomeRetrying issues failed to be commented on and are queued to be
+	// retried once every issue has been processed, when their final outcome
+	// is counted.
+	outcomeRetrying
+)
+
+var outcomeNames = map[Outcome]string{
+	OutcomeSkipped:   "skipped",
+	OutcomeDuplicate: "duplicate",
+	OutcomeCommented: "commented",
+	OutcomeFailed:    "failed",
+	OutcomeInvalid:   "invalid",
+	OutcomeStopped:   "stopped",
+}
+
+// String returns the lowercase name of the outcome.
+func (o Outcome) String() string {
+	if name, ok := outcomeNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("Outcome(%d)", int(o))
+}
+
+func (o Outcome) countsTowardCeiling() bool {
+	return o != OutcomeSkipped && o != OutcomeInvalid && o != OutcomeStopped
+}
+
+// Result summarizes a run.
+type Result struct {
+	// Matched is the number of issues found before any filtering.
+	Matched int
+	// Commented, Skipped and Failed count the matched issues by outcome.
+	// Issues left over by the ceiling or sampling are not counted.
+	Commented int
+	Skipped   int
+	Failed    int
+	// CommentedOn are the sorted URLs of the issues commented on.
+	CommentedOn []string
+	// Issues are the outcomes of the issues processed, sorted by URL. Issues
+	// dropped before processing, such as by the repo checks, are only counted.
+	Issues []IssueResult
+	// Problems are the sorted failures, including those not tied to an issue.
+	Problems []string
+	// Repos break the counts down by repo, most commented on first.
+	Repos []RepoResult
+	// API is how much of the GitHub API the run used.
+	API APIUsage
+	// FewMatches is set when the searches matched no issues with
+	// FailOnZeroMatches, or fewer than WarnBelow.
+	FewMatches bool
+}
+
+// LeftOver returns how many of the matched issues were neither processed nor
+// skipped, such as those past the ceiling or left when stopping early.
+func (r Result) LeftOver() int {
+	return r.Matched - r.Commented - r.Skipped - r.Failed
+}
+
+// IssueResult is what Run did with a single issue.
+type IssueResult struct {
+	URL     string
+	Outcome Outcome
+	// Variant is the comment variant rendered for the issue, counted from 1,
+	// or 0 if the commenter has no variants.
+	Variant int
+}
+
+func (r *Result) count(out Outcome, url string) {
+	r.Issues = append(r.Issues, IssueResult{URL: url, Outcome: out})
+	switch out {
+	case OutcomeSkipped, OutcomeDuplicate, OutcomeStopped:
+		r.Skipped++
+	case OutcomeCommented:
+		r.Commented++
+		r.CommentedOn = append(r.CommentedOn, url)
+	case OutcomeFailed, OutcomeInvalid:
+		r.Failed++
+	}
+}
+
+// log writes the summary line and the problems.
+func (r Result) log(logger *log.Logger) {
+	logger.Printf("Matched %d issues: commented on %d, skipped %d, failed on %d, %d problems", r.Matched, r.Commented, r.Skipped, r.Failed, len(r.Problems))
+	logger.Printf("The run %s", r.API)
+	if len(r.Repos) > 0 {
+		for _, line := range strings.Split(strings.TrimSuffix(repoTable(r.Repos), "\n"), "\n") {
+			logger.Printf("  %s", line)
+		}
+	}
+	for _, p := range r.Problems {
+		logger.Printf("  %s", p)
+	}
+}
+
+// err returns the problems as an error, if any.
+func (r Result) err() error {
+	if len(r.Problems) > 0 {
+		return fmt.Errorf("encoutered %d failures: %v", len(r.Problems), r.Problems)
+	}
+	return nil
+}
+
+// ceilingBudget hands out up to limit slots to concurrent workers, 0 for infinite.
+// Slots are reserved before an issue is dispatched so that the ceiling holds
+// no matter how many workers are in flight.
+type ceilingBudget struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	limit   int
+	used    int
+	pending int
+}
+
+func newCeilingBudget(limit int) *ceilingBudget {
+	b := &ceilingBudget{limit: limit}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// reserve blocks until a slot is available, returning false once the limit
+// is used up. A nil budget is infinite.
+func (b *ceilingBudget) reserve() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.limit > 0 && b.used+b.pending >= b.limit {
+		if b.used >= b.limit {
+			return false
+		}
+		b.cond.Wait()
+	}
+	b.pending++
+	return true
+}
+
+// release returns a reserved slot, charging it against the limit if used.
+func (b *ceilingBudget) release(used bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending--
+	if used {
+		b.used++
+	}
+	b.cond.Broadcast()
+}
+
+// Run comments on the issues matching o. It only returns an error when it
+// cannot get started, such as when every search fails; failures on
+// individual issues are reported in the result.
+func Run(ctx context.Context, c Client, o Options) (res Result, err error) {
+	if o.Logger == nil {
+		o.Logger = log.Default()
+	}
+	if o.Safeguards.Logger == nil {
+		o.Safeguards.Logger = o.Logger
+	}
+	if o.Clock == nil {
+		o.Clock = clock.RealClock{}
+	}
+	if err := o.RateLimit.preflight(ctx); err != nil {
+		return res, err
+	}
+	counted := &usageClient{Client: c}
+	c = counted
+	start, startOK := o.RateLimit.started()
+	if !startOK {
+		start, startOK = coreLimit(c, o.Logger)
+	}
+	if o.MaxBotComments > 0 || o.Prune != PruneOff || o.Metrics != nil || o.Escalation != nil || o.ReRequestExisting || o.FetchComments > 0 {
+		isBot, err := c.BotUserChecker()
+		if err != nil {
+			return res, fmt.Errorf("failed to get the bot user: %w", err)
+		}
+		o.isBot = isBot
+	}
+	if o.SkipCrossRepoDuplicates {
+		o.titles = &titleIndex{first: map[string]string{}}
+	}
+	if o.Retries > 0 {
+		o.retries = &retryQueue{}
+	}
+	if o.PullRequests.PRStatus != PRStatusAny {
+		o.prStatusCalls = new(int64)
+	}
+	if o.FetchFullIssue {
+		o.fullIssueFetches = new(int64)
+	}
+	o.variants = newVariantLog()
+	problems := &problemList{logger: o.Logger}
+	var issues []github.Issue
+	if o.IssueURLs != nil {
+		issues = fetchIssues(c, o.IssueURLs, problems)
+		o.Logger.Printf("Found %d of %d listed issues", len(issues), len(o.IssueURLs))
+	}
+	// seen maps the issueKey of every issue found to the search that found
+	// it first, so that later searches skip it before it takes up the ceiling.
+	seen := map[string]string{}
+	for _, i := range issues {
+		seen[issueKey(i)] = "--issues-file"
+	}
+	failedSearches := 0
+	for _, s := range o.Searches {
+		found, err := search(c, s, o.Sort, o.Asc, o.Logger)
+		if err != nil {
+			if failedSearches++; failedSearches == len(o.Searches) {
+				return res, fmt.Errorf("search failed: %w", err)
+			}
+			problems.add("%sSearch failed: %v", s.logPrefix(), err)
+			continue
+		}
+		o.Logger.Printf("%sFound %d matches", s.logPrefix(), len(found))
+		// Search pagination is not stable, so an issue updated while paging
+		// can come back on two pages.
+		returned := map[string]bool{}
+		for _, i := range found {
+			key := issueKey(i)
+			if returned[key] {
+				o.Logger.Printf("%sSkipping %s: returned again by the search", s.logPrefix(), i.HTMLURL)
+				continue
+			}
+			returned[key] = true
+			if first, ok := seen[key]; ok {
+				o.Logger.Printf("%sSkipping %s: already matched by %s", s.logPrefix(), i.HTMLURL, first)
+				continue
+			}
+			seen[key] = s.String()
+			issues = append(issues, i)
+		}
+	}
+	if len(o.Searches) > 1 {
+		sortIssues(issues, o.Sort, o.Asc)
+		o.Logger.Printf("Found %d matches in %d searches", len(issues), len(o.Searches))
+	}
+	res.Matched = len(issues)
+	for n := range issues {
+		markPullRequest(&issues[n])
+	}
+	matched := issues
+	// leftOver are the issues that sampling and the ceiling kept from being
+	// processed, once known.
+	var leftOver []github.Issue
+	defer func() {
+		res.API = counted.usage(start, startOK, o.Logger)
+		o.Metrics.setAPI(res.API)
+		o.Metrics.setMatches(res.Matched, res.FewMatches)
+		res.Repos = repoBreakdown(matched, leftOver, res.Issues)
+		res.Problems = problems.sorted()
+		sort.Strings(res.CommentedOn)
+		for n := range res.Issues {
+			res.Issues[n].Variant = o.variants.of(res.Issues[n].URL)
+		}
+		sort.Slice(res.Issues, func(i, j int) bool { return res.Issues[i].URL < res.Issues[j].URL })
+		res.log(o.Logger)
+	}()
+	if len(o.Searches) > 0 {
+		var err error
+		if res.FewMatches, err = checkMatches(o, res.Matched); err != nil {
+			return res, err
+		}
+	}
+	if o.Kind != AnyKind {
+		var kept []github.Issue
+		for _, i := range issues {
+			if !o.Kind.matches(i) {
+				o.Logger.Printf("Skipping %s: not of the kind %s", i.HTMLURL, o.Kind)
+				continue
+			}
+			kept = append(kept, i)
+		}
+		res.Skipped += len(issues) - len(kept)
+		issues = kept
+	}
+	if o.Repos != nil {
+		var kept []github.Issue
+		for _, i := range issues {
+			ref, _, err := issueRef(i)
+			if err != nil {
+				// Kept so that processIssue reports it.
+				kept = append(kept, i)
+				continue
+			}
+			if reason := o.Repos.skip(ref.Org, ref.Repo); reason != "" {
+				o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+				continue
+			}
+			kept = append(kept, i)
+		}
+		res.Skipped += len(issues) - len(kept)
+		issues = kept
+	}
+	if o.SpamUserList != "" || o.SpamDomain != "" {
+		spammers := map[string]bool{}
+		if o.SpamUserList != "" {
+			logins, err := ReadLines(o.SpamUserList)
+			if err != nil {
+				return res, fmt.Errorf("failed to read --spam-user-list: %w", err)
+			}
+			for _, l := range logins {
+				spammers[github.NormLogin(l)] = true
+			}
+		}
+		var legit []github.Issue
+		for _, i := range issues {
+			if reason := spamReason(i.User, spammers, o.SpamDomain); reason != "" {
+				o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+				continue
+			}
+			legit = append(legit, i)
+		}
+		res.Skipped += len(issues) - len(legit)
+		issues = legit
+	}
+	if o.RequireWriteAccess || o.MinRepo != (RepoThresholds{}) {
+		var failed []string
+		before := len(issues)
+		issues, failed = filterRepos(c, issues, func(key string, r github.FullRepo) bool {
+			if o.RequireWriteAccess && !r.Permissions.Push && !r.Permissions.Maintain && !r.Permissions.Admin {
+				o.Logger.Printf("Skipping issues in %s: no push access", key)
+				return false
+			}
+			if reason := o.MinRepo.shortfall(r); reason != "" {
+				o.Logger.Printf("Skipping issues in %s: %s", key, reason)
+				return false
+			}
+			return true
+		})
+		res.Skipped += before - len(issues)
+		problems.addAll(failed...)
+		o.Logger.Printf("Kept %d matches after checking their repos", len(issues))
+	}
+	if o.MinAuthorAge > 0 || o.MaxAuthorAge > 0 {
+		var failed []string
+		before := len(issues)
+		issues, failed = filterAuthorAge(ctx, c, issues, o.MinAuthorAge, o.MaxAuthorAge, o.Clock.Now(), o.Logger)
+		res.Skipped += before - len(issues)
+		problems.addAll(failed...)
+	}
+	if o.State != nil {
+		var fresh []github.Issue
+		for _, i := range issues {
+			if o.State.has(i.HTMLURL) {
+				o.Logger.Printf("Skipping %s: already commented on according to the state file", i.HTMLURL)
+				continue
+			}
+			fresh = append(fresh, i)
+		}
+		res.Skipped += len(issues) - len(fresh)
+		issues = fresh
+	}
+	if o.MinReactions != (github.Reactions{}) {
+		var popular []github.Issue
+		for _, i := range issues {
+			if reason := missingReactions(i.Reactions, o.MinReactions); reason != "" {
+				o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+				continue
+			}
+			popular = append(popular, i)
+		}
+		res.Skipped += len(issues) - len(popular)
+		issues = popular
+	}
+	if o.TitleRegex != nil {
+		var matched []github.Issue
+		for _, i := range issues {
+			if !o.TitleRegex.MatchString(i.Title) {
+				o.Logger.Printf("Skipping %s: title does not match --title-regex", i.HTMLURL)
+				continue
+			}
+			matched = append(matched, i)
+		}
+		res.Skipped += len(issues) - len(matched)
+		issues = matched
+	}
+	if o.BodyRegex != nil {
+		var matched []github.Issue
+		for _, i := range issues {
+			body := i.Body
+			if o.SkipCodeBlocks {
+				body = stripCode(body)
+			}
+			if !o.BodyRegex.MatchString(body) {
+				o.Logger.Printf("Skipping %s: body does not match --body-regex", i.HTMLURL)
+				continue
+			}
+			matched = append(matched, i)
+		}
+		res.Skipped += len(issues) - len(matched)
+		issues = matched
+	}
+	if o.ClosesIssue != nil {
+		var closing []github.Issue
+		for _, i := range issues {
+			ref, _, err := issueRef(i)
+			if err != nil {
+				// Kept so that processIssue reports it.
+				closing = append(closing, i)
+				continue
+			}
+			if !i.IsPullRequest() || !closesIssue(i.Body, ref, *o.ClosesIssue) {
+				o.Logger.Printf("Skipping %s: does not close %s", i.HTMLURL, o.ClosesIssue)
+				continue
+			}
+			closing = append(closing, i)
+		}
+		res.Skipped += len(issues) - len(closing)
+		issues = closing
+	}
+	if o.Random {
+		shuffle := rand.Shuffle
+		if o.Rand != nil {
+			shuffle = o.Rand.Shuffle
+		}
+		shuffle(len(issues), func(i, j int) {
+			issues[i], issues[j] = issues[j], issues[i]
+		})
+
+	}
+	if o.RandomWeighted {
+		r := o.Rand
+		if r == nil {
+			r = rand.New(rand.NewSource(time.Now().UnixNano()))
+		}
+		weightedShuffle(issues, o.Clock.Now(), r)
+	}
+	if n := sampleSize(len(issues), o.SamplePercent); n < len(issues) {
+		leftOver = append(leftOver, issues[n:]...)
+		if n == 0 {
+			o.Logger.Printf("Not commenting on any of %d results with --sample-percent=%v", len(issues), o.SamplePercent)
+			return res, nil
+		}
+		o.Logger.Printf("Sampling %d of %d results with --sample-percent=%v", n, len(issues), o.SamplePercent)
+		issues = issues[:n]
+	}
+	if o.LabelSync {
+		missing := syncLabels(c, issues, o.AddLabels, o.LabelCreate, o.Safeguards.Audit, problems, o.Logger)
+		var labelled []github.Issue
+		for _, i := range issues {
+			if ref, _, err := issueRef(i); err == nil && missing[ref.Org+"/"+ref.Repo] {
+				res.Skipped++
+				continue
+			}
+			labelled = append(labelled, i)
+		}
+		issues = labelled
+	}
+
+	workers := o.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	budget := newCeilingBudget(o.Ceiling)
+	orgBudgets := newOrgBudgets(o.CeilingPerOrg, issues)
+	jobs := make(chan github.Issue)
+	// stopped is closed once an issue is OutcomeStopped.
+	stopped := make(chan struct{})
+	var stop sync.Once
+	// An issue being processed when ctx is done is still finished.
+	issueCtx := context.WithoutCancel(ctx)
+	// unprocessed counts the issues left when ctx is done.
+	unprocessed := 0
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				select {
+				case <-stopped:
+					// Left over like those past the ceiling.
+					budget.release(false)
+					orgBudgets.of(i).release(false)
+					continue
+				case <-ctx.Done():
+					budget.release(false)
+					orgBudgets.of(i).release(false)
+					mu.Lock()
+					unprocessed++
+					mu.Unlock()
+					continue
+				default:
+				}
+				out := processIssue(issueCtx, c, o, i, problems)
+				if out != outcomeRetrying {
+					o.Summary.add(i, out)
+				}
+				if err := o.Metrics.add(c, i, o.isBot, o.Clock.Now()); err != nil {
+					problems.add("Failed to measure %s: %v", i.HTMLURL, err)
+				}
+				if out == OutcomeStopped {
+					stop.Do(func() { close(stopped) })
+				}
+				if out == OutcomeCommented {
+					if err := o.RateLimit.commented(ctx); err != nil {
+						problems.add("Failed to check the rate limit: %v", err)
+					}
+				}
+				if out != outcomeRetrying {
+					mu.Lock()
+					res.count(out, i.HTMLURL)
+					mu.Unlock()
+				}
+				budget.release(out.countsTowardCeiling())
+				orgBudgets.of(i).release(out.countsTowardCeiling())
+				if o.Delay > 0 {
+					select {
+					case <-time.After(o.Delay):
+					case <-ctx.Done():
+					}
+				}
+			}
+		}()
+	}
+feed:
+	for n, i := range issues {
+		orgBudget := orgBudgets.of(i)
+		if !orgBudget.reserve() {
+			orgBudgets.reached(i, o.Logger)
+			continue
+		}
+		if !budget.reserve() {
+			orgBudget.release(false)
+			o.Logger.Printf("Stopping at --ceiling=%d after %d of %d results", o.Ceiling, n, len(issues))
+			break
+		}
+		select {
+		case jobs <- i:
+		case <-stopped:
+			budget.release(false)
+			orgBudget.release(false)
+			o.Logger.Printf("Stopping as asked after %d of %d results", n, len(issues))
+			break feed
+		case <-ctx.Done():
+			budget.release(false)
+			orgBudget.release(false)
+			mu.Lock()
+			unprocessed += len(issues) - n
+			mu.Unlock()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if o.prStatusCalls != nil {
+		o.Logger.Printf("Made %d API calls for --pr-status=%s", atomic.LoadInt64(o.prStatusCalls), o.PullRequests.PRStatus)
+	}
+	if o.fullIssueFetches != nil {
+		o.Logger.Printf("Made %d API calls for --fetch-full-issue", atomic.LoadInt64(o.fullIssueFetches))
+	}
+	// Those processed are told apart by repoBreakdown.
+	leftOver = append(leftOver, issues...)
+	if unprocessed > 0 {
+		problems.add("Stopped with %d of %d issues left unprocessed: %v", unprocessed, len(issues), ctx.Err())
+	}
+	if o.retries != nil {
+		o.retries.retry(ctx, c, o, problems, func(i github.Issue, out Outcome) {
+			o.Summary.add(i, out)
+			res.count(out, i.HTMLURL)
+			if out == OutcomeCommented {
+				if err := o.RateLimit.commented(ctx); err != nil {
+					problems.add("Failed to check the rate limit: %v", err)
+				}
+			}
+		})
+	}
+	if o.Rollup != nil {
+		if err := o.Rollup.post(c, o.Commenter, o.Safeguards, o.Confirm, o.Logger); err != nil {
+			problems.add("Failed to write the roll-up: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// OrgSearch is a search limited to a single org, or unlimited when org is empty.
+type OrgSearch struct {
+	Org string
+	// queries are searched and only issues matching all of them are kept.
+	Queries []string
+}
+
+// logPrefix returns the prefix of log lines about the search.
+func (s OrgSearch) logPrefix() string {
+	if s.Org == "" {
+		return ""
+	}
+	return "[" + s.Org + "] "
+}
+
+// String names the search in logs by its queries.
+func (s OrgSearch) String() string {
+	return strconv.Quote(strings.Join(s.Queries, " "))
+}
+
+// search returns the issues matching every query of s, in the order of the first one.
+func search(c Client, s OrgSearch, sort string, asc bool, logger *log.Logger) ([]github.Issue, error) {
+	var issues []github.Issue
+	for n, query := range s.Queries {
+		logger.Printf("%sSearching: %s", s.logPrefix(), query)
+		found, err := c.FindIssuesWithOrg(s.Org, query, sort, asc)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			issues = found
+			continue
+		}
+		matched := map[string]bool{}
+		for _, i := range found {
+			matched[i.HTMLURL] = true
+		}
+		var kept []github.Issue
+		for _, i := range issues {
+			if matched[i.HTMLURL] {
+				kept = append(kept, i)
+			}
+		}
+		issues = kept
+	}
+	return issues, nil
+}
+
+// ReadLines reads the lines of path, or stdin if path is -, ignoring blank
+// lines and # comments.
+func ReadLines(path string) ([]string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	urls := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	return urls, nil
+}
+
+// issueKey identifies i across searches: its repo, ignoring case, and number,
+// or its URL when they cannot be told.
+func issueKey(i github.Issue) string {
+	ref, _, err := issueRef(i)
+	if err != nil {
+		return i.HTMLURL
+	}
+	return strings.ToLower(ref.Org+"/"+ref.Repo) + "#" + strconv.Itoa(ref.Number)
+}
+
+// fetchIssues gets the issue at each of urls, skipping repeated ones and
+// recording those that fail to parse or fetch as problems.
+func fetchIssues(c Client, urls []string, problems *problemList) []github.Issue {
+	var issues []github.Issue
+	seen := map[IssueRef]bool{}
+	for _, u := range urls {
+		ref, err := ParseHTMLURL(u)
+		if err != nil {
+			problems.add("Failed to parse %s: %v", u, err)
+			continue
+		}
+		// GitHub redirects between the /issues/ and /pull/ URLs of a pull request.
+		key := IssueRef{Org: ref.Org, Repo: ref.Repo, Number: ref.Number}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		i, err := c.GetIssue(ref.Org, ref.Repo, ref.Number)
+		if err != nil {
+			problems.add("Failed to get %s: %v", ref, err)
+			continue
+		}
+		if i.HTMLURL == "" {
+			i.HTMLURL = u
+		}
+		issues = append(issues, *i)
+	}
+	return issues
+}
+
+// sortIssues restores the order of issues combined from several searches
+// when sorting by a field every issue carries.
+func sortIssues(issues []github.Issue, by string, asc bool) {
+	var key func(github.Issue) time.Time
+	switch by {
+	case "updated":
+		key = func(i github.Issue) time.Time { return i.UpdatedAt }
+	case "created":
+		key = func(i github.Issue) time.Time { return i.CreatedAt }
+	default:
+		return
+	}
+	sort.SliceStable(issues, func(a, b int) bool {
+		if asc {
+			return key(issues[a]).Before(key(issues[b]))
+		}
+		return key(issues[a]).After(key(issues[b]))
+	})
+}
+
+// labelVars maps each prefix, without a trailing / or :, to the rest of the
+// names of labels with that prefix. Several matching labels are joined with ", ".
+func labelVars(labels []github.Label, prefixes []string) map[string]string {
+	vars := map[string]string{}
+	for _, prefix := range prefixes {
+		key := strings.TrimRight(prefix, "/:")
+		var values []string
+		for _, l := range labels {
+			if v := strings.TrimPrefix(l.Name, prefix); v != l.Name && v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) > 0 {
+			vars[key] = strings.Join(values, ", ")
+		}
+	}
+	return vars
+}
+
+// inlineCode matches markdown code spans delimited by one or two backticks.
+var inlineCode = regexp.MustCompile("``[^\n]*?``|`[^`\n]*`")
+
+// CompileFilterRegex compiles a --body-regex or --title-regex, ignoring case
+// when caseInsensitive is set as if it started with (?i).
+func CompileFilterRegex(expr string, caseInsensitive bool) (*regexp.Regexp, error) {
+	if caseInsensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// stripCode removes fenced code blocks and inline code from markdown, so that
+// quoted logs and snippets do not match --body-regex.
+func stripCode(body string) string {
+	return inlineCode.ReplaceAllString(stripFences(body), " ")
+}
+
+// stripFences removes fenced code blocks from markdown. An unclosed fence runs
+// to the end.
+func stripFences(body string) string {
+	var kept []string
+	fence := ""
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			for _, r := range trimmed[3:] {
+				if r != rune(fence[0]) {
+					break
+				}
+				fence += fence[:1]
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+var (
+	htmlComment  = regexp.MustCompile(`(?s)<!--.*?-->`)
+	mdLink       = regexp.MustCompile(`!?\[([^\]\n]*)\]\([^)\n]*\)`)
+	mdLinePrefix = regexp.MustCompile(`(?m)^[ \t]*(#{1,6}[ \t]+|>[ \t]?|[-*+][ \t]+|\d+\.[ \t]+)`)
+	mdEmphasis   = regexp.MustCompile("\\*+|~~|__|`+")
+)
+
+// bodyExcerpt returns the first n characters of body as plain text on a
+// single line, without code blocks, template comments or markdown syntax,
+// ending in an ellipsis when cut.
+func bodyExcerpt(body string, n int) string {
+	text := htmlComment.ReplaceAllString(stripFences(body), " ")
+	text = mdLink.ReplaceAllString(text, "$1")
+	text = mdLinePrefix.ReplaceAllString(text, "")
+	text = mdEmphasis.ReplaceAllString(text, "")
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
+// prependExcerpt quotes the excerpt of body above comment, if it has any text.
+func prependExcerpt(comment, body string, n int) string {
+	excerpt := bodyExcerpt(body, n)
+	if excerpt == "" {
+		return comment
+	}
+	return "> " + excerpt + "\n\n" + comment
+}
+
+// spamReason returns why u looks like a spammer, or the empty string if it
+// does not: its login is one of spammers or its email is in domain.
+func spamReason(u github.User, spammers map[string]bool, domain string) string {
+	if spammers[github.NormLogin(u.Login)] {
+		return fmt.Sprintf("%s is on the spam list", u.Login)
+	}
+	if _, d, ok := strings.Cut(strings.ToLower(u.Email), "@"); ok && domain != "" && (d == domain || strings.HasSuffix(d, "."+domain)) {
+		return fmt.Sprintf("email of %s is in the spam domain %s", u.Login, domain)
+	}
+	return ""
+}
+
+// missingReactions returns which of the thumbs up, heart and rocket minimums
+// the reactions fall short of, or the empty string when they meet all of them.
+func missingReactions(r, minimum github.Reactions) string {
+	var missing []string
+	if r.PlusOne < minimum.PlusOne {
+		missing = append(missing, fmt.Sprintf("%d of %d thumbs up", r.PlusOne, minimum.PlusOne))
+	}
+	if r.Heart < minimum.Heart {
+		missing = append(missing, fmt.Sprintf("%d of %d hearts", r.Heart, minimum.Heart))
+	}
+	if r.Rocket < minimum.Rocket {
+		missing = append(missing, fmt.Sprintf("%d of %d rockets", r.Rocket, minimum.Rocket))
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return "only " + strings.Join(missing, ", ")
+}
+
+// titleIndex remembers the first issue commented on with each normalized title.
+type titleIndex struct {
+	sync.Mutex
+	// first maps normalized titles to issue URLs.
+	first map[string]string
+}
+
+// normalizeTitle lowercases title and strips its punctuation.
+func normalizeTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// claim records the issue at url, in ref, as the first with title unless an
+// issue in another repo already is, in which case it returns that issue's URL
+// and false. Issues in the same repo are never duplicates of each other.
+func (t *titleIndex) claim(title, url string, ref IssueRef) (string, bool) {
+	key := normalizeTitle(title)
+	if key == "" {
+		return "", true
+	}
+	t.Lock()
+	defer t.Unlock()
+	first, ok := t.first[key]
+	if !ok {
+		t.first[key] = url
+		return "", true
+	}
+	if firstRef, err := ParseHTMLURL(first); err == nil && firstRef.Org == ref.Org && firstRef.Repo == ref.Repo {
+		return "", true
+	}
+	return first, false
+}
+
+// release forgets the issue at url as the first with title, if it was.
+func (t *titleIndex) release(title, url string) {
+	key := normalizeTitle(title)
+	t.Lock()
+	defer t.Unlock()
+	if t.first[key] == url {
+		delete(t.first, key)
+	}
+}
+
+// countComments returns how many comments are by authors matching by.
+func countComments(comments []github.IssueComment, by func(login string) bool) int {
+	n := 0
+	for _, comment := range comments {
+		if by(comment.User.Login) {
+			n++
+		}
+	}
+	return n
+}
+
+// issueHistory lists the comments and events of an issue at most once.
+type issueHistory struct {
+	c        Client
+	ref      IssueRef
+	comments []github.IssueComment
+	events   []github.ListedIssueEvent
+	// listed records which of the two have been fetched.
+	listedComments, listedEvents bool
+}
+
+func (h *issueHistory) listComments() ([]github.IssueComment, error) {
+	if !h.listedComments {
+		comments, err := h.c.ListIssueComments(h.ref.Org, h.ref.Repo, h.ref.Number)
+		if err != nil {
+			return nil, err
+		}
+		h.comments, h.listedComments = comments, true
+	}
+	return h.comments, nil
+}
+
+func (h *issueHistory) listEvents() ([]github.ListedIssueEvent, error) {
+	if !h.listedEvents {
+		events, err := h.c.ListIssueEvents(h.ref.Org, h.ref.Repo, h.ref.Number)
+		if err != nil {
+			return nil, err
+		}
+		h.events, h.listedEvents = events, true
+	}
+	return h.events, nil
+}
+
+// QuietWindows are how long an issue must have gone without each kind of
+// activity, unset to allow it at any time.
+type QuietWindows struct {
+	Comment    time.Duration
+	Label      time.Duration
+	Assignment time.Duration
+}
+
+// recentActivity returns the activity on the issue that happened within the
+// windows, or the empty string if there was none.
+func recentActivity(h *issueHistory, w QuietWindows, now time.Time) (string, error) {
+	if w.Comment > 0 {
+		comments, err := h.listComments()
+		if err != nil {
+			return "", fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, c := range comments {
+			if age := now.Sub(c.CreatedAt); age < w.Comment {
+				return fmt.Sprintf("%s commented %s ago, within %s", c.User.Login, age.Round(time.Minute), w.Comment), nil
+			}
+		}
+	}
+	if w.Label == 0 && w.Assignment == 0 {
+		return "", nil
+	}
+	events, err := h.listEvents()
+	if err != nil {
+		return "", fmt.Errorf("failed to list events: %w", err)
+	}
+	for _, e := range events {
+		age := now.Sub(e.CreatedAt)
+		switch e.Event {
+		case github.IssueActionLabeled, github.IssueActionUnlabeled:
+			if age < w.Label {
+				return fmt.Sprintf("label %s was %s %s ago, within %s", e.Label.Name, e.Event, age.Round(time.Minute), w.Label), nil
+			}
+		case github.IssueActionAssigned, github.IssueActionUnassigned:
+			if age < w.Assignment {
+				return fmt.Sprintf("%s was %s %s ago, within %s", e.Assignee.Login, e.Event, age.Round(time.Minute), w.Assignment), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// awaitingAuthorResponse returns why the issue is not waiting on its author,
+// or the empty string when the latest comment is from someone else and has
+// gone unanswered for at least since.
+func awaitingAuthorResponse(i github.Issue, comments []github.IssueComment, since time.Duration, now time.Time) string {
+	var latest *github.IssueComment
+	for n := range comments {
+		if latest == nil || !comments[n].CreatedAt.Before(latest.CreatedAt) {
+			latest = &comments[n]
+		}
+	}
+	switch {
+	case latest == nil:
+		return "no comments"
+	case i.IsAuthor(latest.User.Login):
+		return "latest comment is from the author"
+	case now.Sub(latest.CreatedAt) < since:
+		return fmt.Sprintf("latest comment from %s is newer than %s", latest.User.Login, since)
+	}
+	return ""
+}
+
+// processIssue comments on a single issue, recording any failure in problems.
+// It returns what it did with the issue.
+func processIssue(ctx context.Context, c Client, o Options, i github.Issue, problems *problemList) Outcome {
+	o.Logger.Printf("Matched %s %s (%s)", kind(i), i.HTMLURL, i.Title)
+	ref, fromURL, err := issueRef(i)
+	if err != nil {
+		problems.add("Failed to parse %s: %v", i.HTMLURL, err)
+		return OutcomeInvalid
+	}
+	if fromURL {
+		o.Logger.Printf("Identified %s as %s by its URL: no repository in the search result", i.HTMLURL, ref)
+	}
+	org, repo, number := ref.Org, ref.Repo, ref.Number
+	m := Meta{Number: number, Org: org, Repo: repo, Issue: i, IsPR: i.IsPullRequest(), LabelVars: labelVars(i.Labels, o.LabelPrefixes)}
+	m.setAges(o.Clock.Now(), o.MinInactivity)
+	if o.IgnoreMarker != "" {
+		if i.Body == "" {
+			// Search results carry the whole body, so only fetch a missing one.
+			fresh, err := c.GetIssue(org, repo, number)
+			if err != nil {
+				problems.add("Failed to get the body of %s/%s#%d: %v", org, repo, number, err)
+				return OutcomeFailed
+			}
+			i.Body = fresh.Body
+			m.Issue.Body = fresh.Body
+		}
+		if strings.Contains(i.Body, o.IgnoreMarker) {
+			o.Logger.Printf("Skipping %s: body opts out with %s", i.HTMLURL, o.IgnoreMarker)
+			return OutcomeSkipped
+		}
+	}
+	if o.Milestoned != nil {
+		milestone := i.Milestone
+		if milestone.Title == "" {
+			// Search results may leave out the milestone, so make sure.
+			fresh, err := c.GetIssue(org, repo, number)
+			if err != nil {
+				problems.add("Failed to get the milestone of %s/%s#%d: %v", org, repo, number, err)
+				return OutcomeFailed
+			}
+			milestone = fresh.Milestone
+		}
+		switch {
+		case *o.Milestoned && milestone.Title == "":
+			o.Logger.Printf("Skipping %s: not in a milestone", i.HTMLURL)
+			return OutcomeSkipped
+		case !*o.Milestoned && milestone.Title != "":
+			o.Logger.Printf("Skipping %s: in the milestone %s", i.HTMLURL, milestone.Title)
+			return OutcomeSkipped
+		}
+	}
+	if filters, prOnly := prFilters(o); len(filters) > 0 {
+		if len(prOnly) > 0 && !m.IsPR {
+			o.Logger.Printf("Warning: skipping %s: not a pull request, as required by %s", i.HTMLURL, strings.Join(prOnly, ", "))
+			return OutcomeSkipped
+		}
+		for _, f := range filters {
+			reason, err := f(ctx, c, o, &m)
+			if err != nil {
+				problems.add("Failed to %v", err)
+				return OutcomeFailed
+			}
+			if reason != "" {
+				o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+				return OutcomeSkipped
+			}
+		}
+	}
+	if o.ProjectColumn != "" {
+		in, err := inProjectColumn(ctx, c, ref, o.ProjectColumn)
+		if err != nil {
+			problems.add("Failed to get the project cards of %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if !in {
+			o.Logger.Printf("Skipping %s: not in a %s project column", i.HTMLURL, o.ProjectColumn)
+			return OutcomeSkipped
+		}
+	}
+	history := &issueHistory{c: c, ref: ref}
+	if o.Quiet != (QuietWindows{}) {
+		reason, err := recentActivity(history, o.Quiet, o.Clock.Now())
+		if err != nil {
+			problems.add("Failed to check the activity on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if reason != "" {
+			o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+			return OutcomeSkipped
+		}
+	}
+	if o.AwaitingAuthorSince > 0 {
+		comments, err := history.listComments()
+		if err != nil {
+			problems.add("Failed to list comments on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if reason := awaitingAuthorResponse(i, comments, o.AwaitingAuthorSince, o.Clock.Now()); reason != "" {
+			o.Logger.Printf("Skipping %s: %s", i.HTMLURL, reason)
+			return OutcomeSkipped
+		}
+	}
+	if o.MaxBotComments > 0 {
+		comments, err := history.listComments()
+		if err != nil {
+			problems.add("Failed to list comments on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if n := countComments(comments, o.isBot); n >= o.MaxBotComments {
+			o.Logger.Printf("Skipping %s: already has %d comments from the bot", i.HTMLURL, n)
+			return OutcomeSkipped
+		}
+	}
+	if o.Escalation != nil {
+		comments, err := history.listComments()
+		if err != nil {
+			problems.add("Failed to list comments on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		stage, warned := stageOf(comments, o.Safeguards.Marker, o.isBot, o.Escalation.After, o.Clock.Now())
+		switch stage {
+		case stageWarn:
+			// The search may reach back only as far as Escalation.After.
+			if updated := i.UpdatedAt; o.MinInactivity > 0 && o.Clock.Since(updated) < o.MinInactivity {
+				o.Logger.Printf("Skipping %s: updated at %s, not inactive for %s yet", i.HTMLURL, updated.Format(time.RFC3339), o.MinInactivity)
+				return OutcomeSkipped
+			}
+			o.Logger.Printf("Warning %s: no earlier warning", i.HTMLURL)
+		case stageWaiting:
+			o.Logger.Printf("Skipping %s: warned at %s, escalating after %s", i.HTMLURL, warned.Format(time.RFC3339), o.Escalation.After)
+			return OutcomeSkipped
+		case stageEscalated:
+			o.Logger.Printf("Skipping %s: already escalated", i.HTMLURL)
+			return OutcomeSkipped
+		case stageEscalate:
+			o.Logger.Printf("Escalating %s: warned at %s", i.HTMLURL, warned.Format(time.RFC3339))
+			// The rest of processIssue applies to the escalation instead.
+			o.Commenter = o.Escalation.Commenter
+			o.Safeguards.Marker = escalationMarker(o.Safeguards.Marker)
+			o.AddLabels = append(append([]string(nil), o.AddLabels...), o.Escalation.AddLabels...)
+			o.Close = o.Close || o.Escalation.Close
+		}
+	}
+	if o.SkipWithLinkedPR && !i.IsPullRequest() {
+		url, err := openLinkedPR(ctx, c, ref)
+		if err != nil {
+			problems.add("Failed to look for pull requests linked to %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if url != "" {
+			o.Logger.Printf("Skipping %s: linked to the open pull request %s", i.HTMLURL, url)
+			return OutcomeSkipped
+		}
+	}
+	if o.FetchPRDetails && m.IsPR {
+		if err := loadPR(c, &m); err != nil {
+			problems.add("Failed to get pull request %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+	}
+	if o.FetchComments > 0 {
+		comments, err := history.listComments()
+		if err != nil {
+			problems.add("Failed to list comments on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		m.LastComments = lastComments(comments, o.FetchComments, o.isBot)
+	}
+	if o.FetchFullIssue {
+		atomic.AddInt64(o.fullIssueFetches, 1)
+		fresh, err := c.GetIssue(org, repo, number)
+		if err != nil {
+			// Rather than comment with what may be stale.
+			problems.add("Failed to get %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		m.Issue = *fresh
+		m.LabelVars = labelVars(fresh.Labels, o.LabelPrefixes)
+		m.setAges(m.Now, o.MinInactivity)
+	}
+	if o.Rollup != nil {
+		o.Rollup.add(m)
+		o.Logger.Printf("Listing %s in the roll-up", i.HTMLURL)
+		return OutcomeCommented
+	}
+	var comment string
+	if o.Commenter != nil {
+		comment, err = o.Commenter(m)
+		if err != nil {
+			problems.add("Failed to create comment for %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if n := commentVariant(comment); n > 0 {
+			o.Logger.Printf("Using comment variant %d for %s", n, i.HTMLURL)
+			o.variants.add(i.HTMLURL, n)
+		}
+	}
+	labels := o.AddLabels
+	if o.TemplateLabels {
+		labels, err = renderLabels(labels, m)
+		if err != nil {
+			problems.add("Failed to render labels for %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+	}
+	if o.ExcerptLength > 0 {
+		comment = prependExcerpt(comment, i.Body, o.ExcerptLength)
+	}
+	if o.MaxLinkedPRs > 0 {
+		urls, err := linkedPRs(ctx, c, IssueRef{Org: org, Repo: repo, Number: number}, o.MaxLinkedPRs)
+		if err != nil {
+			problems.add("Failed to list pull requests linked to %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		comment = appendLinkedPRs(comment, urls)
+	}
+	if o.Prompt != nil {
+		a, err := o.Prompt.Ask(i, comment)
+		if err != nil {
+			problems.add("Failed to confirm the comment for %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		switch a {
+		case AnswerYes:
+		case AnswerQuit:
+			o.Logger.Printf("Skipping %s: stopping the run", i.HTMLURL)
+			return OutcomeStopped
+		default:
+			o.Logger.Printf("Skipping %s: not confirmed", i.HTMLURL)
+			return OutcomeSkipped
+		}
+	}
+	if o.OverflowToGist && len(o.Safeguards.decorate(comment)) > o.Safeguards.limit() {
+		short, err := overflowToGist(c, IssueRef{Org: org, Repo: repo, Number: number}, comment, o.Safeguards)
+		if err != nil {
+			problems.add("Failed to shorten comment for %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		o.Logger.Printf("Moved the %d byte comment for %s into a gist", len(comment), i.HTMLURL)
+		comment = short
+	}
+	if !o.RecheckCutoff.IsZero() {
+		fresh, err := c.GetIssue(org, repo, number)
+		if err != nil {
+			problems.add("Failed to recheck %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+		if fresh.UpdatedAt.After(o.RecheckCutoff) {
+			o.Logger.Printf("Skipping %s: updated at %s, after the cutoff %s", i.HTMLURL, fresh.UpdatedAt.Format(time.RFC3339), o.RecheckCutoff.Format(time.RFC3339))
+			return OutcomeSkipped
+		}
+	}
+	if o.titles != nil {
+		first, claimed := o.titles.claim(i.Title, i.HTMLURL, ref)
+		if !claimed {
+			o.Logger.Printf("Skipping %s: duplicate of %s", i.HTMLURL, first)
+			return OutcomeSkipped
+		}
+	}
+	target := ref
+	if o.Redirect != nil {
+		target = *o.Redirect
+		comment = redirected(comment, i.HTMLURL)
+	}
+	if o.Prune != PruneOff && o.Redirect == nil {
+		_, err := prunePrevious(ctx, c, ref, pruneOptions{
+			mode:       o.Prune,
+			classifier: o.Classifier,
+			max:        o.PruneMax,
+			marker:     o.Safeguards.Marker,
+			isBot:      o.isBot,
+			confirm:    o.Confirm,
+			audit:      o.Safeguards.Audit,
+			logger:     o.Logger,
+		})
+		if err != nil {
+			problems.add("Failed to prune previous comments on %s/%s#%d: %v", org, repo, number, err)
+			return OutcomeFailed
+		}
+	}
+	o.Summary.rendered(i.HTMLURL, comment)
+	p := pendingComment{issue: i, meta: m, ref: ref, target: target, comment: comment, labels: labels}
+	out, err := deliver(ctx, c, o, p, problems)
+	switch {
+	case err == nil:
+		return out
+	case o.retries == nil:
+		if o.titles != nil {
+			o.titles.release(i.Title, i.HTMLURL)
+		}
+		problems.add("Failed to apply comment to %s/%s#%d: %v", org, repo, number, err)
+		return OutcomeFailed
+	case retryable(err):
+		o.Logger.Printf("Will retry commenting on %s: %v", i.HTMLURL, err)
+		p.err = err
+		o.retries.add(p)
+		return outcomeRetrying
+	}
+	p.err = err
+	giveUp(o, p, "(not retryable)", problems)
+	return OutcomeFailed
+}
+
+// describeActions lists what deliver does after commenting, for runs
+// without a comment.
+func describeActions(o Options, labels []string) string {
+	var actions []string
+	if len(labels) > 0 {
+		actions = append(actions, "add labels "+strings.Join(labels, ", "))
+	}
+	if o.Close {
+		actions = append(actions, "close")
+	}
+	if o.IssueType != "" {
+		actions = append(actions, "set issue type "+o.IssueType)
+	}
+	if len(o.RequestReviewers) > 0 || o.ReRequestExisting {
+		actions = append(actions, "request reviews")
+	}
+	for _, t := range o.TransitionLabels {
+		actions = append(actions, "move label "+t.From+" to "+t.To)
+	}
+	if len(actions) == 0 {
+		return "nothing"
+	}
+	return strings.Join(actions, ", then ")
+}
+
+// deliver posts the comment of p and, once it is created, applies the labels,
+// closing and the rest that follow a comment. It only returns an error when
+// posting fails, leaving the title claimed for a retry.
+func deliver(ctx context.Context, c Client, o Options, p pendingComment, problems *problemList) (Outcome, error) {
+	i, m, ref, target, comment := p.issue, p.meta, p.ref, p.target, p.comment
+	org, repo, number := ref.Org, ref.Repo, ref.Number
+	var res PostResult
+	if o.Commenter == nil {
+		// There is no comment to post, only the actions that follow one.
+		if o.Confirm {
+			o.Logger.Printf("Applying to %s without a comment: %s", i.HTMLURL, describeActions(o, p.labels))
+		} else {
+			o.Logger.Printf("Would apply to %s without a comment: %s", i.HTMLURL, describeActions(o, p.labels))
+		}
+		res.Commented = true
+	} else {
+		var err error
+		if res, err = PostComment(ctx, c, target, comment, o.Safeguards); err != nil {
+			return OutcomeFailed, err
+		}
+	}
+	if o.titles != nil && !res.Commented {
+		o.titles.release(i.Title, i.HTMLURL)
+	}
+	if res.Commented && o.Redirect != nil {
+		o.Logger.Printf("Commented on %s for %s", target, i.HTMLURL)
+		return OutcomeCommented, nil
+	}
+	if res.Commented {
+		if o.Commenter != nil {
+			o.Logger.Printf("Commented on %s", i.HTMLURL)
+		}
+		if o.State != nil {
+			o.State.add(i.HTMLURL)
+		}
+		if o.Schedule != nil {
+			o.Schedule.add(i.HTMLURL, o.Clock.Now())
+		}
+		if len(p.labels) > 0 {
+			err := c.AddLabels(org, repo, number, p.labels...)
+			o.Safeguards.Audit.record(auditAddLabels, ref, "", strings.Join(p.labels, ","), err)
+			if err != nil {
+				problems.add("Failed to add labels to %s/%s#%d: %v", org, repo, number, err)
+			}
+		}
+		for _, t := range o.TransitionLabels {
+			switch {
+			case !hasLabel(i, t.From):
+				o.Logger.Printf("Not moving %s to label %s: it lacks %s", i.HTMLURL, t.To, t.From)
+			case !o.Confirm:
+				o.Logger.Printf("Would move %s from label %s to %s", i.HTMLURL, t.From, t.To)
+			default:
+				if err := transitionLabel(c, ref, t, o.Safeguards.Audit); err != nil {
+					problems.add("Failed to move %s/%s#%d from label %s to %s: %v", org, repo, number, t.From, t.To, err)
+				} else {
+					o.Logger.Printf("Moved %s from label %s to %s", i.HTMLURL, t.From, t.To)
+				}
+			}
+		}
+		if o.Close {
+			err := c.CloseIssue(org, repo, number)
+			o.Safeguards.Audit.record(auditClose, ref, "", "", err)
+			if err != nil {
+				problems.add("Failed to close %s/%s#%d: %v", org, repo, number, err)
+			} else {
+				o.Logger.Printf("Closed %s", i.HTMLURL)
+			}
+		}
+		if o.IssueType != "" {
+			if !o.Confirm {
+				o.Logger.Printf("Would set issue type of %s to %s", i.HTMLURL, o.IssueType)
+				o.Safeguards.Audit.record(auditIssueType, ref, "", o.IssueType, nil)
+			} else if err := setIssueType(ctx, c, org, repo, number, o.IssueType); err != nil {
+				o.Safeguards.Audit.record(auditIssueType, ref, "", o.IssueType, err)
+				problems.add("Failed to set issue type of %s/%s#%d: %v", org, repo, number, err)
+			} else {
+				o.Safeguards.Audit.record(auditIssueType, ref, "", o.IssueType, nil)
+				o.Logger.Printf("Set issue type of %s to %s", i.HTMLURL, o.IssueType)
+			}
+		}
+		if len(o.RequestReviewers) > 0 || o.ReRequestExisting {
+			if !m.IsPR {
+				o.Logger.Printf("Warning: not requesting reviews on %s: not a pull request", i.HTMLURL)
+			} else if err := requestReviews(c, o, &m, i.HTMLURL); err != nil {
+				problems.add("Failed to request reviews on %s/%s#%d: %v", org, repo, number, err)
+			}
+		}
+		if o.Email != nil {
+			if err := emailAuthor(ctx, c, o.Email, m, comment, o.Logger); err != nil {
+				problems.add("Failed to email the author of %s/%s#%d: %v", org, repo, number, err)
+			}
+		}
+		return OutcomeCommented, nil
+	}
+	return OutcomeDuplicate, nil
+}
@@ -0,0 +1,3895 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	githubql "github.com/shurcooL/githubv4"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestParseHTMLURL(t *testing.T) {
+	cases := []struct {
+		name string
+		url  string
+		org  string
+		repo string
+		num  int
+		isPR bool
+		fail bool
+	}{
+		{
+			name: "normal issue",
+			url:  "https://github.com/org/repo/issues/1234",
+			org:  "org",
+			repo: "repo",
+			num:  1234,
+		},
+		{
+			name: "normal pull",
+			url:  "https://github.com/pull-org/pull-repo/pull/5555",
+			org:  "pull-org",
+			repo: "pull-repo",
+			num:  5555,
+			isPR: true,
+		},
+		{
+			name: "different host",
+			url:  "ftp://gitlab.whatever/org/repo/issues/6666",
+			org:  "org",
+			repo: "repo",
+			num:  6666,
+		},
+		{
+			name: "enterprise host",
+			url:  "https://git.corp.example.com/org/repo/issues/7",
+			org:  "org",
+			repo: "repo",
+			num:  7,
+		},
+		{
+			name: "enterprise host with path prefix",
+			url:  "https://git.corp.example.com/github/org/repo/issues/7",
+			org:  "org",
+			repo: "repo",
+			num:  7,
+		},
+		{
+			name: "enterprise host with deep path prefix",
+			url:  "https://git.corp.example.com/a/b/c/org/repo/pull/8",
+			org:  "org",
+			repo: "repo",
+			num:  8,
+			isPR: true,
+		},
+		{
+			name: "trailing slash",
+			url:  "https://github.com/org/repo/issues/9/",
+			org:  "org",
+			repo: "repo",
+			num:  9,
+		},
+		{
+			name: "enterprise host with path prefix and trailing slash",
+			url:  "https://git.corp.example.com/github/org/repo/pull/10/",
+			org:  "org",
+			repo: "repo",
+			num:  10,
+			isPR: true,
+		},
+		{
+			name: "repo named issues",
+			url:  "https://github.com/org/issues/issues/11",
+			org:  "org",
+			repo: "issues",
+			num:  11,
+		},
+		{
+			name: "query string",
+			url:  "https://github.com/org/repo/issues/12?foo=bar",
+			org:  "org",
+			repo: "repo",
+			num:  12,
+		},
+		{
+			name: "comment fragment",
+			url:  "https://github.com/org/repo/issues/13#issuecomment-123",
+			org:  "org",
+			repo: "repo",
+			num:  13,
+		},
+		{
+			name: "pull request with trailing slash, query string and fragment",
+			url:  "https://github.com/org/repo/pull/14/?w=1#discussion_r5",
+			org:  "org",
+			repo: "repo",
+			num:  14,
+			isPR: true,
+		},
+		{
+			name: "uppercase org",
+			url:  "https://github.com/Kubernetes-SIGs/repo/issues/15",
+			org:  "Kubernetes-SIGs",
+			repo: "repo",
+			num:  15,
+		},
+		{
+			name: "repo with dots and dashes",
+			url:  "https://github.com/org/my.repo-name.go/pull/16",
+			org:  "org",
+			repo: "my.repo-name.go",
+			num:  16,
+			isPR: true,
+		},
+		{
+			name: "repo named like a dotfile",
+			url:  "https://github.com/org/.github/issues/17",
+			org:  "org",
+			repo: ".github",
+			num:  17,
+		},
+		{
+			name: "without a scheme",
+			url:  "github.com/org/repo/issues/18",
+			org:  "org",
+			repo: "repo",
+			num:  18,
+		},
+		{
+			name: "gitlab issue with a fragment",
+			url:  "https://gitlab.example.com/group/project/-/issues/19#note_1",
+			org:  "group",
+			repo: "project",
+			num:  19,
+		},
+		{
+			name: "empty",
+			url:  "",
+			fail: true,
+		},
+		{
+			name: "host only",
+			url:  "https://github.com",
+			fail: true,
+		},
+		{
+			name: "bad escape",
+			url:  "https://github.com/org/repo%zz/issues/20",
+			fail: true,
+		},
+		{
+			name: "negative number",
+			url:  "https://github.com/org/repo/issues/-20",
+			fail: true,
+		},
+		{
+			name: "number too large",
+			url:  "https://github.com/org/repo/issues/99999999999999999999",
+			fail: true,
+		},
+		{
+			name: "number only in the query string",
+			url:  "https://github.com/org/repo/issues?id=21",
+			fail: true,
+		},
+		{
+			name: "number only in the fragment",
+			url:  "https://github.com/org/repo/issues/#21",
+			fail: true,
+		},
+		{
+			name: "commits of a pull request",
+			url:  "https://github.com/org/repo/pull/22/commits",
+			fail: true,
+		},
+		{
+			name: "missing org",
+			url:  "https://github.com//repo/issues/23",
+			fail: true,
+		},
+		{
+			name: "string issue",
+			url:  "https://github.com/org/repo/issues/future",
+			fail: true,
+		},
+		{
+			name: "weird issue",
+			url:  "https://gubernator.k8s.io/build/kubernetes-jenkins/logs/ci-kubernetes-e2e-gci-gce/11947/",
+			fail: true,
+		},
+		{
+			name: "host is not the org",
+			url:  "https://github.com/repo/issues/12",
+			fail: true,
+		},
+		{
+			name: "missing number",
+			url:  "https://github.com/org/repo/issues/",
+			fail: true,
+		},
+		{
+			name: "issues is not the second to last segment",
+			url:  "https://github.com/org/repo/issues/12/files",
+			fail: true,
+		},
+	}
+
+	for _, tc := range cases {
+		ref, err := ParseHTMLURL(tc.url)
+		if err != nil && !tc.fail {
+			t.Errorf("%s: should not have produced error: %v", tc.name, err)
+		} else if err == nil && tc.fail {
+			t.Errorf("%s: failed to produce an error", tc.name)
+		} else {
+			if ref.Org != tc.org {
+				t.Errorf("%s: org %s != expected %s", tc.name, ref.Org, tc.org)
+			}
+			if ref.Repo != tc.repo {
+				t.Errorf("%s: repo %s != expected %s", tc.name, ref.Repo, tc.repo)
+			}
+			if ref.Number != tc.num {
+				t.Errorf("%s: num %d != expected %d", tc.name, ref.Number, tc.num)
+			}
+			if ref.IsPR != tc.isPR {
+				t.Errorf("%s: isPR %t != expected %t", tc.name, ref.IsPR, tc.isPR)
+			}
+		}
+	}
+}
+
+func TestMakeQuery(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		archived bool
+		closed   bool
+		locked   bool
+		kind     IssueKind
+		dur      time.Duration
+		maxDur   time.Duration
+		// createdBefore and createdAfter are --created-before and --created-after.
+		createdBefore time.Duration
+		createdAfter  time.Duration
+		// updatedBefore and updatedAfter are --updated-before and --updated-after.
+		updatedBefore time.Time
+		updatedAfter  time.Time
+		expected      []string
+		unexpected    []string
+		err           bool
+	}{
+		{
+			name:       "basic query",
+			query:      "hello world",
+			expected:   []string{"hello world", "is:open", "archived:false"},
+			unexpected: []string{"updated:", "openhello", "worldis"},
+		},
+		{
+			name:       "basic archived",
+			query:      "hello world",
+			archived:   true,
+			expected:   []string{"hello world", "is:open", "is:unlocked"},
+			unexpected: []string{"archived:false"},
+		},
+		{
+			name:       "basic closed",
+			query:      "hello world",
+			closed:     true,
+			expected:   []string{"hello world", "archived:false", "is:unlocked"},
+			unexpected: []string{"is:open"},
+		},
+		{
+			name:       "basic locked",
+			query:      "hello world",
+			locked:     true,
+			expected:   []string{"hello world", "is:open", "archived:false"},
+			unexpected: []string{"is:unlocked"},
+		},
+		{
+			name:     "basic duration",
+			query:    "hello",
+			dur:      1 * time.Hour,
+			expected: []string{"hello", "updated:<"},
+		},
+		{
+			name:       "activity window",
+			query:      "hello",
+			dur:        2 * time.Hour,
+			maxDur:     30 * 24 * time.Hour,
+			expected:   []string{"hello", "updated:", ".."},
+			unexpected: []string{"updated:<"},
+		},
+		{
+			name:       "activity window without a minimum",
+			query:      "hello",
+			maxDur:     time.Hour,
+			expected:   []string{"hello", "updated:>="},
+			unexpected: []string{".."},
+		},
+		{
+			name:   "activity window ending before it starts",
+			query:  "hello",
+			dur:    2 * time.Hour,
+			maxDur: time.Hour,
+			err:    true,
+		},
+		{
+			name:   "activity window of no length",
+			query:  "hello",
+			dur:    time.Hour,
+			maxDur: time.Hour,
+			err:    true,
+		},
+		{
+			name:          "updated before",
+			query:         "hello",
+			updatedBefore: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600)),
+			expected:      []string{"hello", "updated:<=2024-03-01T11:00:00Z"},
+		},
+		{
+			name:         "updated after",
+			query:        "hello",
+			updatedAfter: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			expected:     []string{"hello", "updated:>=2024-03-01T12:00:00Z"},
+		},
+		{
+			name:          "updated between",
+			query:         "hello",
+			updatedBefore: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			updatedAfter:  time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			expected:      []string{"updated:2024-03-01T00:00:00Z..2024-04-01T00:00:00Z"},
+		},
+		{
+			name:          "updated before overrides the duration",
+			query:         "hello",
+			dur:           time.Hour,
+			updatedBefore: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			expected:      []string{"updated:<=2024-03-01T12:00:00Z"},
+		},
+		{
+			name:         "updated after overrides --updated-max",
+			query:        "hello",
+			maxDur:       time.Hour,
+			updatedAfter: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+			expected:     []string{"updated:>=2024-03-01T12:00:00Z"},
+		},
+		{
+			name:          "updated window ending before it starts",
+			query:         "hello",
+			updatedBefore: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			updatedAfter:  time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC),
+			err:           true,
+		},
+		{
+			name:         "updated after with updated: query errors",
+			query:        "hello updated:>2020-01-01",
+			updatedAfter: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			err:          true,
+		},
+		{
+			name:          "updated: query with only updated before",
+			query:         "hello updated:>2020-01-01",
+			updatedBefore: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+			expected:      []string{"updated:>2020-01-01", "updated:<=2024-03-01T00:00:00Z"},
+		},
+		{
+			name:   "activity window with updated: query errors",
+			query:  "hello updated:>2020-01-01",
+			maxDur: time.Hour,
+			err:    true,
+		},
+		{
+			name:   "activity window with excluded updated: query errors",
+			query:  "hello -Updated:<2020-01-01",
+			maxDur: time.Hour,
+			err:    true,
+		},
+		{
+			name:          "created before",
+			query:         "hello",
+			createdBefore: 365 * 24 * time.Hour,
+			expected:      []string{"hello", "created:<="},
+			unexpected:    []string{"created:>=", ".."},
+		},
+		{
+			name:         "created after",
+			query:        "hello",
+			createdAfter: 24 * time.Hour,
+			expected:     []string{"hello", "created:>="},
+			unexpected:   []string{"created:<=", ".."},
+		},
+		{
+			name:          "created between",
+			query:         "hello",
+			createdBefore: 24 * time.Hour,
+			createdAfter:  48 * time.Hour,
+			expected:      []string{"hello", "created:", ".."},
+			unexpected:    []string{"created:<=", "created:>="},
+		},
+		{
+			name:          "created between with updated",
+			query:         "hello",
+			dur:           time.Hour,
+			createdBefore: 24 * time.Hour,
+			createdAfter:  48 * time.Hour,
+			expected:      []string{"updated:<=", "created:", ".."},
+		},
+		{
+			name:          "created window ending before it starts",
+			query:         "hello",
+			createdBefore: 48 * time.Hour,
+			createdAfter:  24 * time.Hour,
+			err:           true,
+		},
+		{
+			name:          "created window of no length",
+			query:         "hello",
+			createdBefore: 24 * time.Hour,
+			createdAfter:  24 * time.Hour,
+			err:           true,
+		},
+		{
+			name:          "created before with created: query errors",
+			query:         "hello created:<2020-01-01",
+			createdBefore: time.Hour,
+			err:           true,
+		},
+		{
+			name:         "created after with excluded created: query errors",
+			query:        "hello -created:<2020-01-01",
+			createdAfter: time.Hour,
+			err:          true,
+		},
+		{
+			name:     "created: query without created flags",
+			query:    "hello created:<2020-01-01",
+			expected: []string{"created:<2020-01-01"},
+		},
+		{
+			name:     "updated: query without an activity window",
+			query:    "hello updated:>2020-01-01",
+			dur:      time.Hour,
+			expected: []string{"updated:>2020-01-01", "updated:<="},
+		},
+		{
+			name:       "weird characters not escaped",
+			query:      "oh yeah!@#$&*()",
+			expected:   []string{"!", "@", "#", " "},
+			unexpected: []string{"%", "+"},
+		},
+		{
+			name:     "linebreaks are replaced by whitespaces",
+			query:    "label:foo\nlabel:bar",
+			expected: []string{"label:foo label:bar"},
+		},
+		{
+			name:   "include closed with is:open query errors",
+			query:  "hello is:open",
+			closed: true,
+			err:    true,
+		},
+		{
+			name:     "archived:false with include-archived errors",
+			query:    "hello archived:false",
+			archived: true,
+			err:      true,
+		},
+		{
+			name:  "archived:true without includeArchived errors",
+			query: "hello archived:true",
+			err:   true,
+		},
+		{
+			name:  "is:closed without includeClosed errors",
+			query: "hello is:closed",
+			err:   true,
+		},
+		{
+			name:  "is:locked without includeLocked errors",
+			query: "hello is:locked",
+			err:   true,
+		},
+		{
+			name:   "is:unlocked with includeLocked errors",
+			query:  "hello is:unlocked",
+			locked: true,
+			err:    true,
+		},
+		{
+			name:     "excluded is:closed without includeClosed",
+			query:    "hello -is:closed",
+			expected: []string{"hello -is:closed", "is:open"},
+		},
+		{
+			name:  "excluded is:open without includeClosed errors",
+			query: "hello -is:open",
+			err:   true,
+		},
+		{
+			name:   "excluded is:closed with includeClosed errors",
+			query:  "hello -is:closed",
+			closed: true,
+			err:    true,
+		},
+		{
+			name:     "excluded archived:true without includeArchived",
+			query:    "hello -archived:true",
+			expected: []string{"hello -archived:true", "archived:false"},
+		},
+		{
+			name:  "excluded archived:false without includeArchived errors",
+			query: "hello -archived:false",
+			err:   true,
+		},
+		{
+			name:     "excluded is:locked without includeLocked",
+			query:    "hello -is:locked",
+			expected: []string{"hello -is:locked", "is:unlocked"},
+		},
+		{
+			name:     "qualifiers in quoted values",
+			query:    `label:"archived:true" label:"is:closed" "is:locked"`,
+			expected: []string{`label:"archived:true"`, "archived:false", "is:open", "is:unlocked"},
+		},
+		{
+			name:     "qualifiers in free text",
+			query:    "this:is:closed not-archived:true xis:locked",
+			expected: []string{"this:is:closed", "archived:false", "is:open", "is:unlocked"},
+		},
+		{
+			name:  "qualifiers after a tab",
+			query: "hello\tis:closed",
+			err:   true,
+		},
+		{
+			name:  "qualifiers in another case",
+			query: "hello Is:Closed",
+			err:   true,
+		},
+		{
+			name:     "query at the length limit",
+			query:    strings.Repeat("a", maxQueryLength),
+			archived: true,
+			closed:   true,
+			locked:   true,
+			expected: []string{strings.Repeat("a", maxQueryLength)},
+		},
+		{
+			name:  "qualifiers push the query over the length limit",
+			query: strings.Repeat("a", maxQueryLength-len(" archived:false is:open")+1),
+			err:   true,
+		},
+		{
+			name:     "updated cutoff pushes the query over the length limit",
+			query:    strings.Repeat("a", maxQueryLength-len(" updated:<=2006-01-02T15:04:05Z")+1),
+			archived: true,
+			closed:   true,
+			locked:   true,
+			dur:      time.Hour,
+			err:      true,
+		},
+		{
+			name:     "length is measured in characters",
+			query:    strings.Repeat("ü", maxQueryLength),
+			archived: true,
+			closed:   true,
+			locked:   true,
+			expected: []string{"ü"},
+		},
+		{
+			name:       "only issues",
+			query:      "hello",
+			kind:       OnlyIssues,
+			expected:   []string{"hello", "is:issue"},
+			unexpected: []string{"is:pr"},
+		},
+		{
+			name:       "only pull requests",
+			query:      "hello",
+			kind:       OnlyPRs,
+			expected:   []string{"hello", "is:pr"},
+			unexpected: []string{"is:issue"},
+		},
+		{
+			name:     "only issues with is:issue query",
+			query:    "hello is:issue",
+			kind:     OnlyIssues,
+			expected: []string{"hello is:issue"},
+		},
+		{
+			name:  "only issues with is:pr query errors",
+			query: "hello is:pr",
+			kind:  OnlyIssues,
+			err:   true,
+		},
+		{
+			name:  "only issues with type:pr query errors",
+			query: "hello type:pr",
+			kind:  OnlyIssues,
+			err:   true,
+		},
+		{
+			name:  "only pull requests with is:issue query errors",
+			query: "hello is:issue",
+			kind:  OnlyPRs,
+			err:   true,
+		},
+		{
+			name:  "only pull requests with type:issue query errors",
+			query: "hello type:issue",
+			kind:  OnlyPRs,
+			err:   true,
+		},
+		{
+			name:     "only pull requests with is:private query",
+			query:    "hello is:private",
+			kind:     OnlyPRs,
+			expected: []string{"is:private", "is:pr"},
+		},
+		{
+			name:     "either kind with is:pr query",
+			query:    "hello is:pr",
+			expected: []string{"hello is:pr"},
+		},
+		{
+			name:  "too many operators",
+			query: "a OR b OR c OR d AND e NOT f OR g",
+			err:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		queries, err := MakeQuery(QueryOptions{
+			Query:           tc.query,
+			IncludeArchived: tc.archived,
+			IncludeClosed:   tc.closed,
+			IncludeLocked:   tc.locked,
+			Kind:            tc.kind,
+			MinUpdated:      tc.dur,
+			MaxUpdated:      tc.maxDur,
+			UpdatedBefore:   tc.updatedBefore,
+			UpdatedAfter:    tc.updatedAfter,
+			CreatedBefore:   tc.createdBefore,
+			CreatedAfter:    tc.createdAfter,
+		})
+		actual := strings.Join(queries, " ")
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.err {
+			t.Errorf("%s: failed to raise an error", tc.name)
+		}
+		for _, e := range tc.expected {
+			if !strings.Contains(actual, e) {
+				t.Errorf("%s: could not find %s in %s", tc.name, e, actual)
+			}
+		}
+		for _, u := range tc.unexpected {
+			if strings.Contains(actual, u) {
+				t.Errorf("%s: should not have found %s in %s", tc.name, u, actual)
+			}
+		}
+	}
+}
+
+func TestMakeQueryUTC(t *testing.T) {
+	local := time.Local
+	defer func() { time.Local = local }()
+	time.Local = time.FixedZone("UTC-7", -7*3600)
+	queries, err := MakeQuery(QueryOptions{Query: "hello", MinUpdated: time.Hour, MaxUpdated: 2 * time.Hour, CreatedBefore: 3 * time.Hour})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, term := range queryTerms(queries[0]) {
+		if strings.HasPrefix(term, "updated:") || strings.HasPrefix(term, "created:") {
+			if strings.Contains(term, "-07:00") || !strings.HasSuffix(term, "Z") {
+				t.Errorf("expected %s in UTC", term)
+			}
+		}
+	}
+}
+
+func TestFindQualifierKey(t *testing.T) {
+	cases := []struct {
+		query    string
+		keys     []string
+		expected string
+	}{
+		{query: "hello org:kubernetes", keys: []string{"org:"}, expected: "org:kubernetes"},
+		{query: "hello -Repo:o/r", keys: []string{"org:", "repo:"}, expected: "-Repo:o/r"},
+		{query: `label:"org:kubernetes" sorg:x`, keys: []string{"org:"}},
+		{query: `"org: in quotes"`, keys: []string{"org:"}},
+		{query: "hello", keys: []string{"org:"}},
+	}
+	for _, tc := range cases {
+		if actual := FindQualifierKey(tc.query, tc.keys...); actual != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.query, tc.expected, actual)
+		}
+	}
+}
+
+func TestMakeQueryRanges(t *testing.T) {
+	const day = 24 * time.Hour
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name                        string
+		minUpdated, maxUpdated      time.Duration
+		createdBefore, createdAfter time.Duration
+		qualifier                   string
+		start, end                  time.Duration
+	}{
+		{
+			name:       "activity window",
+			minUpdated: 2 * time.Hour,
+			maxUpdated: 30 * day,
+			qualifier:  "updated",
+			start:      30 * day,
+			end:        2 * time.Hour,
+		},
+		{
+			name:          "creation window",
+			createdBefore: 365 * day,
+			createdAfter:  730 * day,
+			qualifier:     "created",
+			start:         730 * day,
+			end:           365 * day,
+		},
+	}
+	for _, tc := range cases {
+		queries, err := MakeQuery(QueryOptions{
+			Query:         "hello",
+			MinUpdated:    tc.minUpdated,
+			MaxUpdated:    tc.maxUpdated,
+			CreatedBefore: tc.createdBefore,
+			CreatedAfter:  tc.createdAfter,
+			Clock:         clocktesting.NewFakePassiveClock(now),
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		match := regexp.MustCompile(`(?:^| )` + tc.qualifier + `:(\S+)\.\.(\S+)(?: |$)`).FindStringSubmatch(queries[0])
+		if match == nil {
+			t.Errorf("%s: expected a %s:A..B range in %q", tc.name, tc.qualifier, queries[0])
+			continue
+		}
+		start, err := time.Parse(time.RFC3339, match[1])
+		if err != nil {
+			t.Errorf("%s: bad start of the range: %v", tc.name, err)
+		} else if !start.Equal(now.Add(-tc.start)) {
+			t.Errorf("%s: expected the range to start %s ago, got %s", tc.name, tc.start, start)
+		}
+		end, err := time.Parse(time.RFC3339, match[2])
+		if err != nil {
+			t.Errorf("%s: bad end of the range: %v", tc.name, err)
+		} else if !end.Equal(now.Add(-tc.end)) {
+			t.Errorf("%s: expected the range to end %s ago, got %s", tc.name, tc.end, end)
+		}
+		if strings.Contains(queries[0], tc.qualifier+":<=") || strings.Contains(queries[0], tc.qualifier+":>=") {
+			t.Errorf("%s: expected only the range in %q", tc.name, queries[0])
+		}
+	}
+}
+
+func TestMakeQuerySplit(t *testing.T) {
+	var exclusions []string
+	for n := 0; n < 20; n++ {
+		exclusions = append(exclusions, fmt.Sprintf("-label:\"excluded label %02d\"", n))
+	}
+	query := "is:issue " + strings.Join(exclusions, " ") + " label:foo"
+
+	if _, err := MakeQuery(QueryOptions{Query: query, MinUpdated: time.Hour}); err == nil {
+		t.Fatal("failed to reject a query over the length limit")
+	}
+	queries, err := MakeQuery(QueryOptions{Query: query, MinUpdated: time.Hour, Split: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queries) < 2 {
+		t.Fatalf("expected several queries, got %q", queries)
+	}
+	seen := map[string]int{}
+	for _, q := range queries {
+		if n := utf8.RuneCountInString(q); n > maxQueryLength {
+			t.Errorf("%d characters exceed the limit in %q", n, q)
+		}
+		for _, e := range []string{"is:issue ", " label:foo ", "archived:false", "is:open", "is:unlocked", "updated:<="} {
+			if !strings.Contains(q, e) {
+				t.Errorf("could not find %s in %q", e, q)
+			}
+		}
+		for _, term := range queryTerms(q) {
+			if strings.HasPrefix(term, "-") {
+				seen[term]++
+			}
+		}
+	}
+	for _, e := range exclusions {
+		if seen[e] != 1 {
+			t.Errorf("expected %s in exactly one query, found it in %d", e, seen[e])
+		}
+	}
+
+	if _, err := MakeQuery(QueryOptions{Query: strings.Repeat("a", maxQueryLength), Split: true}); err == nil {
+		t.Error("failed to reject a query without exclusions to split")
+	}
+}
+
+func makeIssue(owner, repo string, number int, title string) github.Issue {
+	return github.Issue{
+		HTMLURL: fmt.Sprintf("fake://localhost/%s/%s/issues/%d", owner, repo, number),
+		Title:   title,
+	}
+}
+
+type fakeClient struct {
+	sync.Mutex
+	comments []int
+	bodies   []string
+	issues   []github.Issue
+	// repos maps org/repo to the repo returned by GetRepo.
+	repos    map[string]github.FullRepo
+	getRepos []string
+	// existing maps issue numbers to the comments returned by ListIssueComments.
+	existing map[int][]github.IssueComment
+	// prs maps pull request numbers to the pull requests returned by GetPullRequest.
+	prs map[int]github.PullRequest
+	// crossRefs maps issue numbers to the URLs of their cross references, oldest
+	// first, with the empty string for references that are not pull requests.
+	crossRefs map[int][]string
+	// closedPRs are the cross referenced pull requests that are not open.
+	closedPRs map[string]bool
+	// issueTypes are the issue types of every org, by name.
+	issueTypes []string
+	// mutations records the inputs of GraphQL mutations.
+	mutations []githubql.Input
+	// gists records the content of created gists.
+	gists []string
+	// current maps issue numbers to the issue GetIssue returns instead of the search result.
+	current map[int]github.Issue
+	// repoLabels maps org/repo to its label names, or to nil when listing fails.
+	repoLabels map[string][]string
+	// createdLabels records labels created by AddRepoLabel as org/repo:label.
+	createdLabels []string
+	// addedLabels records labels added by AddLabels as org/repo#number:label.
+	// Adding labels starting with unaddable fails.
+	addedLabels []string
+	// removedLabels records labels removed by RemoveLabel like addedLabels.
+	// Removing labels starting with unremovable fails.
+	removedLabels []string
+	// closed records the numbers of issues closed by CloseIssue.
+	closed []int
+	// signedUp maps logins to when their accounts were created.
+	signedUp    map[string]time.Time
+	userLookups []string
+	// deployments maps sha@environment to the state of its latest deployment.
+	deployments map[string]string
+	// deleted records the IDs of comments deleted by DeleteComment.
+	deleted []int
+	// reviews maps pull request numbers to their reviews.
+	reviews map[int][]github.Review
+	// minimized holds the node IDs of minimized comments.
+	minimized map[string]bool
+	// emails maps logins to their public emails.
+	emails map[string]string
+	// events maps issue numbers to the events returned by ListIssueEvents.
+	events     map[int][]github.ListedIssueEvent
+	eventLists int
+	// searchPages are the pages of GraphQL search results, and searchQueries
+	// the queries searched.
+	searchPages   [][]searchNode
+	searchQueries []string
+	// rateLimits are the core rate limits returned in turn, repeating the
+	// last one.
+	rateLimits      []github.RateLimit
+	rateLimitChecks int
+	// projectColumns maps issue numbers to the classic project columns of
+	// their cards, with the empty string for cards not in a column.
+	projectColumns map[int][]string
+	// titled are the issues found by title searches, which have in:title.
+	titled []github.Issue
+	// created records the issues created by CreateIssue, numbered from 1000.
+	created []github.Issue
+	// edited maps issue numbers to the bodies EditIssue set.
+	edited map[int]string
+	// checkRuns maps head SHAs to their check runs.
+	checkRuns map[string][]github.CheckRun
+	// statuses maps head SHAs to their combined statuses.
+	statuses map[string]github.CombinedStatus
+	// outages maps issue numbers to how many more times CreateComment fails
+	// on them with a server error.
+	outages map[int]int
+	// requested maps pull request numbers to the reviewers RequestReview
+	// requested, which fails for logins starting with outsider.
+	requested map[int][]string
+}
+
+// Fakes creating a gist, using the same signature as github.Client
+func (c *fakeClient) CreateGist(description, content string) (string, error) {
+	if strings.Contains(description, "error") {
+		return "", errors.New("injected gist error")
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.gists = append(c.gists, content)
+	return fmt.Sprintf("https://gist.example.com/%d", len(c.gists)), nil
+}
+
+// Fakes Creating a client, using the same signature as github.Client
+func (c *fakeClient) CreateComment(owner, repo string, number int, comment string) error {
+	if strings.Contains(comment, "error") || repo == "error" {
+		return errors.New(comment)
+	}
+	c.Lock()
+	defer c.Unlock()
+	if c.outages[number] > 0 {
+		c.outages[number]--
+		return github.NewServerError(http.StatusBadGateway)
+	}
+	c.comments = append(c.comments, number)
+	c.bodies = append(c.bodies, comment)
+	return nil
+}
+
+// Fakes searching for issues, using the same signature as github.Client
+func (c *fakeClient) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	if strings.Contains(query, "error") || org == "error" {
+		return nil, errors.New(query)
+	}
+	if strings.Contains(query, "in:title") {
+		return c.titled, nil
+	}
+	ret := []github.Issue{}
+	for _, i := range c.issues {
+		if ref, err := ParseHTMLURL(i.HTMLURL); org != "" && (err != nil || ref.Org != org) {
+			continue
+		}
+		if strings.Contains(i.Title, query) {
+			ret = append(ret, i)
+		}
+	}
+	return ret, nil
+}
+
+// runErr returns the fatal error of a run, or its problems as an error.
+func runErr(res Result, err error) error {
+	if err != nil {
+		return err
+	}
+	return res.err()
+}
+
+// unscoped returns a search of queries that is not limited to an org.
+func unscoped(queries ...string) []OrgSearch {
+	return []OrgSearch{{Queries: queries}}
+}
+
+// Fakes getting an issue, using the same signature as github.Client
+func (c *fakeClient) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	if i, ok := c.current[number]; ok {
+		return &i, nil
+	}
+	for _, i := range c.issues {
+		if ref, err := ParseHTMLURL(i.HTMLURL); err == nil && sameIssue(ref, IssueRef{Org: org, Repo: repo, Number: number}) {
+			return &i, nil
+		}
+	}
+	return nil, fmt.Errorf("no such issue %s/%s#%d", org, repo, number)
+}
+
+// Fakes listing comments, using the same signature as github.Client
+func (c *fakeClient) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	if repo == "error" {
+		return nil, errors.New("injected list error")
+	}
+	return c.existing[number], nil
+}
+
+// Fakes adding labels to an issue, using the same signature as github.Client
+func (c *fakeClient) AddLabels(org, repo string, number int, labels ...string) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, l := range labels {
+		if strings.HasPrefix(l, "unaddable") {
+			return fmt.Errorf("injected error adding %s", l)
+		}
+	}
+	for _, l := range labels {
+		c.addedLabels = append(c.addedLabels, fmt.Sprintf("%s/%s#%d:%s", org, repo, number, l))
+	}
+	return nil
+}
+
+// Fakes removing a label, using the same signature as github.Client
+func (c *fakeClient) RemoveLabel(org, repo string, number int, label string) error {
+	c.Lock()
+	defer c.Unlock()
+	if strings.HasPrefix(label, "unremovable") {
+		return fmt.Errorf("injected error removing %s", label)
+	}
+	c.removedLabels = append(c.removedLabels, fmt.Sprintf("%s/%s#%d:%s", org, repo, number, label))
+	return nil
+}
+
+// Fakes listing the labels of a repo, using the same signature as github.Client
+func (c *fakeClient) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	names, ok := c.repoLabels[org+"/"+repo]
+	if !ok {
+		return nil, fmt.Errorf("no such repo %s/%s", org, repo)
+	}
+	var labels []github.Label
+	for _, n := range names {
+		labels = append(labels, github.Label{Name: n})
+	}
+	return labels, nil
+}
+
+// Fakes creating a repo label, using the same signature as github.Client
+func (c *fakeClient) AddRepoLabel(org, repo, label, description, color string) error {
+	if label == "error" {
+		return errors.New("injected label error")
+	}
+	c.createdLabels = append(c.createdLabels, fmt.Sprintf("%s/%s:%s", org, repo, label))
+	return nil
+}
+
+// Fakes closing an issue, using the same signature as github.Client
+func (c *fakeClient) CloseIssue(org, repo string, number int) error {
+	if repo == "error" {
+		return errors.New("injected close error")
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.closed = append(c.closed, number)
+	return nil
+}
+
+// Fakes creating an issue, using the same signature as github.Client
+func (c *fakeClient) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	if repo == "error" {
+		return 0, errors.New("injected create error")
+	}
+	c.Lock()
+	defer c.Unlock()
+	number := 1000 + len(c.created)
+	c.created = append(c.created, github.Issue{Number: number, Title: title, Body: body})
+	return number, nil
+}
+
+// Fakes listing check runs, using the same signature as github.Client
+func (c *fakeClient) ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error) {
+	if ref == "error" {
+		return nil, errors.New("injected check runs error")
+	}
+	return &github.CheckRunList{CheckRuns: c.checkRuns[ref]}, nil
+}
+
+// Fakes getting the combined status of a commit, using the same signature as github.Client
+func (c *fakeClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	if ref == "error" {
+		return nil, errors.New("injected combined status error")
+	}
+	s := c.statuses[ref]
+	return &s, nil
+}
+
+// Fakes editing an issue, using the same signature as github.Client
+func (c *fakeClient) EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.edited == nil {
+		c.edited = map[int]string{}
+	}
+	c.edited[number] = issue.Body
+	return issue, nil
+}
+
+// Fakes deleting a comment, using the same signature as github.Client
+func (c *fakeClient) DeleteComment(org, repo string, id int) error {
+	if id < 0 {
+		return errors.New("injected delete error")
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.deleted = append(c.deleted, id)
+	return nil
+}
+
+// Fakes listing events, using the same signature as github.Client
+func (c *fakeClient) RateLimit() (github.RateLimits, error) {
+	c.Lock()
+	defer c.Unlock()
+	var limits github.RateLimits
+	if len(c.rateLimits) == 0 {
+		return limits, errors.New("injected rate limit error")
+	}
+	limits.Resources.Core = c.rateLimits[0]
+	if len(c.rateLimits) > 1 {
+		c.rateLimits = c.rateLimits[1:]
+	}
+	c.rateLimitChecks++
+	return limits, nil
+}
+
+func (c *fakeClient) ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error) {
+	if repo == "error" {
+		return nil, errors.New("injected events error")
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.eventLists++
+	return c.events[num], nil
+}
+
+// Fakes listing reviews, using the same signature as github.Client
+func (c *fakeClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	if repo == "error" {
+		return nil, errors.New("injected reviews error")
+	}
+	return c.reviews[number], nil
+}
+
+// Fakes requesting reviews, using the same signature as github.Client
+func (c *fakeClient) RequestReview(org, repo string, number int, logins []string) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, l := range logins {
+		if strings.HasPrefix(l, "outsider") {
+			return fmt.Errorf("%s is not a collaborator of %s/%s", l, org, repo)
+		}
+	}
+	if c.requested == nil {
+		c.requested = map[int][]string{}
+	}
+	c.requested[number] = append(c.requested[number], logins...)
+	return nil
+}
+
+// Fakes checking for the bot user, using the same signature as github.Client
+func (c *fakeClient) BotUserChecker() (func(candidate string) bool, error) {
+	return func(candidate string) bool {
+		return candidate == "bot" || candidate == "bot[bot]"
+	}, nil
+}
+
+// Fakes getting a pull request, using the same signature as github.Client
+func (c *fakeClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	pr, ok := c.prs[number]
+	if !ok {
+		return nil, fmt.Errorf("no such pull request %s/%s#%d", org, repo, number)
+	}
+	return &pr, nil
+}
+
+// Fakes GraphQL queries, using the same signature as github.Client
+func (c *fakeClient) QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error {
+	n, _ := vars["number"].(githubql.Int)
+	number := int(n)
+	switch q := q.(type) {
+	case *deploymentsQuery:
+		sha := string(vars["sha"].(githubql.GitObjectID))
+		env := string(vars["environments"].([]githubql.String)[0])
+		if sha == "error" {
+			return errors.New("injected deployments error")
+		}
+		if state, ok := c.deployments[sha+"@"+env]; ok {
+			var n struct {
+				LatestStatus struct{ State githubql.String }
+			}
+			n.LatestStatus.State = githubql.String(state)
+			q.Repository.Object.Commit.Deployments.Nodes = append(q.Repository.Object.Commit.Deployments.Nodes, n)
+		}
+		return nil
+	case *minimizedQuery:
+		for _, id := range vars["ids"].([]githubql.ID) {
+			if id == "error" {
+				return errors.New("injected minimized error")
+			}
+			var n minimizedNode
+			n.IssueComment.ID = id
+			n.IssueComment.IsMinimized = githubql.Boolean(c.minimized[id.(string)])
+			q.Nodes = append(q.Nodes, n)
+		}
+		return nil
+	case *issueSearchQuery:
+		page := 0
+		if cursor := vars["cursor"].(*githubql.String); cursor != nil {
+			page, _ = strconv.Atoi(string(*cursor))
+		}
+		c.searchQueries = append(c.searchQueries, string(vars["query"].(githubql.String)))
+		if page >= len(c.searchPages) {
+			return errors.New("injected search error")
+		}
+		q.Search.Nodes = c.searchPages[page]
+		q.RateLimit.Cost = 1
+		if page+1 < len(c.searchPages) {
+			q.Search.PageInfo.HasNextPage = true
+			q.Search.PageInfo.EndCursor = githubql.String(strconv.Itoa(page + 1))
+		}
+		return nil
+	case *nodeIDQuery:
+		if vars["repo"] == githubql.String("error") {
+			return errors.New("injected node error")
+		}
+		q.Repository.IssueOrPullRequest.Issue.ID = fmt.Sprintf("looked-up-%d", number)
+		return nil
+	case *userEmailQuery:
+		login := string(vars["login"].(githubql.String))
+		if login == "error" {
+			return errors.New("injected user error")
+		}
+		q.User.Email = githubql.String(c.emails[login])
+		return nil
+	case *userCreatedQuery:
+		login := string(vars["login"].(githubql.String))
+		c.Lock()
+		c.userLookups = append(c.userLookups, login)
+		c.Unlock()
+		t, ok := c.signedUp[login]
+		if !ok {
+			return fmt.Errorf("no such user %s", login)
+		}
+		q.User.CreatedAt = githubql.DateTime{Time: t}
+		return nil
+	case *linkedPRsQuery:
+		if vars["repo"] == githubql.String("error") {
+			return errors.New("injected query error")
+		}
+		for _, url := range c.crossRefs[number] {
+			var n timelineNode
+			n.CrossReferencedEvent.Source.PullRequest.URL = githubql.String(url)
+			if url != "" {
+				n.CrossReferencedEvent.Source.PullRequest.State = githubql.PullRequestStateOpen
+				if c.closedPRs[url] {
+					n.CrossReferencedEvent.Source.PullRequest.State = githubql.PullRequestStateMerged
+				}
+			}
+			q.Repository.Issue.TimelineItems.Nodes = append(q.Repository.Issue.TimelineItems.Nodes, n)
+		}
+		return nil
+	case *projectCardsQuery:
+		if vars["repo"] == githubql.String("error") {
+			return errors.New("injected project cards error")
+		}
+		for _, column := range c.projectColumns[number] {
+			var card projectCard
+			card.Column.Name = githubql.String(column)
+			q.Repository.IssueOrPullRequest.Issue.ProjectCards.Nodes = append(q.Repository.IssueOrPullRequest.Issue.ProjectCards.Nodes, card)
+		}
+		return nil
+	case *issueTypeQuery:
+		q.Repository.Issue.ID = fmt.Sprintf("issue-%d", number)
+		for _, name := range c.issueTypes {
+			q.Organization.IssueTypes.Nodes = append(q.Organization.IssueTypes.Nodes, issueType{ID: "type-" + name, Name: githubql.String(name)})
+		}
+		return nil
+	}
+	return fmt.Errorf("unexpected query %T", q)
+}
+
+// Fakes GraphQL mutations, using the same signature as github.Client
+func (c *fakeClient) MutateWithGitHubAppsSupport(ctx context.Context, m interface{}, input githubql.Input, vars map[string]interface{}, org string) error {
+	c.Lock()
+	defer c.Unlock()
+	c.mutations = append(c.mutations, input)
+	return nil
+}
+
+// Fakes getting a repo, using the same signature as github.Client
+func (c *fakeClient) GetRepo(owner, name string) (github.FullRepo, error) {
+	key := owner + "/" + name
+	c.getRepos = append(c.getRepos, key)
+	r, ok := c.repos[key]
+	if !ok {
+		return github.FullRepo{}, fmt.Errorf("no such repo %s", key)
+	}
+	return r, nil
+}
+
+func TestRun(t *testing.T) {
+	manyIssues := []github.Issue{}
+	manyComments := []int{}
+	for i := 0; i < 100; i++ {
+		manyIssues = append(manyIssues, makeIssue("o", "r", i, "many "+strconv.Itoa(i)))
+		manyComments = append(manyComments, i)
+	}
+
+	cases := []struct {
+		name     string
+		query    string
+		comment  string
+		template bool
+		ceiling  int
+		client   fakeClient
+		expected []int
+		err      bool
+	}{
+		{
+			name:     "find all",
+			query:    "many",
+			comment:  "found you",
+			client:   fakeClient{issues: manyIssues},
+			expected: manyComments,
+		},
+		{
+			name:     "find first 10",
+			query:    "many",
+			ceiling:  10,
+			comment:  "hey",
+			client:   fakeClient{issues: manyIssues},
+			expected: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:    "find none",
+			query:   "none",
+			comment: "this should not happen",
+			client:  fakeClient{issues: manyIssues},
+		},
+		{
+			name:    "search error",
+			query:   "this search should error",
+			comment: "comment",
+			client:  fakeClient{issues: manyIssues},
+			err:     true,
+		},
+		{
+			name:    "comment error",
+			query:   "problematic",
+			comment: "rolo tomassi",
+			client: fakeClient{issues: []github.Issue{
+				makeIssue("o", "r", 1, "problematic this should work"),
+				makeIssue("o", "error", 2, "problematic expect an error"),
+				makeIssue("o", "r", 3, "problematic works as well"),
+			}},
+			err:      true,
+			expected: []int{1, 3},
+		},
+		{
+			name:     "template comment",
+			query:    "67",
+			client:   fakeClient{issues: manyIssues},
+			comment:  "https://gubernator.k8s.io/pr/{{.Org}}/{{.Repo}}/{{.Number}}",
+			template: true,
+			expected: []int{67},
+		},
+		{
+			name:     "bad template errors",
+			query:    "67",
+			client:   fakeClient{issues: manyIssues},
+			comment:  "Bad {{.UnknownField}}",
+			template: true,
+			err:      true,
+		},
+	}
+
+	for i := range cases {
+		tc := &cases[i]
+		err := runErr(Run(context.Background(), &tc.client, Options{
+			Searches:      unscoped(tc.query),
+			SamplePercent: 100,
+			Ceiling:       tc.ceiling,
+			Commenter:     MakeCommenter(tc.comment, tc.template),
+		}))
+		if tc.err && err == nil {
+			t.Errorf("%s: failed to received an error", tc.name)
+			continue
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if len(tc.expected) != len(tc.client.comments) {
+			t.Errorf("%s: expected comments %v != actual %v", tc.name, tc.expected, tc.client.comments)
+			continue
+		}
+		missing := []int{}
+		for _, e := range tc.expected {
+			found := false
+			for _, cmt := range tc.client.comments {
+				if cmt == e {
+					found = true
+					break
+				}
+			}
+			if !found {
+				missing = append(missing, e)
+			}
+		}
+		if len(missing) > 0 {
+			t.Errorf("%s: missing %v from actual comments %v", tc.name, missing, tc.client.comments)
+		}
+	}
+}
+
+func TestRunIntersectsQueries(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "split both"),
+		makeIssue("o", "r", 2, "split"),
+		makeIssue("o", "r", 3, "both"),
+		makeIssue("o", "r", 4, "both split"),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("split", "both"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hi", false),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on issues matching every query %v, got %v", expected, c.comments)
+	}
+}
+
+func TestMissingReactions(t *testing.T) {
+	minimum := github.Reactions{PlusOne: 3, Heart: 1}
+	cases := []struct {
+		name      string
+		reactions github.Reactions
+		expected  string
+	}{
+		{
+			name:      "meets every minimum",
+			reactions: github.Reactions{PlusOne: 3, Heart: 2},
+		},
+		{
+			name:      "rockets are not required",
+			reactions: github.Reactions{PlusOne: 5, Heart: 1, Rocket: 0},
+		},
+		{
+			name:      "negative reactions do not count",
+			reactions: github.Reactions{TotalCount: 10, MinusOne: 9, Heart: 1},
+			expected:  "only 0 of 3 thumbs up",
+		},
+		{
+			name:      "several minimums missed",
+			reactions: github.Reactions{PlusOne: 2},
+			expected:  "only 2 of 3 thumbs up, 0 of 1 hearts",
+		},
+	}
+	for _, tc := range cases {
+		if actual := missingReactions(tc.reactions, minimum); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunMinReactions(t *testing.T) {
+	popular := makeIssue("o", "r", 1, "reacted")
+	popular.Reactions = github.Reactions{PlusOne: 4, Rocket: 1}
+	unpopular := makeIssue("o", "r", 2, "reacted")
+	unpopular.Reactions = github.Reactions{PlusOne: 4}
+	c := fakeClient{issues: []github.Issue{unpopular, popular}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("reacted"),
+		SamplePercent: 100,
+		Ceiling:       1,
+		Commenter:     MakeCommenter("hi", false),
+		MinReactions:  github.Reactions{PlusOne: 2, Rocket: 1},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunOrgs(t *testing.T) {
+	now := time.Now()
+	issue := func(org string, number int, age time.Duration) github.Issue {
+		i := makeIssue(org, "r", number, "org")
+		i.UpdatedAt = now.Add(-age)
+		return i
+	}
+	c := fakeClient{issues: []github.Issue{
+		issue("a", 1, time.Hour),
+		issue("a", 2, 4*time.Hour),
+		issue("b", 3, 2*time.Hour),
+		issue("b", 4, 3*time.Hour),
+		issue("c", 5, 5*time.Hour),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches: []OrgSearch{
+			{Org: "a", Queries: []string{"org"}},
+			{Org: "error", Queries: []string{"org"}},
+			{Org: "b", Queries: []string{"org"}},
+		},
+		Sort:          "updated",
+		Asc:           true,
+		SamplePercent: 100,
+		Ceiling:       3,
+		Commenter:     MakeCommenter("hi", false),
+	}))
+	if err == nil || !strings.Contains(err.Error(), "[error] Search failed") {
+		t.Errorf("expected the failed org to be reported, got %v", err)
+	}
+	if expected := []int{2, 4, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected the ceiling to pick the stalest issues of every org %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunOverlappingSearches(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "stale bug"),
+		makeIssue("o", "r", 2, "stale bug"),
+		makeIssue("o", "r", 3, "stale feature"),
+		makeIssue("o", "r", 4, "rotten bug"),
+	}}
+	res, err := Run(context.Background(), &c, Options{
+		Searches: []OrgSearch{
+			{Queries: []string{"stale"}},
+			{Queries: []string{"bug"}},
+		},
+		SamplePercent: 100,
+		Ceiling:       4,
+		Commenter:     MakeCommenter("hi", false),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, 2, 3, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected a single comment on each issue %v without using up the ceiling, got %v", expected, c.comments)
+	}
+	if res.Matched != 4 || res.Skipped != 0 {
+		t.Errorf("expected duplicates to be neither matched nor skipped, got %+v", res)
+	}
+}
+
+func TestRunPaginationDuplicates(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "paged"),
+		makeIssue("o", "r", 2, "paged"),
+		// Updated while paging, so returned on the next page too.
+		makeIssue("o", "r", 1, "paged"),
+		makeIssue("o", "r", 3, "paged"),
+		makeIssue("O", "R", 2, "paged"),
+	}}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("paged"),
+		SamplePercent: 100,
+		Ceiling:       3,
+		Random:        true,
+		Rand:          rand.New(rand.NewSource(1)),
+		Commenter:     MakeCommenter("hi", false),
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.Ints(c.comments)
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected a single comment on each issue %v, got %v", expected, c.comments)
+	}
+	if res.Matched != 3 || res.Skipped != 0 {
+		t.Errorf("expected duplicates to be neither matched nor skipped, got %+v", res)
+	}
+	if n := strings.Count(logs.String(), "returned again by the search"); n != 2 {
+		t.Errorf("expected both duplicates logged, got %d in:\n%s", n, logs.String())
+	}
+}
+
+func TestRunMaxBotComments(t *testing.T) {
+	comment := func(login string) github.IssueComment {
+		return github.IssueComment{User: github.User{Login: login}}
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "nagged"),
+			makeIssue("o", "r", 2, "nagged"),
+			makeIssue("o", "r", 3, "nagged"),
+			makeIssue("o", "error", 4, "nagged"),
+		},
+		existing: map[int][]github.IssueComment{
+			1: {comment("bot"), comment("author"), comment("bot[bot]")},
+			2: {comment("bot"), comment("author"), comment("author")},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:       unscoped("nagged"),
+		SamplePercent:  100,
+		Commenter:      MakeCommenter("hi", false),
+		MaxBotComments: 2,
+	}))
+	if err == nil {
+		t.Error("failed to report the comments that could not be listed")
+	}
+	if expected := []int{2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestReadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issues")
+	content := "# from the triage script\nhttps://github.com/o/r/issues/1\n\n  https://github.com/o/r/pull/2  \n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	urls, err := ReadLines(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"https://github.com/o/r/issues/1", "https://github.com/o/r/pull/2"}; !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected %v, got %v", expected, urls)
+	}
+}
+
+func TestRunIssueURLs(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "listed"),
+		makeIssue("o", "r", 2, "listed"),
+		makeIssue("o", "r", 3, "listed"),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		IssueURLs: []string{
+			makeIssue("o", "r", 3, "").HTMLURL,
+			"not a url",
+			makeIssue("o", "r", 1, "").HTMLURL,
+			makeIssue("o", "r", 3, "").HTMLURL + "#issuecomment-1",
+			makePR("o", "r", 1, "").HTMLURL,
+			makeIssue("o", "r", 4, "").HTMLURL,
+			makeIssue("o", "r", 2, "").HTMLURL,
+		},
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("{{.Issue.Title}} {{.Number}}", true),
+	}))
+	if err == nil || !strings.Contains(err.Error(), "not a url") || !strings.Contains(err.Error(), "o/r#4") {
+		t.Errorf("expected the malformed and missing issues to be reported, got %v", err)
+	}
+	if expected := []string{"listed 3", "listed 1"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %v, got %v", expected, c.bodies)
+	}
+}
+
+func TestStripCode(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "plain text",
+			body:     "panic: runtime error",
+			expected: "panic: runtime error",
+		},
+		{
+			name:     "fenced blocks",
+			body:     "before\n```go\npanic: oops\n```\nbetween\n  ~~~~\npanic: again\n~~~\nstill code\n~~~~\nafter",
+			expected: "before\nbetween\nafter",
+		},
+		{
+			name:     "unclosed fence runs to the end",
+			body:     "before\n```\npanic: oops",
+			expected: "before",
+		},
+		{
+			name:     "inline code",
+			body:     "run `panic()` or ``a `panic` b`` now",
+			expected: "run   or   now",
+		},
+	}
+	for _, tc := range cases {
+		if actual := stripCode(tc.body); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestBodyExcerpt(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		n        int
+		expected string
+	}{
+		{
+			name:     "short plain text",
+			body:     "The build fails.",
+			n:        100,
+			expected: "The build fails.",
+		},
+		{
+			name:     "cut at the length",
+			body:     "The build fails on every arm64 node.",
+			n:        15,
+			expected: "The build fails…",
+		},
+		{
+			name:     "markdown removed",
+			body:     "<!-- Please fill in the template -->\n### What happened\n\n* The **build** fails, see [the log](https://example.com/log) and `make test`.\n> quoted\n```\npanic: oops\n```\n1. retry_count is ~~3~~ 5",
+			n:        200,
+			expected: "What happened The build fails, see the log and make test. quoted retry_count is 3 5",
+		},
+		{
+			name:     "characters rather than bytes",
+			body:     "ünïcödé text",
+			n:        7,
+			expected: "ünïcödé…",
+		},
+		{
+			name: "nothing but a template",
+			body: "<!-- describe the bug -->\n\n",
+			n:    100,
+		},
+	}
+	for _, tc := range cases {
+		if actual := bodyExcerpt(tc.body, tc.n); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunBodyExcerpt(t *testing.T) {
+	issue := func(number int, body string) github.Issue {
+		i := makeIssue("o", "r", number, "excerpt")
+		i.Body = body
+		return i
+	}
+	c := fakeClient{issues: []github.Issue{
+		issue(1, "**Flaky** test in CI"),
+		issue(2, ""),
+		issue(3, strings.Repeat("long ", 20)),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("excerpt"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("Is this still happening?", false),
+		ExcerptLength: 30,
+		Safeguards:    SafeguardOptions{MaxLength: 50, NoTruncate: true},
+	}))
+	if err == nil {
+		t.Error("failed to apply --comment-max-length after adding the excerpt")
+	}
+	expected := []string{"> Flaky test in CI\n\nIs this still happening?", "Is this still happening?"}
+	if !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected %q, got %q", expected, c.bodies)
+	}
+}
+
+func TestRunBodyRegex(t *testing.T) {
+	issue := func(number int, body string) github.Issue {
+		i := makeIssue("o", "r", number, "body")
+		i.Body = body
+		return i
+	}
+	c := fakeClient{issues: []github.Issue{
+		issue(1, "It panics on start."),
+		issue(2, "Logs:\n```\npanic: nil map\n```"),
+		issue(3, "Calling `panic` is fine here."),
+		issue(4, "Nothing to see."),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:       unscoped("body"),
+		SamplePercent:  100,
+		Commenter:      MakeCommenter("hi", false),
+		BodyRegex:      regexp.MustCompile("panic"),
+		SkipCodeBlocks: true,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunRegexCase(t *testing.T) {
+	issue := func(number int, title, body string) github.Issue {
+		i := makeIssue("o", "r", number, "case "+title)
+		i.Body = body
+		return i
+	}
+	issues := []github.Issue{
+		issue(1, "Flaky test", "It fails on CI."),
+		issue(2, "flaky test", "it FAILS on ci."),
+		issue(3, "FLAKY TEST", "Nothing to see."),
+		issue(4, "Broken build", "It fails."),
+	}
+	cases := []struct {
+		name            string
+		title, body     string
+		caseInsensitive bool
+		expected        []int
+	}{
+		{
+			name:     "case-sensitive title",
+			title:    "Flaky",
+			expected: []int{1},
+		},
+		{
+			name:            "case-insensitive title",
+			title:           "flaky",
+			caseInsensitive: true,
+			expected:        []int{1, 2, 3},
+		},
+		{
+			name:     "case-sensitive body",
+			body:     "fails on CI",
+			expected: []int{1},
+		},
+		{
+			name:            "case-insensitive body",
+			body:            "fails on ci",
+			caseInsensitive: true,
+			expected:        []int{1, 2},
+		},
+		{
+			name:     "inline flag",
+			title:    "(?i)flaky",
+			body:     "fails",
+			expected: []int{1},
+		},
+		{
+			name:            "both ignoring case",
+			title:           "flaky",
+			body:            "fails",
+			caseInsensitive: true,
+			expected:        []int{1, 2},
+		},
+	}
+	for _, tc := range cases {
+		o := Options{
+			Searches:      unscoped("case"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hi", false),
+		}
+		var err error
+		if tc.title != "" {
+			if o.TitleRegex, err = CompileFilterRegex(tc.title, tc.caseInsensitive); err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.name, err)
+			}
+		}
+		if tc.body != "" {
+			if o.BodyRegex, err = CompileFilterRegex(tc.body, tc.caseInsensitive); err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.name, err)
+			}
+		}
+		c := fakeClient{issues: issues}
+		if err := runErr(Run(context.Background(), &c, o)); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(c.comments, tc.expected) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, tc.expected, c.comments)
+		}
+	}
+}
+
+func TestRunResult(t *testing.T) {
+	bad := makeIssue("o", "r", 0, "counted")
+	bad.HTMLURL = "https://github.com/o/r/discussions/7"
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "counted"),
+			bad,
+			makeIssue("o", "error", 2, "counted"),
+			makeIssue("o", "r", 3, "counted"),
+			makeIssue("o", "r", 4, "counted"),
+			makeIssue("o", "r", 5, "counted"),
+		},
+		existing: map[int][]github.IssueComment{3: {{Body: "hi"}}},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("counted"),
+		SamplePercent: 100,
+		Ceiling:       4,
+		Commenter:     MakeCommenter("hi", false),
+		Safeguards:    SafeguardOptions{SkipDuplicates: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Result{Matched: 6, Commented: 2, Skipped: 1, Failed: 2}
+	if res.Matched != expected.Matched || res.Commented != expected.Commented || res.Skipped != expected.Skipped || res.Failed != expected.Failed || len(res.Problems) != 2 {
+		t.Errorf("expected %+v with 2 problems, got %+v", expected, res)
+	}
+
+	if _, err := Run(context.Background(), &c, Options{Searches: unscoped("error"), SamplePercent: 100}); err == nil {
+		t.Error("failed to return the search failure")
+	}
+}
+
+func TestRunLoggerAndClock(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "logged"),
+		makeIssue("o", "r", 2, "logged"),
+	}
+	for n := range issues {
+		issues[n].UpdatedAt = now.Add(-72 * time.Hour)
+	}
+	c := fakeClient{
+		issues:   issues,
+		existing: map[int][]github.IssueComment{2: {{Body: "3 days"}}},
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("logged"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("{{.DaysSinceUpdate}} days", true),
+		Safeguards:    SafeguardOptions{SkipDuplicates: true},
+		Logger:        log.New(&logs, "", 0),
+		Clock:         clocktesting.NewFakePassiveClock(now),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"3 days"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+	expected := []IssueResult{
+		{URL: issues[0].HTMLURL, Outcome: OutcomeCommented},
+		{URL: issues[1].HTMLURL, Outcome: OutcomeDuplicate},
+	}
+	if !reflect.DeepEqual(res.Issues, expected) {
+		t.Errorf("expected issues %+v, got %+v", expected, res.Issues)
+	}
+	if !strings.Contains(logs.String(), issues[0].HTMLURL) {
+		t.Errorf("expected the logger to get the run's output, got %q", logs.String())
+	}
+	if actual := OutcomeDuplicate.String(); actual != "duplicate" {
+		t.Errorf("expected duplicate, got %q", actual)
+	}
+}
+
+func TestWithHeaderFooter(t *testing.T) {
+	m := Meta{Org: "o", Repo: "r", Number: 7}
+	cases := []struct {
+		name     string
+		header   string
+		footer   string
+		expected string
+		err      bool
+	}{
+		{
+			name:     "neither",
+			expected: "hello",
+		},
+		{
+			name:     "header only",
+			header:   "Hi {{.Org}}/{{.Repo}}#{{.Number}}!\n",
+			expected: "Hi o/r#7!\n\nhello",
+		},
+		{
+			name:     "footer only",
+			footer:   "I am a bot, see [muting](https://example.com/mute?issue={{.Number}}).\n",
+			expected: withFooter("hello", "I am a bot, see [muting](https://example.com/mute?issue=7)."),
+		},
+		{
+			name:     "both",
+			header:   "Hi",
+			footer:   "Bye",
+			expected: withFooter("Hi\n\nhello", "Bye"),
+		},
+		{
+			name:   "footer fails to render",
+			footer: "{{.Missing}}",
+			err:    true,
+		},
+	}
+	for _, tc := range cases {
+		commenter, err := WithHeaderFooter(MakeCommenter("hello", false), tc.header, tc.footer)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		actual, err := commenter(m)
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.err {
+			t.Errorf("%s: failed to receive an error", tc.name)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+	if _, err := WithHeaderFooter(MakeCommenter("hello", false), "{{", ""); err == nil {
+		t.Error("failed to reject a bad header")
+	}
+}
+
+func TestSpamReason(t *testing.T) {
+	spammers := map[string]bool{"spammer": true}
+	cases := []struct {
+		user github.User
+		spam bool
+	}{
+		{user: github.User{Login: "Spammer"}, spam: true},
+		{user: github.User{Login: "alice", Email: "alice@Spam.example"}, spam: true},
+		{user: github.User{Login: "bob", Email: "bob@mail.spam.example"}, spam: true},
+		{user: github.User{Login: "carol", Email: "carol@notspam.example"}},
+		{user: github.User{Login: "dave"}},
+	}
+	for _, tc := range cases {
+		if reason := spamReason(tc.user, spammers, "spam.example"); (reason != "") != tc.spam {
+			t.Errorf("%s <%s>: expected spam=%t, got %q", tc.user.Login, tc.user.Email, tc.spam, reason)
+		}
+	}
+}
+
+func TestRunSpamUserListIsReread(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spam-users.txt")
+	issue := func(number int, login string) github.Issue {
+		i := makeIssue("o", "r", number, "spam")
+		i.User.Login = login
+		return i
+	}
+	c := fakeClient{issues: []github.Issue{issue(1, "alice"), issue(2, "spammer"), issue(3, "bob")}}
+	o := Options{
+		Searches:      unscoped("spam"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hi", false),
+		SpamUserList:  path,
+	}
+	for n, spammers := range []string{"spammer\n", "# updated\nspammer\nbob\n"} {
+		if err := os.WriteFile(path, []byte(spammers), 0644); err != nil {
+			t.Fatal(err)
+		}
+		c.comments = nil
+		res, err := Run(context.Background(), &c, o)
+		if err != nil {
+			t.Fatalf("run %d: unexpected error: %v", n, err)
+		}
+		if expected := [][]int{{1, 3}, {1}}[n]; !reflect.DeepEqual(c.comments, expected) {
+			t.Errorf("run %d: expected comments on %v, got %v", n, expected, c.comments)
+		}
+		if res.Skipped != n+1 {
+			t.Errorf("run %d: expected %d skipped issues, got %d", n, n+1, res.Skipped)
+		}
+	}
+}
+
+func TestRunRequireWriteAccess(t *testing.T) {
+	push := github.FullRepo{Repo: github.Repo{Permissions: github.RepoPermissions{Push: true}}}
+	admin := github.FullRepo{Repo: github.Repo{Permissions: github.RepoPermissions{Admin: true}}}
+	pull := github.FullRepo{Repo: github.Repo{Permissions: github.RepoPermissions{Pull: true}}}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "push", 1, "write"),
+			makeIssue("o", "pull", 2, "write"),
+			makeIssue("o", "push", 3, "write"),
+			makeIssue("o", "admin", 4, "write"),
+			makeIssue("o", "pull", 5, "write"),
+			makeIssue("o", "missing", 6, "write"),
+		},
+		repos: map[string]github.FullRepo{
+			"o/push":  push,
+			"o/admin": admin,
+			"o/pull":  pull,
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:           unscoped("write"),
+		SamplePercent:      100,
+		Ceiling:            3,
+		Commenter:          MakeCommenter("hello", false),
+		RequireWriteAccess: true,
+	}))
+	if err == nil {
+		t.Error("failed to report the repo that could not be fetched")
+	}
+	if expected := []int{1, 3, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if expected := []string{"o/push", "o/pull", "o/admin", "o/missing"}; !reflect.DeepEqual(c.getRepos, expected) {
+		t.Errorf("expected each repo to be checked once %v, got %v", expected, c.getRepos)
+	}
+}
+
+func TestRunRepoThresholds(t *testing.T) {
+	repo := func(stars, watchers, forks int) github.FullRepo {
+		r := github.FullRepo{SubscribersCount: watchers}
+		r.StargazersCount = stars
+		r.ForksCount = forks
+		return r
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "popular", 1, "visible"),
+			makeIssue("o", "unstarred", 2, "visible"),
+			makeIssue("o", "unwatched", 3, "visible"),
+			makeIssue("o", "popular", 4, "visible"),
+			makeIssue("o", "unforked", 5, "visible"),
+			makeIssue("o", "missing", 6, "visible"),
+		},
+		repos: map[string]github.FullRepo{
+			"o/popular":   repo(100, 10, 20),
+			"o/unstarred": repo(99, 10, 20),
+			"o/unwatched": repo(100, 9, 20),
+			"o/unforked":  repo(100, 10, 19),
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("visible"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+		MinRepo:       RepoThresholds{Stars: 100, Watchers: 10, Forks: 20},
+	}))
+	if err == nil {
+		t.Error("failed to report the repo that could not be fetched")
+	}
+	if expected := []int{1, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if expected := []string{"o/popular", "o/unstarred", "o/unwatched", "o/unforked", "o/missing"}; !reflect.DeepEqual(c.getRepos, expected) {
+		t.Errorf("expected each repo to be checked once %v, got %v", expected, c.getRepos)
+	}
+}
+
+func TestFilterAuthorAge(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	c := fakeClient{
+		signedUp: map[string]time.Time{
+			"newbie":  now.Add(-2 * day),
+			"regular": now.Add(-400 * day),
+			"veteran": now.Add(-3000 * day),
+		},
+	}
+	by := func(number int, login string) github.Issue {
+		i := makeIssue("o", "r", number, "")
+		i.User.Login = login
+		return i
+	}
+	issues := []github.Issue{by(1, "newbie"), by(2, "regular"), by(3, "Regular"), by(4, "veteran"), by(5, "ghost"), by(6, "ghost")}
+	cases := []struct {
+		name     string
+		min, max time.Duration
+		expected []int
+	}{
+		{
+			name:     "new accounts",
+			max:      30 * day,
+			expected: []int{1},
+		},
+		{
+			name:     "established accounts",
+			min:      30 * day,
+			expected: []int{2, 3, 4},
+		},
+		{
+			name:     "both bounds",
+			min:      30 * day,
+			max:      5 * 365 * day,
+			expected: []int{2, 3},
+		},
+	}
+	for _, tc := range cases {
+		c.userLookups = nil
+		kept, problems := filterAuthorAge(context.Background(), &c, issues, tc.min, tc.max, now, log.Default())
+		var numbers []int
+		for _, i := range kept {
+			ref, _ := ParseHTMLURL(i.HTMLURL)
+			numbers = append(numbers, ref.Number)
+		}
+		if !reflect.DeepEqual(numbers, tc.expected) {
+			t.Errorf("%s: expected to keep %v, got %v", tc.name, tc.expected, numbers)
+		}
+		if len(problems) != 1 {
+			t.Errorf("%s: expected the missing user to be reported once, got %v", tc.name, problems)
+		}
+		if expected := []string{"newbie", "regular", "veteran", "ghost"}; !reflect.DeepEqual(c.userLookups, expected) {
+			t.Errorf("%s: expected each author to be looked up once %v, got %v", tc.name, expected, c.userLookups)
+		}
+	}
+}
+
+// slowClient tracks how many comments are created concurrently.
+type slowClient struct {
+	fakeClient
+	inflight    int
+	maxInflight int
+}
+
+func (c *slowClient) CreateComment(owner, repo string, number int, comment string) error {
+	c.Lock()
+	c.inflight++
+	if c.inflight > c.maxInflight {
+		c.maxInflight = c.inflight
+	}
+	c.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.Lock()
+	c.inflight--
+	c.Unlock()
+	return c.fakeClient.CreateComment(owner, repo, number, comment)
+}
+
+func TestRunWorkers(t *testing.T) {
+	issues := []github.Issue{}
+	for i := 0; i < 40; i++ {
+		issues = append(issues, makeIssue("o", "r", i, "pool "+strconv.Itoa(i)))
+	}
+
+	cases := []struct {
+		name     string
+		workers  int
+		ceiling  int
+		expected int
+	}{
+		{
+			name:     "single worker",
+			workers:  1,
+			expected: 40,
+		},
+		{
+			name:     "many workers",
+			workers:  8,
+			expected: 40,
+		},
+		{
+			name:     "ceiling holds under concurrency",
+			workers:  8,
+			ceiling:  5,
+			expected: 5,
+		},
+		{
+			name:     "more workers than issues allowed by the ceiling",
+			workers:  16,
+			ceiling:  3,
+			expected: 3,
+		},
+	}
+
+	for _, tc := range cases {
+		c := slowClient{fakeClient: fakeClient{issues: issues}}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("pool"),
+			SamplePercent: 100,
+			Ceiling:       tc.ceiling,
+			Workers:       tc.workers,
+			Commenter:     MakeCommenter("hello", false),
+		}))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if len(c.comments) != tc.expected {
+			t.Errorf("%s: expected %d comments, got %d", tc.name, tc.expected, len(c.comments))
+		}
+		if c.maxInflight > tc.workers {
+			t.Errorf("%s: %d comments in flight exceeds %d workers", tc.name, c.maxInflight, tc.workers)
+		}
+	}
+}
+
+// sleepyClient takes sleep to create each comment.
+type sleepyClient struct {
+	fakeClient
+	sleep time.Duration
+}
+
+func (c *sleepyClient) CreateComment(owner, repo string, number int, comment string) error {
+	time.Sleep(c.sleep)
+	return c.fakeClient.CreateComment(owner, repo, number, comment)
+}
+
+func TestRunMaxDuration(t *testing.T) {
+	issues := []github.Issue{makeIssue("o", "r", 1, "slow"), makeIssue("o", "r", 2, "slow"), makeIssue("o", "r", 3, "slow")}
+	cases := []struct {
+		name    string
+		sleep   time.Duration
+		delay   time.Duration
+		timeout time.Duration
+	}{
+		{
+			name:    "comment in flight is finished",
+			sleep:   100 * time.Millisecond,
+			timeout: 20 * time.Millisecond,
+		},
+		{
+			name:    "delay is cut short",
+			delay:   time.Minute,
+			timeout: 20 * time.Millisecond,
+		},
+	}
+	for _, tc := range cases {
+		c := sleepyClient{fakeClient: fakeClient{issues: issues}, sleep: tc.sleep}
+		ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+		start := time.Now()
+		res, err := Run(ctx, &c, Options{
+			Searches:      unscoped("slow"),
+			SamplePercent: 100,
+			Delay:         tc.delay,
+			Commenter:     MakeCommenter("hello", false),
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%s: took %s despite the deadline", tc.name, elapsed)
+		}
+		if expected := []int{1}; !reflect.DeepEqual(c.comments, expected) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, expected, c.comments)
+		}
+		if len(res.Problems) != 1 || !strings.Contains(res.Problems[0], "2 of 3 issues left unprocessed") {
+			t.Errorf("%s: expected the unprocessed issues to be reported, got %v", tc.name, res.Problems)
+		}
+	}
+}
+
+// blockingClient blocks creating each comment until ctx is done, like a
+// request in flight when the job is interrupted.
+type blockingClient struct {
+	fakeClient
+	ctx     context.Context
+	started chan struct{}
+	once    sync.Once
+}
+
+func (c *blockingClient) CreateComment(owner, repo string, number int, comment string) error {
+	c.once.Do(func() { close(c.started) })
+	<-c.ctx.Done()
+	return c.fakeClient.CreateComment(owner, repo, number, comment)
+}
+
+func TestRunInterrupted(t *testing.T) {
+	issues := []github.Issue{makeIssue("o", "r", 1, "slow"), makeIssue("o", "r", 2, "slow"), makeIssue("o", "r", 3, "slow")}
+	cases := []struct {
+		name     string
+		outages  map[int]int
+		comments []int
+		problem  string
+	}{
+		{
+			name:     "comment in flight is finished and the delay cut short",
+			comments: []int{1},
+			problem:  "2 of 3 issues left unprocessed: context canceled",
+		},
+		{
+			name:    "retry is not waited for",
+			outages: map[int]int{1: 1},
+			problem: "after 0 retries, stopped early: context canceled",
+		},
+	}
+	for _, tc := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		c := blockingClient{fakeClient: fakeClient{issues: issues, outages: tc.outages}, ctx: ctx, started: make(chan struct{})}
+		go func() {
+			<-c.started
+			cancel()
+		}()
+		start := time.Now()
+		res, err := Run(ctx, &c, Options{
+			Searches:      unscoped("slow"),
+			SamplePercent: 100,
+			Delay:         time.Hour,
+			Retries:       3,
+			RetryDelay:    time.Hour,
+			Commenter:     MakeCommenter("hello", false),
+		})
+		cancel()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("%s: took %s despite the cancellation", tc.name, elapsed)
+		}
+		if !reflect.DeepEqual(c.comments, tc.comments) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, tc.comments, c.comments)
+		}
+		if !strings.Contains(strings.Join(res.Problems, "\n"), tc.problem) {
+			t.Errorf("%s: expected a problem containing %q, got %v", tc.name, tc.problem, res.Problems)
+		}
+	}
+}
+
+func TestRunWorkersSortsProblems(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "error", 3, "sorted c"),
+		makeIssue("o", "error", 1, "sorted a"),
+		makeIssue("o", "error", 2, "sorted b"),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("sorted"),
+		SamplePercent: 100,
+		Workers:       3,
+		Commenter:     MakeCommenter("hello", false),
+	}))
+	if err == nil {
+		t.Fatal("failed to receive an error")
+	}
+	expected := "encoutered 3 failures: [Failed to apply comment to o/error#1: hello Failed to apply comment to o/error#2: hello Failed to apply comment to o/error#3: hello]"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestCeilingBudget(t *testing.T) {
+	b := newCeilingBudget(2)
+	if !b.reserve() || !b.reserve() {
+		t.Fatal("failed to reserve slots below the limit")
+	}
+	b.release(false)
+	if !b.reserve() {
+		t.Fatal("failed to reuse a slot that was released unused")
+	}
+	b.release(true)
+	b.release(true)
+	if b.reserve() {
+		t.Error("reserved a slot beyond the limit")
+	}
+
+	unlimited := newCeilingBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.reserve() {
+			t.Fatal("unlimited budget ran out")
+		}
+		unlimited.release(true)
+	}
+}
+
+func makePR(owner, repo string, number int, title string) github.Issue {
+	i := makeIssue(owner, repo, number, title)
+	i.HTMLURL = fmt.Sprintf("fake://localhost/%s/%s/pull/%d", owner, repo, number)
+	i.PullRequest = &struct{}{}
+	return i
+}
+
+func TestRunOnlyConflicted(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "conflict issue"),
+			makePR("o", "r", 2, "conflict clean"),
+			makePR("o", "r", 3, "conflict dirty"),
+			makePR("o", "r", 4, "conflict missing"),
+			makePR("o", "r", 5, "conflict dirty too"),
+		},
+		prs: map[int]github.PullRequest{
+			2: {MergeableState: "clean"},
+			3: {MergeableState: "dirty", Base: github.PullRequestBranch{Ref: "main"}},
+			5: {MergeableState: "dirty", Base: github.PullRequestBranch{Ref: "main"}},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("conflict"),
+		SamplePercent: 100,
+		Ceiling:       3,
+		Commenter:     MakeCommenter("#{{.Number}} is {{.PR.MergeableState}} against {{.PR.Base.Ref}}", true),
+		PullRequests: PRFilterOptions{
+			OnlyConflicted: true,
+		},
+	}))
+	if err == nil {
+		t.Error("failed to report the pull request that could not be fetched")
+	}
+	if expected := []int{3, 5}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunWithoutComment(t *testing.T) {
+	for _, confirm := range []bool{false, true} {
+		c := fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "relabel"), makeIssue("o", "r", 2, "relabel")}}
+		var logs bytes.Buffer
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("relabel"),
+			SamplePercent: 100,
+			AddLabels:     []string{"lifecycle/frozen"},
+			Close:         true,
+			Confirm:       confirm,
+			Logger:        log.New(&logs, "", 0),
+		})
+		if err := runErr(res, err); err != nil {
+			t.Fatalf("confirm=%t: unexpected error: %v", confirm, err)
+		}
+		if len(c.comments) != 0 || len(c.bodies) != 0 {
+			t.Errorf("confirm=%t: expected no comments, got %v", confirm, c.bodies)
+		}
+		if expected := []string{"o/r#1:lifecycle/frozen", "o/r#2:lifecycle/frozen"}; !reflect.DeepEqual(c.addedLabels, expected) {
+			t.Errorf("confirm=%t: expected labels %v, got %v", confirm, expected, c.addedLabels)
+		}
+		if expected := []int{1, 2}; !reflect.DeepEqual(c.closed, expected) {
+			t.Errorf("confirm=%t: expected %v closed, got %v", confirm, expected, c.closed)
+		}
+		verb := "Would apply"
+		if confirm {
+			verb = "Applying"
+		}
+		expected := verb + " to fake://localhost/o/r/issues/1 without a comment: add labels lifecycle/frozen, then close"
+		if !strings.Contains(logs.String(), expected) || strings.Contains(logs.String(), "Commented on") {
+			t.Errorf("confirm=%t: expected the actions logged as %q, got:\n%s", confirm, expected, logs.String())
+		}
+	}
+}
+
+func TestRunIgnoreMarker(t *testing.T) {
+	const marker = "<!-- commenter: ignore -->"
+	withBody := func(i github.Issue, body string) github.Issue {
+		i.Body = body
+		return i
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			withBody(makeIssue("o", "r", 1, "optout"), "Flaky test\n"+marker),
+			withBody(makeIssue("o", "r", 2, "optout"), "Flaky test"),
+			// Left out of the search payload.
+			makeIssue("o", "r", 3, "optout"),
+			makeIssue("o", "r", 4, "optout"),
+		},
+		current: map[int]github.Issue{
+			3: withBody(makeIssue("o", "r", 3, "optout"), marker+" until the next release"),
+			4: makeIssue("o", "r", 4, "optout"),
+		},
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("optout"),
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("hi", false),
+		IgnoreMarker:  marker,
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{2, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v without the opted out issues taking up the ceiling, got %v", expected, c.comments)
+	}
+	if res.Skipped != 2 {
+		t.Errorf("expected both opted out issues skipped, got %+v", res)
+	}
+	if n := strings.Count(logs.String(), "body opts out with "+marker); n != 2 {
+		t.Errorf("expected both opted out issues logged, got %d in:\n%s", n, logs.String())
+	}
+}
+
+func TestRunFetchPRDetails(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "details issue"),
+			makePR("o", "r", 2, "details pr"),
+		},
+		prs: map[int]github.PullRequest{
+			2: {
+				Head:              github.PullRequestBranch{Ref: "fix-flake"},
+				Base:              github.PullRequestBranch{Ref: "main"},
+				AuthorAssociation: "FIRST_TIME_CONTRIBUTOR",
+			},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:       unscoped("details"),
+		SamplePercent:  100,
+		Commenter:      MakeCommenter("{{if .IsPR}}Thanks for {{.PR.Head.Ref}} into {{.PR.Base.Ref}}, {{.PR.AuthorAssociation}}!{{else}}Issue #{{.Number}} needs triage.{{end}}", true),
+		FetchPRDetails: true,
+	}))
+	if err != nil {
+		// Issue #1 has no pull request to fetch, so fails if fetched anyway.
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"Issue #1 needs triage.",
+		"Thanks for fix-flake into main, FIRST_TIME_CONTRIBUTOR!",
+	}
+	if !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+}
+
+// failingGetClient fails to get the issues in failing.
+type failingGetClient struct {
+	fakeClient
+	failing map[int]bool
+}
+
+func (c *failingGetClient) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	if c.failing[number] {
+		return nil, errors.New("injected get error")
+	}
+	return c.fakeClient.GetIssue(org, repo, number)
+}
+
+func TestRunFetchFullIssue(t *testing.T) {
+	fresh := makeIssue("o", "r", 1, "full")
+	fresh.Assignees = []github.User{{Login: "alice"}}
+	c := failingGetClient{
+		fakeClient: fakeClient{
+			issues:  []github.Issue{makeIssue("o", "r", 1, "full"), makeIssue("o", "r", 2, "full"), makeIssue("o", "r", 3, "full")},
+			current: map[int]github.Issue{1: fresh},
+		},
+		failing: map[int]bool{2: true},
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:       unscoped("full"),
+		SamplePercent:  100,
+		Ceiling:        2,
+		Commenter:      MakeCommenter("Assigned to{{range .Issue.Assignees}} {{.Login}}{{end}}", true),
+		FetchFullIssue: true,
+		Logger:         log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"Assigned to alice"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+	// The issue that failed to be fetched is not commented on with what the
+	// search returned.
+	if res.Failed != 1 || len(res.Problems) != 1 {
+		t.Errorf("expected a single failure, got %+v", res)
+	}
+	// The issue past the ceiling is not fetched.
+	if line := "Made 2 API calls for --fetch-full-issue"; !strings.Contains(logs.String(), line) {
+		t.Errorf("expected %q in logs:\n%s", line, logs.String())
+	}
+}
+
+func TestRunIsPR(t *testing.T) {
+	// Some clients only tell pull requests apart by their URL.
+	byURL := makePR("o", "r", 3, "kind by url")
+	byURL.PullRequest = nil
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "kind issue"),
+			makePR("o", "r", 2, "kind pr"),
+			byURL,
+		},
+	}
+	var logs bytes.Buffer
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("kind"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("Thanks for {{if .IsPR}}this pull request{{else}}this issue{{end}}!", true),
+		Logger:        log.New(&logs, "", 0),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"Thanks for this issue!", "Thanks for this pull request!", "Thanks for this pull request!"}
+	if !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+	for _, line := range []string{
+		"Matched issue fake://localhost/o/r/issues/1 (kind issue)",
+		"Matched pull request fake://localhost/o/r/pull/2 (kind pr)",
+		"Matched pull request fake://localhost/o/r/pull/3 (kind by url)",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("expected %q in logs:\n%s", line, logs.String())
+		}
+	}
+}
+
+// computingClient returns pull requests without their mergeability until
+// they were fetched computing times, like GitHub while it computes it.
+type computingClient struct {
+	fakeClient
+	computing map[int]int
+	fetches   map[int]int
+}
+
+func (c *computingClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	c.fetches[number]++
+	pr, err := c.fakeClient.GetPullRequest(org, repo, number)
+	if err == nil && c.fetches[number] <= c.computing[number] {
+		pr.Mergable = nil
+	}
+	return pr, err
+}
+
+func TestRunPRMergeable(t *testing.T) {
+	mergeable := func(m bool) github.PullRequest {
+		return github.PullRequest{Mergable: &m, Base: github.PullRequestBranch{Ref: "main"}}
+	}
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "rebase issue"),
+		makePR("o", "r", 2, "rebase clean"),
+		makePR("o", "r", 3, "rebase conflicted"),
+		makePR("o", "r", 4, "rebase computed late"),
+		makePR("o", "r", 5, "rebase never computed"),
+	}
+	prs := map[int]github.PullRequest{2: mergeable(true), 3: mergeable(false), 4: mergeable(false), 5: mergeable(false)}
+	cases := []struct {
+		mergeable bool
+		comments  []int
+	}{
+		{mergeable: false, comments: []int{3, 4}},
+		{mergeable: true, comments: []int{2}},
+	}
+	for _, tc := range cases {
+		c := computingClient{
+			fakeClient: fakeClient{issues: issues, prs: prs},
+			computing:  map[int]int{4: 1, 5: 2},
+			fetches:    map[int]int{},
+		}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("rebase"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("#{{.Number}} conflicts with {{.PR.Base.Ref}}, please rebase", true),
+			PullRequests: PRFilterOptions{
+				Mergeable:      &tc.mergeable,
+				MergeableDelay: time.Millisecond,
+			},
+		})
+		if err != nil {
+			t.Fatalf("mergeable=%t: unexpected error: %v", tc.mergeable, err)
+		}
+		if !reflect.DeepEqual(c.comments, tc.comments) {
+			t.Errorf("mergeable=%t: expected comments on %v, got %v", tc.mergeable, tc.comments, c.comments)
+		}
+		if expected := map[int]int{2: 1, 3: 1, 4: 2, 5: 2}; !reflect.DeepEqual(c.fetches, expected) {
+			t.Errorf("mergeable=%t: expected only unknown mergeability fetched again, once, got %v", tc.mergeable, c.fetches)
+		}
+		if res.Skipped != 5-len(tc.comments) {
+			t.Errorf("mergeable=%t: expected the rest skipped, got %+v", tc.mergeable, res)
+		}
+		if expected := fmt.Sprintf("#%d conflicts with main, please rebase", tc.comments[0]); c.bodies[0] != expected {
+			t.Errorf("mergeable=%t: expected the comment %q, got %q", tc.mergeable, expected, c.bodies[0])
+		}
+	}
+}
+
+func TestRunSkipDrafts(t *testing.T) {
+	draft := func(i github.Issue, d bool) github.Issue {
+		i.Draft = &d
+		return i
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			// Plain issues are never fetched as pull requests.
+			makeIssue("o", "r", 1, "draft issue"),
+			draft(makePR("o", "r", 2, "draft searched"), true),
+			draft(makePR("o", "r", 3, "draft searched ready"), false),
+			makePR("o", "r", 4, "draft fetched"),
+			makePR("o", "r", 5, "draft fetched ready"),
+			makePR("o", "r", 6, "draft missing"),
+		},
+		prs: map[int]github.PullRequest{
+			// Ignored for the search results that carry the flag.
+			2: {Draft: false},
+			3: {Draft: true},
+			4: {Draft: true},
+			5: {Draft: false},
+		},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("draft"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hi", false),
+		PullRequests: PRFilterOptions{
+			SkipDrafts: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, 3, 5}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if res.Skipped != 2 || len(res.Problems) != 1 || !strings.Contains(res.Problems[0], "o/r#6") {
+		t.Errorf("expected both drafts skipped and the missing pull request reported, got %+v", res)
+	}
+}
+
+func TestRunCommitCount(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "squash issue"),
+			makePR("o", "r", 2, "squash one"),
+			makePR("o", "r", 3, "squash three"),
+			makePR("o", "r", 4, "squash missing"),
+			makePR("o", "r", 5, "squash ten"),
+		},
+		prs: map[int]github.PullRequest{
+			2: {Commits: 1},
+			3: {Commits: 3},
+			5: {Commits: 10},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("squash"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("#{{.Number}} has {{.PR.Commits}} commits", true),
+		PullRequests: PRFilterOptions{
+			MinCommits: 2,
+			MaxCommits: 5,
+		},
+	}))
+	if err == nil {
+		t.Error("failed to report the pull request that could not be fetched")
+	}
+	if expected := []int{3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestCountReviews(t *testing.T) {
+	reviews := []github.Review{
+		{State: github.ReviewStateApproved},
+		{State: github.ReviewStateCommented},
+		{State: github.ReviewStatePending},
+		{State: github.ReviewStateApproved},
+	}
+	cases := []struct {
+		state    github.ReviewState
+		expected int
+	}{
+		{expected: 3},
+		{state: github.ReviewStateApproved, expected: 2},
+		{state: github.ReviewStateChangesRequested},
+	}
+	for _, tc := range cases {
+		if n := countReviews(reviews, tc.state); n != tc.expected {
+			t.Errorf("%q: expected %d reviews, got %d", tc.state, tc.expected, n)
+		}
+	}
+}
+
+func TestIssueRef(t *testing.T) {
+	cases := []struct {
+		name     string
+		issue    github.Issue
+		expected IssueRef
+		fromURL  bool
+		err      bool
+	}{
+		{
+			name:     "repository in the API response",
+			issue:    github.Issue{Number: 5, RepositoryURL: "https://api.github.com/repos/new-org/new.repo", HTMLURL: "https://github.com/old-org/old-repo/issues/5"},
+			expected: IssueRef{Org: "new-org", Repo: "new.repo", Number: 5},
+		},
+		{
+			name:     "enterprise API",
+			issue:    github.Issue{Number: 6, RepositoryURL: "https://git.corp.example.com/api/v3/repos/org/repo", PullRequest: &struct{}{}},
+			expected: IssueRef{Org: "org", Repo: "repo", Number: 6, IsPR: true},
+		},
+		{
+			name:     "falls back to the URL without a repository",
+			issue:    github.Issue{Number: 7, HTMLURL: "https://github.com/org/repo/pull/7"},
+			expected: IssueRef{Org: "org", Repo: "repo", Number: 7, IsPR: true},
+			fromURL:  true,
+		},
+		{
+			name:     "falls back to the URL with an unexpected repository URL",
+			issue:    github.Issue{Number: 8, RepositoryURL: "https://github.com/org/repo", HTMLURL: "https://github.com/org/repo/issues/8"},
+			expected: IssueRef{Org: "org", Repo: "repo", Number: 8},
+			fromURL:  true,
+		},
+		{
+			name:     "falls back to the URL without a number",
+			issue:    github.Issue{RepositoryURL: "https://api.github.com/repos/org/repo", HTMLURL: "https://github.com/org/repo/issues/9"},
+			expected: IssueRef{Org: "org", Repo: "repo", Number: 9},
+			fromURL:  true,
+		},
+		{
+			name:    "neither",
+			issue:   github.Issue{Number: 10, HTMLURL: "https://github.com/org"},
+			fromURL: true,
+			err:     true,
+		},
+	}
+	for _, tc := range cases {
+		ref, fromURL, err := issueRef(tc.issue)
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.err {
+			t.Errorf("%s: failed to produce an error", tc.name)
+		}
+		if ref != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, ref)
+		}
+		if fromURL != tc.fromURL {
+			t.Errorf("%s: expected fromURL %t, got %t", tc.name, tc.fromURL, fromURL)
+		}
+	}
+}
+
+func TestRunTransferredIssue(t *testing.T) {
+	// The search result still has the HTML URL from before the transfer.
+	i := makeIssue("old", "repo", 5, "moved")
+	i.Number = 5
+	i.RepositoryURL = "https://api.github.com/repos/new/repo"
+	c := fakeClient{issues: []github.Issue{i}}
+	var logs bytes.Buffer
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("moved"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("{{.Org}}/{{.Repo}}#{{.Number}}", true),
+		AddLabels:     []string{"moved"},
+		Logger:        log.New(&logs, "", 0),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"new/repo#5"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %v, got %v", expected, c.bodies)
+	}
+	if expected := []string{"new/repo#5:moved"}; !reflect.DeepEqual(c.addedLabels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.addedLabels)
+	}
+	if strings.Contains(logs.String(), "by its URL") {
+		t.Errorf("expected the API response to be used, got logs:\n%s", logs.String())
+	}
+}
+
+func TestRunLogsURLFallback(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "fallback")}}
+	var logs bytes.Buffer
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("fallback"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Logger:        log.New(&logs, "", 0),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Identified fake://localhost/o/r/issues/1 as o/r#1 by its URL") {
+		t.Errorf("expected the fallback to be logged, got:\n%s", logs.String())
+	}
+}
+
+func TestParseIssueRef(t *testing.T) {
+	if ref, err := ParseIssueRef("kubernetes/test-infra#123"); err != nil || ref != (IssueRef{Org: "kubernetes", Repo: "test-infra", Number: 123}) {
+		t.Errorf("expected kubernetes/test-infra#123, got %v, %v", ref, err)
+	}
+	for _, bad := range []string{"", "#1", "o#1", "o/r", "o/r#", "o/r#x", "o/r#0", "o/r/x#1", "/r#1"} {
+		if ref, err := ParseIssueRef(bad); err == nil {
+			t.Errorf("%q: expected an error, got %v", bad, ref)
+		}
+	}
+}
+
+func TestClosedIssues(t *testing.T) {
+	pr := IssueRef{Org: "o", Repo: "r", Number: 10}
+	body := `Fixes #1
+closes: other/repo#2
+This RESOLVED https://github.com/o/r/issues/3 and resolves o/r#12345.
+Not fixing #4, see #5, prefixes #6 and closes#7.`
+	expected := []IssueRef{
+		{Org: "o", Repo: "r", Number: 1},
+		{Org: "other", Repo: "repo", Number: 2},
+		{Org: "o", Repo: "r", Number: 3},
+		{Org: "o", Repo: "r", Number: 12345},
+	}
+	if actual := closedIssues(body, pr); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if !closesIssue("fixes O/R#1", pr, IssueRef{Org: "o", Repo: "r", Number: 1}) {
+		t.Error("expected the org and repo to be compared ignoring case")
+	}
+}
+
+func TestRunPRClosesIssue(t *testing.T) {
+	withBody := func(i github.Issue, body string) github.Issue {
+		i.Body = body
+		return i
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			withBody(makePR("o", "r", 1, "closes"), "Fixes #100"),
+			withBody(makePR("o", "other", 2, "closes"), "Fixes #100"),
+			withBody(makePR("o", "other", 3, "closes"), "Resolves o/r#100"),
+			withBody(makePR("o", "r", 4, "closes"), "Refs #100"),
+			withBody(makeIssue("o", "r", 5, "closes"), "Fixes #100"),
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("closes"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		ClosesIssue:   &IssueRef{Org: "o", Repo: "r", Number: 100},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRecentActivity(t *testing.T) {
+	now := time.Date(2023, 6, 10, 0, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	event := func(action github.IssueEventAction, at time.Time) github.ListedIssueEvent {
+		return github.ListedIssueEvent{Event: action, CreatedAt: at, Label: github.Label{Name: "bug"}, Assignee: github.User{Login: "alice"}}
+	}
+	c := fakeClient{
+		existing: map[int][]github.IssueComment{
+			1: {{CreatedAt: ago(48 * time.Hour), User: github.User{Login: "bob"}}},
+		},
+		events: map[int][]github.ListedIssueEvent{
+			1: {
+				event(github.IssueActionLabeled, ago(72*time.Hour)),
+				event(github.IssueActionUnassigned, ago(12*time.Hour)),
+				event(github.IssueActionClosed, ago(time.Hour)),
+			},
+		},
+	}
+	cases := []struct {
+		name    string
+		windows QuietWindows
+		recent  string
+	}{
+		{
+			name:    "quiet",
+			windows: QuietWindows{Comment: 24 * time.Hour, Label: 48 * time.Hour, Assignment: 6 * time.Hour},
+		},
+		{
+			name:    "recent comment",
+			windows: QuietWindows{Comment: 72 * time.Hour},
+			recent:  "bob commented 48h0m0s ago, within 72h0m0s",
+		},
+		{
+			name:    "recent label change",
+			windows: QuietWindows{Label: 96 * time.Hour},
+			recent:  "label bug was labeled 72h0m0s ago, within 96h0m0s",
+		},
+		{
+			name:    "recent assignment change",
+			windows: QuietWindows{Assignment: 24 * time.Hour},
+			recent:  "alice was unassigned 12h0m0s ago, within 24h0m0s",
+		},
+	}
+	for _, tc := range cases {
+		h := &issueHistory{c: &c, ref: IssueRef{Org: "o", Repo: "r", Number: 1}}
+		recent, err := recentActivity(h, tc.windows, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if recent != tc.recent {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.recent, recent)
+		}
+	}
+
+	c.eventLists = 0
+	h := &issueHistory{c: &c, ref: IssueRef{Org: "o", Repo: "r", Number: 1}}
+	for n := 0; n < 2; n++ {
+		if _, err := recentActivity(h, QuietWindows{Label: time.Hour, Assignment: time.Hour}, now); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if c.eventLists != 1 {
+		t.Errorf("expected the events to be listed once, listed %d times", c.eventLists)
+	}
+}
+
+func TestRunQuiet(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "quiet"),
+			makeIssue("o", "r", 2, "quiet"),
+			makeIssue("o", "error", 3, "quiet"),
+		},
+		events: map[int][]github.ListedIssueEvent{
+			2: {{Event: github.IssueActionLabeled, CreatedAt: time.Now()}},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("quiet"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Quiet:         QuietWindows{Label: time.Hour},
+	}))
+	if err == nil {
+		t.Error("failed to report the events that could not be listed")
+	}
+	if expected := []int{1}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunKind(t *testing.T) {
+	pr := makePR("o", "r", 1, "kind")
+	issue := makeIssue("o", "r", 2, "kind")
+	// Only the URL tells that this one is a pull request.
+	unmarked := makePR("o", "r", 3, "kind")
+	unmarked.PullRequest = nil
+	for _, tc := range []struct {
+		kind     IssueKind
+		expected []int
+	}{
+		{kind: AnyKind, expected: []int{1, 2, 3}},
+		{kind: OnlyIssues, expected: []int{2}},
+		{kind: OnlyPRs, expected: []int{1, 3}},
+	} {
+		c := fakeClient{issues: []github.Issue{pr, issue, unmarked}}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("kind"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("ping", false),
+			Kind:          tc.kind,
+		})
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tc.kind, err)
+		}
+		if !reflect.DeepEqual(c.comments, tc.expected) {
+			t.Errorf("%q: expected comments on %v, got %v", tc.kind, tc.expected, c.comments)
+		}
+		if res.Skipped != 3-len(tc.expected) {
+			t.Errorf("%q: expected %d skipped, got %d", tc.kind, 3-len(tc.expected), res.Skipped)
+		}
+	}
+}
+
+func TestRunMilestoned(t *testing.T) {
+	milestoned := func(number int, milestone string) github.Issue {
+		i := makeIssue("o", "r", number, "triage")
+		i.Milestone.Title = milestone
+		return i
+	}
+	for _, only := range []bool{false, true} {
+		c := fakeClient{
+			issues: []github.Issue{
+				milestoned(1, "v1.0"),
+				milestoned(2, ""),
+				milestoned(3, ""),
+			},
+			// The search result for #3 left out its milestone.
+			current: map[int]github.Issue{3: milestoned(3, "v1.1")},
+		}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("triage"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("ping", false),
+			Milestoned:    &only,
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := []int{2}
+		if only {
+			expected = []int{1, 3}
+		}
+		if !reflect.DeepEqual(c.comments, expected) {
+			t.Errorf("only %t: expected comments on %v, got %v", only, expected, c.comments)
+		}
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	for title, expected := range map[string]string{
+		"Flaky test: TestFoo":        "flaky test testfoo",
+		"  flaky   TEST -- testfoo!": "flaky test testfoo",
+		"...":                        "",
+	} {
+		if actual := normalizeTitle(title); actual != expected {
+			t.Errorf("%q: expected %q, got %q", title, expected, actual)
+		}
+	}
+}
+
+func TestRunSkipsCrossRepoDuplicates(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "a", 1, "Bump Go to 1.21"),
+			makeIssue("o", "b", 2, "bump go to 1.21!"),
+			makeIssue("o", "a", 3, "Bump Go to 1.21."),
+			makeIssue("o", "b", 4, "Bump Go to 1.22"),
+			makeIssue("o", "error", 5, "Drop Python 2"),
+			makeIssue("o", "c", 6, "drop python 2"),
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:                unscoped(""),
+		SamplePercent:           100,
+		Commenter:               MakeCommenter("ping", false),
+		SkipCrossRepoDuplicates: true,
+	}))
+	if err == nil {
+		t.Error("failed to report the failed comment")
+	}
+	// #5 fails to comment, so #6 is the first with its title.
+	if expected := []int{1, 3, 4, 6}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunReviews(t *testing.T) {
+	approved := github.Review{State: github.ReviewStateApproved}
+	commented := github.Review{State: github.ReviewStateCommented}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "review issue"),
+			makePR("o", "r", 2, "review none"),
+			makePR("o", "r", 3, "review commented"),
+			makePR("o", "r", 4, "review approved"),
+			makePR("o", "error", 5, "review error"),
+		},
+		reviews: map[int][]github.Review{
+			3: {commented, commented},
+			4: {commented, approved},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("review"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("#{{.Number}} needs approval", true),
+		PullRequests: PRFilterOptions{
+			Reviews: &ReviewFilter{Max: 0, State: github.ReviewStateApproved},
+		},
+	}))
+	if err == nil {
+		t.Error("failed to report the reviews that could not be listed")
+	}
+	if expected := []int{2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+
+	c.comments = nil
+	if err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("review"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("#{{.Number}} was reviewed", true),
+		PullRequests: PRFilterOptions{
+			Reviews: &ReviewFilter{Min: 2, Max: -1},
+		},
+	})); err == nil {
+		t.Error("failed to report the reviews that could not be listed")
+	}
+	if expected := []int{3, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunDeployment(t *testing.T) {
+	head := func(sha string) github.PullRequest {
+		return github.PullRequest{Head: github.PullRequestBranch{SHA: sha}}
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "deploy issue"),
+			makePR("o", "r", 2, "deploy success"),
+			makePR("o", "r", 3, "deploy failure"),
+			makePR("o", "r", 4, "deploy elsewhere"),
+			makePR("o", "r", 5, "deploy error"),
+			makePR("o", "r", 6, "deploy success too"),
+		},
+		prs: map[int]github.PullRequest{
+			2: head("a"),
+			3: head("b"),
+			4: head("c"),
+			5: head("error"),
+			6: head("d"),
+		},
+		deployments: map[string]string{
+			"a@staging":    "SUCCESS",
+			"b@staging":    "FAILURE",
+			"c@production": "SUCCESS",
+			"d@staging":    "SUCCESS",
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("deploy"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("#{{.Number}} is on staging", true),
+		PullRequests: PRFilterOptions{
+			DeploymentEnvironment: "staging",
+			DeploymentState:       "success",
+		},
+	}))
+	if err == nil {
+		t.Error("failed to report the deployments that could not be fetched")
+	}
+	if expected := []int{2, 6}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunProjectColumn(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "column"),
+			makeIssue("o", "r", 2, "column"),
+			makePR("o", "r", 3, "column"),
+			makeIssue("o", "r", 4, "column"),
+			makeIssue("o", "error", 5, "column"),
+		},
+		projectColumns: map[int][]string{
+			1: {"In Progress"},
+			2: {"Done", "to do"},
+			3: {"To Do"},
+			4: {""},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("column"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+		ProjectColumn: "To Do",
+	}))
+	if err == nil {
+		t.Error("failed to report the project cards that could not be fetched")
+	}
+	if expected := []int{2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunClose(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "stale"),
+			makeIssue("o", "r", 2, "stale"),
+		},
+		existing: map[int][]github.IssueComment{2: {{Body: "closing"}}},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("stale"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("closing", false),
+		Safeguards:    SafeguardOptions{SkipDuplicates: true},
+		AddLabels:     []string{"lifecycle/closed"},
+		Close:         true,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(c.closed, expected) {
+		t.Errorf("expected to close %v, closed %v", expected, c.closed)
+	}
+	if expected := []string{"o/r#1:lifecycle/closed"}; !reflect.DeepEqual(c.addedLabels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.addedLabels)
+	}
+}
+
+func TestCommitCountOutside(t *testing.T) {
+	cases := []struct {
+		name     string
+		n        int
+		min, max int
+		outside  bool
+	}{
+		{name: "no bounds", n: 7},
+		{name: "at the minimum", n: 2, min: 2},
+		{name: "below the minimum", n: 1, min: 2, outside: true},
+		{name: "squash bot", n: 1, max: 1},
+		{name: "above the maximum", n: 2, max: 1, outside: true},
+		{name: "within both", n: 3, min: 2, max: 5},
+	}
+	for _, tc := range cases {
+		if reason := commitCountOutside(tc.n, tc.min, tc.max); (reason != "") != tc.outside {
+			t.Errorf("%s: expected outside=%t, got reason %q", tc.name, tc.outside, reason)
+		}
+	}
+}
+
+func TestChecksNotPassed(t *testing.T) {
+	run := func(name, status, conclusion string) github.CheckRun {
+		return github.CheckRun{Name: name, Status: status, Conclusion: conclusion}
+	}
+	cases := []struct {
+		name     string
+		runs     []github.CheckRun
+		expected string
+	}{
+		{
+			name: "all passed",
+			runs: []github.CheckRun{run("build", "completed", "success"), run("lint", "completed", "success")},
+		},
+		{
+			name: "skipped checks are ignored",
+			runs: []github.CheckRun{run("build", "completed", "success"), run("deploy", "completed", "skipped")},
+		},
+		{
+			name:     "failed check",
+			runs:     []github.CheckRun{run("build", "completed", "success"), run("lint", "completed", "failure")},
+			expected: "check lint concluded failure",
+		},
+		{
+			name:     "running check",
+			runs:     []github.CheckRun{run("build", "in_progress", "")},
+			expected: "check build is in progress",
+		},
+		{
+			name:     "only skipped checks",
+			runs:     []github.CheckRun{run("deploy", "completed", "skipped")},
+			expected: "no checks ran",
+		},
+		{
+			name:     "no checks",
+			expected: "no checks ran",
+		},
+	}
+	for _, tc := range cases {
+		if actual := checksNotPassed(tc.runs); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunAllChecksPassed(t *testing.T) {
+	head := func(sha string) github.PullRequest {
+		return github.PullRequest{Head: github.PullRequestBranch{SHA: sha}}
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "checks issue"),
+			makePR("o", "r", 2, "checks green"),
+			makePR("o", "r", 3, "checks red"),
+			makePR("o", "r", 4, "checks error"),
+		},
+		prs: map[int]github.PullRequest{
+			2: head("a"),
+			3: head("b"),
+			4: head("error"),
+		},
+		checkRuns: map[string][]github.CheckRun{
+			"a": {{Name: "build", Status: "completed", Conclusion: "success"}},
+			"b": {{Name: "build", Status: "completed", Conclusion: "failure"}},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("checks"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("green, please merge", false),
+		PullRequests: PRFilterOptions{
+			AllChecksPassed: true,
+		},
+	}))
+	if err == nil {
+		t.Error("failed to report the check runs that could not be listed")
+	}
+	if expected := []int{2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestAwaitingAuthorResponse(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	issue := github.Issue{User: github.User{Login: "Author"}}
+	comment := func(login string, age time.Duration) github.IssueComment {
+		return github.IssueComment{User: github.User{Login: login}, CreatedAt: now.Add(-age)}
+	}
+	day := 24 * time.Hour
+
+	cases := []struct {
+		name     string
+		comments []github.IssueComment
+		waiting  bool
+	}{
+		{
+			name: "no comments",
+		},
+		{
+			name:     "maintainer asked long ago",
+			comments: []github.IssueComment{comment("author", 20*day), comment("maintainer", 10*day)},
+			waiting:  true,
+		},
+		{
+			name:     "maintainer asked recently",
+			comments: []github.IssueComment{comment("author", 20*day), comment("maintainer", day)},
+		},
+		{
+			name:     "author responded",
+			comments: []github.IssueComment{comment("maintainer", 10*day), comment("author", 9*day)},
+		},
+		{
+			name:     "author login compared case-insensitively",
+			comments: []github.IssueComment{comment("maintainer", 10*day), comment("AUTHOR", 9*day)},
+		},
+		{
+			name:     "comments out of order",
+			comments: []github.IssueComment{comment("maintainer", 10*day), comment("author", 20*day)},
+			waiting:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		reason := awaitingAuthorResponse(issue, tc.comments, 7*day, now)
+		if waiting := reason == ""; waiting != tc.waiting {
+			t.Errorf("%s: expected waiting=%t, got %t (%s)", tc.name, tc.waiting, waiting, reason)
+		}
+	}
+}
+
+func TestRunAwaitingAuthor(t *testing.T) {
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	author := github.User{Login: "author"}
+	maintainer := github.User{Login: "maintainer"}
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "awaiting"),
+		makeIssue("o", "r", 2, "awaiting"),
+		makeIssue("o", "r", 3, "awaiting"),
+	}
+	for n := range issues {
+		issues[n].User = author
+	}
+	c := fakeClient{
+		issues: issues,
+		existing: map[int][]github.IssueComment{
+			1: {{User: maintainer, CreatedAt: old}},
+			2: {{User: maintainer, CreatedAt: old}, {User: author, CreatedAt: old.Add(time.Hour)}},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:            unscoped("awaiting"),
+		SamplePercent:       100,
+		Ceiling:             1,
+		Commenter:           MakeCommenter("hello", false),
+		AwaitingAuthorSince: 7 * 24 * time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestRunSkipsUnparsableURLs(t *testing.T) {
+	bad := makeIssue("o", "r", 0, "unparsable")
+	bad.HTMLURL = "https://github.com/o/r/discussions/7"
+	c := fakeClient{issues: []github.Issue{
+		bad,
+		makeIssue("o", "r", 1, "unparsable"),
+		makeIssue("o", "r", 2, "unparsable"),
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("unparsable"),
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("{{.Org}}/{{.Repo}}#{{.Number}}", true),
+	}))
+	if err == nil {
+		t.Error("failed to report the unparsable URL")
+	}
+	for _, n := range c.comments {
+		if n == 0 {
+			t.Errorf("commented on issue #0: %v", c.bodies)
+		}
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected the unparsable URL not to count toward the ceiling, commented on %v instead of %v", c.comments, expected)
+	}
+}
+
+func TestLabelVars(t *testing.T) {
+	labels := []github.Label{{Name: "area/storage"}, {Name: "priority/high"}, {Name: "area/network"}, {Name: "kind:bug"}, {Name: "area/"}, {Name: "lifecycle"}}
+	cases := []struct {
+		name     string
+		prefixes []string
+		expected map[string]string
+	}{
+		{
+			name:     "no prefixes",
+			expected: map[string]string{},
+		},
+		{
+			name:     "single match",
+			prefixes: []string{"priority/"},
+			expected: map[string]string{"priority": "high"},
+		},
+		{
+			name:     "several matches are joined",
+			prefixes: []string{"area/"},
+			expected: map[string]string{"area": "storage, network"},
+		},
+		{
+			name:     "colon separator",
+			prefixes: []string{"kind:"},
+			expected: map[string]string{"kind": "bug"},
+		},
+		{
+			name:     "missing prefix is absent",
+			prefixes: []string{"sig/", "priority/"},
+			expected: map[string]string{"priority": "high"},
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := labelVars(labels, tc.prefixes); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunLabelVars(t *testing.T) {
+	i := makeIssue("o", "r", 1, "labelled")
+	i.Labels = []github.Label{{Name: "area/storage"}}
+	c := fakeClient{issues: []github.Issue{i}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("labelled"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping {{.LabelVars.area}} owners{{with .LabelVars.sig}} and {{.}}{{end}}", true),
+		LabelPrefixes: []string{"area/", "sig/"},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []string{"ping storage owners"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected %q, got %q", expected, c.bodies)
+	}
+}
+
+func TestRunRecheckUpdated(t *testing.T) {
+	cutoff := time.Now().Add(-time.Hour)
+	stale := cutoff.Add(-time.Hour)
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "recheck"),
+		makeIssue("o", "r", 2, "recheck"),
+		makeIssue("o", "r", 3, "recheck"),
+		makeIssue("o", "r", 4, "recheck"),
+	}
+	for n := range issues {
+		issues[n].UpdatedAt = stale
+	}
+	touched := issues[0]
+	touched.UpdatedAt = time.Now()
+	c := fakeClient{
+		issues:  issues,
+		current: map[int]github.Issue{1: touched},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("recheck"),
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("hello", false),
+		RecheckCutoff: cutoff,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestSampleSize(t *testing.T) {
+	cases := []struct {
+		name     string
+		total    int
+		percent  float64
+		expected int
+	}{
+		{
+			name:     "everything",
+			total:    7,
+			percent:  100,
+			expected: 7,
+		},
+		{
+			name:    "nothing",
+			total:   7,
+			percent: 0,
+		},
+		{
+			name:     "exact",
+			total:    200,
+			percent:  5,
+			expected: 10,
+		},
+		{
+			name:     "fractions round up",
+			total:    7,
+			percent:  50,
+			expected: 4,
+		},
+		{
+			name:     "tiny percentage still picks one",
+			total:    3,
+			percent:  0.01,
+			expected: 1,
+		},
+		{
+			name:     "repeating decimal does not overshoot",
+			total:    3,
+			percent:  100.0 / 3,
+			expected: 1,
+		},
+		{
+			name:    "no issues",
+			percent: 50,
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := sampleSize(tc.total, tc.percent); actual != tc.expected {
+			t.Errorf("%s: sampleSize(%d, %v) = %d, expected %d", tc.name, tc.total, tc.percent, actual, tc.expected)
+		}
+	}
+}
+
+func TestRunSamplePercent(t *testing.T) {
+	issues := []github.Issue{}
+	for i := 0; i < 20; i++ {
+		issues = append(issues, makeIssue("o", "r", i, "sample "+strconv.Itoa(i)))
+	}
+
+	cases := []struct {
+		name     string
+		percent  float64
+		ceiling  int
+		random   bool
+		expected int
+	}{
+		{
+			name:     "sample a quarter",
+			percent:  25,
+			expected: 5,
+		},
+		{
+			name:     "ceiling caps the sample",
+			percent:  50,
+			ceiling:  3,
+			expected: 3,
+		},
+		{
+			name:     "sample below ceiling",
+			percent:  10,
+			ceiling:  5,
+			expected: 2,
+		},
+		{
+			name:    "zero comments on nothing",
+			percent: 0,
+		},
+		{
+			name:     "random sample",
+			percent:  30,
+			random:   true,
+			expected: 6,
+		},
+	}
+
+	for _, tc := range cases {
+		c := fakeClient{issues: issues}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("sample"),
+			Random:        tc.random,
+			Rand:          rand.New(rand.NewSource(1)),
+			SamplePercent: tc.percent,
+			Ceiling:       tc.ceiling,
+			Commenter:     MakeCommenter("hello", false),
+		}))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if len(c.comments) != tc.expected {
+			t.Errorf("%s: expected %d comments, got %d: %v", tc.name, tc.expected, len(c.comments), c.comments)
+		}
+	}
+}
+
+func TestRunSeedIsReproducible(t *testing.T) {
+	issues := []github.Issue{}
+	for i := 0; i < 50; i++ {
+		issues = append(issues, makeIssue("o", "r", i, "seed "+strconv.Itoa(i)))
+	}
+	comment := func(seed int64) []int {
+		c := fakeClient{issues: issues}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("seed"),
+			Random:        true,
+			Rand:          rand.New(rand.NewSource(seed)),
+			SamplePercent: 10,
+			Commenter:     MakeCommenter("hello", false),
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return c.comments
+	}
+	first, second := comment(42), comment(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed commented on different issues: %v != %v", first, second)
+	}
+}
+
+func TestMetaAges(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	render := MakeCommenter("idle {{.DaysSinceUpdate}} of {{.MinInactivity}} days, open {{.DaysSinceCreation}} days", true)
+	cases := []struct {
+		name     string
+		issue    github.Issue
+		expected string
+	}{
+		{
+			name:     "timestamps",
+			issue:    github.Issue{CreatedAt: now.Add(-400 * day), UpdatedAt: now.Add(-95*day - 23*time.Hour)},
+			expected: "idle 95 of 90 days, open 400 days",
+		},
+		{
+			name:     "updated moments ago",
+			issue:    github.Issue{CreatedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Minute)},
+			expected: "idle 0 of 90 days, open 0 days",
+		},
+		{
+			name:     "missing timestamps",
+			expected: "idle -1 of 90 days, open -1 days",
+		},
+	}
+	for _, tc := range cases {
+		m := Meta{Issue: tc.issue}
+		m.setAges(now, 90*day+12*time.Hour)
+		actual, err := render(m)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestMakeCommenter(t *testing.T) {
+	m := Meta{
+		Number: 10,
+		Org:    "org",
+		Repo:   "repo",
+		Issue: github.Issue{
+			Number:  10,
+			HTMLURL: "url",
+			Title:   "title",
+		},
+	}
+	cases := []struct {
+		name     string
+		comment  string
+		template bool
+		expected string
+		err      bool
+	}{
+		{
+			name:     "string works",
+			comment:  "hello world {{.Number}} {{.Invalid}}",
+			expected: "hello world {{.Number}} {{.Invalid}}",
+		},
+		{
+			name:     "template works",
+			comment:  "N={{.Number}} R={{.Repo}} O={{.Org}} U={{.Issue.HTMLURL}} T={{.Issue.Title}}",
+			template: true,
+			expected: "N=10 R=repo O=org U=url T=title",
+		},
+		{
+			name:     "bad template errors",
+			comment:  "Bad {{.UnknownField}} Template",
+			expected: "Bad ",
+			template: true,
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		c := MakeCommenter(tc.comment, tc.template)
+		actual, err := c(m)
+		if actual != tc.expected {
+			t.Errorf("%s: expected '%s' != actual '%s'", tc.name, tc.expected, actual)
+		}
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected err: %v", tc.name, err)
+		}
+		if err == nil && tc.err {
+			t.Errorf("%s: failed to raise an exception", tc.name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// lastCommentBodyLimit is how many bytes of the body of each of the
+// LastComments templates see.
+const lastCommentBodyLimit = 1000
+
+// Comment is a comment on the issue, as templates see it.
+type Comment struct {
+	Author    string
+	CreatedAt time.Time
+	// Body is cut to lastCommentBodyLimit bytes, ending with … if cut.
+	Body string
+	// IsBot is set for comments of the bot user.
+	IsBot bool
+}
+
+// lastComments returns the newest n of comments, newest first.
+func lastComments(comments []github.IssueComment, n int, isBot func(string) bool) []Comment {
+	comments = append([]github.IssueComment(nil), comments...)
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].CreatedAt.After(comments[j].CreatedAt) })
+	if len(comments) > n {
+		comments = comments[:n]
+	}
+	last := make([]Comment, 0, len(comments))
+	for _, c := range comments {
+		body := c.Body
+		if len(body) > lastCommentBodyLimit {
+			body = truncateUTF8(body, lastCommentBodyLimit) + "…"
+		}
+		last = append(last, Comment{
+			Author:    c.User.Login,
+			CreatedAt: c.CreatedAt,
+			Body:      body,
+			IsBot:     isBot != nil && isBot(c.User.Login),
+		})
+	}
+	return last
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunFetchComments(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2024, 5, day, 0, 0, 0, 0, time.UTC) }
+	comment := func(login, body string, day int) github.IssueComment {
+		return github.IssueComment{User: github.User{Login: login}, Body: body, CreatedAt: at(day)}
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "waiting"),
+			makePR("o", "r", 2, "waiting"),
+			makeIssue("o", "r", 3, "waiting"),
+		},
+		existing: map[int][]github.IssueComment{
+			1: {
+				comment("alice", "first", 1),
+				comment("bob", "Could you share the reproduction steps?", 3),
+				comment("bot", "ping", 4),
+				comment("alice", "second", 2),
+			},
+			2: {comment("carol", "never fetched", 1)},
+		},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("waiting"),
+		SamplePercent: 100,
+		Kind:          OnlyIssues,
+		FetchComments: 3,
+		Commenter: MakeCommenter(`{{range .LastComments}}{{if not .IsBot}}@{{.Author}} on {{.CreatedAt.Format "Jan 2"}}: {{.Body}}
+{{end}}{{else}}no comments{{end}}`, true),
+		Confirm: true,
+	})
+	if err := runErr(res, err); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		"@bob on May 3: Could you share the reproduction steps?\n@alice on May 2: second\n",
+		"no comments",
+	}
+	if !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+	// The pull request skipped by --only-issues is not fetched.
+	if res.API.IssueFetches != 2 {
+		t.Errorf("expected comments listed for the 2 issues kept, got %d fetches", res.API.IssueFetches)
+	}
+}
+
+func TestLastComments(t *testing.T) {
+	long := strings.Repeat("é", lastCommentBodyLimit)
+	actual := lastComments([]github.IssueComment{{User: github.User{Login: "alice"}, Body: long}}, 5, nil)
+	if len(actual) != 1 || len(actual[0].Body) > lastCommentBodyLimit+len("…") || !strings.HasSuffix(actual[0].Body, "é…") {
+		t.Errorf("expected the body cut to %d bytes, got %d: %+v", lastCommentBodyLimit, len(actual[0].Body), actual)
+	}
+	if actual := lastComments(nil, 5, nil); len(actual) != 0 {
+		t.Errorf("expected no comments, got %+v", actual)
+	}
+}
@@ -0,0 +1,836 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/github"
+)
+
+// Config holds the commenter flags, which Execute runs once Validate has
+// checked them.
+type Config struct {
+	Ceiling         int
+	Comment         flagutil.Strings
+	IncludeArchived bool
+	IncludeClosed   bool
+	IncludeLocked   bool
+	UseTemplate     bool
+	Query           string
+	Endpoint        flagutil.Strings
+	GraphQLEndpoint string
+	Token           string
+	Updated         time.Duration
+	Confirm         bool
+	Random          bool
+	Seed            int64
+	SamplePercent   float64
+
+	// GitHubAppID and GitHubAppPrivateKeyPath authenticate as a GitHub App
+	// instead of with the Token, each call as the installation in its org.
+	GitHubAppID             string
+	GitHubAppPrivateKeyPath string
+
+	RequireWriteAccess bool
+	Workers            int
+	Delay              time.Duration
+	Marker             string
+	SkipDuplicates     bool
+	SingleIssue        string
+	OnlyConflicted     bool
+	StateFile          string
+	StateReset         bool
+
+	AwaitingAuthorSince time.Duration
+	Interval            time.Duration
+	IncludeLinkedPRs    bool
+	MaxLinkedPRs        int
+	IssueType           string
+	AllowedIssueTypes   flagutil.Strings
+	CommentMaxLength    int
+	OverflowToGist      bool
+	LabelPrefixes       flagutil.Strings
+	RecheckUpdated      bool
+	Sort                string
+	SortAsc             bool
+	NewestFirst         bool
+	SplitQuery          bool
+	MinReactions        github.Reactions
+	Org                 string
+	MaxBotComments      int
+	Provider            string
+	GitLabBaseURL       string
+	GitLabTokenPath     string
+	IssuesFile          string
+	AddLabels           flagutil.Strings
+	LabelSync           bool
+	LabelCreate         bool
+	BodyRegex           string
+	BodyRegexSkipCode   bool
+	SpamUserList        string
+	SpamDomain          string
+	AuditLog            string
+	MinCommits          int
+	MaxCommits          int
+	SlackWebhookFile    string
+	SlackMaxIssues      int
+	CloseAfter          time.Duration
+	// ScheduledActionsFile is written by commenting runs and read by
+	// --run-scheduled-actions runs.
+	ScheduledActionsFile  string
+	RunScheduledActions   bool
+	ConfirmEach           bool
+	MinAuthorAge          time.Duration
+	MaxAuthorAge          time.Duration
+	MaxDuration           time.Duration
+	DeploymentEnvironment string
+	DeploymentState       string
+	TitleRegex            string
+	// RegexCaseInsensitive applies to both BodyRegex and TitleRegex.
+	RegexCaseInsensitive bool
+	ExcerptLength        int
+	Prune                PruneMode
+	PruneMax             int
+	MinReviews           int
+	MaxReviews           int
+	ReviewState          string
+	MinimizePrevious     bool
+	MinimizeClassifier   string
+	EmailIssueAuthor     bool
+	SMTPConfig           string
+	EmailTemplateFile    string
+	SkipWithLinkedPR     bool
+	// SkipCrossRepoDuplicates only ever compares titles within a single run.
+	SkipCrossRepoDuplicates bool
+	SkipMilestoned          bool
+	OnlyMilestoned          bool
+	MinRepo                 RepoThresholds
+	OnlyIssues              bool
+	OnlyPRs                 bool
+	PRClosesIssue           string
+	SummaryMarkdown         string
+	Quiet                   QuietWindows
+	UseGraphQL              bool
+	ExportMetricsFile       string
+	MinRateLimit            int
+	WaitForRateLimit        bool
+	RateLimitCheckEvery     int
+	TestModeRedirectTo      string
+	TestIssueNumber         int
+	ProjectColumn           string
+	StaleWarnLabel          string
+	StaleCloseLabel         string
+	RollupRepo              string
+	RollupTitle             string
+	SuggestQuery            bool
+	ActionsRunLink          bool
+	Escalate                bool
+	EscalationAfter         time.Duration
+	EscalationComment       string
+	EscalationClose         bool
+	EscalationLabels        flagutil.Strings
+	AllChecksPassed         bool
+	HeaderFile              string
+	FooterFile              string
+	NoTruncate              bool
+	Retries                 int
+	RetryDelay              time.Duration
+	UpdatedMax              time.Duration
+	CreatedBefore           time.Duration
+	CreatedAfter            time.Duration
+	IncludeRepos            flagutil.Strings
+	ExcludeRepos            flagutil.Strings
+	CeilingPerOrg           int
+	RandomWeighted          bool
+	SkipDrafts              bool
+	PRStatus                PRStatus
+	PRMergeable             *bool
+	FetchPRDetails          bool
+	IgnoreMarker            string
+	ValidateOnly            bool
+	OutputCSV               string
+	ReportWebhookFile       string
+	ReportWebhookHeaders    flagutil.Strings
+	RequestReviewers        string
+	ReRequestExisting       bool
+	TransitionLabels        flagutil.Strings
+	OrgsConfig              string
+	ProwConfig              string
+	OrgsConfigFilter        string
+	LastRunFile             string
+	LastRunAdvanceOnPartial bool
+	FetchComments           int
+	FetchFullIssue          bool
+	UpdatedWithin           time.Duration
+	UpdatedBefore           time.Time
+	UpdatedAfter            time.Time
+	FailOnZeroMatches       bool
+	RollupBy                RollupGroup
+	WarnBelow               int
+	GitHubCallTimeout       time.Duration
+
+	// Set by Validate from the fields above.
+	reviewers    []string
+	transitions  []LabelTransition
+	closesIssue  *IssueRef
+	redirect     *IssueRef
+	classifier   githubql.ReportedContentClassifiers
+	kind         IssueKind
+	rollupTarget IssueRef
+	repos        *RepoFilter
+	bodyRegexp   *regexp.Regexp
+	titleRegexp  *regexp.Regexp
+}
+
+// Validate checks that the flags in o go together, and sets what they imply,
+// such as the kind of issues to match and the compiled regexes.
+func (o *Config) Validate() error {
+	if o.RunScheduledActions {
+		if nonEmpty(o.Query, o.SingleIssue, o.IssuesFile) > 0 || o.CloseAfter != 0 {
+			return errors.New("--run-scheduled-actions cannot be combined with --query, --single-issue, --issues-file or --close-after-comment-if-not-updated")
+		}
+		if o.ScheduledActionsFile == "" {
+			return errors.New("--run-scheduled-actions requires --scheduled-actions-file")
+		}
+	} else if o.Query == "" && o.SingleIssue == "" && o.IssuesFile == "" {
+		return errors.New("empty --query")
+	}
+	if nonEmpty(o.Query, o.SingleIssue, o.IssuesFile) > 1 {
+		return errors.New("--query, --single-issue and --issues-file are mutually exclusive")
+	}
+	if o.IssuesFile != "" && o.Org != "" {
+		return errors.New("--org only applies to --query")
+	}
+	if o.OrgsConfig != "" || o.ProwConfig != "" {
+		if o.Query == "" {
+			return errors.New("--orgs-config and --prow-config only apply to --query")
+		}
+		if o.Org != "" {
+			return errors.New("--orgs-config and --prow-config conflict with --org")
+		}
+		if FindQualifierKey(o.Query, "org:", "repo:") != "" {
+			return errors.New("--orgs-config and --prow-config conflict with org: and repo: in --query")
+		}
+	} else if o.OrgsConfigFilter != "" {
+		return errors.New("--orgs-config-filter requires --orgs-config or --prow-config")
+	}
+	switch o.Provider {
+	case "github":
+		app := o.GitHubAppID != "" || o.GitHubAppPrivateKeyPath != ""
+		switch {
+		case o.Token == "" && !app:
+			return errors.New("empty --token, or --github-app-id and --github-app-private-key-path")
+		case o.Token != "" && app:
+			return errors.New("--token is mutually exclusive with --github-app-id and --github-app-private-key-path")
+		case app && (o.GitHubAppID == "" || o.GitHubAppPrivateKeyPath == ""):
+			return errors.New("--github-app-id and --github-app-private-key-path must be set together")
+		case app && o.Query != "" && o.Org == "" && o.OrgsConfig == "" && o.ProwConfig == "":
+			// Searches are only authenticated in the installation of an org.
+			return errors.New("--github-app-id requires --org, --orgs-config or --prow-config to search with --query")
+		}
+	case "gitlab":
+		if o.GitLabBaseURL == "" || o.GitLabTokenPath == "" {
+			return errors.New("--provider=gitlab requires --gitlab-base-url and --gitlab-token-path")
+		}
+		if flags := githubOnlyFlags(*o); len(flags) > 0 {
+			return fmt.Errorf("--provider=gitlab does not support %s", strings.Join(flags, ", "))
+		}
+	default:
+		return fmt.Errorf("--provider=%s must be github or gitlab", o.Provider)
+	}
+	if o.ValidateOnly {
+		if o.Query == "" {
+			return errors.New("--validate-only requires --query")
+		}
+		if o.SingleIssue != "" || o.RunScheduledActions || o.Interval > 0 {
+			return errors.New("--validate-only cannot be used with --single-issue, --run-scheduled-actions or --interval")
+		}
+		for _, comment := range commentVariants(*o) {
+			if err := CheckTemplate(comment); o.UseTemplate && err != nil {
+				return fmt.Errorf("bad --comment template: %w", err)
+			}
+		}
+		if err := CheckTemplate(o.EscalationComment); o.UseTemplate && err != nil {
+			return fmt.Errorf("bad --escalation-comment template: %w", err)
+		}
+	} else if len(commentVariants(*o)) == 0 && !o.RunScheduledActions {
+		if len(actionFlags(*o)) == 0 {
+			return errors.New("empty --comment, which needs an action instead such as --label-add, --stale-close-label or --set-issue-type")
+		}
+		if flags := commentlessConflicts(*o); len(flags) > 0 {
+			return fmt.Errorf("empty --comment cannot be used with %s", strings.Join(flags, ", "))
+		}
+	}
+	if variants := o.Comment.Strings(); len(variants) > 1 {
+		for _, comment := range variants {
+			if comment == "" {
+				return errors.New("--comment must not be empty when passed more than once")
+			}
+		}
+	}
+	if o.RequestReviewers != "" {
+		for _, r := range strings.Split(o.RequestReviewers, ",") {
+			r = strings.TrimSpace(r)
+			if err := CheckReviewer(r); err != nil {
+				return fmt.Errorf("bad --request-reviewers: %w", err)
+			}
+			o.reviewers = append(o.reviewers, r)
+		}
+	}
+	for _, s := range o.TransitionLabels.Strings() {
+		t, err := ParseLabelTransition(s)
+		if err != nil {
+			return fmt.Errorf("bad --transition-label: %w", err)
+		}
+		o.transitions = append(o.transitions, t)
+	}
+	if o.LastRunFile != "" {
+		if o.Query == "" || o.Updated <= 0 {
+			return errors.New("--last-run-file requires --query and --updated")
+		}
+		if o.UpdatedMax != 0 || o.Escalate {
+			return errors.New("--last-run-file cannot be used with --updated-max or --escalate")
+		}
+		if term := FindQualifierKey(o.Query, "updated:"); term != "" {
+			return fmt.Errorf("--last-run-file conflicts with %s in --query", term)
+		}
+	} else if o.LastRunAdvanceOnPartial {
+		return errors.New("--last-run-advance-on-partial requires --last-run-file")
+	}
+	if o.GitHubCallTimeout < 0 {
+		return fmt.Errorf("--github-call-timeout=%s must not be negative", o.GitHubCallTimeout)
+	}
+	if o.WarnBelow < 0 {
+		return fmt.Errorf("--warn-below=%d must not be negative", o.WarnBelow)
+	}
+	if o.FetchComments < 0 {
+		return fmt.Errorf("--fetch-comments=%d must not be negative", o.FetchComments)
+	}
+	if o.Interval < 0 {
+		return fmt.Errorf("--interval=%s must not be negative", o.Interval)
+	}
+	if o.Interval > 0 && o.SingleIssue != "" {
+		return errors.New("--interval cannot be used with --single-issue")
+	}
+	if o.IncludeLinkedPRs && o.MaxLinkedPRs < 1 {
+		return fmt.Errorf("--max-linked-prs=%d must be at least 1", o.MaxLinkedPRs)
+	}
+	if o.IssueType != "" && !containsFold(o.AllowedIssueTypes.Strings(), o.IssueType) {
+		return fmt.Errorf("--set-issue-type=%s must be one of --allowed-issue-types=%s", o.IssueType, o.AllowedIssueTypes.String())
+	}
+	if o.CommentMaxLength < 1 || o.CommentMaxLength > MaxCommentLength {
+		return fmt.Errorf("--comment-max-length=%d must be between 1 and %d", o.CommentMaxLength, MaxCommentLength)
+	}
+	if o.RecheckUpdated && o.Updated <= 0 {
+		return errors.New("--recheck-updated requires --updated")
+	}
+	if o.MinReactions.PlusOne < 0 || o.MinReactions.Heart < 0 || o.MinReactions.Rocket < 0 {
+		return errors.New("--min-thumbs-up, --min-hearts and --min-rockets must not be negative")
+	}
+	if o.MaxBotComments < 0 {
+		return fmt.Errorf("--max-bot-comments-per-issue=%d must not be negative", o.MaxBotComments)
+	}
+	if o.MinCommits < 0 || o.MaxCommits < 0 {
+		return errors.New("--pr-min-commits and --pr-max-commits must not be negative")
+	}
+	if o.MaxCommits > 0 && o.MinCommits > o.MaxCommits {
+		return fmt.Errorf("--pr-min-commits=%d must not exceed --pr-max-commits=%d", o.MinCommits, o.MaxCommits)
+	}
+	if o.CloseAfter < 0 {
+		return fmt.Errorf("--close-after-comment-if-not-updated=%s must not be negative", o.CloseAfter)
+	}
+	if o.UpdatedMax < 0 {
+		return fmt.Errorf("--updated-max=%s must not be negative", o.UpdatedMax)
+	}
+	if o.UpdatedMax > 0 && o.Query == "" {
+		return errors.New("--updated-max requires --query")
+	}
+	if o.CreatedBefore < 0 || o.CreatedAfter < 0 {
+		return errors.New("--created-before and --created-after must not be negative")
+	}
+	if (o.CreatedBefore > 0 || o.CreatedAfter > 0) && o.Query == "" {
+		return errors.New("--created-before and --created-after require --query")
+	}
+	if o.Random && o.RandomWeighted {
+		return errors.New("--random and --random-weighted cannot be used together")
+	}
+	if o.CeilingPerOrg < 0 {
+		return fmt.Errorf("--ceiling-per-org=%d must not be negative", o.CeilingPerOrg)
+	}
+	if o.Retries < 0 || o.RetryDelay < 0 {
+		return errors.New("--retries and --retry-delay must not be negative")
+	}
+	if o.CloseAfter > 0 && o.ScheduledActionsFile == "" {
+		return errors.New("--close-after-comment-if-not-updated requires --scheduled-actions-file")
+	}
+	if o.CloseAfter > 0 && o.SingleIssue != "" {
+		return errors.New("--close-after-comment-if-not-updated cannot be used with --single-issue")
+	}
+	if o.ConfirmEach {
+		if o.SingleIssue != "" || o.RunScheduledActions || o.LabelCreate {
+			return errors.New("--confirm-each cannot be used with --single-issue, --run-scheduled-actions or --label-create")
+		}
+		if !isTerminal(os.Stdin) {
+			return errors.New("--confirm-each requires stdin to be a terminal")
+		}
+		o.Confirm = true
+	}
+	if o.MinAuthorAge < 0 || o.MaxAuthorAge < 0 {
+		return errors.New("--author-account-age-min and --author-account-age-max must not be negative")
+	}
+	if o.MaxAuthorAge > 0 && o.MinAuthorAge > o.MaxAuthorAge {
+		return fmt.Errorf("--author-account-age-min=%s must not exceed --author-account-age-max=%s", o.MinAuthorAge, o.MaxAuthorAge)
+	}
+	if o.DeploymentState != "" && o.DeploymentEnvironment == "" {
+		return errors.New("--require-deployment-state requires --require-deployment-environment")
+	}
+	if o.MinimizePrevious {
+		if o.Prune == PruneDelete {
+			return errors.New("--minimize-previous conflicts with --prune-previous=delete")
+		}
+		o.Prune = PruneMinimize
+	}
+	if c, err := ParseClassifier(o.MinimizeClassifier); err != nil {
+		return fmt.Errorf("--minimize-classifier: %w", err)
+	} else {
+		o.classifier = c
+	}
+	if o.Prune != PruneOff && o.Marker == "" {
+		return errors.New("--prune-previous requires --marker to tell the comments to prune")
+	}
+	if o.PruneMax < 1 {
+		return fmt.Errorf("--prune-previous-max=%d must be at least 1", o.PruneMax)
+	}
+	if o.MinReviews < 0 || o.MaxReviews < -1 {
+		return errors.New("--pr-min-reviews must not be negative and --pr-max-reviews must be at least -1")
+	}
+	if o.MaxReviews >= 0 && o.MinReviews > o.MaxReviews {
+		return fmt.Errorf("--pr-min-reviews=%d must not exceed --pr-max-reviews=%d", o.MinReviews, o.MaxReviews)
+	}
+	if o.ReviewState != "" && o.MinReviews == 0 && o.MaxReviews < 0 {
+		return errors.New("--pr-review-state requires --pr-min-reviews or --pr-max-reviews")
+	}
+	if o.MinRepo.Stars < 0 || o.MinRepo.Watchers < 0 || o.MinRepo.Forks < 0 {
+		return errors.New("--require-repo-min-stars, --require-repo-min-watchers and --require-repo-min-forks must not be negative")
+	}
+	switch {
+	case o.OnlyIssues && o.OnlyPRs:
+		return errors.New("--only-issues and --only-prs are mutually exclusive")
+	case o.OnlyIssues:
+		o.kind = OnlyIssues
+	case o.OnlyPRs:
+		o.kind = OnlyPRs
+	}
+	if o.PRClosesIssue != "" {
+		ref, err := ParseIssueRef(o.PRClosesIssue)
+		if err != nil {
+			return fmt.Errorf("invalid --pr-closes-issue: %w", err)
+		}
+		o.closesIssue = &ref
+	}
+	if o.Quiet.Comment < 0 || o.Quiet.Label < 0 || o.Quiet.Assignment < 0 {
+		return errors.New("--no-comment-within, --no-label-change-within and --no-assignment-change-within must not be negative")
+	}
+	if o.MinRateLimit < 0 || o.RateLimitCheckEvery < 0 {
+		return errors.New("--min-rate-limit and --rate-limit-check-every must not be negative")
+	}
+	if o.WaitForRateLimit && o.MinRateLimit == 0 {
+		return errors.New("--wait-for-rate-limit requires --min-rate-limit")
+	}
+	if o.TestModeRedirectTo != "" {
+		if o.SingleIssue != "" {
+			return errors.New("--test-mode-redirect-to cannot be used with --single-issue")
+		}
+		ref, err := ParseIssueRef(fmt.Sprintf("%s#%d", o.TestModeRedirectTo, o.TestIssueNumber))
+		if err != nil || o.TestIssueNumber < 1 {
+			return fmt.Errorf("--test-mode-redirect-to=%s and --test-issue-number=%d must name an org/repo and an issue in it", o.TestModeRedirectTo, o.TestIssueNumber)
+		}
+		o.redirect = &ref
+	}
+	if o.SkipMilestoned && o.OnlyMilestoned {
+		return errors.New("--skip-milestoned and --only-milestoned are mutually exclusive")
+	}
+	if o.EmailIssueAuthor && o.SMTPConfig == "" {
+		return errors.New("--email-issue-author requires --smtp-config")
+	}
+	if !o.EmailIssueAuthor && (o.SMTPConfig != "" || o.EmailTemplateFile != "") {
+		return errors.New("--smtp-config and --email-template-file require --email-issue-author")
+	}
+	if o.ExcerptLength < 0 {
+		return fmt.Errorf("--comment-include-body-excerpt-length=%d must not be negative", o.ExcerptLength)
+	}
+	if o.MaxDuration < 0 {
+		return fmt.Errorf("--max-duration=%s must not be negative", o.MaxDuration)
+	}
+	if o.SlackMaxIssues < 0 {
+		return fmt.Errorf("--slack-max-issues=%d must not be negative", o.SlackMaxIssues)
+	}
+	if o.StaleCloseLabel != "" && o.StaleWarnLabel == "" {
+		return errors.New("--stale-close-label requires --stale-warn-label")
+	}
+	if o.StaleWarnLabel != "" {
+		if o.Query == "" {
+			return errors.New("--stale-warn-label requires --query")
+		}
+		if o.StaleCloseLabel != "" && o.Updated <= 0 {
+			return errors.New("--stale-close-label requires --updated to tell how long warned issues get to respond")
+		}
+	}
+	if o.Escalate {
+		if o.Marker == "" || o.EscalationComment == "" || o.EscalationAfter <= 0 {
+			return errors.New("--escalate requires --marker, --escalation-comment and --escalation-after")
+		}
+		if o.SingleIssue != "" || o.RecheckUpdated {
+			return errors.New("--escalate cannot be used with --single-issue or --recheck-updated")
+		}
+	} else if o.EscalationAfter != 0 || o.EscalationComment != "" || o.EscalationClose || len(o.EscalationLabels.Strings()) > 0 {
+		return errors.New("--escalation-after, --escalation-comment, --escalation-close and --escalation-label-add require --escalate")
+	}
+	if o.RollupRepo != "" {
+		org, repo, ok := strings.Cut(o.RollupRepo, "/")
+		if !ok || org == "" || repo == "" || strings.Contains(repo, "/") {
+			return fmt.Errorf("--rollup-repo=%s must be org/repo", o.RollupRepo)
+		}
+		if o.RollupTitle == "" {
+			return errors.New("--rollup-repo requires --rollup-title")
+		}
+		if flags := rollupConflicts(*o); len(flags) > 0 {
+			return fmt.Errorf("--rollup-repo cannot be used with %s", strings.Join(flags, ", "))
+		}
+		o.rollupTarget = IssueRef{Org: org, Repo: repo}
+	} else if o.RollupTitle != "" || o.RollupBy != RollupSingle {
+		return errors.New("--rollup-title and --rollup-by require --rollup-repo")
+	}
+	if o.LabelSync && len(o.AddLabels.Strings()) == 0 {
+		return errors.New("--label-sync requires --label-add")
+	}
+	if o.LabelCreate && !o.LabelSync {
+		return errors.New("--label-create requires --label-sync")
+	}
+	for _, labels := range []flagutil.Strings{o.AddLabels, o.EscalationLabels} {
+		if err := CheckLabels(labels.Strings(), o.UseTemplate); err != nil {
+			return fmt.Errorf("invalid label: %w", err)
+		}
+	}
+	if o.LabelSync && o.UseTemplate && strings.Contains(strings.Join(o.AddLabels.Strings(), ""), "{{") {
+		return errors.New("--label-sync cannot check --label-add templates before rendering them")
+	}
+	if len(o.IncludeRepos.Strings()) > 0 || len(o.ExcludeRepos.Strings()) > 0 {
+		var err error
+		if o.repos, err = NewRepoFilter(o.IncludeRepos.Strings(), o.ExcludeRepos.Strings()); err != nil {
+			return fmt.Errorf("bad --include-repo or --exclude-repo: %w", err)
+		}
+	}
+	if o.BodyRegex != "" {
+		var err error
+		if o.bodyRegexp, err = CompileFilterRegex(o.BodyRegex, o.RegexCaseInsensitive); err != nil {
+			return fmt.Errorf("bad --body-regex: %w", err)
+		}
+	} else if o.BodyRegexSkipCode {
+		return errors.New("--body-regex-skip-code-blocks requires --body-regex")
+	}
+	if o.TitleRegex != "" {
+		var err error
+		if o.titleRegexp, err = CompileFilterRegex(o.TitleRegex, o.RegexCaseInsensitive); err != nil {
+			return fmt.Errorf("bad --title-regex: %w", err)
+		}
+	}
+	if o.RegexCaseInsensitive && o.bodyRegexp == nil && o.titleRegexp == nil {
+		return errors.New("--regex-case-insensitive requires --body-regex or --title-regex")
+	}
+	if o.Workers < 1 {
+		return fmt.Errorf("--workers=%d must be at least 1", o.Workers)
+	}
+	if o.SamplePercent < 0 || o.SamplePercent > 100 {
+		return fmt.Errorf("--sample-percent=%v must be between 0 and 100", o.SamplePercent)
+	}
+	if len(splitOrgs(o.Org)) > 0 && FindQualifierKey(o.Query, "org:") != "" {
+		return errors.New("--org conflicts with org: in --query")
+	}
+	if o.SuggestQuery && o.Query == "" {
+		return errors.New("--suggest-query-improvements requires --query")
+	}
+	if o.ReportWebhookFile == "" && len(o.ReportWebhookHeaders.Strings()) > 0 {
+		return errors.New("--report-webhook-header requires --report-webhook-url-file")
+	}
+	return nil
+}
+
+// githubOnlyFlags returns the set flags that rely on GitHub features the
+// gitlab provider lacks.
+func githubOnlyFlags(o Config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"--require-write-access":               o.RequireWriteAccess,
+		"--only-prs":                           o.OnlyPRs,
+		"--use-graphql":                        o.UseGraphQL,
+		"--github-app-id":                      o.GitHubAppID != "",
+		"--github-app-private-key-path":        o.GitHubAppPrivateKeyPath != "",
+		"--min-rate-limit":                     o.MinRateLimit > 0,
+		"--no-label-change-within":             o.Quiet.Label > 0,
+		"--no-assignment-change-within":        o.Quiet.Assignment > 0,
+		"--require-repo-min-stars":             o.MinRepo.Stars > 0,
+		"--require-repo-min-watchers":          o.MinRepo.Watchers > 0,
+		"--require-repo-min-forks":             o.MinRepo.Forks > 0,
+		"--comment-if-pr-has-conflicts":        o.OnlyConflicted,
+		"--comment-include-linked-prs":         o.IncludeLinkedPRs,
+		"--skip-with-linked-pr":                o.SkipWithLinkedPR,
+		"--set-issue-type":                     o.IssueType != "",
+		"--comment-overflow-to-gist":           o.OverflowToGist,
+		"--min-thumbs-up":                      o.MinReactions.PlusOne > 0,
+		"--min-hearts":                         o.MinReactions.Heart > 0,
+		"--min-rockets":                        o.MinReactions.Rocket > 0,
+		"--label-add":                          len(o.AddLabels.Strings()) > 0,
+		"--pr-min-commits":                     o.MinCommits > 0,
+		"--pr-max-commits":                     o.MaxCommits > 0,
+		"--require-deployment-environment":     o.DeploymentEnvironment != "",
+		"--project-column-filter":              o.ProjectColumn != "",
+		"--stale-warn-label":                   o.StaleWarnLabel != "",
+		"--rollup-repo":                        o.RollupRepo != "",
+		"--escalation-close":                   o.EscalationClose,
+		"--escalation-label-add":               len(o.EscalationLabels.Strings()) > 0,
+		"--all-checks-passed":                  o.AllChecksPassed,
+		"--pr-status":                          o.PRStatus != PRStatusAny,
+		"--pr-mergeable":                       o.PRMergeable != nil,
+		"--fetch-pr-details":                   o.FetchPRDetails,
+		"--author-account-age-min":             o.MinAuthorAge > 0,
+		"--author-account-age-max":             o.MaxAuthorAge > 0,
+		"--prune-previous":                     o.Prune != PruneOff,
+		"--minimize-previous":                  o.MinimizePrevious,
+		"--email-issue-author":                 o.EmailIssueAuthor,
+		"--pr-min-reviews":                     o.MinReviews > 0,
+		"--pr-max-reviews":                     o.MaxReviews >= 0,
+		"--run-scheduled-actions":              o.RunScheduledActions,
+		"--close-after-comment-if-not-updated": o.CloseAfter > 0,
+		"--request-reviewers":                  o.RequestReviewers != "",
+		"--re-request-existing":                o.ReRequestExisting,
+		"--transition-label":                   len(o.TransitionLabels.Strings()) > 0,
+	} {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// rollupConflicts returns the set flags that act on every issue commented on,
+// which --rollup-repo does not comment on.
+func rollupConflicts(o Config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"--single-issue":                        o.SingleIssue != "",
+		"--skip-duplicates":                     o.SkipDuplicates,
+		"--test-mode-redirect-to":               o.TestModeRedirectTo != "",
+		"--confirm-each":                        o.ConfirmEach,
+		"--recheck-updated":                     o.RecheckUpdated,
+		"--skip-cross-repo-duplicates":          o.SkipCrossRepoDuplicates,
+		"--state-file":                          o.StateFile != "",
+		"--comment-include-linked-prs":          o.IncludeLinkedPRs,
+		"--comment-include-body-excerpt-length": o.ExcerptLength > 0,
+		"--comment-overflow-to-gist":            o.OverflowToGist,
+		"--prune-previous":                      o.Prune != PruneOff,
+		"--label-add":                           len(o.AddLabels.Strings()) > 0,
+		"--stale-warn-label":                    o.StaleWarnLabel != "",
+		"--set-issue-type":                      o.IssueType != "",
+		"--email-issue-author":                  o.EmailIssueAuthor,
+		"--close-after-comment-if-not-updated":  o.CloseAfter > 0,
+		"--escalate":                            o.Escalate,
+		"--comment more than once":              len(o.Comment.Strings()) > 1,
+		"--request-reviewers":                   o.RequestReviewers != "",
+		"--re-request-existing":                 o.ReRequestExisting,
+		"--transition-label":                    len(o.TransitionLabels.Strings()) > 0,
+	} {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// commentVariants returns the --comment values, none if the only one is empty.
+func commentVariants(o Config) []string {
+	comments := o.Comment.Strings()
+	if len(comments) == 1 && comments[0] == "" {
+		return nil
+	}
+	return comments
+}
+
+// actionFlags returns the set flags that act on issues other than by
+// commenting, which is all a run without a --comment does.
+func actionFlags(o Config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"--label-add":           len(o.AddLabels.Strings()) > 0,
+		"--stale-warn-label":    o.StaleWarnLabel != "",
+		"--stale-close-label":   o.StaleCloseLabel != "",
+		"--set-issue-type":      o.IssueType != "",
+		"--request-reviewers":   o.RequestReviewers != "",
+		"--re-request-existing": o.ReRequestExisting,
+		"--transition-label":    len(o.TransitionLabels.Strings()) > 0,
+	} {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// commentlessConflicts returns the set flags that shape or rely on the
+// comment, which a run without a --comment does not post.
+func commentlessConflicts(o Config) []string {
+	var flags []string
+	for name, set := range map[string]bool{
+		"--single-issue":                        o.SingleIssue != "",
+		"--rollup-repo":                         o.RollupRepo != "",
+		"--header-file":                         o.HeaderFile != "",
+		"--footer-file":                         o.FooterFile != "",
+		"--github-actions-run-link":             o.ActionsRunLink,
+		"--skip-duplicates":                     o.SkipDuplicates,
+		"--test-mode-redirect-to":               o.TestModeRedirectTo != "",
+		"--comment-include-linked-prs":          o.IncludeLinkedPRs,
+		"--comment-include-body-excerpt-length": o.ExcerptLength > 0,
+		"--comment-overflow-to-gist":            o.OverflowToGist,
+		"--prune-previous":                      o.Prune != PruneOff,
+		"--email-issue-author":                  o.EmailIssueAuthor,
+		"--close-after-comment-if-not-updated":  o.CloseAfter > 0,
+		"--escalate":                            o.Escalate,
+	} {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// staleLabel returns the label that --stale-warn-label runs add to the issues
+// they comment on: the warning label, or the close label when closing.
+func staleLabel(o Config) []string {
+	switch {
+	case o.StaleCloseLabel != "":
+		return []string{o.StaleCloseLabel}
+	case o.StaleWarnLabel != "":
+		return []string{o.StaleWarnLabel}
+	}
+	return nil
+}
+
+// staleQualifier returns the label qualifier that --stale-warn-label runs add
+// to --query: warning runs skip the issues already warned and closing runs
+// only take those.
+func staleQualifier(o Config) string {
+	switch {
+	case o.StaleWarnLabel == "":
+		return ""
+	case o.StaleCloseLabel != "":
+		return "label:" + strconv.Quote(o.StaleWarnLabel)
+	}
+	return "-label:" + strconv.Quote(o.StaleWarnLabel)
+}
+
+// searchScopes returns the scopes to search --query in: one for each --org,
+// those of the --orgs-config and --prow-config, or else a single unscoped one.
+func searchScopes(o Config, logger *log.Logger) ([]TargetScope, error) {
+	if o.OrgsConfig == "" && o.ProwConfig == "" {
+		var scopes []TargetScope
+		for _, org := range splitOrgs(o.Org) {
+			scopes = append(scopes, TargetScope{Org: org, Qualifiers: "org:" + org})
+		}
+		if len(scopes) == 0 {
+			scopes = []TargetScope{{}}
+		}
+		return scopes, nil
+	}
+	var targets Targets
+	if o.OrgsConfig != "" {
+		t, err := LoadOrgsConfig(o.OrgsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("bad --orgs-config: %w", err)
+		}
+		targets = targets.Merge(t)
+	}
+	if o.ProwConfig != "" {
+		t, err := LoadProwConfig(o.ProwConfig)
+		if err != nil {
+			return nil, fmt.Errorf("bad --prow-config: %w", err)
+		}
+		targets = targets.Merge(t)
+	}
+	if o.OrgsConfigFilter != "" {
+		re, err := regexp.Compile(o.OrgsConfigFilter)
+		if err != nil {
+			return nil, fmt.Errorf("bad --orgs-config-filter: %w", err)
+		}
+		targets = targets.Filter(re)
+	}
+	if targets.Empty() {
+		return nil, errors.New("--orgs-config and --prow-config leave no orgs or repos to search")
+	}
+	logger.Printf("Searching %s from the configs", targets)
+	return targets.Scopes(), nil
+}
+
+// splitOrgs returns the distinct orgs in a comma-separated list.
+func splitOrgs(list string) []string {
+	var orgs []string
+	seen := map[string]bool{}
+	for _, org := range strings.Split(list, ",") {
+		org = strings.TrimSpace(org)
+		if org != "" && !seen[org] {
+			seen[org] = true
+			orgs = append(orgs, org)
+		}
+	}
+	return orgs
+}
+
+// nonEmpty returns how many of values are not empty.
+func nonEmpty(values ...string) int {
+	n := 0
+	for _, v := range values {
+		if v != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// containsFold returns whether s case-insensitively matches any of values.
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
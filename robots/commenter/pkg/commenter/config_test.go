@@ -0,0 +1,183 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/flagutil"
+)
+
+func TestSplitOrgs(t *testing.T) {
+	if actual, expected := splitOrgs(" kubernetes,kubernetes-sigs,, kubernetes ,kubernetes-client"), []string{"kubernetes", "kubernetes-sigs", "kubernetes-client"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if actual := splitOrgs(""); len(actual) != 0 {
+		t.Errorf("expected no orgs, got %v", actual)
+	}
+}
+
+func TestSearchScopes(t *testing.T) {
+	scopes, err := searchScopes(Config{Org: "kubernetes,kubernetes-sigs"}, log.Default())
+	expected := []TargetScope{{Org: "kubernetes", Qualifiers: "org:kubernetes"}, {Org: "kubernetes-sigs", Qualifiers: "org:kubernetes-sigs"}}
+	if err != nil || !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("expected %v, got %v, %v", expected, scopes, err)
+	}
+	if scopes, err := searchScopes(Config{}, log.Default()); err != nil || !reflect.DeepEqual(scopes, []TargetScope{{}}) {
+		t.Errorf("expected a single unscoped search, got %v, %v", scopes, err)
+	}
+
+	orgsConfig := filepath.Join(t.TempDir(), "orgs.yaml")
+	if err := os.WriteFile(orgsConfig, []byte("orgs:\n  kubernetes:\n    repos:\n      test-infra: {}\n      website: {}\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	scopes, err = searchScopes(Config{OrgsConfig: orgsConfig, OrgsConfigFilter: "test-infra"}, log.Default())
+	expected = []TargetScope{{Org: "kubernetes", Qualifiers: "repo:kubernetes/test-infra"}}
+	if err != nil || !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("expected %v, got %v, %v", expected, scopes, err)
+	}
+	if _, err := searchScopes(Config{OrgsConfig: orgsConfig, OrgsConfigFilter: "nothing"}, log.Default()); err == nil {
+		t.Error("expected an error when the filter leaves no repos")
+	}
+	if _, err := searchScopes(Config{OrgsConfig: filepath.Join(t.TempDir(), "missing.yaml")}, log.Default()); err == nil {
+		t.Error("expected an error for a missing config")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		return Config{
+			Query:              "is:open",
+			Comment:            flagutil.NewStrings("hello"),
+			Token:              "token",
+			Provider:           "github",
+			Workers:            1,
+			CommentMaxLength:   MaxCommentLength,
+			MinimizeClassifier: "outdated",
+			PruneMax:           5,
+			MaxReviews:         -1,
+		}
+	}
+	cases := []struct {
+		name   string
+		modify func(*Config)
+		err    string
+		check  func(Config) bool
+	}{
+		{
+			name:   "valid",
+			modify: func(*Config) {},
+		},
+		{
+			name:   "no query",
+			modify: func(o *Config) { o.Query = "" },
+			err:    "empty --query",
+		},
+		{
+			name:   "no token",
+			modify: func(o *Config) { o.Token = "" },
+			err:    "empty --token",
+		},
+		{
+			name: "github app",
+			modify: func(o *Config) {
+				o.Token, o.GitHubAppID, o.GitHubAppPrivateKeyPath, o.Org = "", "123", "key.pem", "kubernetes"
+			},
+		},
+		{
+			name:   "github app and token",
+			modify: func(o *Config) { o.GitHubAppID, o.GitHubAppPrivateKeyPath = "123", "key.pem" },
+			err:    "--token is mutually exclusive with --github-app-id",
+		},
+		{
+			name:   "github app without a private key",
+			modify: func(o *Config) { o.Token, o.GitHubAppID, o.Org = "", "123", "kubernetes" },
+			err:    "must be set together",
+		},
+		{
+			name:   "github app searching without an org",
+			modify: func(o *Config) { o.Token, o.GitHubAppID, o.GitHubAppPrivateKeyPath = "", "123", "key.pem" },
+			err:    "--github-app-id requires --org",
+		},
+		{
+			name: "github app on gitlab",
+			modify: func(o *Config) {
+				o.Provider, o.GitLabBaseURL, o.GitLabTokenPath, o.GitHubAppID = "gitlab", "https://gitlab.com", "token", "123"
+			},
+			err: "--github-app-id",
+		},
+		{
+			name:   "org in both --org and --query",
+			modify: func(o *Config) { o.Org, o.Query = "kubernetes", "org:kubernetes-sigs is:open" },
+			err:    "--org conflicts with org: in --query",
+		},
+		{
+			name:   "--only-prs",
+			modify: func(o *Config) { o.OnlyPRs = true },
+			check:  func(o Config) bool { return o.kind == OnlyPRs },
+		},
+		{
+			name:   "--stale-warn-label leaves --query to the searches",
+			modify: func(o *Config) { o.StaleWarnLabel = "stale" },
+			check:  func(o Config) bool { return o.Validate() == nil && o.Query == "is:open" },
+		},
+		{
+			name: "--last-run-file with updated: in --query",
+			modify: func(o *Config) {
+				o.LastRunFile, o.Updated, o.Query = "last-run", time.Hour, "is:open updated:>2024-01-01"
+			},
+			err: "--last-run-file conflicts with updated:>2024-01-01",
+		},
+		{
+			name: "--last-run-file with a negated updated: in --query",
+			modify: func(o *Config) {
+				o.LastRunFile, o.Updated, o.Query = "last-run", time.Hour, "is:open -updated:<2024-01-01"
+			},
+			err: "--last-run-file conflicts with -updated:<2024-01-01",
+		},
+		{
+			name: "--last-run-file with updated: quoted in --query",
+			modify: func(o *Config) {
+				o.LastRunFile, o.Updated, o.Query = "last-run", time.Hour, `is:open label:"needs updated: docs"`
+			},
+		},
+		{
+			name:   "bad --title-regex",
+			modify: func(o *Config) { o.TitleRegex = "(" },
+			err:    "bad --title-regex",
+		},
+	}
+	for _, tc := range cases {
+		o := valid()
+		tc.modify(&o)
+		err := o.Validate()
+		switch {
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.err, err)
+		case tc.check != nil && !tc.check(o):
+			t.Errorf("%s: unexpected config after validation: %+v", tc.name, o)
+		}
+	}
+}
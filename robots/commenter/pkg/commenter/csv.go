@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvHeader names the columns of the --output-csv.
+var csvHeader = []string{"org", "repo", "number", "url", "title", "author", "labels", "created", "updated", "action", "error"}
+
+// writeCSV writes a row for each of the entries, in the order of
+// writeSummary, with the problems that mention the issue as its error.
+func writeCSV(w io.Writer, h SummaryHeader, res Result, entries []summaryEntry) error {
+	entries = sortedEntries(entries)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		var labels []string
+		for _, l := range e.issue.Labels {
+			labels = append(labels, l.Name)
+		}
+		row := []string{
+			e.ref.Org,
+			e.ref.Repo,
+			strconv.Itoa(e.ref.Number),
+			e.issue.HTMLURL,
+			e.issue.Title,
+			e.issue.User.Login,
+			strings.Join(labels, ";"),
+			csvTime(e.issue.CreatedAt),
+			csvTime(e.issue.UpdatedAt),
+			h.describe(e.outcome),
+			strings.Join(problemsAbout(res.Problems, e.ref, e.issue.HTMLURL), "; "),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvTime formats t for a spreadsheet, leaving it blank if unknown.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// problemsAbout returns the problems that mention the issue by its URL or
+// ref, but not those about an issue whose number merely starts with its own,
+// such as issue 10 for issue 1.
+func problemsAbout(problems []string, ref IssueRef, url string) []string {
+	var about []string
+	for _, p := range problems {
+		if mentions(p, url) || mentions(p, ref.String()) {
+			about = append(about, p)
+		}
+	}
+	return about
+}
+
+// mentions reports whether s contains name not followed by another digit.
+func mentions(s, name string) bool {
+	for {
+		n := strings.Index(s, name)
+		if n < 0 {
+			return false
+		}
+		s = s[n+len(name):]
+		if s == "" || s[0] < '0' || s[0] > '9' {
+			return true
+		}
+	}
+}
+
+// SaveCSV writes a row for each issue processed, with what was done to it,
+// to path.
+func (s *SummaryLog) SaveCSV(path string, h SummaryHeader, res Result) error {
+	s.Lock()
+	entries := s.entries
+	s.Unlock()
+	var buf bytes.Buffer
+	if err := writeCSV(&buf, h, res, entries); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
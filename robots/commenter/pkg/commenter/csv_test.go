@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestSaveCSVRoundTrip(t *testing.T) {
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	quoted := makeIssue("o", "r", 1, `Flaky "e2e", sweep again`)
+	quoted.User.Login = "alice"
+	quoted.Labels = []github.Label{{Name: "kind/flake"}, {Name: "sig/node"}}
+	quoted.CreatedAt = created
+	quoted.UpdatedAt = updated
+	multiline := makeIssue("o", "r", 10, "sweep line one\nline two")
+	failing := makeIssue("o", "error", 2, "sweep broken")
+	c := fakeClient{issues: []github.Issue{quoted, multiline, failing}}
+	summary := NewSummaryLog()
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Summary:       summary,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "out.csv")
+	if err := summary.SaveCSV(path, SummaryHeader{}, res); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read back the CSV: %v", err)
+	}
+	if len(res.Problems) != 1 {
+		t.Fatalf("expected a single problem, got %q", res.Problems)
+	}
+	expected := [][]string{
+		csvHeader,
+		{"o", "error", "2", failing.HTMLURL, "sweep broken", "", "", "", "", "failed", res.Problems[0]},
+		{"o", "r", "1", quoted.HTMLURL, `Flaky "e2e", sweep again`, "alice", "kind/flake;sig/node", "2023-05-01T12:00:00Z", "2023-06-01T12:00:00Z", "commented", ""},
+		{"o", "r", "10", multiline.HTMLURL, "sweep line one\nline two", "", "", "", "", "commented", ""},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, rows)
+	}
+}
+
+func TestProblemsAbout(t *testing.T) {
+	problems := []string{
+		"Failed to comment on https://github.com/o/r/issues/1: boom",
+		"Failed to comment on https://github.com/o/r/issues/10: boom",
+		"Failed to add labels to o/r#1: boom",
+		"Failed to add labels to o/r#12: boom",
+		"Failed to write the roll-up: boom",
+	}
+	actual := problemsAbout(problems, IssueRef{Org: "o", Repo: "r", Number: 1}, "https://github.com/o/r/issues/1")
+	expected := []string{problems[0], problems[2]}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
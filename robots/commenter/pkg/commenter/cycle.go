@@ -0,0 +1,288 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"k8s.io/test-infra/prow/config/secret"
+)
+
+// cycle is a single run of a Config, which --interval repeats: it searches
+// up to the current cutoff, runs, and then writes and posts what the run
+// leaves behind.
+type cycle struct {
+	o      Config
+	client Client
+	// opts are the options of every run, each setting its own searches,
+	// recheck cutoff and logs.
+	opts   Options
+	scopes []TargetScope
+	// lastRun, if set, narrows the searches to the issues that went stale
+	// since the last run.
+	lastRun       *LastRun
+	slackWebhook  func() []byte
+	reportWebhook func() []byte
+	reportHeaders http.Header
+	logger        *log.Logger
+}
+
+// searches scopes the query to the issues updated up to cutoff, or since the
+// last run with a --last-run-file.
+func (c *cycle) searches(cutoff time.Time) ([]OrgSearch, error) {
+	o := c.o
+	// Warnings update the issues, so escalations must be found by a search
+	// of their own cutoff, leaving Run to hold warnings to --updated.
+	minUpdated, window := o.Updated, ""
+	if o.Escalate && o.EscalationAfter < minUpdated {
+		minUpdated = o.EscalationAfter
+	}
+	if c.lastRun != nil {
+		var err error
+		if window, err = c.lastRun.Qualifier(cutoff); err != nil {
+			return nil, err
+		}
+		minUpdated = 0
+	}
+	var searches []OrgSearch
+	for _, scope := range c.scopes {
+		query := o.Query
+		if stale := staleQualifier(o); stale != "" {
+			query += " " + stale
+		}
+		if window != "" {
+			query = window + " " + query
+		}
+		if scope.Qualifiers != "" {
+			query = scope.Qualifiers + " " + query
+		}
+		queries, err := MakeQuery(QueryOptions{
+			Query:           query,
+			IncludeArchived: o.IncludeArchived,
+			IncludeClosed:   o.IncludeClosed,
+			IncludeLocked:   o.IncludeLocked,
+			Kind:            o.kind,
+			MinUpdated:      minUpdated,
+			MaxUpdated:      o.UpdatedMax,
+			UpdatedBefore:   o.UpdatedBefore,
+			UpdatedAfter:    o.UpdatedAfter,
+			CreatedBefore:   o.CreatedBefore,
+			CreatedAfter:    o.CreatedAfter,
+			Split:           o.SplitQuery,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bad query %q: %w", query, err)
+		}
+		searches = append(searches, OrgSearch{Org: scope.Org, Queries: queries})
+	}
+	return searches, nil
+}
+
+// loadWebhooks starts watching the --slack-webhook-file and
+// --report-webhook-url-file, which are secrets.
+func (c *cycle) loadWebhooks() error {
+	o := c.o
+	if o.SlackWebhookFile != "" {
+		if err := secret.Add(o.SlackWebhookFile); err != nil {
+			return fmt.Errorf("failed to load --slack-webhook-file: %w", err)
+		}
+		c.slackWebhook = func() []byte {
+			return bytes.TrimSpace(secret.GetSecret(o.SlackWebhookFile))
+		}
+	}
+	if o.ReportWebhookFile != "" {
+		if err := secret.Add(o.ReportWebhookFile); err != nil {
+			return fmt.Errorf("failed to load --report-webhook-url-file: %w", err)
+		}
+		c.reportWebhook = func() []byte {
+			return bytes.TrimSpace(secret.GetSecret(o.ReportWebhookFile))
+		}
+		h, err := ParseReportHeaders(o.ReportWebhookHeaders.Strings())
+		if err != nil {
+			return fmt.Errorf("bad --report-webhook-header: %w", err)
+		}
+		c.reportHeaders = h
+	}
+	return nil
+}
+
+// run runs once with the searches rebuilt for the current cutoff, then
+// reports the result and saves what the next runs need.
+func (c *cycle) run(ctx context.Context) (Result, error) {
+	o := c.o
+	cutoff := time.Now().Add(-o.Updated)
+	if o.Query != "" {
+		searches, err := c.searches(cutoff)
+		if errors.Is(err, ErrNoNewWindow) {
+			// The clock went back, and the last run already searched up to here.
+			c.logger.Printf("Skipping the run: %v", err)
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		c.opts.Searches = searches
+	}
+	if o.RecheckUpdated {
+		c.opts.RecheckCutoff = time.Now().Add(-o.Updated)
+	}
+	if o.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.MaxDuration)
+		defer cancel()
+	}
+	if o.SummaryMarkdown != "" || o.OutputCSV != "" {
+		c.opts.Summary = NewSummaryLog()
+	}
+	if o.ExportMetricsFile != "" {
+		c.opts.Metrics = &MetricsLog{}
+	}
+	if o.RollupRepo != "" {
+		c.opts.Rollup = NewRollup(o.rollupTarget.Org, o.rollupTarget.Repo, o.RollupTitle)
+		c.opts.Rollup.GroupBy = o.RollupBy
+	}
+	res, err := Run(ctx, c.client, c.opts)
+	c.report(res, err)
+	c.save(cutoff, res, err != nil || ctx.Err() != nil)
+	return res, err
+}
+
+// report writes the metrics, summary and CSV of a run and posts it to Slack
+// and the report webhook, logging the failures.
+func (c *cycle) report(res Result, err error) {
+	o := c.o
+	if c.opts.Metrics != nil {
+		if err := c.opts.Metrics.Save(o.ExportMetricsFile); err != nil {
+			c.logger.Printf("Failed to write --export-metrics-file: %v", err)
+		}
+	}
+	describe := describe(o)
+	if c.opts.Summary != nil {
+		h := SummaryHeader{Query: describe, DryRun: !o.Confirm, Ceiling: o.Ceiling, Now: time.Now()}
+		if o.Updated > 0 {
+			h.Cutoff = h.Now.Add(-o.Updated)
+		} else if !o.UpdatedBefore.IsZero() {
+			h.Cutoff = o.UpdatedBefore
+		}
+		if o.SummaryMarkdown != "" {
+			if err := c.opts.Summary.Save(o.SummaryMarkdown, h, res); err != nil {
+				c.logger.Printf("Failed to write --summary-markdown: %v", err)
+			}
+		}
+		if o.OutputCSV != "" {
+			if err := c.opts.Summary.SaveCSV(o.OutputCSV, h, res); err != nil {
+				c.logger.Printf("Failed to write --output-csv: %v", err)
+			}
+		}
+	}
+	if c.slackWebhook != nil {
+		summary := NewSlackSummary(describe, !o.Confirm, res, err, o.SlackMaxIssues)
+		if err := PostSlack(string(c.slackWebhook()), summary); err != nil {
+			c.logger.Printf("Failed to post the summary to Slack: %v", err)
+		}
+	}
+	if c.reportWebhook != nil {
+		report := NewRunReport(describe, !o.Confirm, res, err)
+		if err := PostReport(string(c.reportWebhook()), c.reportHeaders, report); err != nil {
+			c.logger.Printf("Failed to post the report to --report-webhook-url-file: %v", err)
+		}
+	}
+}
+
+// save appends the actions the run scheduled to the --scheduled-actions-file,
+// writes the --state-file and advances the --last-run-file to cutoff.
+func (c *cycle) save(cutoff time.Time, res Result, failed bool) {
+	o := c.o
+	if c.opts.Schedule != nil {
+		if actions := c.opts.Schedule.Take(); !o.Confirm {
+			c.logger.Printf("Not scheduling %d actions in %s without --confirm", len(actions), o.ScheduledActionsFile)
+		} else if err := AppendScheduledActions(o.ScheduledActionsFile, actions); err != nil {
+			c.logger.Printf("Failed to write %s: %v", o.ScheduledActionsFile, err)
+		}
+	}
+	if c.opts.State != nil {
+		if !o.Confirm {
+			c.logger.Printf("Not writing %s without --confirm", o.StateFile)
+		} else if err := c.opts.State.Save(); err != nil {
+			c.logger.Printf("Failed to write %s: %v", o.StateFile, err)
+		}
+	}
+	if c.lastRun != nil {
+		advanceLastRun(c.lastRun, o, cutoff, res, failed, c.logger)
+	}
+}
+
+// describe returns what the runs of o search, for summaries and reports.
+func describe(o Config) string {
+	describe := o.Query
+	if o.IssuesFile != "" {
+		describe = "--issues-file=" + o.IssuesFile
+	}
+	if o.Org != "" {
+		describe = "--org=" + o.Org + " " + describe
+	}
+	if o.ProwConfig != "" {
+		describe = "--prow-config=" + o.ProwConfig + " " + describe
+	}
+	if o.OrgsConfig != "" {
+		describe = "--orgs-config=" + o.OrgsConfig + " " + describe
+	}
+	return describe
+}
+
+// advanceLastRun records the cutoff of a run in the --last-run-file unless
+// some of the issues it matched could be left behind: when it failed, was
+// interrupted or left issues over, or, without --last-run-advance-on-partial,
+// failed on some of them.
+func advanceLastRun(l *LastRun, o Config, cutoff time.Time, res Result, failed bool, logger *log.Logger) {
+	switch {
+	case !o.Confirm:
+		logger.Printf("Not writing %s without --confirm", o.LastRunFile)
+	case failed:
+		logger.Printf("Not advancing %s after a failed or interrupted run", o.LastRunFile)
+	case res.LeftOver() > 0:
+		logger.Printf("Not advancing %s with %d matched issues left over", o.LastRunFile, res.LeftOver())
+	case len(res.Problems) > 0 && !o.LastRunAdvanceOnPartial:
+		logger.Printf("Not advancing %s after %d problems, see --last-run-advance-on-partial", o.LastRunFile, len(res.Problems))
+	default:
+		if err := l.Advance(cutoff); err != nil {
+			logger.Printf("Failed to write %s: %v", o.LastRunFile, err)
+		}
+	}
+}
+
+// runEvery calls cycle every interval until ctx is done, logging failures
+// instead of stopping. A cycle in flight is left to wind down by itself.
+func runEvery(ctx context.Context, interval time.Duration, cycle func() error, logger *log.Logger) {
+	for {
+		if err := cycle(); err != nil {
+			logger.Printf("Failed run: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			logger.Print("Stopping after the current run")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvanceLastRun(t *testing.T) {
+	cutoff := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		confirm   bool
+		onPartial bool
+		res       Result
+		failed    bool
+		advanced  bool
+	}{
+		{
+			name:     "successful run",
+			confirm:  true,
+			res:      Result{Matched: 2, Commented: 1, Skipped: 1},
+			advanced: true,
+		},
+		{
+			name: "dry run",
+			res:  Result{Matched: 1, Commented: 1},
+		},
+		{
+			name:    "failed or interrupted run",
+			confirm: true,
+			failed:  true,
+		},
+		{
+			name:    "issues left over by the ceiling",
+			confirm: true,
+			res:     Result{Matched: 3, Commented: 1},
+		},
+		{
+			name:    "partial failure",
+			confirm: true,
+			res:     Result{Matched: 2, Commented: 1, Failed: 1, Problems: []string{"boom"}},
+		},
+		{
+			name:      "partial failure with --last-run-advance-on-partial",
+			confirm:   true,
+			onPartial: true,
+			res:       Result{Matched: 2, Commented: 1, Failed: 1, Problems: []string{"boom"}},
+			advanced:  true,
+		},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), "last-run.json")
+		l, err := LoadLastRun(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		o := Config{Confirm: tc.confirm, LastRunFile: path, LastRunAdvanceOnPartial: tc.onPartial}
+		advanceLastRun(l, o, cutoff, tc.res, tc.failed, log.Default())
+		if l, err = LoadLastRun(path); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		q, _ := l.Qualifier(cutoff.Add(time.Hour))
+		if advanced := q != "updated:<=2024-03-01T11:00:00Z"; advanced != tc.advanced {
+			t.Errorf("%s: expected advanced=%t, got the window %q", tc.name, tc.advanced, q)
+		}
+	}
+}
+
+func TestRunEvery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cycles := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runEvery(ctx, time.Millisecond, func() error {
+			cycles++
+			if cycles == 3 {
+				cancel()
+			}
+			// A failed cycle must not stop the loop.
+			return errors.New("injected failure")
+		}, log.Default())
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("runEvery did not stop after cancellation")
+	}
+	if cycles != 3 {
+		t.Errorf("expected 3 cycles, got %d", cycles)
+	}
+}
+
+func TestCycleSearchesStaleLabel(t *testing.T) {
+	cases := []struct {
+		name     string
+		o        Config
+		expected string
+	}{
+		{
+			name:     "warning runs skip the issues already warned",
+			o:        Config{Query: "is:open", StaleWarnLabel: "stale"},
+			expected: `-label:"stale"`,
+		},
+		{
+			name:     "closing runs only take the issues already warned",
+			o:        Config{Query: "is:open", StaleWarnLabel: "stale", StaleCloseLabel: "closed"},
+			expected: `label:"stale"`,
+		},
+	}
+	for _, tc := range cases {
+		c := cycle{o: tc.o, scopes: []TargetScope{{Org: "kubernetes", Qualifiers: "org:kubernetes"}}}
+		for range [2]struct{}{} {
+			searches, err := c.searches(time.Now())
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.name, err)
+			}
+			if len(searches) != 1 || len(searches[0].Queries) != 1 {
+				t.Fatalf("%s: expected a single query, got %+v", tc.name, searches)
+			}
+			if q := searches[0].Queries[0]; strings.Count(q, tc.expected) != 1 || strings.Count(q, "label:") != 1 {
+				t.Errorf("%s: expected %s once in %q", tc.name, tc.expected, q)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/config/secret"
+)
+
+// smtpConfig is the --smtp-config file.
+type smtpConfig struct {
+	Host string `json:"host"`
+	// Port defaults to 587, for submission with STARTTLS.
+	Port int    `json:"port,omitempty"`
+	From string `json:"from"`
+	// Username and the password in PasswordFile authenticate, if set.
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+}
+
+// loadSMTPConfig reads and validates the YAML file at path.
+func loadSMTPConfig(path string) (smtpConfig, error) {
+	var config smtpConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.UnmarshalStrict(b, &config); err != nil {
+		return config, err
+	}
+	if config.Host == "" || config.From == "" {
+		return config, errors.New("host and from are required")
+	}
+	if (config.Username == "") != (config.PasswordFile == "") {
+		return config, errors.New("username and password_file must be set together")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return config, nil
+}
+
+// sendMailFunc has the signature of smtp.SendMail.
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// Emailer sends issue authors a copy of the comments on their issues.
+type Emailer struct {
+	config   smtpConfig
+	password func() []byte
+	// render is the --email-template-file, or nil to send the comment.
+	render func(Meta) (string, error)
+	send   sendMailFunc
+	// confirm sends, otherwise what would be sent is only logged.
+	Confirm bool
+	Audit   *AuditLog
+}
+
+// NewEmailer loads the --smtp-config and --email-template-file, if set.
+func NewEmailer(configPath, templatePath string) (*Emailer, error) {
+	config, err := loadSMTPConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", configPath, err)
+	}
+	e := &Emailer{config: config, send: smtp.SendMail}
+	if config.PasswordFile != "" {
+		if err := secret.Add(config.PasswordFile); err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", config.PasswordFile, err)
+		}
+		e.password = func() []byte {
+			return []byte(strings.TrimSpace(string(secret.GetSecret(config.PasswordFile))))
+		}
+	}
+	if templatePath != "" {
+		b, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := newTemplate("email").Parse(string(b)); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", templatePath, err)
+		}
+		e.render = MakeCommenter(string(b), true)
+	}
+	return e, nil
+}
+
+// message formats a plain text email.
+func (e *Emailer) message(to, subject, body string) []byte {
+	subject = strings.Join(strings.Fields(subject), " ")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// emailAuthor sends the author of the issue in m either the comment or the
+// --email-template-file rendered for m. Authors without a public email are
+// skipped.
+func emailAuthor(ctx context.Context, c Client, e *Emailer, m Meta, comment string, logger *log.Logger) error {
+	login := m.Issue.User.Login
+	to, err := userEmail(ctx, c, m.Org, login)
+	if err != nil {
+		return fmt.Errorf("failed to look up the email of %s: %w", login, err)
+	}
+	if to == "" {
+		return nil
+	}
+	body := comment
+	if e.render != nil {
+		if body, err = e.render(m); err != nil {
+			return fmt.Errorf("failed to render the email: %w", err)
+		}
+	}
+	ref := IssueRef{Org: m.Org, Repo: m.Repo, Number: m.Number}
+	if !e.Confirm {
+		logger.Printf("Would email %s about %s", login, m.Issue.HTMLURL)
+		e.Audit.record(auditEmail, ref, body, login, nil)
+		return nil
+	}
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		auth = smtp.PlainAuth("", e.config.Username, string(e.password()), e.config.Host)
+	}
+	subject := fmt.Sprintf("Re: %s (%s/%s#%d)", m.Issue.Title, m.Org, m.Repo, m.Number)
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	err = e.send(addr, auth, e.config.From, []string{to}, e.message(to, subject, body))
+	e.Audit.record(auditEmail, ref, body, login, err)
+	if err != nil {
+		return err
+	}
+	logger.Printf("Emailed %s about %s", login, m.Issue.HTMLURL)
+	return nil
+}
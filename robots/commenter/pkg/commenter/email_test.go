@@ -0,0 +1,180 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestLoadSMTPConfig(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected smtpConfig
+		err      bool
+	}{
+		{
+			name:     "defaults the port",
+			content:  "host: smtp.example.com\nfrom: bot@example.com\n",
+			expected: smtpConfig{Host: "smtp.example.com", Port: 587, From: "bot@example.com"},
+		},
+		{
+			name:     "authenticates",
+			content:  "host: smtp.example.com\nport: 25\nfrom: bot@example.com\nusername: bot\npassword_file: /etc/smtp/password\n",
+			expected: smtpConfig{Host: "smtp.example.com", Port: 25, From: "bot@example.com", Username: "bot", PasswordFile: "/etc/smtp/password"},
+		},
+		{
+			name:    "missing from",
+			content: "host: smtp.example.com\n",
+			err:     true,
+		},
+		{
+			name:    "username without password",
+			content: "host: smtp.example.com\nfrom: bot@example.com\nusername: bot\n",
+			err:     true,
+		},
+		{
+			name:    "unknown field",
+			content: "host: smtp.example.com\nfrom: bot@example.com\ntls: true\n",
+			err:     true,
+		},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), "smtp.yaml")
+		if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		config, err := loadSMTPConfig(path)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.err, err)
+		} else if !tc.err && config != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, config)
+		}
+	}
+}
+
+// sentMail is an email passed to a fake sendMailFunc.
+type sentMail struct {
+	addr string
+	to   []string
+	msg  string
+}
+
+func fakeEmailer(sent *[]sentMail, sendErr error) *Emailer {
+	return &Emailer{
+		config:  smtpConfig{Host: "smtp.example.com", Port: 587, From: "bot@example.com"},
+		Confirm: true,
+		send: func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			if sendErr != nil {
+				return sendErr
+			}
+			*sent = append(*sent, sentMail{addr: addr, to: to, msg: string(msg)})
+			return nil
+		},
+	}
+}
+
+func TestEmailAuthor(t *testing.T) {
+	issue := func(login string) Meta {
+		i := makeIssue("o", "r", 1, "Flaky\ntest")
+		i.User.Login = login
+		return Meta{Org: "o", Repo: "r", Number: 1, Issue: i}
+	}
+	c := fakeClient{emails: map[string]string{"alice": "alice@example.com"}}
+
+	var sent []sentMail
+	if err := emailAuthor(context.Background(), &c, fakeEmailer(&sent, nil), issue("alice"), "the comment", log.Default()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 email, got %v", sent)
+	}
+	if sent[0].addr != "smtp.example.com:587" || !reflect.DeepEqual(sent[0].to, []string{"alice@example.com"}) {
+		t.Errorf("bad email %+v", sent[0])
+	}
+	for _, s := range []string{"To: alice@example.com\r\n", "Subject: Re: Flaky test (o/r#1)\r\n", "\r\n\r\nthe comment"} {
+		if !strings.Contains(sent[0].msg, s) {
+			t.Errorf("expected the email to contain %q, got %q", s, sent[0].msg)
+		}
+	}
+
+	sent = nil
+	templated := fakeEmailer(&sent, nil)
+	templated.render = MakeCommenter("Hi {{.Issue.User.Login}}, see {{.Issue.HTMLURL}}", true)
+	if err := emailAuthor(context.Background(), &c, templated, issue("alice"), "the comment", log.Default()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sent) != 1 || !strings.HasSuffix(sent[0].msg, "Hi alice, see fake://localhost/o/r/issues/1") {
+		t.Errorf("expected the templated email, got %v", sent)
+	}
+
+	sent = nil
+	if err := emailAuthor(context.Background(), &c, fakeEmailer(&sent, nil), issue("bob"), "the comment", log.Default()); err != nil || sent != nil {
+		t.Errorf("expected to skip an author without a public email, got %v, %v", sent, err)
+	}
+
+	dryRun := fakeEmailer(&sent, nil)
+	dryRun.Confirm = false
+	if err := emailAuthor(context.Background(), &c, dryRun, issue("alice"), "the comment", log.Default()); err != nil || sent != nil {
+		t.Errorf("expected not to send in dry-run, got %v, %v", sent, err)
+	}
+
+	if err := emailAuthor(context.Background(), &c, fakeEmailer(&sent, nil), issue("error"), "the comment", log.Default()); err == nil {
+		t.Error("failed to report the failed lookup")
+	}
+	if err := emailAuthor(context.Background(), &c, fakeEmailer(&sent, errors.New("injected send error")), issue("alice"), "the comment", log.Default()); err == nil {
+		t.Error("failed to report the failed send")
+	}
+}
+
+func TestRunEmailsAuthor(t *testing.T) {
+	authored := func(number int, login string) github.Issue {
+		i := makeIssue("o", "r", number, "email")
+		i.User.Login = login
+		return i
+	}
+	c := fakeClient{
+		issues: []github.Issue{authored(1, "alice"), authored(2, "bob"), authored(3, "error")},
+		emails: map[string]string{"alice": "alice@example.com"},
+	}
+	var sent []sentMail
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("email"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Email:         fakeEmailer(&sent, nil),
+	}))
+	if err == nil {
+		t.Error("failed to report the email that could not be sent")
+	}
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if len(sent) != 1 || sent[0].to[0] != "alice@example.com" {
+		t.Errorf("expected to email only alice, got %v", sent)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// Escalation turns a run into the second stage of a warning: issues the bot
+// already warned with the marker get the escalation comment and actions once
+// the warning is old enough, while the others are warned as usual if they
+// were not updated within Options.MinInactivity.
+type Escalation struct {
+	// After is how long a warning stands before it is escalated.
+	After time.Duration
+	// Commenter renders the escalation comment.
+	Commenter func(Meta) (string, error)
+	// Close closes escalated issues, after adding AddLabels.
+	Close bool
+	// AddLabels are added to escalated issues.
+	AddLabels []string
+}
+
+// escalationStage is where an issue is in the escalation.
+type escalationStage int
+
+const (
+	// stageWarn issues have not been warned yet.
+	stageWarn escalationStage = iota
+	// stageWaiting issues were warned less than Escalation.After ago.
+	stageWaiting
+	// stageEscalate issues were warned long enough ago to escalate.
+	stageEscalate
+	// stageEscalated issues were escalated since their latest warning.
+	stageEscalated
+)
+
+// escalationMarker is the marker of escalation comments, which must differ
+// from that of warnings.
+func escalationMarker(marker string) string {
+	return marker + "-escalated"
+}
+
+// stageOf returns the stage of an issue with comments, along with when the
+// latest warning was posted if there is one. Only comments of the bot with
+// the marker count as warnings.
+func stageOf(comments []github.IssueComment, marker string, isBot func(candidate string) bool, after time.Duration, now time.Time) (escalationStage, time.Time) {
+	var warned, escalated time.Time
+	for _, comment := range comments {
+		if !isBot(comment.User.Login) {
+			continue
+		}
+		switch {
+		case strings.Contains(comment.Body, markerTag(marker)):
+			if comment.CreatedAt.After(warned) {
+				warned = comment.CreatedAt
+			}
+		case strings.Contains(comment.Body, markerTag(escalationMarker(marker))):
+			if comment.CreatedAt.After(escalated) {
+				escalated = comment.CreatedAt
+			}
+		}
+	}
+	switch {
+	case !escalated.IsZero() && !escalated.Before(warned):
+		return stageEscalated, warned
+	case warned.IsZero():
+		return stageWarn, warned
+	case now.Sub(warned) < after:
+		return stageWaiting, warned
+	}
+	return stageEscalate, warned
+}
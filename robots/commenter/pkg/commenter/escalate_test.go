@@ -0,0 +1,138 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestStageOf(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	comment := func(login, body string, age time.Duration) github.IssueComment {
+		return github.IssueComment{User: github.User{Login: login}, Body: body, CreatedAt: now.Add(-age)}
+	}
+	warning := withMarker("stale", "m")
+	escalation := withMarker("closing", escalationMarker("m"))
+	isBot := func(login string) bool { return login == "bot" }
+	day := 24 * time.Hour
+	cases := []struct {
+		name     string
+		comments []github.IssueComment
+		stage    escalationStage
+		warned   time.Time
+	}{
+		{
+			name:     "fresh issue",
+			comments: []github.IssueComment{comment("someone", "hi", 40*day)},
+			stage:    stageWarn,
+		},
+		{
+			name:     "marker copied by someone else",
+			comments: []github.IssueComment{comment("someone", warning, 40*day)},
+			stage:    stageWarn,
+		},
+		{
+			name:     "warned recently",
+			comments: []github.IssueComment{comment("bot", warning, 40*day), comment("bot", warning, 10*day)},
+			stage:    stageWaiting,
+			warned:   now.Add(-10 * day),
+		},
+		{
+			name:     "ripe for escalation",
+			comments: []github.IssueComment{comment("bot", warning, 31*day), comment("someone", "ping", 20*day)},
+			stage:    stageEscalate,
+			warned:   now.Add(-31 * day),
+		},
+		{
+			name:     "already escalated",
+			comments: []github.IssueComment{comment("bot", warning, 40*day), comment("bot", escalation, 5*day)},
+			stage:    stageEscalated,
+			warned:   now.Add(-40 * day),
+		},
+		{
+			name:     "warned again after an escalation",
+			comments: []github.IssueComment{comment("bot", escalation, 90*day), comment("bot", warning, 40*day)},
+			stage:    stageEscalate,
+			warned:   now.Add(-40 * day),
+		},
+	}
+	for _, tc := range cases {
+		stage, warned := stageOf(tc.comments, "m", isBot, 30*day, now)
+		if stage != tc.stage || !warned.Equal(tc.warned) {
+			t.Errorf("%s: expected stage %d warned at %s, got %d at %s", tc.name, tc.stage, tc.warned, stage, warned)
+		}
+	}
+}
+
+func TestRunEscalation(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	warned := func(age time.Duration) []github.IssueComment {
+		return []github.IssueComment{{User: github.User{Login: "bot"}, Body: withMarker("stale", "m"), CreatedAt: now.Add(-age)}}
+	}
+	active := makeIssue("o", "r", 4, "escalate")
+	active.UpdatedAt = now.Add(-5 * day)
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "escalate"),
+			makeIssue("o", "r", 2, "escalate"),
+			makeIssue("o", "r", 3, "escalate"),
+			active,
+		},
+		existing: map[int][]github.IssueComment{
+			2: warned(10 * day),
+			3: warned(31 * day),
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("escalate"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("stale", false),
+		Safeguards:    SafeguardOptions{Marker: "m"},
+		Clock:         clocktesting.NewFakePassiveClock(now),
+		MinInactivity: 90 * day,
+		Escalation: &Escalation{
+			After:     30 * day,
+			Commenter: MakeCommenter("closing", false),
+			Close:     true,
+			AddLabels: []string{"lifecycle/rotten"},
+		},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{1, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	expected := []string{withMarker("stale", "m"), withMarker("closing", "m-escalated")}
+	if !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected bodies %q, got %q", expected, c.bodies)
+	}
+	if expected := []int{3}; !reflect.DeepEqual(c.closed, expected) {
+		t.Errorf("expected to close %v, closed %v", expected, c.closed)
+	}
+	if expected := []string{"o/r#3:lifecycle/rotten"}; !reflect.DeepEqual(c.addedLabels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.addedLabels)
+	}
+}
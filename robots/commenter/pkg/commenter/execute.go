@@ -0,0 +1,474 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dgrijalva/jwt-go/v4"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/test-infra/prow/config/secret"
+	"k8s.io/test-infra/prow/github"
+)
+
+// Exit codes of a single run.
+const (
+	exitSuccess = 0
+	// exitFatal is also used for setup and search failures.
+	exitFatal   = 1
+	exitPartial = 2
+	// exitRateLimited is for a run that did not start for --min-rate-limit.
+	exitRateLimited = 3
+	// exitZeroMatches is for a run whose searches matched nothing with
+	// --fail-on-zero-matches.
+	exitZeroMatches = 4
+)
+
+// Execute validates o and runs it, once or every --interval until
+// interrupted, logging to the standard logger. It returns the exit code of
+// a single run.
+func Execute(o Config) int {
+	logger := log.Default()
+	code, err := execute(o, logger)
+	if err != nil {
+		logger.Print(err)
+		return exitFatal
+	}
+	return code
+}
+
+// execute runs o, returning an error for the setup failures.
+func execute(o Config, logger *log.Logger) (int, error) {
+	if err := o.Validate(); err != nil {
+		return exitFatal, err
+	}
+	frame, err := headerFooter(o)
+	if err != nil {
+		return exitFatal, err
+	}
+	c, err := newClient(o, logger)
+	if err != nil {
+		return exitFatal, err
+	}
+
+	safeguards := SafeguardOptions{
+		Marker:         o.Marker,
+		SkipDuplicates: o.SkipDuplicates,
+		MaxLength:      o.CommentMaxLength,
+		NoTruncate:     o.NoTruncate,
+		Logger:         logger,
+	}
+	if o.ActionsRunLink {
+		if safeguards.Footer = actionsRunFooter(os.Getenv); safeguards.Footer == "" {
+			logger.Print("Not linking to the workflow run: not running in GitHub Actions")
+		}
+	}
+	if o.AuditLog != "" {
+		if safeguards.Audit, err = OpenAuditLog(o.AuditLog, !o.Confirm); err != nil {
+			return exitFatal, fmt.Errorf("failed to open --audit-log: %w", err)
+		}
+	}
+	if o.RunScheduledActions {
+		scheduled := func() error {
+			return RunScheduledActionsFile(c, o.ScheduledActionsFile, time.Now(), o.Confirm, safeguards.Audit)
+		}
+		if o.Interval == 0 {
+			if err := scheduled(); err != nil {
+				return exitFatal, fmt.Errorf("failed run: %w", err)
+			}
+			return exitSuccess, nil
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		runEvery(ctx, o.Interval, scheduled, logger)
+		return exitSuccess, nil
+	}
+	seed := o.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if o.SingleIssue != "" {
+		if err := RunSingle(context.Background(), c, o.SingleIssue, frame(MakeVariantCommenter(commentVariants(o), o.UseTemplate, rand.New(rand.NewSource(seed)))), o.Updated, safeguards); err != nil {
+			return exitFatal, fmt.Errorf("failed to comment on %s: %w", o.SingleIssue, err)
+		}
+		return exitSuccess, nil
+	}
+
+	var issueURLs []string
+	if o.IssuesFile != "" {
+		if issueURLs, err = ReadLines(o.IssuesFile); err != nil {
+			return exitFatal, fmt.Errorf("failed to read --issues-file: %w", err)
+		}
+	}
+	cy := &cycle{o: o, client: c, logger: logger}
+	if cy.scopes, err = searchScopes(o, logger); err != nil {
+		return exitFatal, err
+	}
+	if o.LastRunFile != "" {
+		if cy.lastRun, err = LoadLastRun(o.LastRunFile); err != nil {
+			return exitFatal, fmt.Errorf("failed to load --last-run-file: %w", err)
+		}
+	}
+	if o.Query != "" {
+		searches, err := cy.searches(time.Now().Add(-o.Updated))
+		if errors.Is(err, ErrNoNewWindow) {
+			logger.Printf("Warning: %v, so runs search nothing until the clock passes it", err)
+		} else if err != nil {
+			return exitFatal, err
+		}
+		logQuery(o, searches, logger)
+		if o.ValidateOnly {
+			if _, err := Preview(c, searches, o.Sort, o.SortAsc, PreviewMatches, logger); err != nil {
+				return exitFatal, fmt.Errorf("failed run: %w", err)
+			}
+			return exitSuccess, nil
+		}
+	}
+	if cy.opts, err = runOptions(o, c, frame, seed, issueURLs, safeguards, logger); err != nil {
+		return exitFatal, err
+	}
+	if err := cy.loadWebhooks(); err != nil {
+		return exitFatal, err
+	}
+
+	// A signal stops the run from starting more comments, and the results
+	// so far are still logged, written and posted. A second one kills it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if o.Interval == 0 {
+		res, err := cy.run(ctx)
+		if errors.Is(err, ErrRateLimited) {
+			logger.Printf("Failed run: %v", err)
+			return exitRateLimited, nil
+		}
+		if errors.Is(err, ErrZeroMatches) {
+			logger.Printf("Failed run: %v", err)
+			return exitZeroMatches, nil
+		}
+		if err != nil {
+			return exitFatal, fmt.Errorf("failed run: %w", err)
+		}
+		interrupted := ctx.Err() != nil
+		if interrupted {
+			logger.Print("Interrupted, exiting after a partial run")
+		}
+		return exitCode(res, interrupted), nil
+	}
+	// Problems are logged with each run's summary, only fatal errors are left.
+	runEvery(ctx, o.Interval, func() error {
+		_, err := cy.run(ctx)
+		return err
+	}, logger)
+	return exitSuccess, nil
+}
+
+// headerFooter returns a function adding the --header-file and --footer-file
+// to the comments.
+func headerFooter(o Config) (func(func(Meta) (string, error)) func(Meta) (string, error), error) {
+	if o.HeaderFile == "" && o.FooterFile == "" {
+		return func(c func(Meta) (string, error)) func(Meta) (string, error) {
+			return c
+		}, nil
+	}
+	header, err := readOptionalFile(o.HeaderFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --header-file: %w", err)
+	}
+	footer, err := readOptionalFile(o.FooterFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read --footer-file: %w", err)
+	}
+	if _, err := WithHeaderFooter(nil, header, footer); err != nil {
+		return nil, fmt.Errorf("bad --header-file or --footer-file: %w", err)
+	}
+	return func(c func(Meta) (string, error)) func(Meta) (string, error) {
+		framed, _ := WithHeaderFooter(c, header, footer)
+		return framed
+	}, nil
+}
+
+// logQuery logs the final searches of the --query and, with
+// --suggest-query-improvements, how to improve them.
+func logQuery(o Config, searches []OrgSearch, logger *log.Logger) {
+	now := time.Now().UTC()
+	if o.CreatedBefore > 0 {
+		logger.Printf("Matching issues created before %s (--created-before=%s)", now.Add(-o.CreatedBefore).Format(time.RFC3339), o.CreatedBefore)
+	}
+	if o.CreatedAfter > 0 {
+		logger.Printf("Matching issues created after %s (--created-after=%s)", now.Add(-o.CreatedAfter).Format(time.RFC3339), o.CreatedAfter)
+	}
+	for _, s := range searches {
+		logger.Printf("Final query: %s", s)
+	}
+	if !o.SuggestQuery {
+		return
+	}
+	for _, s := range searches {
+		for _, q := range s.Queries {
+			for _, suggestion := range SuggestQuery(q) {
+				logger.Printf("Suggestion for %q: %s", q, suggestion)
+			}
+		}
+	}
+}
+
+// runOptions returns the options of every run of o, without the searches and
+// logs that each run sets itself.
+func runOptions(o Config, c Client, frame func(func(Meta) (string, error)) func(Meta) (string, error), seed int64, issueURLs []string, safeguards SafeguardOptions, logger *log.Logger) (Options, error) {
+	// Without a --comment, the run only applies the actions.
+	var comment func(Meta) (string, error)
+	if variants := commentVariants(o); len(variants) > 0 {
+		comment = frame(MakeVariantCommenter(variants, o.UseTemplate, rand.New(rand.NewSource(seed))))
+	}
+	ro := Options{
+		Sort:          o.Sort,
+		Asc:           o.SortAsc,
+		Random:        o.Random,
+		Rand:          rand.New(rand.NewSource(seed)),
+		SamplePercent: o.SamplePercent,
+		Ceiling:       o.Ceiling,
+		Commenter:     comment,
+
+		RequireWriteAccess: o.RequireWriteAccess,
+		Kind:               o.kind,
+		ClosesIssue:        o.closesIssue,
+		MinRepo:            o.MinRepo,
+		Workers:            o.Workers,
+		Delay:              o.Delay,
+		Safeguards:         safeguards,
+		PullRequests: PRFilterOptions{
+			OnlyConflicted:        o.OnlyConflicted,
+			SkipDrafts:            o.SkipDrafts,
+			Mergeable:             o.PRMergeable,
+			MinCommits:            o.MinCommits,
+			MaxCommits:            o.MaxCommits,
+			DeploymentEnvironment: o.DeploymentEnvironment,
+			DeploymentState:       o.DeploymentState,
+			AllChecksPassed:       o.AllChecksPassed,
+			PRStatus:              o.PRStatus,
+		},
+
+		AwaitingAuthorSince: o.AwaitingAuthorSince,
+		Quiet:               o.Quiet,
+		IssueType:           o.IssueType,
+		Confirm:             o.Confirm,
+		OverflowToGist:      o.OverflowToGist,
+		LabelPrefixes:       o.LabelPrefixes.Strings(),
+		MinInactivity:       o.Updated,
+		ExcerptLength:       o.ExcerptLength,
+		Prune:               o.Prune,
+		PruneMax:            o.PruneMax,
+		SkipWithLinkedPR:    o.SkipWithLinkedPR,
+		Classifier:          o.classifier,
+		MinReactions:        o.MinReactions,
+		IssueURLs:           issueURLs,
+		AddLabels:           append(o.AddLabels.Strings(), staleLabel(o)...),
+		LabelSync:           o.LabelSync,
+		LabelCreate:         o.LabelCreate,
+		TemplateLabels:      o.UseTemplate,
+		BodyRegex:           o.bodyRegexp,
+		TitleRegex:          o.titleRegexp,
+		SkipCodeBlocks:      o.BodyRegexSkipCode,
+		SpamUserList:        o.SpamUserList,
+		SpamDomain:          strings.ToLower(strings.TrimPrefix(o.SpamDomain, "@")),
+		MaxBotComments:      o.MaxBotComments,
+		MinAuthorAge:        o.MinAuthorAge,
+		MaxAuthorAge:        o.MaxAuthorAge,
+		Logger:              logger,
+
+		SkipCrossRepoDuplicates: o.SkipCrossRepoDuplicates,
+		ProjectColumn:           o.ProjectColumn,
+		Close:                   o.StaleCloseLabel != "",
+		Retries:                 o.Retries,
+		RetryDelay:              o.RetryDelay,
+		Repos:                   o.repos,
+		CeilingPerOrg:           o.CeilingPerOrg,
+		RandomWeighted:          o.RandomWeighted,
+		FetchPRDetails:          o.FetchPRDetails,
+		IgnoreMarker:            o.IgnoreMarker,
+		RequestReviewers:        o.reviewers,
+		ReRequestExisting:       o.ReRequestExisting,
+		TransitionLabels:        o.transitions,
+		FetchComments:           o.FetchComments,
+		FetchFullIssue:          o.FetchFullIssue,
+		FailOnZeroMatches:       o.FailOnZeroMatches,
+		WarnBelow:               o.WarnBelow,
+	}
+	if o.Escalate {
+		ro.Escalation = &Escalation{
+			After:     o.EscalationAfter,
+			Commenter: frame(MakeCommenter(o.EscalationComment, o.UseTemplate)),
+			Close:     o.EscalationClose,
+			AddLabels: o.EscalationLabels.Strings(),
+		}
+	}
+	if o.SkipMilestoned || o.OnlyMilestoned {
+		ro.Milestoned = &o.OnlyMilestoned
+	}
+	if o.MinReviews > 0 || o.MaxReviews >= 0 {
+		ro.PullRequests.Reviews = &ReviewFilter{Min: o.MinReviews, Max: o.MaxReviews, State: github.ReviewState(strings.ToUpper(o.ReviewState))}
+	}
+	if o.CloseAfter > 0 {
+		ro.Schedule = &ScheduleQueue{CloseAfter: o.CloseAfter}
+	}
+	ro.Redirect = o.redirect
+	if o.MinRateLimit > 0 {
+		ro.RateLimit = NewRateGuard(c, o.MinRateLimit, o.WaitForRateLimit, o.RateLimitCheckEvery)
+	}
+	if o.ConfirmEach {
+		ro.Prompt = NewLinePrompter(os.Stdin, os.Stdout)
+	}
+	if o.IncludeLinkedPRs {
+		ro.MaxLinkedPRs = o.MaxLinkedPRs
+	}
+	var err error
+	if o.StateFile != "" {
+		if ro.State, err = LoadState(o.StateFile, o.StateReset); err != nil {
+			return ro, fmt.Errorf("failed to load --state-file: %w", err)
+		}
+	}
+	if o.EmailIssueAuthor {
+		if ro.Email, err = NewEmailer(o.SMTPConfig, o.EmailTemplateFile); err != nil {
+			return ro, fmt.Errorf("failed to set up --email-issue-author: %w", err)
+		}
+		ro.Email.Confirm = o.Confirm
+		ro.Email.Audit = safeguards.Audit
+	}
+	return ro, nil
+}
+
+// newClient returns a client for the --provider, which only mutates when confirming.
+func newClient(o Config, logger *log.Logger) (Client, error) {
+	if o.Provider == "gitlab" {
+		if _, err := url.ParseRequestURI(o.GitLabBaseURL); err != nil {
+			return nil, fmt.Errorf("invalid --gitlab-base-url %q: %w", o.GitLabBaseURL, err)
+		}
+		if err := secret.Add(o.GitLabTokenPath); err != nil {
+			return nil, fmt.Errorf("error starting secrets agent: %w", err)
+		}
+		return withCallTimeout(o, NewGitLabClient(o.GitLabBaseURL, secret.GetTokenGenerator(o.GitLabTokenPath), !o.Confirm)), nil
+	}
+
+	for _, ep := range o.Endpoint.Strings() {
+		if _, err := url.ParseRequestURI(ep); err != nil {
+			return nil, fmt.Errorf("invalid --endpoint URL %q: %w", ep, err)
+		}
+	}
+	options := github.ClientOptions{
+		Censor:          secret.Censor,
+		GraphqlEndpoint: o.GraphQLEndpoint,
+		Bases:           o.Endpoint.Strings(),
+		DryRun:          !o.Confirm,
+	}
+	if o.GitHubAppID != "" {
+		// The app client scopes each call to the installation of the org it
+		// names, minting a token per org, so that every org of --org is
+		// searched and commented on as its own installation. An org without
+		// the app installed fails its own calls only.
+		key, err := secret.AddWithParser(o.GitHubAppPrivateKeyPath, func(raw []byte) (*rsa.PrivateKey, error) {
+			return jwt.ParseRSAPrivateKeyFromPEM(raw)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load --github-app-private-key-path: %w", err)
+		}
+		options.AppID, options.AppPrivateKey = o.GitHubAppID, key
+	} else {
+		if err := secret.Add(o.Token); err != nil {
+			return nil, fmt.Errorf("error starting secrets agent: %w", err)
+		}
+		options.GetToken = secret.GetTokenGenerator(o.Token)
+	}
+	_, _, gh, err := github.NewClientFromOptions(logrus.Fields{}, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct GitHub client: %w", err)
+	}
+	// Below the GraphQL client, each page and mutation is timed on its own.
+	c := withCallTimeout(o, gh)
+	if o.UseGraphQL {
+		c = NewGraphQLClient(c, !o.Confirm, logger)
+	}
+	return c, nil
+}
+
+// withCallTimeout applies --github-call-timeout to c, if set.
+func withCallTimeout(o Config, c Client) Client {
+	if o.GitHubCallTimeout == 0 {
+		return c
+	}
+	return WithCallTimeout(context.Background(), c, o.GitHubCallTimeout)
+}
+
+// actionsRunFooter returns a footer linking to the GitHub Actions workflow
+// run described by the environment, or "" outside of GitHub Actions.
+func actionsRunFooter(getenv func(string) string) string {
+	if getenv("GITHUB_ACTIONS") != "true" {
+		return ""
+	}
+	server := getenv("GITHUB_SERVER_URL")
+	if server == "" {
+		server = "https://github.com"
+	}
+	url := fmt.Sprintf("%s/%s/actions/runs/%s", server, getenv("GITHUB_REPOSITORY"), getenv("GITHUB_RUN_ID"))
+	return fmt.Sprintf("*Posted by [workflow run #%s](%s)*", getenv("GITHUB_RUN_NUMBER"), url)
+}
+
+// readOptionalFile returns the contents of the file at path, or "" if path is.
+func readOptionalFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+// exitCode returns exitSuccess without problems, exitPartial when some
+// comments were posted despite problems or the run was interrupted, and
+// exitFatal when none were.
+func exitCode(r Result, interrupted bool) int {
+	switch {
+	case interrupted:
+		return exitPartial
+	case len(r.Problems) == 0:
+		return exitSuccess
+	case r.Commented > 0:
+		return exitPartial
+	default:
+		return exitFatal
+	}
+}
+
+// isTerminal returns whether f is a terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
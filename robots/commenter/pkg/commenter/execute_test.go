@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"testing"
+)
+
+func TestActionsRunFooter(t *testing.T) {
+	env := map[string]string{
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_REPOSITORY": "o/r",
+		"GITHUB_RUN_ID":     "123456",
+		"GITHUB_RUN_NUMBER": "42",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+	if actual, expected := actionsRunFooter(getenv), "*Posted by [workflow run #42](https://github.com/o/r/actions/runs/123456)*"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	env["GITHUB_SERVER_URL"] = "https://ghe.example.com"
+	if actual, expected := actionsRunFooter(getenv), "*Posted by [workflow run #42](https://ghe.example.com/o/r/actions/runs/123456)*"; actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+	env["GITHUB_ACTIONS"] = ""
+	if actual := actionsRunFooter(getenv); actual != "" {
+		t.Errorf("expected no footer outside of GitHub Actions, got %q", actual)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		name        string
+		res         Result
+		interrupted bool
+		expected    int
+	}{
+		{
+			name:     "nothing matched",
+			expected: exitSuccess,
+		},
+		{
+			name:     "every comment posted",
+			res:      Result{Matched: 3, Commented: 2, Skipped: 1},
+			expected: exitSuccess,
+		},
+		{
+			name:     "some comments failed",
+			res:      Result{Matched: 200, Commented: 195, Failed: 5, Problems: make([]string, 5)},
+			expected: exitPartial,
+		},
+		{
+			name:     "commented but an org search failed",
+			res:      Result{Matched: 1, Commented: 1, Problems: []string{"[o] Search failed"}},
+			expected: exitPartial,
+		},
+		{
+			name:     "every comment failed",
+			res:      Result{Matched: 2, Failed: 2, Problems: make([]string, 2)},
+			expected: exitFatal,
+		},
+		{
+			name:        "interrupted before commenting",
+			res:         Result{Matched: 3, Problems: []string{"Stopped with 3 of 3 issues left unprocessed"}},
+			interrupted: true,
+			expected:    exitPartial,
+		},
+		{
+			name:        "interrupted with nothing left",
+			res:         Result{Matched: 1, Commented: 1},
+			interrupted: true,
+			expected:    exitPartial,
+		},
+	}
+	for _, tc := range cases {
+		if actual := exitCode(tc.res, tc.interrupted); actual != tc.expected {
+			t.Errorf("%s: expected exit code %d, got %d", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// templateFuncs are the functions of every template, for Markdown that is
+// awkward to get right with range and if alone.
+var templateFuncs = template.FuncMap{
+	"list":          list,
+	"markdownList":  markdownList,
+	"markdownTable": markdownTable,
+	"mentionAll":    mentionAll,
+	"codeBlock":     codeBlock,
+}
+
+// newTemplate returns an empty template with templateFuncs.
+func newTemplate(name string) *template.Template {
+	return template.New(name).Funcs(templateFuncs)
+}
+
+// list returns its arguments, for the rows of markdownTable.
+func list(items ...string) []string {
+	return items
+}
+
+// texts returns the strings of v: the logins of users, the names of labels,
+// or v itself for strings.
+func texts(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []string:
+		return v, nil
+	case []github.User:
+		var out []string
+		for _, u := range v {
+			out = append(out, u.Login)
+		}
+		return out, nil
+	case []github.Label:
+		var out []string
+		for _, l := range v {
+			out = append(out, l.Name)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot list %T", v)
+}
+
+// markdownList returns a bulleted list of items, indenting the lines after
+// the first of each so that they stay in it.
+func markdownList(items interface{}) (string, error) {
+	s, err := texts(items)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]string, len(s))
+	for n, item := range s {
+		lines[n] = "- " + strings.ReplaceAll(item, "\n", "\n  ")
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// markdownTable returns a table with the header and rows, escaping pipes and
+// line breaks in the cells. Rows are padded or cut to the header.
+func markdownTable(header []string, rows ...[]string) string {
+	if len(header) == 0 {
+		return ""
+	}
+	line := func(cells []string) string {
+		escaped := make([]string, len(header))
+		for n := range escaped {
+			if n < len(cells) {
+				escaped[n] = tableCell(cells[n])
+			}
+		}
+		return "| " + strings.Join(escaped, " | ") + " |"
+	}
+	lines := []string{line(header), "|" + strings.Repeat(" --- |", len(header))}
+	for _, r := range rows {
+		lines = append(lines, line(r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var tableCellReplacer = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// tableCell escapes s for a cell of markdownTable.
+func tableCell(s string) string {
+	return tableCellReplacer.Replace(strings.TrimSpace(s))
+}
+
+// mentionAll returns @mentions of logins separated by commas. Escaped
+// mentions are put in code spans, which GitHub does not notify, for
+// previews.
+func mentionAll(escape bool, logins interface{}) (string, error) {
+	s, err := texts(logins)
+	if err != nil {
+		return "", err
+	}
+	mentions := make([]string, 0, len(s))
+	for _, l := range s {
+		l = strings.TrimPrefix(strings.TrimSpace(l), "@")
+		if l == "" {
+			continue
+		}
+		if escape {
+			mentions = append(mentions, "`@"+l+"`")
+		} else {
+			mentions = append(mentions, "@"+l)
+		}
+	}
+	return strings.Join(mentions, ", "), nil
+}
+
+// codeBlock returns s fenced as code in the language lang, which may be
+// empty. The fence is longer than any run of backticks in s.
+func codeBlock(lang, s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fence + lang + "\n" + strings.TrimSuffix(s, "\n") + "\n" + fence
+}
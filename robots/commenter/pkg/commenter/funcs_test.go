@@ -0,0 +1,243 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestMarkdownList(t *testing.T) {
+	cases := []struct {
+		name     string
+		items    interface{}
+		expected string
+		err      bool
+	}{
+		{
+			name: "nothing",
+		},
+		{
+			name:     "strings",
+			items:    []string{"one", "two"},
+			expected: "- one\n- two",
+		},
+		{
+			name:     "multi-line items stay in the list",
+			items:    []string{"one\nmore"},
+			expected: "- one\n  more",
+		},
+		{
+			name:     "labels",
+			items:    []github.Label{{Name: "kind/bug"}, {Name: "lifecycle/stale"}},
+			expected: "- kind/bug\n- lifecycle/stale",
+		},
+		{
+			name:     "users",
+			items:    []github.User{{Login: "alice"}},
+			expected: "- alice",
+		},
+		{
+			name:  "other types",
+			items: 3,
+			err:   true,
+		},
+	}
+	for _, tc := range cases {
+		actual, err := markdownList(tc.items)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.err, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestMarkdownTable(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   []string
+		rows     [][]string
+		expected string
+	}{
+		{
+			name: "no header",
+			rows: [][]string{{"a"}},
+		},
+		{
+			name:     "header only",
+			header:   []string{"Label", "Since"},
+			expected: "| Label | Since |\n| --- | --- |",
+		},
+		{
+			name:     "rows",
+			header:   []string{"Label", "Since"},
+			rows:     [][]string{{"kind/bug", "2024-03-01"}, {"lifecycle/stale", "2024-04-01"}},
+			expected: "| Label | Since |\n| --- | --- |\n| kind/bug | 2024-03-01 |\n| lifecycle/stale | 2024-04-01 |",
+		},
+		{
+			name:     "cells are escaped",
+			header:   []string{"A|B"},
+			rows:     [][]string{{"one\ntwo "}},
+			expected: "| A\\|B |\n| --- |\n| one<br>two |",
+		},
+		{
+			name:     "rows are fitted to the header",
+			header:   []string{"A", "B"},
+			rows:     [][]string{{"a"}, {"a", "b", "c"}},
+			expected: "| A | B |\n| --- | --- |\n| a |  |\n| a | b |",
+		},
+	}
+	for _, tc := range cases {
+		if actual := markdownTable(tc.header, tc.rows...); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestMentionAll(t *testing.T) {
+	users := []github.User{{Login: "alice"}, {Login: "bob"}}
+	cases := []struct {
+		name     string
+		escape   bool
+		logins   interface{}
+		expected string
+	}{
+		{
+			name: "nobody",
+		},
+		{
+			name:     "users",
+			logins:   users,
+			expected: "@alice, @bob",
+		},
+		{
+			name:     "escaped",
+			escape:   true,
+			logins:   users,
+			expected: "`@alice`, `@bob`",
+		},
+		{
+			name:     "logins with and without @",
+			logins:   []string{"@alice", " bob", ""},
+			expected: "@alice, @bob",
+		},
+		{
+			name:     "a single login",
+			logins:   "alice",
+			expected: "@alice",
+		},
+	}
+	for _, tc := range cases {
+		actual, err := mentionAll(tc.escape, tc.logins)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+	if _, err := mentionAll(false, 3); err == nil {
+		t.Error("expected an error for a number")
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	cases := []struct {
+		name     string
+		lang     string
+		code     string
+		expected string
+	}{
+		{
+			name:     "plain",
+			code:     "make test\n",
+			expected: "```\nmake test\n```",
+		},
+		{
+			name:     "language",
+			lang:     "yaml",
+			code:     "a: b",
+			expected: "```yaml\na: b\n```",
+		},
+		{
+			name:     "fence longer than the backticks inside",
+			code:     "````\nnested\n````",
+			expected: "`````\n````\nnested\n````\n`````",
+		},
+	}
+	for _, tc := range cases {
+		if actual := codeBlock(tc.lang, tc.code); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	i := makeIssue("o", "r", 7, "flaky test")
+	i.Assignees = []github.User{{Login: "alice"}, {Login: "bob"}}
+	i.Labels = []github.Label{{Name: "kind/flake"}, {Name: "sig/testing"}}
+	i.UpdatedAt = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	m := Meta{Org: "o", Repo: "r", Number: 7, Issue: i}
+	m.setAges(i.UpdatedAt.Add(100*24*time.Hour), 90*24*time.Hour)
+	comment := `{{mentionAll false .Issue.Assignees}}: this issue has had no activity for {{.DaysSinceUpdate}} days.
+
+{{markdownTable (list "Labels" "Inactive for") (list "kind/flake, sig/testing" (printf "%d days" .DaysSinceUpdate))}}
+
+Labels:
+{{markdownList .Issue.Labels}}
+
+To keep it open, comment:
+{{codeBlock "" "/remove-lifecycle stale"}}`
+	for _, tc := range []struct {
+		name     string
+		comment  string
+		expected string
+	}{
+		{
+			name:    "comment",
+			comment: comment,
+			expected: "@alice, @bob: this issue has had no activity for 100 days.\n\n" +
+				"| Labels | Inactive for |\n| --- | --- |\n| kind/flake, sig/testing | 100 days |\n\n" +
+				"Labels:\n- kind/flake\n- sig/testing\n\n" +
+				"To keep it open, comment:\n```\n/remove-lifecycle stale\n```",
+		},
+		{
+			name:     "preview without pinging",
+			comment:  "{{mentionAll true .Issue.Assignees}}",
+			expected: "`@alice`, `@bob`",
+		},
+	} {
+		if err := CheckTemplate(tc.comment); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		actual, err := MakeCommenter(tc.comment, true)(m)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// errGitLabUnsupported is returned for Client methods without a GitLab equivalent.
+var errGitLabUnsupported = errors.New("not supported by the gitlab provider")
+
+// gitlabClient implements Client against the GitLab REST API. It only
+// handles issues: searches never return merge requests.
+type gitlabClient struct {
+	// api is the base URL of the REST API, e.g. https://gitlab.example.com/api/v4.
+	api    string
+	token  func() []byte
+	dryRun bool
+	http   *http.Client
+}
+
+// NewGitLabClient returns a client of the GitLab instance at baseURL, which
+// only mutates when dryRun is false.
+func NewGitLabClient(baseURL string, token func() []byte, dryRun bool) Client {
+	return &gitlabClient{
+		api:    strings.TrimSuffix(baseURL, "/") + "/api/v4",
+		token:  token,
+		dryRun: dryRun,
+		http:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+// gitlabIssue is the subset of a GitLab issue the commenter uses.
+type gitlabIssue struct {
+	IID              int              `json:"iid"`
+	Title            string           `json:"title"`
+	Description      string           `json:"description"`
+	State            string           `json:"state"`
+	WebURL           string           `json:"web_url"`
+	Labels           []string         `json:"labels"`
+	Author           gitlabUser       `json:"author"`
+	Assignees        []gitlabUser     `json:"assignees"`
+	DiscussionLocked bool             `json:"discussion_locked"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	Milestone        *gitlabMilestone `json:"milestone"`
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+type gitlabMilestone struct {
+	IID   int    `json:"iid"`
+	Title string `json:"title"`
+}
+
+// gitlabNote is a comment on a GitLab issue.
+type gitlabNote struct {
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	Author    gitlabUser `json:"author"`
+	System    bool       `json:"system"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// toGitHub converts the issue to the GitHub type the rest of the commenter uses.
+func (i gitlabIssue) toGitHub() github.Issue {
+	state := i.State
+	if state == "opened" {
+		state = "open"
+	}
+	issue := github.Issue{
+		Number:    i.IID,
+		Title:     i.Title,
+		Body:      i.Description,
+		State:     state,
+		HTMLURL:   i.WebURL,
+		User:      github.User{Login: i.Author.Username},
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+	}
+	for _, l := range i.Labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: l})
+	}
+	for _, a := range i.Assignees {
+		issue.Assignees = append(issue.Assignees, github.User{Login: a.Username})
+	}
+	if i.Milestone != nil {
+		issue.Milestone = github.Milestone{Number: i.Milestone.IID, Title: i.Milestone.Title}
+	}
+	return issue
+}
+
+// gitlabQuery is a GitHub search query translated to GitLab's issue list API.
+type gitlabQuery struct {
+	// path is the issue list endpoint, global or scoped to a group or project.
+	path   string
+	values url.Values
+	// locked, if set, keeps only issues whose discussion lock matches it,
+	// since the API cannot filter on it.
+	locked *bool
+}
+
+// projectPath returns the URL-encoded project ID of org/repo.
+func projectPath(org, repo string) string {
+	return "/projects/" + url.PathEscape(org+"/"+repo)
+}
+
+// translateQuery maps a GitHub search query onto GitLab's issue list
+// parameters as closely as possible, failing on qualifiers GitLab lacks.
+func translateQuery(org, query, sort string, asc bool) (gitlabQuery, error) {
+	q := gitlabQuery{path: "/issues", values: url.Values{"scope": {"all"}, "per_page": {"100"}}}
+	if org != "" {
+		q.path = "/groups/" + url.PathEscape(org) + "/issues"
+		q.values.Del("scope")
+	}
+	var labels, notLabels, text []string
+	for _, term := range queryTerms(query) {
+		negated := strings.HasPrefix(term, "-")
+		key, value, qualified := strings.Cut(strings.TrimPrefix(term, "-"), ":")
+		if !qualified {
+			text = append(text, strings.Trim(term, `"`))
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch {
+		case key == "label" && negated:
+			notLabels = append(notLabels, value)
+		case key == "label":
+			labels = append(labels, value)
+		case key == "author" && negated:
+			q.values.Set("not[author_username]", value)
+		case key == "author":
+			q.values.Set("author_username", value)
+		case key == "assignee" && !negated:
+			q.values.Set("assignee_username", value)
+		case key == "milestone" && !negated:
+			q.values.Set("milestone", value)
+		case key == "no" && !negated && (value == "assignee" || value == "milestone"):
+			q.values.Set(value+"_id", "None")
+		case key == "org" && !negated:
+			q.path = "/groups/" + url.PathEscape(value) + "/issues"
+			q.values.Del("scope")
+		case key == "repo" && !negated:
+			org, repo, ok := cutLast(value, "/")
+			if !ok {
+				return q, fmt.Errorf("repo:%s is not a project path", value)
+			}
+			q.path = projectPath(org, repo) + "/issues"
+			q.values.Del("scope")
+		case key == "is" && !negated && value == "open":
+			q.values.Set("state", "opened")
+		case key == "is" && !negated && value == "closed":
+			q.values.Set("state", "closed")
+		case key == "is" && !negated && value == "issue":
+		case key == "is" && !negated && (value == "locked" || value == "unlocked"):
+			locked := value == "locked"
+			q.locked = &locked
+		case key == "archived" && !negated:
+			q.values.Set("non_archived", strconv.FormatBool(value == "false"))
+		case (key == "updated" || key == "created") && !negated && strings.HasPrefix(value, "<="):
+			q.values.Set(key+"_before", strings.TrimPrefix(value, "<="))
+		case (key == "updated" || key == "created") && !negated && strings.HasPrefix(value, ">="):
+			q.values.Set(key+"_after", strings.TrimPrefix(value, ">="))
+		default:
+			return q, fmt.Errorf("%s is not supported by the gitlab provider", term)
+		}
+	}
+	if len(labels) > 0 {
+		q.values.Set("labels", strings.Join(labels, ","))
+	}
+	if len(notLabels) > 0 {
+		q.values.Set("not[labels]", strings.Join(notLabels, ","))
+	}
+	if len(text) > 0 {
+		q.values.Set("search", strings.Join(text, " "))
+	}
+	switch sort {
+	case "":
+	case "updated", "created":
+		q.values.Set("order_by", sort+"_at")
+		q.values.Set("sort", "desc")
+		if asc {
+			q.values.Set("sort", "asc")
+		}
+	default:
+		return q, fmt.Errorf("--sort=%s is not supported by the gitlab provider", sort)
+	}
+	return q, nil
+}
+
+// cutLast slices s around the last instance of sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// do sends a request to path, relative to the API, and decodes the JSON
+// response into out if set. It returns the next page from the response headers.
+func (c *gitlabClient) do(ctx context.Context, method, path string, values url.Values, body, out interface{}) (string, error) {
+	u := c.api + path
+	if len(values) > 0 {
+		u += "?" + values.Encode()
+	}
+	var in io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		in = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, in)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("PRIVATE-TOKEN", string(c.token()))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, b)
+	}
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			return "", fmt.Errorf("%s %s: %w", method, path, err)
+		}
+	}
+	return resp.Header.Get("X-Next-Page"), nil
+}
+
+// FindIssuesWithOrg lists the issues matching query, within the org group if set.
+func (c *gitlabClient) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	return c.FindIssuesWithOrgWithContext(context.Background(), org, query, sort, asc)
+}
+
+func (c *gitlabClient) FindIssuesWithOrgWithContext(ctx context.Context, org, query, sort string, asc bool) ([]github.Issue, error) {
+	q, err := translateQuery(org, query, sort, asc)
+	if err != nil {
+		return nil, err
+	}
+	var issues []github.Issue
+	for page := "1"; page != ""; {
+		q.values.Set("page", page)
+		var found []gitlabIssue
+		if page, err = c.do(ctx, http.MethodGet, q.path, q.values, nil, &found); err != nil {
+			return nil, err
+		}
+		for _, i := range found {
+			if q.locked == nil || *q.locked == i.DiscussionLocked {
+				issues = append(issues, i.toGitHub())
+			}
+		}
+	}
+	return issues, nil
+}
+
+// GetIssue gets the issue with the given iid in the org/repo project.
+func (c *gitlabClient) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	return c.GetIssueWithContext(context.Background(), org, repo, number)
+}
+
+func (c *gitlabClient) GetIssueWithContext(ctx context.Context, org, repo string, number int) (*github.Issue, error) {
+	var i gitlabIssue
+	if _, err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d", projectPath(org, repo), number), nil, nil, &i); err != nil {
+		return nil, err
+	}
+	issue := i.toGitHub()
+	return &issue, nil
+}
+
+// CreateComment adds a note to the issue, unless this is a dry run.
+func (c *gitlabClient) CreateComment(org, repo string, number int, comment string) error {
+	return c.CreateCommentWithContext(context.Background(), org, repo, number, comment)
+}
+
+func (c *gitlabClient) CreateCommentWithContext(ctx context.Context, org, repo string, number int, comment string) error {
+	if c.dryRun {
+		return nil
+	}
+	_, err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/issues/%d/notes", projectPath(org, repo), number), nil, map[string]string{"body": comment}, nil)
+	return err
+}
+
+// ListIssueComments lists the notes on the issue, leaving out system notes
+// such as label changes.
+func (c *gitlabClient) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	return c.ListIssueCommentsWithContext(context.Background(), org, repo, number)
+}
+
+func (c *gitlabClient) ListIssueCommentsWithContext(ctx context.Context, org, repo string, number int) ([]github.IssueComment, error) {
+	issue, err := c.GetIssueWithContext(ctx, org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	var comments []github.IssueComment
+	values := url.Values{"per_page": {"100"}, "sort": {"asc"}}
+	for page := "1"; page != ""; {
+		values.Set("page", page)
+		var notes []gitlabNote
+		if page, err = c.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d/notes", projectPath(org, repo), number), values, nil, &notes); err != nil {
+			return nil, err
+		}
+		for _, n := range notes {
+			if n.System {
+				continue
+			}
+			comments = append(comments, github.IssueComment{
+				ID:        n.ID,
+				Body:      n.Body,
+				User:      github.User{Login: n.Author.Username},
+				HTMLURL:   fmt.Sprintf("%s#note_%d", issue.HTMLURL, n.ID),
+				CreatedAt: n.CreatedAt,
+				UpdatedAt: n.UpdatedAt,
+			})
+		}
+	}
+	return comments, nil
+}
+
+// BotUserChecker matches the user the token belongs to.
+func (c *gitlabClient) BotUserChecker() (func(candidate string) bool, error) {
+	return c.BotUserCheckerWithContext(context.Background())
+}
+
+func (c *gitlabClient) BotUserCheckerWithContext(ctx context.Context) (func(candidate string) bool, error) {
+	var u gitlabUser
+	if _, err := c.do(ctx, http.MethodGet, "/user", nil, nil, &u); err != nil {
+		return nil, err
+	}
+	return func(candidate string) bool {
+		return candidate == u.Username
+	}, nil
+}
+
+func (c *gitlabClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) GetRepo(owner, name string) (github.FullRepo, error) {
+	return github.FullRepo{}, errGitLabUnsupported
+}
+
+func (c *gitlabClient) QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) MutateWithGitHubAppsSupport(ctx context.Context, m interface{}, input githubql.Input, vars map[string]interface{}, org string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) CreateGist(description, content string) (string, error) {
+	return "", errGitLabUnsupported
+}
+
+func (c *gitlabClient) AddLabels(org, repo string, number int, labels ...string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) AddRepoLabel(org, repo, label, description, color string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) CloseIssue(org, repo string, number int) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) DeleteComment(org, repo string, id int) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) RateLimit() (github.RateLimits, error) {
+	return github.RateLimits{}, errGitLabUnsupported
+}
+
+func (c *gitlabClient) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	return 0, errGitLabUnsupported
+}
+
+func (c *gitlabClient) ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	return nil, errGitLabUnsupported
+}
+
+func (c *gitlabClient) RequestReview(org, repo string, number int, logins []string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) RemoveLabel(org, repo string, number int, label string) error {
+	return errGitLabUnsupported
+}
+
+func (c *gitlabClient) EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error) {
+	return nil, errGitLabUnsupported
+}
+
+// parseGitLabURL extracts the issue reference from a GitLab issue URL, whose
+// project path may contain nested groups: the repo is its last segment and
+// the org the rest. Merge requests have their own numbers, which the commenter
+// cannot address, so their URLs are rejected. path is the path of the URL u.
+func parseGitLabURL(u, path string) (IssueRef, error) {
+	// Example: https://gitlab.example.com/group/subgroup/project/-/issues/12
+	project, rest, ok := strings.Cut(strings.Trim(path, "/"), "/-/")
+	if !ok {
+		return IssueRef{}, fmt.Errorf("failed to parse: %s", u)
+	}
+	kind, n, ok := strings.Cut(rest, "/")
+	if kind == "merge_requests" {
+		return IssueRef{}, fmt.Errorf("merge requests are not supported by the gitlab provider: %s", u)
+	}
+	if !ok || kind != "issues" {
+		return IssueRef{}, fmt.Errorf("failed to parse: %s", u)
+	}
+	number, err := strconv.Atoi(n)
+	if err != nil {
+		return IssueRef{}, fmt.Errorf("failed to parse %s: %w", u, err)
+	}
+	org, repo, ok := cutLast(project, "/")
+	if !ok || org == "" || repo == "" {
+		return IssueRef{}, fmt.Errorf("failed to parse: %s", u)
+	}
+	return IssueRef{Org: org, Repo: repo, Number: number}, nil
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTranslateQuery(t *testing.T) {
+	cases := []struct {
+		name     string
+		org      string
+		query    string
+		sort     string
+		asc      bool
+		path     string
+		expected url.Values
+		locked   *bool
+		err      bool
+	}{
+		{
+			name:  "commenter qualifiers",
+			query: "label:lifecycle/stale -label:lifecycle/frozen archived:false is:open is:unlocked updated:<=2023-01-02T03:04:05Z",
+			sort:  "updated",
+			asc:   true,
+			path:  "/issues",
+			expected: url.Values{
+				"scope":          {"all"},
+				"per_page":       {"100"},
+				"labels":         {"lifecycle/stale"},
+				"not[labels]":    {"lifecycle/frozen"},
+				"non_archived":   {"true"},
+				"state":          {"opened"},
+				"updated_before": {"2023-01-02T03:04:05Z"},
+				"order_by":       {"updated_at"},
+				"sort":           {"asc"},
+			},
+			locked: new(bool),
+		},
+		{
+			name:  "org scopes to the group",
+			org:   "group/sub",
+			query: `is:issue "needs triage" label:"help wanted" label:bug no:assignee`,
+			path:  "/groups/group%2Fsub/issues",
+			expected: url.Values{
+				"per_page":    {"100"},
+				"labels":      {"help wanted,bug"},
+				"assignee_id": {"None"},
+				"search":      {"needs triage"},
+			},
+		},
+		{
+			name:  "repo scopes to the project",
+			query: "repo:group/sub/project author:alice -author:bob",
+			sort:  "created",
+			path:  "/projects/group%2Fsub%2Fproject/issues",
+			expected: url.Values{
+				"per_page":             {"100"},
+				"author_username":      {"alice"},
+				"not[author_username]": {"bob"},
+				"order_by":             {"created_at"},
+				"sort":                 {"desc"},
+			},
+		},
+		{
+			name:  "unsupported qualifier",
+			query: "reactions:>10",
+			err:   true,
+		},
+		{
+			name:  "pull requests are not issues",
+			query: "is:pr",
+			err:   true,
+		},
+		{
+			name:  "unsupported sort",
+			query: "hello",
+			sort:  "comments",
+			err:   true,
+		},
+	}
+	for _, tc := range cases {
+		q, err := translateQuery(tc.org, tc.query, tc.sort, tc.asc)
+		if err != nil {
+			if !tc.err {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if tc.err {
+			t.Errorf("%s: failed to receive an error", tc.name)
+			continue
+		}
+		if q.path != tc.path {
+			t.Errorf("%s: expected path %s, got %s", tc.name, tc.path, q.path)
+		}
+		if !reflect.DeepEqual(q.values, tc.expected) {
+			t.Errorf("%s: expected values %v, got %v", tc.name, tc.expected, q.values)
+		}
+		if !reflect.DeepEqual(q.locked, tc.locked) {
+			t.Errorf("%s: expected locked filter %v, got %v", tc.name, tc.locked, q.locked)
+		}
+	}
+}
+
+func TestParseGitLabURL(t *testing.T) {
+	cases := []struct {
+		url      string
+		expected IssueRef
+		err      bool
+	}{
+		{
+			url:      "https://gitlab.example.com/group/project/-/issues/12",
+			expected: IssueRef{Org: "group", Repo: "project", Number: 12},
+		},
+		{
+			url:      "https://gitlab.example.com/group/sub/project/-/issues/7/",
+			expected: IssueRef{Org: "group/sub", Repo: "project", Number: 7},
+		},
+		{
+			url: "https://gitlab.example.com/group/project/-/merge_requests/3",
+			err: true,
+		},
+		{
+			url: "https://gitlab.example.com/project/-/issues/3",
+			err: true,
+		},
+		{
+			url: "https://gitlab.example.com/group/project/-/issues/three",
+			err: true,
+		},
+	}
+	for _, tc := range cases {
+		// ParseHTMLURL must hand GitLab URLs over.
+		actual, err := ParseHTMLURL(tc.url)
+		if err != nil {
+			if !tc.err {
+				t.Errorf("%s: unexpected error: %v", tc.url, err)
+			}
+			continue
+		}
+		if tc.err {
+			t.Errorf("%s: failed to receive an error", tc.url)
+		} else if actual != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.url, tc.expected, actual)
+		}
+	}
+}
+
+func TestGitLabClient(t *testing.T) {
+	var notes []string
+	issue := func(iid int, locked bool) gitlabIssue {
+		return gitlabIssue{
+			IID:              iid,
+			Title:            "stale",
+			State:            "opened",
+			WebURL:           fmt.Sprintf("https://gitlab.example.com/group/project/-/issues/%d", iid),
+			Labels:           []string{"bug"},
+			Author:           gitlabUser{Username: "alice"},
+			DiscussionLocked: locked,
+			Milestone:        &gitlabMilestone{IID: 4, Title: "v1.0"},
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/groups/group/issues", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		page := []gitlabIssue{issue(1, false), issue(2, true)}
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-Next-Page", "2")
+		} else {
+			page = []gitlabIssue{issue(3, false)}
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/api/v4/projects/group/project/issues/1/notes", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawPath != "/api/v4/projects/group%2Fproject/issues/1/notes" {
+			http.Error(w, "project path not escaped: "+r.URL.RawPath, http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var body struct{ Body string }
+			b, _ := io.ReadAll(r.Body)
+			json.Unmarshal(b, &body)
+			notes = append(notes, body.Body)
+			return
+		}
+		json.NewEncoder(w).Encode([]gitlabNote{
+			{ID: 5, Body: "added ~bug label", System: true},
+			{ID: 6, Body: "ping", Author: gitlabUser{Username: "bot"}, CreatedAt: time.Unix(0, 0)},
+		})
+	})
+	mux.HandleFunc("/api/v4/projects/group/project/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(issue(1, false))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	c := NewGitLabClient(server.URL+"/", func() []byte { return []byte("secret") }, false)
+
+	issues, err := c.FindIssuesWithOrg("group", "is:unlocked", "", false)
+	if err != nil {
+		t.Fatalf("unexpected search error: %v", err)
+	}
+	var found []int
+	for _, i := range issues {
+		found = append(found, i.Number)
+		if i.State != "open" || i.User.Login != "alice" || len(i.Labels) != 1 || i.Labels[0].Name != "bug" || i.Milestone.Title != "v1.0" {
+			t.Errorf("issue %d converted incorrectly: %+v", i.Number, i)
+		}
+	}
+	if expected := []int{1, 3}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected unlocked issues %v from every page, got %v", expected, found)
+	}
+
+	comments, err := c.ListIssueComments("group", "project", 1)
+	if err != nil {
+		t.Fatalf("unexpected error listing notes: %v", err)
+	}
+	if len(comments) != 1 || comments[0].Body != "ping" || comments[0].User.Login != "bot" || comments[0].HTMLURL != issue(1, false).WebURL+"#note_6" {
+		t.Errorf("expected only the user note, got %+v", comments)
+	}
+
+	if err := c.CreateComment("group", "project", 1, "hello"); err != nil {
+		t.Fatalf("unexpected error creating a note: %v", err)
+	}
+	c.(*gitlabClient).dryRun = true
+	if err := c.CreateComment("group", "project", 1, "dry"); err != nil {
+		t.Fatalf("unexpected dry run error: %v", err)
+	}
+	if expected := []string{"hello"}; !reflect.DeepEqual(notes, expected) {
+		t.Errorf("expected notes %v, got %v", expected, notes)
+	}
+
+	if _, err := c.GetPullRequest("group", "project", 1); err != errGitLabUnsupported {
+		t.Errorf("expected pull requests to be unsupported, got %v", err)
+	}
+}
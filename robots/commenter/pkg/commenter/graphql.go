@@ -0,0 +1,297 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+)
+
+// crossReference is a timeline event for another issue or pull request mentioning this one.
+type crossReference struct {
+	CreatedAt githubql.DateTime
+	Source    struct {
+		PullRequest struct {
+			URL   githubql.String
+			State githubql.PullRequestState
+		} `graphql:"... on PullRequest"`
+	}
+}
+
+type timelineNode struct {
+	CrossReferencedEvent crossReference `graphql:"... on CrossReferencedEvent"`
+}
+
+// linkedPRsQuery fetches the most recent cross references to an issue.
+type linkedPRsQuery struct {
+	Repository struct {
+		Issue struct {
+			TimelineItems struct {
+				Nodes []timelineNode
+			} `graphql:"timelineItems(itemTypes: [CROSS_REFERENCED_EVENT], last: 100)"`
+		} `graphql:"issue(number: $number)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+// crossReferences returns the most recent cross references to the issue, oldest first.
+func crossReferences(ctx context.Context, c Client, ref IssueRef) ([]timelineNode, error) {
+	var q linkedPRsQuery
+	vars := map[string]interface{}{
+		"org":    githubql.String(ref.Org),
+		"repo":   githubql.String(ref.Repo),
+		"number": githubql.Int(ref.Number),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, ref.Org); err != nil {
+		return nil, err
+	}
+	return q.Repository.Issue.TimelineItems.Nodes, nil
+}
+
+// linkedPRs returns the URLs of up to max pull requests that reference the issue, newest first.
+func linkedPRs(ctx context.Context, c Client, ref IssueRef, max int) ([]string, error) {
+	nodes, err := crossReferences(ctx, c, ref)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var urls []string
+	for n := len(nodes) - 1; n >= 0 && len(urls) < max; n-- {
+		url := string(nodes[n].CrossReferencedEvent.Source.PullRequest.URL)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// openLinkedPR returns the URL of the most recent open pull request that
+// references the issue, or "" if there is none.
+func openLinkedPR(ctx context.Context, c Client, ref IssueRef) (string, error) {
+	nodes, err := crossReferences(ctx, c, ref)
+	if err != nil {
+		return "", err
+	}
+	for n := len(nodes) - 1; n >= 0; n-- {
+		pr := nodes[n].CrossReferencedEvent.Source.PullRequest
+		if pr.URL != "" && pr.State == githubql.PullRequestStateOpen {
+			return string(pr.URL), nil
+		}
+	}
+	return "", nil
+}
+
+// appendLinkedPRs adds a bulleted list of urls to the comment, if there are any.
+func appendLinkedPRs(comment string, urls []string) string {
+	if len(urls) == 0 {
+		return comment
+	}
+	var b strings.Builder
+	b.WriteString(comment)
+	b.WriteString("\n\nLinked pull requests:\n")
+	for _, u := range urls {
+		fmt.Fprintf(&b, "- %s\n", u)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// userCreatedQuery fetches when an account was created.
+type userCreatedQuery struct {
+	User struct {
+		CreatedAt githubql.DateTime
+	} `graphql:"user(login: $login)"`
+}
+
+// userCreated returns when login signed up, querying as the installation of org.
+func userCreated(ctx context.Context, c Client, org, login string) (time.Time, error) {
+	var q userCreatedQuery
+	vars := map[string]interface{}{
+		"login": githubql.String(login),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, org); err != nil {
+		return time.Time{}, err
+	}
+	return q.User.CreatedAt.Time, nil
+}
+
+// deploymentsQuery fetches the latest deployment of a commit to an environment.
+type deploymentsQuery struct {
+	Repository struct {
+		Object struct {
+			Commit struct {
+				Deployments struct {
+					Nodes []struct {
+						LatestStatus struct {
+							State githubql.String
+						}
+					}
+				} `graphql:"deployments(environments: $environments, last: 1)"`
+			} `graphql:"... on Commit"`
+		} `graphql:"object(oid: $sha)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+// latestDeploymentState returns the state of the latest status of the latest
+// deployment of sha to environment, e.g. SUCCESS, or the empty string when
+// there is no such deployment or status.
+func latestDeploymentState(ctx context.Context, c Client, org, repo, sha, environment string) (string, error) {
+	var q deploymentsQuery
+	vars := map[string]interface{}{
+		"org":          githubql.String(org),
+		"repo":         githubql.String(repo),
+		"sha":          githubql.GitObjectID(sha),
+		"environments": []githubql.String{githubql.String(environment)},
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, org); err != nil {
+		return "", err
+	}
+	nodes := q.Repository.Object.Commit.Deployments.Nodes
+	if len(nodes) == 0 {
+		return "", nil
+	}
+	return string(nodes[0].LatestStatus.State), nil
+}
+
+// projectCardsQuery fetches the classic project cards of an issue or pull request.
+type projectCardsQuery struct {
+	Repository struct {
+		IssueOrPullRequest struct {
+			Issue struct {
+				ProjectCards struct {
+					Nodes []projectCard
+				} `graphql:"projectCards(first: 100)"`
+			} `graphql:"... on Issue"`
+			PullRequest struct {
+				ProjectCards struct {
+					Nodes []projectCard
+				} `graphql:"projectCards(first: 100)"`
+			} `graphql:"... on PullRequest"`
+		} `graphql:"issueOrPullRequest(number: $number)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+type projectCard struct {
+	Column struct {
+		Name githubql.String
+	}
+}
+
+// inProjectColumn returns whether the issue has a card in a classic project
+// column named column, ignoring case.
+func inProjectColumn(ctx context.Context, c Client, ref IssueRef, column string) (bool, error) {
+	var q projectCardsQuery
+	vars := map[string]interface{}{
+		"org":    githubql.String(ref.Org),
+		"repo":   githubql.String(ref.Repo),
+		"number": githubql.Int(ref.Number),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, ref.Org); err != nil {
+		return false, err
+	}
+	cards := append(q.Repository.IssueOrPullRequest.Issue.ProjectCards.Nodes, q.Repository.IssueOrPullRequest.PullRequest.ProjectCards.Nodes...)
+	for _, card := range cards {
+		if strings.EqualFold(string(card.Column.Name), column) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// issueTypeQuery fetches an issue's node ID along with the issue types its org defines.
+type issueTypeQuery struct {
+	Repository struct {
+		Issue struct {
+			ID githubql.ID
+		} `graphql:"issue(number: $number)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+	Organization struct {
+		IssueTypes struct {
+			Nodes []issueType
+		} `graphql:"issueTypes(first: 100)"`
+	} `graphql:"organization(login: $org)"`
+}
+
+type issueType struct {
+	ID   githubql.ID
+	Name githubql.String
+}
+
+// UpdateIssueIssueTypeInput is the input of the updateIssueIssueType mutation.
+// githubv4 derives the GraphQL input type from the Go type name, so it must
+// not be renamed.
+type UpdateIssueIssueTypeInput struct {
+	IssueID     githubql.ID `json:"issueId"`
+	IssueTypeID githubql.ID `json:"issueTypeId"`
+}
+
+type updateIssueTypeMutation struct {
+	UpdateIssueIssueType struct {
+		Issue struct {
+			ID githubql.ID
+		}
+	} `graphql:"updateIssueIssueType(input: $input)"`
+}
+
+// setIssueType sets the issue type of the issue to the org's type named issueType.
+func setIssueType(ctx context.Context, c Client, org, repo string, number int, issueTypeName string) error {
+	var q issueTypeQuery
+	vars := map[string]interface{}{
+		"org":    githubql.String(org),
+		"repo":   githubql.String(repo),
+		"number": githubql.Int(number),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, org); err != nil {
+		return err
+	}
+	var typeID githubql.ID
+	for _, t := range q.Organization.IssueTypes.Nodes {
+		if strings.EqualFold(string(t.Name), issueTypeName) {
+			typeID = t.ID
+			break
+		}
+	}
+	if typeID == nil {
+		return fmt.Errorf("%s has no issue type %q", org, issueTypeName)
+	}
+	input := UpdateIssueIssueTypeInput{IssueID: q.Repository.Issue.ID, IssueTypeID: typeID}
+	var m updateIssueTypeMutation
+	return c.MutateWithGitHubAppsSupport(ctx, &m, input, nil, org)
+}
+
+// userEmailQuery fetches the public email of an account.
+type userEmailQuery struct {
+	User struct {
+		Email githubql.String
+	} `graphql:"user(login: $login)"`
+}
+
+// userEmail returns the public email of login, or "" if it has none.
+func userEmail(ctx context.Context, c Client, org, login string) (string, error) {
+	var q userEmailQuery
+	vars := map[string]interface{}{
+		"login": githubql.String(login),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, org); err != nil {
+		return "", err
+	}
+	return string(q.User.Email), nil
+}
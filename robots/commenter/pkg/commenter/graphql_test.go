@@ -0,0 +1,186 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestLinkedPRs(t *testing.T) {
+	c := fakeClient{crossRefs: map[int][]string{
+		1: {"pr/1", "", "pr/2", "pr/3", "pr/2", "", "pr/4"},
+	}}
+	cases := []struct {
+		name     string
+		number   int
+		max      int
+		expected []string
+	}{
+		{
+			name:     "newest first without issues or duplicates",
+			number:   1,
+			max:      5,
+			expected: []string{"pr/4", "pr/2", "pr/3", "pr/1"},
+		},
+		{
+			name:     "limited to the most recent",
+			number:   1,
+			max:      2,
+			expected: []string{"pr/4", "pr/2"},
+		},
+		{
+			name:   "no references",
+			number: 2,
+			max:    5,
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := linkedPRs(context.Background(), &c, IssueRef{Org: "o", Repo: "r", Number: tc.number}, tc.max)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestAppendLinkedPRs(t *testing.T) {
+	if actual := appendLinkedPRs("hello", nil); actual != "hello" {
+		t.Errorf("expected comment to be unchanged, got %q", actual)
+	}
+	expected := "hello\n\nLinked pull requests:\n- pr/1\n- pr/2"
+	if actual := appendLinkedPRs("hello", []string{"pr/1", "pr/2"}); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRunIncludesLinkedPRs(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "linked"),
+			makeIssue("o", "error", 2, "linked"),
+		},
+		crossRefs: map[int][]string{1: {"pr/1", "pr/2"}},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("linked"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+		MaxLinkedPRs:  1,
+	}))
+	if err == nil {
+		t.Error("failed to report the failed query")
+	}
+	if expected := []string{"hello\n\nLinked pull requests:\n- pr/2"}; !reflect.DeepEqual(c.bodies, expected) {
+		t.Errorf("expected comments %q, got %q", expected, c.bodies)
+	}
+}
+
+func TestOpenLinkedPR(t *testing.T) {
+	c := fakeClient{
+		crossRefs: map[int][]string{
+			1: {"pr/1", "pr/2", "", "pr/3"},
+			2: {"pr/4", ""},
+		},
+		closedPRs: map[string]bool{"pr/3": true, "pr/4": true},
+	}
+	for number, expected := range map[int]string{1: "pr/2", 2: "", 3: ""} {
+		url, err := openLinkedPR(context.Background(), &c, IssueRef{Org: "o", Repo: "r", Number: number})
+		if err != nil {
+			t.Errorf("#%d: unexpected error: %v", number, err)
+		} else if url != expected {
+			t.Errorf("#%d: expected %q, got %q", number, expected, url)
+		}
+	}
+}
+
+func TestRunSkipsWithLinkedPR(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "anyone"),
+			makeIssue("o", "r", 2, "anyone"),
+			makeIssue("o", "r", 3, "anyone"),
+			makeIssue("o", "error", 4, "anyone"),
+		},
+		crossRefs: map[int][]string{1: {"pr/1"}, 2: {"pr/2"}},
+		closedPRs: map[string]bool{"pr/2": true},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:         unscoped("anyone"),
+		SamplePercent:    100,
+		Commenter:        MakeCommenter("is anyone working on this?", false),
+		SkipWithLinkedPR: true,
+	}))
+	if err == nil {
+		t.Error("failed to report the failed query")
+	}
+	if expected := []int{2, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestSetIssueType(t *testing.T) {
+	c := fakeClient{issueTypes: []string{"Bug", "Feature"}}
+	if err := setIssueType(context.Background(), &c, "o", "r", 3, "feature"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []githubql.Input{UpdateIssueIssueTypeInput{IssueID: "issue-3", IssueTypeID: "type-Feature"}}
+	if !reflect.DeepEqual(c.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, c.mutations)
+	}
+	if err := setIssueType(context.Background(), &c, "o", "r", 3, "Task"); err == nil {
+		t.Error("failed to report an issue type the org does not define")
+	}
+}
+
+func TestRunSetsIssueType(t *testing.T) {
+	for _, confirm := range []bool{false, true} {
+		c := fakeClient{
+			issues: []github.Issue{
+				makeIssue("o", "r", 1, "typed"),
+				makeIssue("o", "error", 2, "typed"),
+			},
+			issueTypes: []string{"Bug"},
+		}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("typed"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hello", false),
+			IssueType:     "Bug",
+			Confirm:       confirm,
+		}))
+		if err == nil {
+			t.Errorf("confirm=%t: failed to report the failed comment", confirm)
+		}
+		var expected []githubql.Input
+		if confirm {
+			expected = []githubql.Input{UpdateIssueIssueTypeInput{IssueID: "issue-1", IssueTypeID: "type-Bug"}}
+		}
+		if !reflect.DeepEqual(c.mutations, expected) {
+			t.Errorf("confirm=%t: expected mutations %v, got %v", confirm, expected, c.mutations)
+		}
+	}
+}
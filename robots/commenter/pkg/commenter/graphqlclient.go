@@ -0,0 +1,286 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// graphqlClient searches and comments over GraphQL, fetching every field
+// the filters use in pages of searchPageSize, and leaves the rest to the
+// REST client it wraps.
+type graphqlClient struct {
+	Client
+	// dryRun skips the comment mutation, which the dry-run client would send.
+	dryRun bool
+	logger *log.Logger
+	mu     sync.Mutex
+	// nodeIDs maps issue references to the node IDs found by searches.
+	nodeIDs map[string]githubql.ID
+}
+
+// NewGraphQLClient wraps c to search and comment over GraphQL, logging the
+// cost of searches and dry-run comments to logger, the standard logger if nil.
+// Pass Options.Logger to keep them with what Run reports.
+func NewGraphQLClient(c Client, dryRun bool, logger *log.Logger) Client {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &graphqlClient{Client: c, dryRun: dryRun, logger: logger, nodeIDs: map[string]githubql.ID{}}
+}
+
+// searchPageSize is the most nodes GitHub returns per page.
+const searchPageSize = 100
+
+// issueFields are the fields of an issue or pull request that map onto
+// github.Issue.
+type issueFields struct {
+	ID         githubql.ID
+	DatabaseID githubql.Int
+	Number     githubql.Int
+	Title      githubql.String
+	Body       githubql.String
+	URL        githubql.URI
+	State      githubql.String
+	CreatedAt  githubql.DateTime
+	UpdatedAt  githubql.DateTime
+	Author     struct {
+		Login githubql.String
+	}
+	Labels struct {
+		Nodes []struct {
+			Name githubql.String
+		}
+	} `graphql:"labels(first: 100)"`
+	Assignees struct {
+		Nodes []struct {
+			Login githubql.String
+		}
+	} `graphql:"assignees(first: 20)"`
+	Milestone *struct {
+		Number githubql.Int
+		Title  githubql.String
+	}
+	ReactionGroups []struct {
+		Content  githubql.ReactionContent
+		Reactors struct {
+			TotalCount githubql.Int
+		}
+	}
+}
+
+type searchNode struct {
+	Issue       issueFields `graphql:"... on Issue"`
+	PullRequest issueFields `graphql:"... on PullRequest"`
+}
+
+type rateLimit struct {
+	Cost      githubql.Int
+	Remaining githubql.Int
+}
+
+// issueSearchQuery fetches a page of issues and pull requests matching a query.
+type issueSearchQuery struct {
+	Search struct {
+		IssueCount githubql.Int
+		PageInfo   struct {
+			HasNextPage githubql.Boolean
+			EndCursor   githubql.String
+		}
+		Nodes []searchNode
+	} `graphql:"search(type: ISSUE, first: $first, after: $cursor, query: $query)"`
+	RateLimit rateLimit
+}
+
+// toGitHub converts the node to the REST type the rest of the commenter uses.
+func (n searchNode) toGitHub() github.Issue {
+	f := n.Issue
+	if f.ID == nil {
+		f = n.PullRequest
+	}
+	i := github.Issue{
+		ID:        int(f.DatabaseID),
+		NodeID:    fmt.Sprint(f.ID),
+		User:      github.User{Login: string(f.Author.Login)},
+		Number:    int(f.Number),
+		Title:     string(f.Title),
+		State:     "open",
+		Body:      string(f.Body),
+		CreatedAt: f.CreatedAt.Time,
+		UpdatedAt: f.UpdatedAt.Time,
+	}
+	if f.URL.URL != nil {
+		i.HTMLURL = f.URL.String()
+	}
+	if f.State != "OPEN" {
+		// Merged pull requests are closed as far as REST is concerned.
+		i.State = "closed"
+	}
+	if n.PullRequest.ID != nil {
+		i.PullRequest = &struct{}{}
+	}
+	for _, l := range f.Labels.Nodes {
+		i.Labels = append(i.Labels, github.Label{Name: string(l.Name)})
+	}
+	for _, a := range f.Assignees.Nodes {
+		i.Assignees = append(i.Assignees, github.User{Login: string(a.Login)})
+	}
+	if f.Milestone != nil {
+		i.Milestone = github.Milestone{Number: int(f.Milestone.Number), Title: string(f.Milestone.Title)}
+	}
+	for _, g := range f.ReactionGroups {
+		count := int(g.Reactors.TotalCount)
+		i.Reactions.TotalCount += count
+		switch g.Content {
+		case githubql.ReactionContentThumbsUp:
+			i.Reactions.PlusOne = count
+		case githubql.ReactionContentThumbsDown:
+			i.Reactions.MinusOne = count
+		case githubql.ReactionContentLaugh:
+			i.Reactions.Laugh = count
+		case githubql.ReactionContentHooray:
+			i.Reactions.Hooray = count
+		case githubql.ReactionContentConfused:
+			i.Reactions.Confused = count
+		case githubql.ReactionContentHeart:
+			i.Reactions.Heart = count
+		case githubql.ReactionContentRocket:
+			i.Reactions.Rocket = count
+		case githubql.ReactionContentEyes:
+			i.Reactions.Eyes = count
+		}
+	}
+	return i
+}
+
+// FindIssuesWithOrg searches page by page, logging the rate limit cost of each.
+func (c *graphqlClient) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	return c.FindIssuesWithOrgWithContext(context.Background(), org, query, sort, asc)
+}
+
+func (c *graphqlClient) FindIssuesWithOrgWithContext(ctx context.Context, org, query, sort string, asc bool) ([]github.Issue, error) {
+	if sort != "" {
+		order := "desc"
+		if asc {
+			order = "asc"
+		}
+		query = fmt.Sprintf("%s sort:%s-%s", query, sort, order)
+	}
+	vars := map[string]interface{}{
+		"query":  githubql.String(query),
+		"first":  githubql.Int(searchPageSize),
+		"cursor": (*githubql.String)(nil),
+	}
+	var issues []github.Issue
+	for {
+		var q issueSearchQuery
+		if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, org); err != nil {
+			return nil, err
+		}
+		nodes := len(q.Search.Nodes)
+		if nodes > 0 {
+			c.logger.Printf("GraphQL search page of %d nodes cost %d points, %.2f per node, %d left", nodes, q.RateLimit.Cost, float64(q.RateLimit.Cost)/float64(nodes), q.RateLimit.Remaining)
+		}
+		for _, n := range q.Search.Nodes {
+			i := n.toGitHub()
+			if ref, err := ParseHTMLURL(i.HTMLURL); err == nil && i.NodeID != "" {
+				c.mu.Lock()
+				c.nodeIDs[ref.String()] = githubql.ID(i.NodeID)
+				c.mu.Unlock()
+			}
+			issues = append(issues, i)
+		}
+		if !q.Search.PageInfo.HasNextPage {
+			return issues, nil
+		}
+		cursor := q.Search.PageInfo.EndCursor
+		vars["cursor"] = &cursor
+	}
+}
+
+// nodeIDQuery fetches the node ID of an issue or pull request.
+type nodeIDQuery struct {
+	Repository struct {
+		IssueOrPullRequest struct {
+			Issue struct {
+				ID githubql.ID
+			} `graphql:"... on Issue"`
+			PullRequest struct {
+				ID githubql.ID
+			} `graphql:"... on PullRequest"`
+		} `graphql:"issueOrPullRequest(number: $number)"`
+	} `graphql:"repository(owner: $org, name: $repo)"`
+}
+
+// nodeID returns the node ID of the issue, which searches usually found already.
+func (c *graphqlClient) nodeID(ctx context.Context, ref IssueRef) (githubql.ID, error) {
+	c.mu.Lock()
+	id, ok := c.nodeIDs[ref.String()]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	var q nodeIDQuery
+	vars := map[string]interface{}{
+		"org":    githubql.String(ref.Org),
+		"repo":   githubql.String(ref.Repo),
+		"number": githubql.Int(ref.Number),
+	}
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, vars, ref.Org); err != nil {
+		return nil, err
+	}
+	if id = q.Repository.IssueOrPullRequest.Issue.ID; id == nil {
+		id = q.Repository.IssueOrPullRequest.PullRequest.ID
+	}
+	if id == nil {
+		return nil, fmt.Errorf("%s not found", ref)
+	}
+	return id, nil
+}
+
+type addCommentMutation struct {
+	AddComment struct {
+		ClientMutationID githubql.String
+	} `graphql:"addComment(input: $input)"`
+}
+
+// CreateComment comments with the addComment mutation, unless this is a dry run.
+func (c *graphqlClient) CreateComment(owner, repo string, number int, comment string) error {
+	return c.CreateCommentWithContext(context.Background(), owner, repo, number, comment)
+}
+
+func (c *graphqlClient) CreateCommentWithContext(ctx context.Context, owner, repo string, number int, comment string) error {
+	ref := IssueRef{Org: owner, Repo: repo, Number: number}
+	if c.dryRun {
+		c.logger.Printf("Would comment on %s over GraphQL", ref)
+		return nil
+	}
+	id, err := c.nodeID(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("failed to find %s: %w", ref, err)
+	}
+	var m addCommentMutation
+	input := githubql.AddCommentInput{SubjectID: id, Body: githubql.String(comment)}
+	return c.MutateWithGitHubAppsSupport(ctx, &m, input, nil, owner)
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func makeNode(t *testing.T, rawURL string, pr bool) searchNode {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("bad URL %s: %v", rawURL, err)
+	}
+	var f issueFields
+	f.ID = "node-" + u.Path
+	f.URL = githubql.URI{URL: u}
+	f.State = "OPEN"
+	var n searchNode
+	if pr {
+		n.PullRequest = f
+	} else {
+		n.Issue = f
+	}
+	return n
+}
+
+func TestSearchNodeToGitHub(t *testing.T) {
+	created := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	n := makeNode(t, "https://github.com/o/r/issues/7", false)
+	f := &n.Issue
+	f.DatabaseID = 42
+	f.Number = 7
+	f.Title = "Flaky"
+	f.Body = "It flakes"
+	f.CreatedAt = githubql.DateTime{Time: created}
+	f.UpdatedAt = githubql.DateTime{Time: created.Add(time.Hour)}
+	f.Author.Login = "alice"
+	f.Labels.Nodes = append(f.Labels.Nodes, struct{ Name githubql.String }{"bug"})
+	f.Assignees.Nodes = append(f.Assignees.Nodes, struct{ Login githubql.String }{"bob"})
+	f.Milestone = &struct {
+		Number githubql.Int
+		Title  githubql.String
+	}{Number: 3, Title: "v1.0"}
+	for content, count := range map[githubql.ReactionContent]int{githubql.ReactionContentThumbsUp: 2, githubql.ReactionContentHeart: 1} {
+		var g struct {
+			Content  githubql.ReactionContent
+			Reactors struct {
+				TotalCount githubql.Int
+			}
+		}
+		g.Content = content
+		g.Reactors.TotalCount = githubql.Int(count)
+		f.ReactionGroups = append(f.ReactionGroups, g)
+	}
+	expected := github.Issue{
+		ID:        42,
+		NodeID:    "node-/o/r/issues/7",
+		User:      github.User{Login: "alice"},
+		Number:    7,
+		Title:     "Flaky",
+		State:     "open",
+		HTMLURL:   "https://github.com/o/r/issues/7",
+		Labels:    []github.Label{{Name: "bug"}},
+		Assignees: []github.User{{Login: "bob"}},
+		Body:      "It flakes",
+		CreatedAt: created,
+		UpdatedAt: created.Add(time.Hour),
+		Milestone: github.Milestone{Number: 3, Title: "v1.0"},
+		Reactions: github.Reactions{TotalCount: 3, PlusOne: 2, Heart: 1},
+	}
+	if actual := n.toGitHub(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	merged := makeNode(t, "https://github.com/o/r/pull/8", true)
+	merged.PullRequest.State = "MERGED"
+	if i := merged.toGitHub(); !i.IsPullRequest() || i.State != "closed" {
+		t.Errorf("expected a closed pull request, got %+v", i)
+	}
+}
+
+func TestGraphQLClient(t *testing.T) {
+	fake := &fakeClient{searchPages: [][]searchNode{
+		{makeNode(t, "https://github.com/o/r/issues/1", false), makeNode(t, "https://github.com/o/r/pull/2", true)},
+		{makeNode(t, "https://github.com/o/r/issues/3", false)},
+	}}
+	c := NewGraphQLClient(fake, false, nil)
+	issues, err := c.FindIssuesWithOrg("o", "is:open", "updated", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var urls []string
+	for _, i := range issues {
+		urls = append(urls, i.HTMLURL)
+	}
+	if expected := []string{"https://github.com/o/r/issues/1", "https://github.com/o/r/pull/2", "https://github.com/o/r/issues/3"}; !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected every page %v, got %v", expected, urls)
+	}
+	if expected := []string{"is:open sort:updated-asc", "is:open sort:updated-asc"}; !reflect.DeepEqual(fake.searchQueries, expected) {
+		t.Errorf("expected queries %v, got %v", expected, fake.searchQueries)
+	}
+
+	for _, number := range []int{2, 9} {
+		if err := c.CreateComment("o", "r", number, "ping"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	expected := []githubql.Input{
+		githubql.AddCommentInput{SubjectID: "node-/o/r/pull/2", Body: "ping"},
+		githubql.AddCommentInput{SubjectID: "looked-up-9", Body: "ping"},
+	}
+	if !reflect.DeepEqual(fake.mutations, expected) {
+		t.Errorf("expected mutations %v, got %v", expected, fake.mutations)
+	}
+	if err := c.CreateComment("o", "error", 1, "ping"); err == nil {
+		t.Error("failed to report the issue that could not be found")
+	}
+
+	dryRun := NewGraphQLClient(&fakeClient{}, true, nil)
+	if err := dryRun.CreateComment("o", "r", 1, "ping"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// newLabelColor is the color of labels created by syncLabels, GitHub's default grey.
+const newLabelColor = "ededed"
+
+// syncLabels checks that the repo of every issue has labels, creating the
+// missing ones when create is set. It returns the repos, as org/repo, that
+// still lack some of them and logs a summary of the repos that needed labels.
+func syncLabels(c Client, issues []github.Issue, labels []string, create bool, audit *AuditLog, problems *problemList, logger *log.Logger) map[string]bool {
+	missing := map[string]bool{}
+	checked := map[string]bool{}
+	var needed []string
+	for _, i := range issues {
+		ref, _, err := issueRef(i)
+		if err != nil {
+			// processIssue reports it.
+			continue
+		}
+		key := ref.Org + "/" + ref.Repo
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		existing, err := c.GetRepoLabels(ref.Org, ref.Repo)
+		if err != nil {
+			problems.add("Failed to list labels of %s: %v", key, err)
+			missing[key] = true
+			continue
+		}
+		have := map[string]bool{}
+		for _, l := range existing {
+			have[strings.ToLower(l.Name)] = true
+		}
+		var absent []string
+		for _, l := range labels {
+			if !have[strings.ToLower(l)] {
+				absent = append(absent, l)
+			}
+		}
+		if len(absent) == 0 {
+			continue
+		}
+		needed = append(needed, key+": "+strings.Join(absent, ", "))
+		if !create {
+			logger.Printf("Skipping issues in %s: missing labels %s, add --label-create to create them", key, strings.Join(absent, ", "))
+			missing[key] = true
+			continue
+		}
+		for _, l := range absent {
+			err := c.AddRepoLabel(ref.Org, ref.Repo, l, "", newLabelColor)
+			audit.record(auditCreateLabel, IssueRef{Org: ref.Org, Repo: ref.Repo}, "", l, err)
+			if err != nil {
+				problems.add("Failed to create label %s in %s: %v", l, key, err)
+				missing[key] = true
+				continue
+			}
+			logger.Printf("Created label %s in %s", l, key)
+		}
+	}
+	logger.Printf("%d of %d repos needed labels", len(needed), len(checked))
+	for _, n := range needed {
+		logger.Printf("  %s", n)
+	}
+	return missing
+}
+
+// maxLabelLength is the longest label name GitHub accepts, in characters.
+const maxLabelLength = 50
+
+// checkLabel returns an error if GitHub would reject name as a label name.
+func checkLabel(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return errors.New("empty label name")
+	case strings.ContainsAny(name, "\r\n"):
+		return fmt.Errorf("label %q contains a newline", name)
+	case utf8.RuneCountInString(name) > maxLabelLength:
+		return fmt.Errorf("label %q is longer than %d characters", name, maxLabelLength)
+	}
+	return nil
+}
+
+// CheckLabels returns an error if any of labels is not a valid label name
+// or, with useTemplate, does not parse as a template. Templated labels are
+// only checked once rendered, by processIssue.
+func CheckLabels(labels []string, useTemplate bool) error {
+	for _, l := range labels {
+		if useTemplate {
+			if _, err := newTemplate("label").Parse(l); err != nil {
+				return fmt.Errorf("bad label template %q: %w", l, err)
+			}
+			continue
+		}
+		if err := checkLabel(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderLabels renders each of labels as a template with m, returning an
+// error if one fails to render or is not a valid label name once rendered.
+func renderLabels(labels []string, m Meta) ([]string, error) {
+	var out []string
+	for _, l := range labels {
+		t, err := newTemplate("label").Parse(l)
+		if err != nil {
+			return nil, fmt.Errorf("bad label template %q: %w", l, err)
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, m); err != nil {
+			return nil, fmt.Errorf("failed to render label %q: %w", l, err)
+		}
+		if err := checkLabel(b.String()); err != nil {
+			return nil, err
+		}
+		out = append(out, b.String())
+	}
+	return out, nil
+}
+
+// LabelTransition moves an issue from the From label to the To one.
+type LabelTransition struct {
+	From string
+	To   string
+}
+
+func (t LabelTransition) String() string {
+	return t.From + ":" + t.To
+}
+
+// ParseLabelTransition parses a from:to --transition-label.
+func ParseLabelTransition(s string) (LabelTransition, error) {
+	from, to, ok := strings.Cut(s, ":")
+	if !ok {
+		return LabelTransition{}, fmt.Errorf("%q is not of the form from:to", s)
+	}
+	t := LabelTransition{From: strings.TrimSpace(from), To: strings.TrimSpace(to)}
+	for _, l := range []string{t.From, t.To} {
+		if err := checkLabel(l); err != nil {
+			return LabelTransition{}, err
+		}
+	}
+	if strings.EqualFold(t.From, t.To) {
+		return LabelTransition{}, fmt.Errorf("%q moves %s to itself", s, t.From)
+	}
+	return t, nil
+}
+
+// hasLabel reports whether the issue carries the label, which GitHub
+// matches regardless of case.
+func hasLabel(i github.Issue, label string) bool {
+	for _, l := range i.Labels {
+		if strings.EqualFold(l.Name, label) {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionLabel removes t.From from the issue and adds t.To. If adding
+// fails, t.From is put back so that the issue is left with exactly one of
+// them, and the error says whether that worked.
+func transitionLabel(c Client, ref IssueRef, t LabelTransition, audit *AuditLog) error {
+	err := c.RemoveLabel(ref.Org, ref.Repo, ref.Number, t.From)
+	audit.record(auditRemoveLabel, ref, "", t.From, err)
+	if err != nil {
+		return fmt.Errorf("failed to remove %s: %w", t.From, err)
+	}
+	err = c.AddLabels(ref.Org, ref.Repo, ref.Number, t.To)
+	audit.record(auditAddLabels, ref, "", t.To, err)
+	if err == nil {
+		return nil
+	}
+	rollback := c.AddLabels(ref.Org, ref.Repo, ref.Number, t.From)
+	audit.record(auditAddLabels, ref, "", t.From, rollback)
+	if rollback != nil {
+		return fmt.Errorf("failed to add %s: %v, then failed to put %s back: %w", t.To, err, t.From, rollback)
+	}
+	return fmt.Errorf("failed to add %s, so put %s back: %w", t.To, t.From, err)
+}
@@ -0,0 +1,258 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunLabelSync(t *testing.T) {
+	issues := []github.Issue{
+		makeIssue("o", "ready", 1, "sync"),
+		makeIssue("o", "partial", 2, "sync"),
+		makeIssue("o", "partial", 3, "sync"),
+		makeIssue("o", "missing", 4, "sync"),
+		makeIssue("o", "ready", 5, "sync"),
+	}
+	repoLabels := func() map[string][]string {
+		return map[string][]string{
+			"o/ready":   {"lifecycle/stale", "Triage/Needed"},
+			"o/partial": {"lifecycle/stale"},
+		}
+	}
+	cases := []struct {
+		name     string
+		create   bool
+		comments []int
+		created  []string
+	}{
+		{
+			name:     "skip repos missing labels",
+			comments: []int{1, 5},
+		},
+		{
+			name:     "create missing labels",
+			create:   true,
+			comments: []int{1, 2, 3, 5},
+			created:  []string{"o/partial:triage/needed"},
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{issues: issues, repoLabels: repoLabels()}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("sync"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hi", false),
+			AddLabels:     []string{"lifecycle/stale", "triage/needed"},
+			LabelSync:     true,
+			LabelCreate:   tc.create,
+		}))
+		if err == nil {
+			t.Errorf("%s: failed to report the repo whose labels could not be listed", tc.name)
+		}
+		if !reflect.DeepEqual(c.comments, tc.comments) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, tc.comments, c.comments)
+		}
+		if !reflect.DeepEqual(c.createdLabels, tc.created) {
+			t.Errorf("%s: expected created labels %v, got %v", tc.name, tc.created, c.createdLabels)
+		}
+		if n := len(c.addedLabels); n != 2*len(tc.comments) {
+			t.Errorf("%s: expected both labels added to every issue commented on, got %v", tc.name, c.addedLabels)
+		}
+	}
+}
+
+func TestRunTemplateLabels(t *testing.T) {
+	now := time.Date(2024, time.August, 5, 12, 0, 0, 0, time.UTC)
+	multiline := makeIssue("o", "r", 3, "dated")
+	multiline.Body = "two\nlines"
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "dated"),
+		makeIssue("o", "other", 2, "dated"),
+		multiline,
+	}}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:       unscoped("dated"),
+		SamplePercent:  100,
+		Commenter:      MakeCommenter("hi", false),
+		AddLabels:      []string{"stale/{{.Quarter}}", "{{.Repo}}-{{.Number}}", "seen/{{.Now.Format \"2006-01-02\"}}", "{{if .Issue.Body}}{{.Issue.Body}}{{else}}plain{{end}}"},
+		TemplateLabels: true,
+		Clock:          clocktesting.NewFakePassiveClock(now),
+	}))
+	if err == nil || !strings.Contains(err.Error(), "contains a newline") {
+		t.Errorf("expected the multi-line label to fail its issue, got %v", err)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, without the issue whose label failed, got %v", expected, c.comments)
+	}
+	expected := []string{
+		"o/r#1:stale/2024-Q3", "o/r#1:r-1", "o/r#1:seen/2024-08-05", "o/r#1:plain",
+		"o/other#2:stale/2024-Q3", "o/other#2:other-2", "o/other#2:seen/2024-08-05", "o/other#2:plain",
+	}
+	if !reflect.DeepEqual(c.addedLabels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.addedLabels)
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	cases := []struct {
+		name        string
+		labels      []string
+		useTemplate bool
+		err         bool
+	}{
+		{
+			name:   "plain labels",
+			labels: []string{"lifecycle/stale", strings.Repeat("é", maxLabelLength)},
+		},
+		{
+			name:   "empty label",
+			labels: []string{"ok", " "},
+			err:    true,
+		},
+		{
+			name:   "too long",
+			labels: []string{strings.Repeat("x", maxLabelLength+1)},
+			err:    true,
+		},
+		{
+			name:   "newline",
+			labels: []string{"a\nb"},
+			err:    true,
+		},
+		{
+			name:        "template checked once rendered",
+			labels:      []string{"{{.Issue.Title}}" + strings.Repeat("x", maxLabelLength)},
+			useTemplate: true,
+		},
+		{
+			name:        "bad template",
+			labels:      []string{"{{.Repo"},
+			useTemplate: true,
+			err:         true,
+		},
+		{
+			name:   "braces without --template",
+			labels: []string{"{{.Repo"},
+		},
+	}
+	for _, tc := range cases {
+		if err := CheckLabels(tc.labels, tc.useTemplate); (err != nil) != tc.err {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestRunTransitionLabels(t *testing.T) {
+	labelled := func(number int, labels ...string) github.Issue {
+		i := makeIssue("o", "r", number, "triage")
+		for _, l := range labels {
+			i.Labels = append(i.Labels, github.Label{Name: l})
+		}
+		return i
+	}
+	cases := []struct {
+		name        string
+		transitions []LabelTransition
+		confirm     bool
+		removed     []string
+		added       []string
+		problems    []string
+	}{
+		{
+			name:        "moved, skipping issues without the from label",
+			transitions: []LabelTransition{{From: "needs-triage", To: "triage/stale"}},
+			confirm:     true,
+			removed:     []string{"o/r#1:needs-triage"},
+			added:       []string{"o/r#1:triage/stale"},
+		},
+		{
+			name:        "dry run",
+			transitions: []LabelTransition{{From: "needs-triage", To: "triage/stale"}},
+		},
+		{
+			name:        "removing fails",
+			transitions: []LabelTransition{{From: "unremovable", To: "triage/stale"}},
+			confirm:     true,
+			problems:    []string{"Failed to move o/r#2 from label unremovable to triage/stale: failed to remove unremovable: injected error removing unremovable"},
+		},
+		{
+			name:        "adding fails, so the from label is put back",
+			transitions: []LabelTransition{{From: "needs-triage", To: "unaddable"}},
+			confirm:     true,
+			removed:     []string{"o/r#1:needs-triage"},
+			added:       []string{"o/r#1:needs-triage"},
+			problems:    []string{"Failed to move o/r#1 from label needs-triage to unaddable: failed to add unaddable, so put needs-triage back: injected error adding unaddable"},
+		},
+		{
+			name:        "putting the from label back fails too",
+			transitions: []LabelTransition{{From: "unaddable-old", To: "unaddable-new"}},
+			confirm:     true,
+			removed:     []string{"o/r#3:unaddable-old"},
+			problems:    []string{"Failed to move o/r#3 from label unaddable-old to unaddable-new: failed to add unaddable-new: injected error adding unaddable-new, then failed to put unaddable-old back: injected error adding unaddable-old"},
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{issues: []github.Issue{
+			labelled(1, "kind/bug", "Needs-Triage"),
+			labelled(2, "unremovable"),
+			labelled(3, "unaddable-old"),
+			labelled(4),
+		}}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:         unscoped("triage"),
+			SamplePercent:    100,
+			Commenter:        MakeCommenter("moving on", false),
+			Confirm:          tc.confirm,
+			TransitionLabels: tc.transitions,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if res.Commented != 4 {
+			t.Errorf("%s: expected 4 issues commented on, got %d", tc.name, res.Commented)
+		}
+		if !reflect.DeepEqual(c.removedLabels, tc.removed) {
+			t.Errorf("%s: expected labels removed %v, got %v", tc.name, tc.removed, c.removedLabels)
+		}
+		if !reflect.DeepEqual(c.addedLabels, tc.added) {
+			t.Errorf("%s: expected labels added %v, got %v", tc.name, tc.added, c.addedLabels)
+		}
+		if !reflect.DeepEqual(res.Problems, tc.problems) {
+			t.Errorf("%s: expected problems %q, got %q", tc.name, tc.problems, res.Problems)
+		}
+	}
+}
+
+func TestParseLabelTransition(t *testing.T) {
+	if tr, err := ParseLabelTransition(" needs-triage : triage/stale "); err != nil || tr != (LabelTransition{From: "needs-triage", To: "triage/stale"}) {
+		t.Errorf("expected needs-triage:triage/stale, got %v, %v", tr, err)
+	}
+	for _, bad := range []string{"needs-triage", ":to", "from:", "same:Same", "a:" + strings.Repeat("x", maxLabelLength+1)} {
+		if _, err := ParseLabelTransition(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
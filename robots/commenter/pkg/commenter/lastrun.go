@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+)
+
+// ErrNoNewWindow is returned by LastRun.Qualifier when the cutoff of a run is
+// not after that of the last one, as when the clock went back.
+var ErrNoNewWindow = errors.New("no new updated window since the last run")
+
+// LastRun remembers the updated cutoff of the last successful run, so that
+// each run only handles the issues that went stale since the one before.
+type LastRun struct {
+	path string
+	// cutoff is zero until a run succeeds.
+	cutoff time.Time
+}
+
+// lastRunJSON is the on-disk format of a --last-run-file.
+type lastRunJSON struct {
+	Cutoff time.Time `json:"cutoff"`
+}
+
+// LoadLastRun reads the --last-run-file at path. A missing file is a first run.
+func LoadLastRun(path string) (*LastRun, error) {
+	l := &LastRun{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Last run file %s does not exist, searching everything stale", path)
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var lj lastRunJSON
+	if err := json.Unmarshal(b, &lj); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	l.cutoff = lj.Cutoff
+	return l, nil
+}
+
+// Qualifier returns the updated: qualifier of the issues last updated after
+// the cutoff of the last run and up to cutoff, or of all those updated up to
+// cutoff on a first run. GitHub matches whole seconds at both ends, so the
+// window starts a second after the last one ended. It returns ErrNoNewWindow
+// when cutoff is not after the last one.
+func (l *LastRun) Qualifier(cutoff time.Time) (string, error) {
+	cutoff = cutoff.UTC().Truncate(time.Second)
+	if l.cutoff.IsZero() {
+		return "updated:<=" + cutoff.Format(time.RFC3339), nil
+	}
+	if !cutoff.After(l.cutoff) {
+		return "", fmt.Errorf("%w: the cutoff %s is not after the last one, %s", ErrNoNewWindow, cutoff.Format(time.RFC3339), l.cutoff.Format(time.RFC3339))
+	}
+	return "updated:" + l.cutoff.Add(time.Second).Format(time.RFC3339) + ".." + cutoff.Format(time.RFC3339), nil
+}
+
+// Advance records cutoff as that of the last successful run, never moving it
+// back.
+func (l *LastRun) Advance(cutoff time.Time) error {
+	cutoff = cutoff.UTC().Truncate(time.Second)
+	if !cutoff.After(l.cutoff) {
+		return nil
+	}
+	b, err := json.MarshalIndent(lastRunJSON{Cutoff: cutoff}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(l.path, b); err != nil {
+		return err
+	}
+	l.cutoff = cutoff
+	return nil
+}
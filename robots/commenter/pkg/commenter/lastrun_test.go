@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestLastRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "last-run.json")
+	first := time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	l, err := LoadLastRun(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q, err := l.Qualifier(first); err != nil || q != "updated:<=2024-03-01T10:00:00Z" {
+		t.Errorf("expected the single cutoff on a first run, got %q, %v", q, err)
+	}
+	if err := l.Advance(first); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The next run picks up a second after where the last one ended.
+	l, err = LoadLastRun(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second := first.Add(time.Hour)
+	if q, err := l.Qualifier(second); err != nil || q != "updated:2024-03-01T10:00:01Z..2024-03-01T11:00:00Z" {
+		t.Errorf("expected the window since the last run, got %q, %v", q, err)
+	}
+
+	// A clock that went back searches nothing and never moves the cutoff back.
+	for _, skewed := range []time.Time{first, first.Add(-time.Minute), first.Add(999 * time.Millisecond)} {
+		if q, err := l.Qualifier(skewed); !errors.Is(err, ErrNoNewWindow) {
+			t.Errorf("%s: expected ErrNoNewWindow, got %q, %v", skewed, q, err)
+		}
+		if err := l.Advance(skewed); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if l, err = LoadLastRun(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if q, err := l.Qualifier(second); err != nil || q != "updated:2024-03-01T10:00:01Z..2024-03-01T11:00:00Z" {
+		t.Errorf("expected the cutoff to stay put, got %q, %v", q, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := LoadLastRun(path); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+}
+
+func TestResultLeftOver(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "stale"),
+		makeIssue("o", "r", 2, "stale"),
+		makeIssue("o", "r", 3, "stale"),
+	}}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("stale"),
+		SamplePercent: 100,
+		Ceiling:       1,
+		Commenter:     MakeCommenter("ping", false),
+	})
+	if err := runErr(res, err); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res.LeftOver() != 2 {
+		t.Errorf("expected 2 issues left over past the ceiling, got %d from %+v", res.LeftOver(), res)
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrZeroMatches fails a run with FailOnZeroMatches whose searches match no
+// issues, which usually means a broken query such as one for a renamed label.
+var ErrZeroMatches = errors.New("the searches matched no issues")
+
+// checkMatches returns ErrZeroMatches if matched is zero with
+// FailOnZeroMatches, and warns if it is below WarnBelow. It returns whether
+// matched fell short of either.
+func checkMatches(o Options, matched int) (bool, error) {
+	if matched == 0 && o.FailOnZeroMatches {
+		return true, fmt.Errorf("%w: check the query, such as for renamed labels", ErrZeroMatches)
+	}
+	if matched < o.WarnBelow {
+		o.Logger.Printf("WARNING: the searches matched %d issues, fewer than --warn-below=%d: check the query, such as for renamed labels", matched, o.WarnBelow)
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunFewMatches(t *testing.T) {
+	issues := []github.Issue{makeIssue("o", "r", 1, "floor"), makeIssue("o", "r", 2, "floor")}
+	cases := []struct {
+		name       string
+		query      string
+		failOnZero bool
+		warnBelow  int
+		err        error
+		warned     bool
+		fewMatches bool
+		commented  int
+	}{
+		{
+			name:  "no matches by default",
+			query: "nothing",
+		},
+		{
+			name:       "no matches with --fail-on-zero-matches",
+			query:      "nothing",
+			failOnZero: true,
+			err:        ErrZeroMatches,
+			fewMatches: true,
+		},
+		{
+			name:       "matches with --fail-on-zero-matches",
+			query:      "floor",
+			failOnZero: true,
+			commented:  2,
+		},
+		{
+			name:       "below --warn-below",
+			query:      "floor",
+			warnBelow:  3,
+			warned:     true,
+			fewMatches: true,
+			commented:  2,
+		},
+		{
+			name:      "at --warn-below",
+			query:     "floor",
+			warnBelow: 2,
+			commented: 2,
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{issues: issues}
+		var logs bytes.Buffer
+		metrics := &MetricsLog{}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:          unscoped(tc.query),
+			SamplePercent:     100,
+			Commenter:         MakeCommenter("ping", false),
+			Logger:            log.New(&logs, "", 0),
+			Metrics:           metrics,
+			FailOnZeroMatches: tc.failOnZero,
+			WarnBelow:         tc.warnBelow,
+		})
+		if !errors.Is(err, tc.err) || (err == nil) != (tc.err == nil) {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		if warned := strings.Contains(logs.String(), "WARNING: the searches matched"); warned != tc.warned {
+			t.Errorf("%s: expected warned=%t in logs:\n%s", tc.name, tc.warned, logs.String())
+		}
+		if res.FewMatches != tc.fewMatches || res.Commented != tc.commented {
+			t.Errorf("%s: expected %d commented and FewMatches=%t, got %+v", tc.name, tc.commented, tc.fewMatches, res)
+		}
+		if report := NewRunReport(tc.query, false, res, err); report.FewMatches != tc.fewMatches {
+			t.Errorf("%s: expected FewMatches=%t in the report, got %+v", tc.name, tc.fewMatches, report)
+		}
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		if err := metrics.Save(path); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		var report metricsReport
+		if err := json.Unmarshal(b, &report); err != nil {
+			t.Fatalf("%s: bad report %s: %v", tc.name, b, err)
+		}
+		if report.Matched == nil || *report.Matched != res.Matched || report.FewMatches != tc.fewMatches {
+			t.Errorf("%s: expected %d matched and FewMatches=%t in the metrics, got %s", tc.name, res.Matched, tc.fewMatches, b)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// issueMetrics is the health of a single issue in the --export-metrics-file.
+type issueMetrics struct {
+	URL             string  `json:"url"`
+	IssueAgeDays    float64 `json:"issue_age_days"`
+	CommentsPerDay  float64 `json:"comments_per_day"`
+	ReactionsPerDay float64 `json:"reactions_per_day"`
+	// DaysSinceLastComment is null for issues without comments.
+	DaysSinceLastComment *float64 `json:"days_since_last_comment"`
+	IsBotAssigned        bool     `json:"is_bot_assigned"`
+}
+
+// metricsSummary averages the metrics of every issue in a run.
+type metricsSummary struct {
+	Issues             int     `json:"issues"`
+	AvgIssueAgeDays    float64 `json:"avg_issue_age_days"`
+	AvgCommentsPerDay  float64 `json:"avg_comments_per_day"`
+	AvgReactionsPerDay float64 `json:"avg_reactions_per_day"`
+	// AvgDaysSinceLastComment only counts issues with comments, and is null
+	// when there are none.
+	AvgDaysSinceLastComment *float64 `json:"avg_days_since_last_comment"`
+	BotAssigned             int      `json:"bot_assigned"`
+}
+
+type metricsReport struct {
+	Issues  []issueMetrics `json:"issues"`
+	Summary metricsSummary `json:"summary"`
+	API     *APIUsage      `json:"api,omitempty"`
+	// Matched is how many issues the searches matched, and FewMatches
+	// whether they fell short of --fail-on-zero-matches or --warn-below.
+	Matched    *int `json:"matched,omitempty"`
+	FewMatches bool `json:"few_matches,omitempty"`
+}
+
+// computeMetrics measures issue and its comments at now. Rates are per day of
+// age, counting issues younger than a day as a day old.
+func computeMetrics(issue github.Issue, comments []github.IssueComment, isBot func(string) bool, now time.Time) issueMetrics {
+	m := issueMetrics{URL: issue.HTMLURL}
+	if !issue.CreatedAt.IsZero() {
+		m.IssueAgeDays = now.Sub(issue.CreatedAt).Hours() / 24
+	}
+	age := m.IssueAgeDays
+	if age < 1 {
+		age = 1
+	}
+	m.CommentsPerDay = float64(len(comments)) / age
+	m.ReactionsPerDay = float64(issue.Reactions.TotalCount) / age
+	var last time.Time
+	for _, c := range comments {
+		if c.CreatedAt.After(last) {
+			last = c.CreatedAt
+		}
+	}
+	if !last.IsZero() {
+		days := now.Sub(last).Hours() / 24
+		m.DaysSinceLastComment = &days
+	}
+	for _, a := range issue.Assignees {
+		if isBot(a.Login) {
+			m.IsBotAssigned = true
+			break
+		}
+	}
+	return m
+}
+
+// summarizeMetrics averages metrics.
+func summarizeMetrics(metrics []issueMetrics) metricsSummary {
+	s := metricsSummary{Issues: len(metrics)}
+	if len(metrics) == 0 {
+		return s
+	}
+	var lastComment float64
+	commented := 0
+	for _, m := range metrics {
+		s.AvgIssueAgeDays += m.IssueAgeDays
+		s.AvgCommentsPerDay += m.CommentsPerDay
+		s.AvgReactionsPerDay += m.ReactionsPerDay
+		if m.DaysSinceLastComment != nil {
+			lastComment += *m.DaysSinceLastComment
+			commented++
+		}
+		if m.IsBotAssigned {
+			s.BotAssigned++
+		}
+	}
+	n := float64(len(metrics))
+	s.AvgIssueAgeDays /= n
+	s.AvgCommentsPerDay /= n
+	s.AvgReactionsPerDay /= n
+	if commented > 0 {
+		lastComment /= float64(commented)
+		s.AvgDaysSinceLastComment = &lastComment
+	}
+	return s
+}
+
+// MetricsLog collects the metrics of every issue Run processes. A nil
+// MetricsLog collects nothing.
+type MetricsLog struct {
+	sync.Mutex
+	issues     []issueMetrics
+	api        *APIUsage
+	matched    *int
+	fewMatches bool
+}
+
+// setAPI records the API usage of the run for the report.
+func (l *MetricsLog) setAPI(u APIUsage) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.api = &u
+}
+
+// setMatches records how many issues the run matched for the report.
+func (l *MetricsLog) setMatches(matched int, few bool) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.matched = &matched
+	l.fewMatches = few
+}
+
+// add lists the comments on issue to measure it.
+func (l *MetricsLog) add(c Client, issue github.Issue, isBot func(string) bool, now time.Time) error {
+	if l == nil {
+		return nil
+	}
+	ref, _, err := issueRef(issue)
+	if err != nil {
+		return err
+	}
+	comments, err := c.ListIssueComments(ref.Org, ref.Repo, ref.Number)
+	if err != nil {
+		return err
+	}
+	m := computeMetrics(issue, comments, isBot, now)
+	l.Lock()
+	defer l.Unlock()
+	l.issues = append(l.issues, m)
+	return nil
+}
+
+// Save writes the metrics of the issues and their averages to path as JSON.
+func (l *MetricsLog) Save(path string) error {
+	l.Lock()
+	report := metricsReport{Issues: l.issues, API: l.api, Matched: l.matched, FewMatches: l.fewMatches}
+	l.Unlock()
+	if report.Issues == nil {
+		report.Issues = []issueMetrics{}
+	}
+	report.Summary = summarizeMetrics(report.Issues)
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
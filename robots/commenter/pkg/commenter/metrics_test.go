@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestComputeMetrics(t *testing.T) {
+	now := time.Date(2023, 6, 11, 0, 0, 0, 0, time.UTC)
+	isBot := func(login string) bool { return login == "bot" }
+	issue := makeIssue("o", "r", 1, "")
+	issue.CreatedAt = now.Add(-10 * 24 * time.Hour)
+	issue.Reactions.TotalCount = 5
+	issue.Assignees = []github.User{{Login: "alice"}, {Login: "bot"}}
+	comments := []github.IssueComment{
+		{CreatedAt: now.Add(-4 * 24 * time.Hour)},
+		{CreatedAt: now.Add(-2 * 24 * time.Hour)},
+		{CreatedAt: now.Add(-8 * 24 * time.Hour)},
+	}
+	two := 2.0
+	expected := issueMetrics{
+		URL:                  issue.HTMLURL,
+		IssueAgeDays:         10,
+		CommentsPerDay:       0.3,
+		ReactionsPerDay:      0.5,
+		DaysSinceLastComment: &two,
+		IsBotAssigned:        true,
+	}
+	if actual := computeMetrics(issue, comments, isBot, now); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	fresh := makeIssue("o", "r", 2, "")
+	fresh.CreatedAt = now.Add(-time.Hour)
+	fresh.Reactions.TotalCount = 3
+	m := computeMetrics(fresh, nil, isBot, now)
+	if m.ReactionsPerDay != 3 || m.DaysSinceLastComment != nil || m.IsBotAssigned {
+		t.Errorf("expected rates over a whole day and no last comment, got %+v", m)
+	}
+}
+
+func TestSummarizeMetrics(t *testing.T) {
+	one, three := 1.0, 3.0
+	s := summarizeMetrics([]issueMetrics{
+		{IssueAgeDays: 10, CommentsPerDay: 1, DaysSinceLastComment: &one, IsBotAssigned: true},
+		{IssueAgeDays: 20, ReactionsPerDay: 2, DaysSinceLastComment: &three},
+		{IssueAgeDays: 30},
+	})
+	two := 2.0
+	expected := metricsSummary{
+		Issues:                  3,
+		AvgIssueAgeDays:         20,
+		AvgCommentsPerDay:       1.0 / 3,
+		AvgReactionsPerDay:      2.0 / 3,
+		AvgDaysSinceLastComment: &two,
+		BotAssigned:             1,
+	}
+	if !reflect.DeepEqual(s, expected) {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+	if s := summarizeMetrics(nil); s != (metricsSummary{}) {
+		t.Errorf("expected an empty summary, got %+v", s)
+	}
+}
+
+func TestRunMetrics(t *testing.T) {
+	assigned := makeIssue("o", "r", 1, "measure")
+	assigned.Assignees = []github.User{{Login: "bot"}}
+	c := fakeClient{
+		issues:   []github.Issue{assigned, makeIssue("o", "r", 2, "measure"), makeIssue("o", "error", 3, "measure")},
+		existing: map[int][]github.IssueComment{1: {{Body: "hello", CreatedAt: time.Now()}}},
+	}
+	metrics := &MetricsLog{}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("measure"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Metrics:       metrics,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Problems) == 0 {
+		t.Error("expected the issue that could not be measured to be reported")
+	}
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	if err := metrics.Save(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var report metricsReport
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("bad report %s: %v", b, err)
+	}
+	if report.Summary.Issues != 2 || report.Summary.BotAssigned != 1 || report.Summary.AvgDaysSinceLastComment == nil {
+		t.Errorf("unexpected summary %+v", report.Summary)
+	}
+}
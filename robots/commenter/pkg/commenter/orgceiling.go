@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// orgBudgets holds a ceilingBudget for each org, enforcing --ceiling-per-org.
+type orgBudgets struct {
+	limit   int
+	budgets map[string]*ceilingBudget
+	mu      sync.Mutex
+	// logged are the orgs whose limit was reported as reached.
+	logged map[string]bool
+}
+
+// newOrgBudgets returns the budgets of the orgs of issues, or nil when limit
+// is 0. They are all made up front so that workers can look them up freely.
+func newOrgBudgets(limit int, issues []github.Issue) *orgBudgets {
+	if limit <= 0 {
+		return nil
+	}
+	b := &orgBudgets{limit: limit, budgets: map[string]*ceilingBudget{}, logged: map[string]bool{}}
+	for _, i := range issues {
+		if org := issueOrg(i); org != "" && b.budgets[org] == nil {
+			b.budgets[org] = newCeilingBudget(limit)
+		}
+	}
+	return b
+}
+
+// issueOrg returns the lowercased org of i, or "" if it cannot be told.
+func issueOrg(i github.Issue) string {
+	ref, _, err := issueRef(i)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(ref.Org)
+}
+
+// of returns the budget of the org of i, nil and so infinite when there is no
+// limit or its org is unknown, leaving processIssue to report it.
+func (b *orgBudgets) of(i github.Issue) *ceilingBudget {
+	if b == nil {
+		return nil
+	}
+	return b.budgets[issueOrg(i)]
+}
+
+// reached logs that the org of i used up its budget, once per org.
+func (b *orgBudgets) reached(i github.Issue, logger *log.Logger) {
+	org := issueOrg(i)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.logged[org] {
+		return
+	}
+	b.logged[org] = true
+	logger.Printf("[%s] Reached --ceiling-per-org=%d, moving on to the next org", org, b.limit)
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunCeilingPerOrg(t *testing.T) {
+	issues := []github.Issue{
+		makeIssue("big", "r", 1, "org"),
+		makeIssue("big", "r", 2, "org"),
+		makeIssue("Big", "other", 3, "org"),
+		makeIssue("small", "r", 4, "org"),
+		makeIssue("big", "r", 5, "org"),
+		makeIssue("small", "r", 6, "org"),
+		makeIssue("tiny", "r", 7, "org"),
+	}
+	cases := []struct {
+		name     string
+		ceiling  int
+		perOrg   int
+		comments []int
+	}{
+		{
+			name:     "disabled",
+			ceiling:  3,
+			comments: []int{1, 2, 3},
+		},
+		{
+			name:     "other orgs get a turn",
+			ceiling:  3,
+			perOrg:   1,
+			comments: []int{1, 4, 7},
+		},
+		{
+			name:     "issues skipped by the org do not use the ceiling",
+			ceiling:  4,
+			perOrg:   2,
+			comments: []int{1, 2, 4, 6},
+		},
+		{
+			name:     "no global ceiling",
+			perOrg:   2,
+			comments: []int{1, 2, 4, 6, 7},
+		},
+	}
+	for _, tc := range cases {
+		var logs bytes.Buffer
+		c := fakeClient{issues: issues}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("org"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hi", false),
+			Ceiling:       tc.ceiling,
+			CeilingPerOrg: tc.perOrg,
+			Logger:        log.New(&logs, "", 0),
+		})
+		if err := runErr(res, err); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(c.comments, tc.comments) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, tc.comments, c.comments)
+		}
+		if res.Commented != len(tc.comments) || res.Skipped != 0 {
+			t.Errorf("%s: expected the issues past a ceiling left over, got %+v", tc.name, res)
+		}
+		if tc.perOrg > 0 {
+			if n := strings.Count(logs.String(), "[big] Reached --ceiling-per-org"); n != 1 {
+				t.Errorf("%s: expected the big org reported once, got %d in:\n%s", tc.name, n, logs.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxCommentLength is the longest comment body GitHub accepts. Comments are
+// measured in bytes, which never undercounts GitHub's limit in characters.
+const MaxCommentLength = 65536
+
+// SafeguardOptions configures the checks PostComment applies before commenting.
+type SafeguardOptions struct {
+	// Marker is embedded in the comment as a hidden HTML comment if set.
+	Marker string
+	// SkipDuplicates skips issues that already have an identical comment.
+	SkipDuplicates bool
+	// MaxLength is the longest comment allowed in bytes, MaxCommentLength if
+	// unset.
+	MaxLength int
+	// Audit, if set, records every comment and gist created.
+	Audit *AuditLog
+	// Footer, if set, is appended to every comment below a rule, or below
+	// the footer the comment already has. Duplicate checks ignore footers,
+	// since they usually differ between runs.
+	Footer string
+	// NoTruncate rejects comments over the limit instead of truncating them.
+	NoTruncate bool
+	// Logger gets truncation warnings and skipped duplicates, the standard
+	// logger if unset.
+	Logger *log.Logger
+}
+
+// limit returns the longest comment body allowed.
+func (o SafeguardOptions) limit() int {
+	if o.MaxLength > 0 {
+		return o.MaxLength
+	}
+	return MaxCommentLength
+}
+
+// logger returns where to report what the safeguards did.
+func (o SafeguardOptions) logger() *log.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return log.Default()
+}
+
+// decorate returns comment with the footer and marker it is posted with.
+func (o SafeguardOptions) decorate(comment string) string {
+	return withMarker(withFooter(comment, o.Footer), o.Marker)
+}
+
+// PostResult describes what PostComment did.
+type PostResult struct {
+	// Commented is true when the comment was created.
+	Commented bool
+	// Duplicate is true when an identical comment already existed.
+	Duplicate bool
+}
+
+// withMarker appends the hidden marker to body, if any.
+func withMarker(body, marker string) string {
+	if marker == "" {
+		return body
+	}
+	return body + "\n\n" + markerTag(marker)
+}
+
+// footerTag marks where the footer of a comment starts, so that duplicate
+// checks can ignore it.
+const footerTag = "<!-- commenter: footer -->"
+
+// withFooter appends the footer to body below a rule, if any, or right
+// below the footer body already has.
+func withFooter(body, footer string) string {
+	switch {
+	case footer == "":
+		return body
+	case strings.Contains(body, footerTag):
+		return body + "\n\n" + footer
+	}
+	return body + "\n\n" + footerTag + "\n---\n" + footer
+}
+
+// isDuplicate returns whether the existing comment is body, ignoring the
+// footers of both. The marker must still match.
+func isDuplicate(existing, body, marker string) bool {
+	if existing == body {
+		return true
+	}
+	comment, _, ok := strings.Cut(body, footerTag)
+	if !ok {
+		return false
+	}
+	previous, _, ok := strings.Cut(existing, footerTag)
+	return ok && previous == comment && strings.HasSuffix(existing, withMarker("", marker))
+}
+
+// markerTag is the hidden HTML comment identifying comments with marker.
+func markerTag(marker string) string {
+	return fmt.Sprintf("<!-- commenter: %s -->", marker)
+}
+
+// redirected notes in comment, posted elsewhere for testing, the URL of the
+// issue it was meant for.
+func redirected(comment, url string) string {
+	return fmt.Sprintf("%s\n\n<!-- test redirect from: %s -->", comment, url)
+}
+
+// PostComment creates a comment on target, applying the same safeguards as a
+// batch run: the footer and marker are embedded, oversized bodies are
+// truncated (or rejected with NoTruncate) and duplicate comments are skipped
+// when requested.
+func PostComment(ctx context.Context, c Client, target IssueRef, comment string, opts SafeguardOptions) (PostResult, error) {
+	logger := opts.logger()
+	body := opts.decorate(comment)
+	if n, limit := len(body), opts.limit(); n > limit {
+		if opts.NoTruncate {
+			return PostResult{}, fmt.Errorf("comment is %d bytes, exceeding the limit of %d (truncation is disabled by --no-truncate)", n, limit)
+		}
+		short, err := truncateComment(comment, opts)
+		if err != nil {
+			return PostResult{}, err
+		}
+		body = opts.decorate(short)
+		logger.Printf("Warning: truncated the comment for %s from %d to %d bytes to fit the limit of %d", target, n, len(body), limit)
+	}
+	if opts.SkipDuplicates {
+		comments, err := c.ListIssueComments(target.Org, target.Repo, target.Number)
+		if err != nil {
+			return PostResult{}, fmt.Errorf("failed to list comments: %w", err)
+		}
+		for _, existing := range comments {
+			if isDuplicate(existing.Body, body, opts.Marker) {
+				logger.Printf("Skipping %s: identical comment already exists at %s", target, existing.HTMLURL)
+				return PostResult{Duplicate: true}, nil
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return PostResult{}, err
+	}
+	err := c.CreateComment(target.Org, target.Repo, target.Number, body)
+	opts.Audit.record(auditComment, target, body, "", err)
+	if err != nil {
+		return PostResult{}, err
+	}
+	return PostResult{Commented: true}, nil
+}
+
+// RunSingle renders and posts a comment on the issue at url without searching.
+// minInactivity is only exposed to the template.
+func RunSingle(ctx context.Context, c Client, url string, commenter func(Meta) (string, error), minInactivity time.Duration, opts SafeguardOptions) error {
+	target, err := ParseHTMLURL(url)
+	if err != nil {
+		return err
+	}
+	org, repo, number := target.Org, target.Repo, target.Number
+	issue, err := c.GetIssue(org, repo, number)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", target, err)
+	}
+	m := Meta{Number: number, Org: org, Repo: repo, Issue: *issue, IsPR: issue.IsPullRequest()}
+	m.setAges(time.Now(), minInactivity)
+	comment, err := commenter(m)
+	if err != nil {
+		return fmt.Errorf("failed to create comment for %s: %w", target, err)
+	}
+	res, err := PostComment(ctx, c, target, comment, opts)
+	if err != nil {
+		return fmt.Errorf("failed to apply comment to %s: %w", target, err)
+	}
+	if res.Commented {
+		opts.logger().Printf("Commented on %s", url)
+	}
+	return nil
+}
+
+// overflowToGist stores comment in a gist and returns a shortened comment that
+// starts like the original and links to the gist, fitting within opts' limit.
+func overflowToGist(c Client, target IssueRef, comment string, opts SafeguardOptions) (string, error) {
+	url, err := c.CreateGist(fmt.Sprintf("Comment for %s", target), comment)
+	opts.Audit.record(auditGist, target, comment, url, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to create gist: %w", err)
+	}
+	note := fmt.Sprintf("\n\n... (the full comment is too long for GitHub, see %s)", url)
+	room := opts.limit() - len(opts.decorate(note))
+	if room < 0 {
+		return "", fmt.Errorf("link to %s does not fit in %d bytes", url, opts.limit())
+	}
+	return truncateUTF8(comment, room) + note, nil
+}
+
+// truncatedNote ends comments that were cut to fit the length limit.
+const truncatedNote = "\n\n... (truncated)"
+
+// truncateComment cuts comment so that, decorated, it fits within opts' limit,
+// and notes that it was truncated. Footers added by WithHeaderFooter are kept.
+func truncateComment(comment string, opts SafeguardOptions) (string, error) {
+	text, footer := comment, ""
+	if i := strings.Index(comment, "\n\n"+footerTag); i >= 0 {
+		text, footer = comment[:i], comment[i:]
+	}
+	room := opts.limit() - len(opts.decorate(truncatedNote+footer))
+	if room < 0 {
+		return "", fmt.Errorf("comment does not fit in %d bytes even when truncated", opts.limit())
+	}
+	return truncateUTF8(text, room) + truncatedNote + footer, nil
+}
+
+// truncateUTF8 returns the longest prefix of s that is at most n bytes long
+// and does not split a multi-byte character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
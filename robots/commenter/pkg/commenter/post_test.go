@@ -0,0 +1,455 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestPostComment(t *testing.T) {
+	target := IssueRef{Org: "o", Repo: "r", Number: 1}
+	cases := []struct {
+		name      string
+		target    IssueRef
+		body      string
+		opts      SafeguardOptions
+		existing  []github.IssueComment
+		cancel    bool
+		expected  PostResult
+		commented []int
+		err       bool
+	}{
+		{
+			name:      "plain comment",
+			target:    target,
+			body:      "hello",
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:      "marker does not trip over other comments",
+			target:    target,
+			body:      "hello",
+			opts:      SafeguardOptions{Marker: "stale", SkipDuplicates: true},
+			existing:  []github.IssueComment{{Body: "hello"}},
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:     "duplicate is skipped",
+			target:   target,
+			body:     "hello",
+			opts:     SafeguardOptions{Marker: "stale", SkipDuplicates: true},
+			existing: []github.IssueComment{{Body: "unrelated"}, {Body: withMarker("hello", "stale")}},
+			expected: PostResult{Duplicate: true},
+		},
+		{
+			name:     "duplicate with another run's footer is skipped",
+			target:   target,
+			body:     "hello",
+			opts:     SafeguardOptions{Marker: "stale", SkipDuplicates: true, Footer: "*run 2*"},
+			existing: []github.IssueComment{{Body: withMarker(withFooter("hello", "*run 1*"), "stale")}},
+			expected: PostResult{Duplicate: true},
+		},
+		{
+			name:      "footer does not hide other differences",
+			target:    target,
+			body:      "hello",
+			opts:      SafeguardOptions{SkipDuplicates: true, Footer: "*run 2*"},
+			existing:  []github.IssueComment{{Body: withFooter("hello there", "*run 1*")}},
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:   "footer pushes body over the limit",
+			target: target,
+			body:   strings.Repeat("a", MaxCommentLength),
+			opts:   SafeguardOptions{Footer: "*run 1*", NoTruncate: true},
+			err:    true,
+		},
+		{
+			name:      "duplicates are ignored unless requested",
+			target:    target,
+			body:      "hello",
+			existing:  []github.IssueComment{{Body: "hello"}},
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:   "listing comments fails",
+			target: IssueRef{Org: "o", Repo: "error", Number: 1},
+			body:   "hello",
+			opts:   SafeguardOptions{SkipDuplicates: true},
+			err:    true,
+		},
+		{
+			name:      "body at the limit",
+			target:    target,
+			body:      strings.Repeat("a", MaxCommentLength),
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:   "oversized body is rejected without truncation",
+			target: target,
+			body:   strings.Repeat("a", MaxCommentLength+1),
+			opts:   SafeguardOptions{NoTruncate: true},
+			err:    true,
+		},
+		{
+			name:      "oversized body is truncated",
+			target:    target,
+			body:      strings.Repeat("a", MaxCommentLength+1),
+			expected:  PostResult{Commented: true},
+			commented: []int{1},
+		},
+		{
+			name:   "marker pushes body over the limit",
+			target: target,
+			body:   strings.Repeat("a", MaxCommentLength),
+			opts:   SafeguardOptions{Marker: "stale", NoTruncate: true},
+			err:    true,
+		},
+		{
+			name:   "nothing fits when truncated",
+			target: target,
+			body:   strings.Repeat("a", 100),
+			opts:   SafeguardOptions{MaxLength: 5},
+			err:    true,
+		},
+		{
+			name:   "cancelled context does not comment",
+			target: target,
+			body:   "hello",
+			cancel: true,
+			err:    true,
+		},
+		{
+			name:   "comment fails",
+			target: IssueRef{Org: "o", Repo: "error", Number: 1},
+			body:   "hello",
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		c := fakeClient{existing: map[int][]github.IssueComment{1: tc.existing}}
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancel {
+			cancel()
+		}
+		actual, err := PostComment(ctx, &c, tc.target, tc.body, tc.opts)
+		cancel()
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.err {
+			t.Errorf("%s: failed to receive an error", tc.name)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, actual)
+		}
+		if !reflect.DeepEqual(c.comments, tc.commented) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.name, tc.commented, c.comments)
+		}
+	}
+}
+
+func TestPostCommentTruncates(t *testing.T) {
+	target := IssueRef{Org: "o", Repo: "r", Number: 1}
+	cases := []struct {
+		name      string
+		body      string
+		opts      SafeguardOptions
+		truncated bool
+	}{
+		{
+			name: "one under the limit",
+			body: strings.Repeat("a", MaxCommentLength-1),
+		},
+		{
+			name: "at the limit",
+			body: strings.Repeat("a", MaxCommentLength),
+		},
+		{
+			name:      "one over the limit",
+			body:      strings.Repeat("a", MaxCommentLength+1),
+			truncated: true,
+		},
+		{
+			name: "multi-byte characters at the limit",
+			body: strings.Repeat("é", MaxCommentLength/2),
+		},
+		{
+			name:      "multi-byte character across the cut",
+			body:      "a" + strings.Repeat("é", MaxCommentLength/2),
+			truncated: true,
+		},
+		{
+			name:      "four byte characters across the cut",
+			body:      strings.Repeat("😀", MaxCommentLength/4+1),
+			truncated: true,
+		},
+		{
+			name:      "marker and footer are kept",
+			body:      withFooter(strings.Repeat("é", MaxCommentLength), "*footer*"),
+			opts:      SafeguardOptions{Marker: "m", Footer: "*run 1*"},
+			truncated: true,
+		},
+	}
+
+	for _, tc := range cases {
+		c := fakeClient{}
+		tc.opts.Logger = log.New(io.Discard, "", 0)
+		if _, err := PostComment(context.Background(), &c, target, tc.body, tc.opts); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if len(c.bodies) != 1 {
+			t.Errorf("%s: expected one comment, got %d", tc.name, len(c.bodies))
+			continue
+		}
+		body := c.bodies[0]
+		if len(body) > MaxCommentLength {
+			t.Errorf("%s: comment is %d bytes, exceeding the limit", tc.name, len(body))
+		}
+		if !utf8.ValidString(body) {
+			t.Errorf("%s: comment is not valid UTF-8", tc.name)
+		}
+		if truncated := strings.Contains(body, truncatedNote); truncated != tc.truncated {
+			t.Errorf("%s: expected truncated %t, got %t", tc.name, tc.truncated, truncated)
+		}
+		if !tc.truncated && body != tc.opts.decorate(tc.body) {
+			t.Errorf("%s: comment was modified", tc.name)
+		}
+		if tc.opts.Footer != "" && !strings.Contains(body, "*footer*\n\n*run 1*") {
+			t.Errorf("%s: footers were lost: %q", tc.name, body[len(body)-100:])
+		}
+		if !strings.HasSuffix(body, withMarker("", tc.opts.Marker)) {
+			t.Errorf("%s: marker was lost", tc.name)
+		}
+	}
+}
+
+func TestRunSingle(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{makeIssue("o", "r", 5, "single")}}
+	commenter := MakeCommenter("{{.Issue.Title}} {{.Org}}/{{.Repo}}#{{.Number}}", true)
+	if err := RunSingle(context.Background(), &c, "https://github.com/o/r/pull/5", commenter, 0, SafeguardOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{5}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+
+	if err := RunSingle(context.Background(), &c, "https://github.com/o/r/pull/6", commenter, 0, SafeguardOptions{}); err == nil {
+		t.Error("failed to report an issue that could not be fetched")
+	}
+	if err := RunSingle(context.Background(), &c, "not a url", commenter, 0, SafeguardOptions{}); err == nil {
+		t.Error("failed to report an unparsable url")
+	}
+}
+
+func TestRunAppliesSafeguards(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "guarded"),
+			makeIssue("o", "r", 2, "guarded"),
+		},
+		existing: map[int][]github.IssueComment{
+			1: {{Body: withMarker("hello", "nag")}},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("guarded"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+		Safeguards:    SafeguardOptions{Marker: "nag", SkipDuplicates: true},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	cases := []struct {
+		name     string
+		s        string
+		n        int
+		expected string
+	}{
+		{
+			name:     "short enough",
+			s:        "hello",
+			n:        5,
+			expected: "hello",
+		},
+		{
+			name:     "ascii",
+			s:        "hello",
+			n:        3,
+			expected: "hel",
+		},
+		{
+			name:     "cut inside a multi-byte character",
+			s:        "aé",
+			n:        2,
+			expected: "a",
+		},
+		{
+			name:     "cut after a multi-byte character",
+			s:        "aéb",
+			n:        3,
+			expected: "aé",
+		},
+		{
+			name:     "cut inside a four byte character",
+			s:        "a😀",
+			n:        4,
+			expected: "a",
+		},
+		{
+			name: "nothing fits",
+			s:    "😀",
+			n:    3,
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := truncateUTF8(tc.s, tc.n); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestOverflowToGist(t *testing.T) {
+	c := fakeClient{}
+	opts := SafeguardOptions{Marker: "m", MaxLength: 200}
+	long := strings.Repeat("a", 500)
+	short, err := overflowToGist(&c, IssueRef{Org: "o", Repo: "r", Number: 1}, long, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(c.gists, []string{long}) {
+		t.Errorf("expected the full comment in a gist, got %v", c.gists)
+	}
+	if n := len(withMarker(short, opts.Marker)); n != opts.MaxLength {
+		t.Errorf("expected the shortened comment to fill the %d byte limit, got %d: %q", opts.MaxLength, n, short)
+	}
+	if !strings.HasPrefix(short, "aaa") || !strings.HasSuffix(short, "https://gist.example.com/1)") {
+		t.Errorf("expected the shortened comment to start like the original and link the gist, got %q", short)
+	}
+
+	if _, err := overflowToGist(&c, IssueRef{Org: "o", Repo: "error", Number: 1}, long, opts); err == nil {
+		t.Error("failed to report the gist error")
+	}
+	if _, err := overflowToGist(&c, IssueRef{Org: "o", Repo: "r", Number: 1}, long, SafeguardOptions{MaxLength: 10}); err == nil {
+		t.Error("failed to report a limit too small for the link")
+	}
+}
+
+func TestOverflowToGistDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request in a dry run: %s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+	c, err := github.NewDryRunClient(func() []byte { return []byte("token") }, func(b []byte) []byte { return b }, server.URL+"/graphql", server.URL)
+	if err != nil {
+		t.Fatalf("failed to construct the GitHub client: %v", err)
+	}
+	short, err := overflowToGist(c, IssueRef{Org: "o", Repo: "r", Number: 1}, strings.Repeat("a", 500), SafeguardOptions{MaxLength: 200})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(short, github.DryRunGistURL+")") {
+		t.Errorf("expected the shortened comment to link the dry-run gist, got %q", short)
+	}
+}
+
+func TestRunOverflowToGist(t *testing.T) {
+	for _, overflow := range []bool{false, true} {
+		c := fakeClient{issues: []github.Issue{
+			makeIssue("o", "r", 1, "overflow"),
+		}}
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:       unscoped("overflow"),
+			SamplePercent:  100,
+			Commenter:      MakeCommenter(strings.Repeat("x", 200), false),
+			Safeguards:     SafeguardOptions{MaxLength: 100, NoTruncate: true},
+			OverflowToGist: overflow,
+		}))
+		if overflow {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if len(c.gists) != 1 || len(c.bodies) != 1 || len(c.bodies[0]) > 100 {
+				t.Errorf("expected a gist and a short comment, got gists %v and comments %q", c.gists, c.bodies)
+			}
+		} else {
+			if err == nil {
+				t.Error("failed to report the oversized comment")
+			}
+			if len(c.gists) != 0 || len(c.comments) != 0 {
+				t.Errorf("expected nothing to be created, got gists %v and comments %v", c.gists, c.comments)
+			}
+		}
+	}
+}
+
+func TestRunRedirect(t *testing.T) {
+	first, second := makeIssue("o", "r", 1, "redirect"), makeIssue("o", "r", 2, "redirect")
+	c := fakeClient{
+		issues:   []github.Issue{first, second},
+		existing: map[int][]github.IssueComment{1: {{ID: 7, Body: withMarker("ping", "stale"), User: github.User{Login: "bot"}}}},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("redirect"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Safeguards:    SafeguardOptions{Marker: "stale"},
+		Confirm:       true,
+		Prune:         PruneDelete,
+		PruneMax:      5,
+		AddLabels:     []string{"triage/stale"},
+		Redirect:      &IssueRef{Org: "qa", Repo: "sandbox", Number: 42},
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{42, 42}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	for n, i := range []github.Issue{first, second} {
+		if tag := "<!-- test redirect from: " + i.HTMLURL + " -->"; n >= len(c.bodies) || !strings.Contains(c.bodies[n], tag) {
+			t.Errorf("expected a comment with %q, got %q", tag, c.bodies)
+		}
+	}
+	if len(c.deleted) != 0 || len(c.addedLabels) != 0 {
+		t.Errorf("expected the matched issues to be left alone, deleted %v and labelled %v", c.deleted, c.addedLabels)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// PreviewMatches is how many matches Preview lists.
+const PreviewMatches = 20
+
+// Preview runs searches like Run, only logging how many issues they match and
+// the first limit of them. It makes no changes, so a read-only token will do.
+func Preview(c Client, searches []OrgSearch, sort string, asc bool, limit int, logger *log.Logger) (int, error) {
+	var issues []github.Issue
+	seen := map[string]bool{}
+	for _, s := range searches {
+		found, err := search(c, s, sort, asc, logger)
+		if err != nil {
+			return 0, fmt.Errorf("%ssearch failed: %w", s.logPrefix(), err)
+		}
+		for _, i := range found {
+			if key := issueKey(i); !seen[key] {
+				seen[key] = true
+				issues = append(issues, i)
+			}
+		}
+	}
+	if len(searches) > 1 {
+		sortIssues(issues, sort, asc)
+	}
+	logger.Printf("Matched %d issues", len(issues))
+	for n, i := range issues {
+		if n == limit {
+			logger.Printf("  ... and %d more", len(issues)-limit)
+			break
+		}
+		updated := "never"
+		if !i.UpdatedAt.IsZero() {
+			updated = i.UpdatedAt.Format(time.RFC3339)
+		}
+		logger.Printf("  %s %s %q updated %s", kind(i), i.HTMLURL, i.Title, updated)
+	}
+	return len(issues), nil
+}
+
+// CheckTemplate returns an error if comment does not parse as a --template.
+func CheckTemplate(comment string) error {
+	_, err := newTemplate("comment").Parse(comment)
+	return err
+}
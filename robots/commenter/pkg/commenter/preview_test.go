@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestPreview(t *testing.T) {
+	updated := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var issues []github.Issue
+	for n := 1; n <= 4; n++ {
+		i := makeIssue("o", "r", n, "preview")
+		i.UpdatedAt = updated
+		issues = append(issues, i)
+	}
+	cases := []struct {
+		name     string
+		searches []OrgSearch
+		limit    int
+		count    int
+		lines    []string
+		err      bool
+	}{
+		{
+			name:     "lists every match under the limit",
+			searches: unscoped("preview"),
+			limit:    PreviewMatches,
+			count:    4,
+			lines:    []string{"Matched 4 issues", `  issue fake://localhost/o/r/issues/4 "preview" updated 2024-03-01T12:00:00Z`},
+		},
+		{
+			name:     "counts the matches past the limit",
+			searches: unscoped("preview"),
+			limit:    3,
+			count:    4,
+			lines:    []string{"Matched 4 issues", "  ... and 1 more"},
+		},
+		{
+			name:     "overlapping searches",
+			searches: []OrgSearch{{Org: "o", Queries: []string{"preview"}}, {Queries: []string{"preview"}}},
+			limit:    PreviewMatches,
+			count:    4,
+			lines:    []string{"Matched 4 issues"},
+		},
+		{
+			name:     "failed search",
+			searches: unscoped("error"),
+			err:      true,
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{issues: issues}
+		var logs bytes.Buffer
+		count, err := Preview(&c, tc.searches, "updated", true, tc.limit, log.New(&logs, "", 0))
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.err, err)
+		}
+		if count != tc.count {
+			t.Errorf("%s: expected %d matches, got %d", tc.name, tc.count, count)
+		}
+		for _, line := range tc.lines {
+			if !strings.Contains(logs.String(), line+"\n") {
+				t.Errorf("%s: expected the line %q, got:\n%s", tc.name, line, logs.String())
+			}
+		}
+		if len(c.comments) != 0 {
+			t.Errorf("%s: expected no comments, got %v", tc.name, c.comments)
+		}
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	if err := CheckTemplate("Hi {{.Issue.User.Login}}"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := CheckTemplate("Hi {{.Issue.User.Login"); err == nil {
+		t.Error("expected an unterminated action to be rejected")
+	}
+}
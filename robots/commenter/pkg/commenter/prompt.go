@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// Answer is the decision on a single comment with --confirm-each. The zero
+// Answer is AnswerNo, so that only an explicit AnswerYes posts.
+type Answer int
+
+const (
+	// AnswerNo skips the issue.
+	AnswerNo Answer = iota
+	// AnswerYes posts the comment.
+	AnswerYes
+	// AnswerQuit stops the run without commenting on the remaining issues.
+	AnswerQuit
+)
+
+// Prompter decides whether to post comment on issue. Ask may be called from
+// several workers at once. The issue is not commented on when Ask fails,
+// whatever the Answer.
+type Prompter interface {
+	Ask(issue github.Issue, comment string) (Answer, error)
+}
+
+// LinePrompter shows each comment on out and reads the answers from in, one
+// per line. Once told to quit it answers AnswerQuit without asking again,
+// which stops workers already waiting to ask.
+type LinePrompter struct {
+	sync.Mutex
+	in   *bufio.Reader
+	out  io.Writer
+	quit bool
+}
+
+// NewLinePrompter returns a LinePrompter asking on out and reading from in.
+func NewLinePrompter(in io.Reader, out io.Writer) *LinePrompter {
+	return &LinePrompter{in: bufio.NewReader(in), out: out}
+}
+
+// Ask shows comment and waits for a yes, no or quit, asking again on
+// anything else.
+func (p *LinePrompter) Ask(issue github.Issue, comment string) (Answer, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.quit {
+		return AnswerQuit, nil
+	}
+	fmt.Fprintf(p.out, "\n%s\n%s\n\n%s\n\n", issue.HTMLURL, issue.Title, comment)
+	for {
+		fmt.Fprint(p.out, "Post this comment? [y/n/q] ")
+		line, err := p.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			// Nobody is left to approve anything.
+			p.quit = true
+			if errors.Is(err, io.EOF) {
+				return AnswerQuit, nil
+			}
+			return AnswerQuit, err
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return AnswerYes, nil
+		case "n", "no":
+			return AnswerNo, nil
+		case "q", "quit":
+			p.quit = true
+			return AnswerQuit, nil
+		}
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// scriptedPrompter answers with answers in turn, recording the comments asked
+// about, and fails with err if set.
+type scriptedPrompter struct {
+	answers []Answer
+	asked   []string
+	err     error
+}
+
+func (p *scriptedPrompter) Ask(issue github.Issue, comment string) (Answer, error) {
+	p.asked = append(p.asked, comment)
+	if p.err != nil {
+		return AnswerYes, p.err
+	}
+	a := p.answers[0]
+	p.answers = p.answers[1:]
+	return a, nil
+}
+
+func TestLinePrompter(t *testing.T) {
+	var out bytes.Buffer
+	p := NewLinePrompter(strings.NewReader("Y\nmaybe\nn\nq\ny\n"), &out)
+	issue := makeIssue("o", "r", 1, "Stale issue")
+	var answers []Answer
+	for n := 0; n < 4; n++ {
+		a, err := p.Ask(issue, "the comment")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		answers = append(answers, a)
+	}
+	if expected := []Answer{AnswerYes, AnswerNo, AnswerQuit, AnswerQuit}; !reflect.DeepEqual(answers, expected) {
+		t.Errorf("expected %v, got %v", expected, answers)
+	}
+	shown := out.String()
+	for _, s := range []string{issue.HTMLURL, "Stale issue", "the comment"} {
+		if !strings.Contains(shown, s) {
+			t.Errorf("expected the prompt to show %q, got %q", s, shown)
+		}
+	}
+	if n := strings.Count(shown, "[y/n/q]"); n != 4 {
+		t.Errorf("expected to ask 4 times, including after the bad answer, asked %d times", n)
+	}
+
+	eof := NewLinePrompter(strings.NewReader(""), &out)
+	if a, err := eof.Ask(issue, "the comment"); err != nil || a != AnswerQuit {
+		t.Errorf("expected the end of input to quit, got %v, %v", a, err)
+	}
+}
+
+func TestRunConfirmEach(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "ask"),
+			makeIssue("o", "r", 2, "ask"),
+			makeIssue("o", "r", 3, "ask"),
+			makeIssue("o", "r", 4, "ask"),
+			makeIssue("o", "r", 5, "ask"),
+		},
+	}
+	p := &scriptedPrompter{answers: []Answer{AnswerNo, AnswerYes, AnswerNo, AnswerQuit}}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("ask"),
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("#{{.Number}}", true),
+		Prompt:        p,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if expected := []string{"#1", "#2", "#3", "#4"}; !reflect.DeepEqual(p.asked, expected) {
+		t.Errorf("expected to be asked about %v, got %v", expected, p.asked)
+	}
+	if res.Commented != 1 || res.Skipped != 3 {
+		t.Errorf("expected 1 commented and 3 skipped, got %+v", res)
+	}
+}
+
+func TestRunConfirmEachError(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "ask"),
+			makeIssue("o", "r", 2, "ask"),
+		},
+	}
+	// The prompter fails, answering yes.
+	p := &scriptedPrompter{err: errors.New("injected prompt failure")}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("ask"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Prompt:        p,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.comments) > 0 {
+		t.Errorf("expected no comments when asking fails, got %v", c.comments)
+	}
+	if res.Failed != 2 || len(res.Problems) != 2 {
+		t.Errorf("expected both issues to fail, got %+v", res)
+	}
+
+	// An answer left at its zero value does not post either.
+	p = &scriptedPrompter{answers: []Answer{0, 0}}
+	if err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("ask"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Prompt:        p,
+	})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.comments) > 0 {
+		t.Errorf("expected no comments for the zero Answer, got %v", c.comments)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// PRStatus is the combined CI status of a pull request for --pr-status, from
+// both the commit statuses and the check runs of its head commit.
+type PRStatus string
+
+const (
+	PRStatusAny     PRStatus = ""
+	PRStatusFailing PRStatus = "failing"
+	PRStatusPassing PRStatus = "passing"
+	PRStatusPending PRStatus = "pending"
+)
+
+func (s *PRStatus) String() string {
+	return string(*s)
+}
+
+func (s *PRStatus) Set(value string) error {
+	switch PRStatus(value) {
+	case PRStatusFailing, PRStatusPassing, PRStatusPending:
+		*s = PRStatus(value)
+	default:
+		return fmt.Errorf("must be %s, %s or %s", PRStatusFailing, PRStatusPassing, PRStatusPending)
+	}
+	return nil
+}
+
+// classifyPRStatus combines the commit statuses and check runs of a commit:
+// failing if any failed, else pending if any has yet to finish or none were
+// reported at all, else passing. Skipped and neutral check runs count as
+// neither.
+func classifyPRStatus(combined github.CombinedStatus, runs []github.CheckRun) PRStatus {
+	pending := false
+	passed := false
+	// GitHub reports a commit without statuses as pending.
+	if len(combined.Statuses) > 0 {
+		switch combined.State {
+		case "failure", "error":
+			return PRStatusFailing
+		case "success":
+			passed = true
+		default:
+			pending = true
+		}
+	}
+	for _, run := range runs {
+		switch run.Conclusion {
+		case "success":
+			passed = true
+		case "skipped", "neutral":
+		case "":
+			pending = true
+		default:
+			// failure, timed_out, cancelled, action_required and the like.
+			return PRStatusFailing
+		}
+	}
+	if pending || !passed {
+		return PRStatusPending
+	}
+	return PRStatusPassing
+}
+
+// prStatus fetches and classifies the status of the pull request of m,
+// counting the API calls it makes in calls.
+func prStatus(c Client, m *Meta, calls *int64) (PRStatus, error) {
+	if m.PR == nil {
+		atomic.AddInt64(calls, 1)
+		if err := loadPR(c, m); err != nil {
+			return PRStatusAny, fmt.Errorf("failed to get the pull request: %w", err)
+		}
+	}
+	sha := m.PR.Head.SHA
+	atomic.AddInt64(calls, 1)
+	combined, err := c.GetCombinedStatus(m.Org, m.Repo, sha)
+	if err != nil {
+		return PRStatusAny, fmt.Errorf("failed to get the combined status of %s: %w", sha, err)
+	}
+	atomic.AddInt64(calls, 1)
+	runs, err := c.ListCheckRuns(m.Org, m.Repo, sha)
+	if err != nil {
+		return PRStatusAny, fmt.Errorf("failed to list the check runs of %s: %w", sha, err)
+	}
+	return classifyPRStatus(*combined, runs.CheckRuns), nil
+}
+
+// filterChecksPassed skips pull requests whose head commit has check runs
+// that did not all succeed.
+func filterChecksPassed(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	if err := loadPR(c, m); err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	runs, err := c.ListCheckRuns(m.Org, m.Repo, m.PR.Head.SHA)
+	if err != nil {
+		return "", prError("list check runs of", m, err)
+	}
+	return checksNotPassed(runs.CheckRuns), nil
+}
+
+// checksNotPassed explains why the check runs of a commit are not all
+// successful, ignoring skipped ones, or returns the empty string.
+func checksNotPassed(runs []github.CheckRun) string {
+	passed := 0
+	for _, run := range runs {
+		switch run.Conclusion {
+		case "skipped":
+		case "success":
+			passed++
+		case "":
+			return fmt.Sprintf("check %s is %s", run.Name, strings.ReplaceAll(run.Status, "_", " "))
+		default:
+			return fmt.Sprintf("check %s concluded %s", run.Name, run.Conclusion)
+		}
+	}
+	if passed == 0 {
+		return "no checks ran"
+	}
+	return ""
+}
+
+// filterPRStatus skips pull requests whose CI status is not o.PullRequests.PRStatus.
+func filterPRStatus(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	status, err := prStatus(c, m, o.prStatusCalls)
+	if err != nil {
+		return "", prError("get the CI status of", m, err)
+	}
+	if status != o.PullRequests.PRStatus {
+		return fmt.Sprintf("CI status is %s", status), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestClassifyPRStatus(t *testing.T) {
+	statuses := func(state string) github.CombinedStatus {
+		return github.CombinedStatus{State: state, Statuses: []github.Status{{State: state}}}
+	}
+	run := func(status, conclusion string) github.CheckRun {
+		return github.CheckRun{Name: "test", Status: status, Conclusion: conclusion}
+	}
+	cases := []struct {
+		name     string
+		combined github.CombinedStatus
+		runs     []github.CheckRun
+		expected PRStatus
+	}{
+		{
+			name:     "nothing reported",
+			combined: github.CombinedStatus{State: "pending"},
+			expected: PRStatusPending,
+		},
+		{
+			name:     "statuses passed",
+			combined: statuses("success"),
+			expected: PRStatusPassing,
+		},
+		{
+			name:     "check runs passed",
+			combined: github.CombinedStatus{State: "pending"},
+			runs:     []github.CheckRun{run("completed", "success"), run("completed", "skipped")},
+			expected: PRStatusPassing,
+		},
+		{
+			name:     "only skipped check runs",
+			runs:     []github.CheckRun{run("completed", "skipped"), run("completed", "neutral")},
+			expected: PRStatusPending,
+		},
+		{
+			name:     "status failed",
+			combined: statuses("failure"),
+			runs:     []github.CheckRun{run("completed", "success")},
+			expected: PRStatusFailing,
+		},
+		{
+			name:     "status errored",
+			combined: statuses("error"),
+			expected: PRStatusFailing,
+		},
+		{
+			name:     "check run timed out while another is running",
+			combined: statuses("success"),
+			runs:     []github.CheckRun{run("in_progress", ""), run("completed", "timed_out")},
+			expected: PRStatusFailing,
+		},
+		{
+			name:     "status pending",
+			combined: statuses("pending"),
+			runs:     []github.CheckRun{run("completed", "success")},
+			expected: PRStatusPending,
+		},
+		{
+			name:     "check run queued",
+			combined: statuses("success"),
+			runs:     []github.CheckRun{run("queued", "")},
+			expected: PRStatusPending,
+		},
+	}
+	for _, tc := range cases {
+		if actual := classifyPRStatus(tc.combined, tc.runs); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunPRStatus(t *testing.T) {
+	pr := func(sha string) github.PullRequest {
+		return github.PullRequest{Head: github.PullRequestBranch{SHA: sha}}
+	}
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "ci issue"),
+		makePR("o", "r", 2, "ci red"),
+		makePR("o", "r", 3, "ci green"),
+		makePR("o", "r", 4, "ci running"),
+		makePR("o", "r", 5, "ci broken"),
+	}
+	cases := []struct {
+		status   PRStatus
+		comments []int
+	}{
+		{status: PRStatusFailing, comments: []int{2}},
+		{status: PRStatusPassing, comments: []int{3}},
+		{status: PRStatusPending, comments: []int{4}},
+	}
+	for _, tc := range cases {
+		var logs bytes.Buffer
+		c := fakeClient{
+			issues: issues,
+			prs:    map[int]github.PullRequest{2: pr("red"), 3: pr("green"), 4: pr("running"), 5: pr("error")},
+			statuses: map[string]github.CombinedStatus{
+				"red":   {State: "failure", Statuses: []github.Status{{State: "failure"}}},
+				"green": {State: "success", Statuses: []github.Status{{State: "success"}}},
+			},
+			checkRuns: map[string][]github.CheckRun{
+				"green":   {{Status: "completed", Conclusion: "success"}},
+				"running": {{Status: "in_progress"}},
+			},
+		}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("ci"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hi", false),
+			PullRequests: PRFilterOptions{
+				PRStatus: tc.status,
+			},
+			Logger: log.New(&logs, "", 0),
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.status, err)
+		}
+		if !reflect.DeepEqual(c.comments, tc.comments) {
+			t.Errorf("%s: expected comments on %v, got %v", tc.status, tc.comments, c.comments)
+		}
+		if res.Skipped != 3 || len(res.Problems) != 1 || !strings.Contains(res.Problems[0], "o/r#5") {
+			t.Errorf("%s: expected the issue and other pull requests skipped and #5 reported, got %+v", tc.status, res)
+		}
+		if !strings.Contains(logs.String(), "Warning: skipping fake://localhost/o/r/issues/1") {
+			t.Errorf("%s: expected a warning about the issue, got:\n%s", tc.status, logs.String())
+		}
+		// Each pull request is fetched, then #2 to #4 have their status and check runs listed.
+		if !strings.Contains(logs.String(), "Made 11 API calls for --pr-status="+string(tc.status)) {
+			t.Errorf("%s: expected the API calls to be counted, got:\n%s", tc.status, logs.String())
+		}
+	}
+}
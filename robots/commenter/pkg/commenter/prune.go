@@ -0,0 +1,209 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// PruneMode is how --prune-previous removes earlier comments. On its own the
+// flag deletes them, --prune-previous=minimize hides them instead.
+type PruneMode string
+
+const (
+	PruneOff      PruneMode = ""
+	PruneDelete   PruneMode = "delete"
+	PruneMinimize PruneMode = "minimize"
+)
+
+func (m *PruneMode) String() string {
+	return string(*m)
+}
+
+func (m *PruneMode) Set(value string) error {
+	switch value {
+	case "true", string(PruneDelete):
+		*m = PruneDelete
+	case "false":
+		*m = PruneOff
+	case string(PruneMinimize):
+		*m = PruneMinimize
+	default:
+		return fmt.Errorf("must be %s or %s", PruneDelete, PruneMinimize)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --prune-previous be passed without a value.
+func (m *PruneMode) IsBoolFlag() bool {
+	return true
+}
+
+// minimizeClassifiers are the reasons --minimize-classifier accepts.
+var minimizeClassifiers = []githubql.ReportedContentClassifiers{
+	githubql.ReportedContentClassifiersOutdated,
+	githubql.ReportedContentClassifiersResolved,
+	githubql.ReportedContentClassifiersDuplicate,
+	githubql.ReportedContentClassifiersOffTopic,
+	githubql.ReportedContentClassifiersSpam,
+	githubql.ReportedContentClassifiersAbuse,
+}
+
+// ParseClassifier returns the classifier named by value, in any case.
+func ParseClassifier(value string) (githubql.ReportedContentClassifiers, error) {
+	for _, c := range minimizeClassifiers {
+		if strings.EqualFold(value, string(c)) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unknown classifier %q, must be one of %v", value, minimizeClassifiers)
+}
+
+// pruneOptions configures prunePrevious.
+type pruneOptions struct {
+	mode PruneMode
+	// classifier is the reason given when minimizing.
+	classifier githubql.ReportedContentClassifiers
+	// max is the most comments pruned on a single issue.
+	max int
+	// marker identifies the comments to prune along with isBot.
+	marker string
+	isBot  func(candidate string) bool
+	// confirm prunes, otherwise what would be pruned is only logged.
+	confirm bool
+	audit   *AuditLog
+	logger  *log.Logger
+}
+
+// prunePrevious deletes or minimizes the oldest comments of the bot on
+// target that carry the marker, up to o.max, returning how many it pruned.
+// Comments that are already minimized are left alone when minimizing.
+func prunePrevious(ctx context.Context, c Client, target IssueRef, o pruneOptions) (int, error) {
+	comments, err := c.ListIssueComments(target.Org, target.Repo, target.Number)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list comments: %w", err)
+	}
+	var previous []github.IssueComment
+	for _, comment := range comments {
+		if o.isBot(comment.User.Login) && strings.Contains(comment.Body, markerTag(o.marker)) {
+			previous = append(previous, comment)
+		}
+	}
+	if o.mode == PruneMinimize && len(previous) > 0 {
+		if previous, err = withoutMinimized(ctx, c, target.Org, previous, o.logger); err != nil {
+			return 0, err
+		}
+	}
+	if len(previous) > o.max {
+		o.logger.Printf("Pruning only %d of the %d previous comments on %s", o.max, len(previous), target)
+		previous = previous[:o.max]
+	}
+	for n, comment := range previous {
+		if !o.confirm {
+			o.logger.Printf("Would %s previous comment %s", o.mode, comment.HTMLURL)
+			continue
+		}
+		action := auditDeleteComment
+		if o.mode == PruneMinimize {
+			action = auditMinimizeComment
+			err = minimizeComment(ctx, c, target.Org, comment.NodeID, o.classifier)
+		} else {
+			err = c.DeleteComment(target.Org, target.Repo, comment.ID)
+		}
+		o.audit.record(action, target, comment.Body, comment.HTMLURL, err)
+		if err != nil {
+			return n, fmt.Errorf("failed to %s %s: %w", o.mode, comment.HTMLURL, err)
+		}
+		o.logger.Printf("Pruned previous comment %s (%s)", comment.HTMLURL, o.mode)
+	}
+	if !o.confirm {
+		return 0, nil
+	}
+	return len(previous), nil
+}
+
+type minimizeCommentMutation struct {
+	MinimizeComment struct {
+		MinimizedComment struct {
+			IsMinimized githubql.Boolean
+		}
+	} `graphql:"minimizeComment(input: $input)"`
+}
+
+// minimizeComment hides the comment with the node ID for the classifier.
+func minimizeComment(ctx context.Context, c Client, org, nodeID string, classifier githubql.ReportedContentClassifiers) error {
+	if nodeID == "" {
+		return fmt.Errorf("comment has no node ID")
+	}
+	if classifier == "" {
+		classifier = githubql.ReportedContentClassifiersOutdated
+	}
+	input := githubql.MinimizeCommentInput{SubjectID: githubql.ID(nodeID), Classifier: classifier}
+	var m minimizeCommentMutation
+	return c.MutateWithGitHubAppsSupport(ctx, &m, input, nil, org)
+}
+
+type minimizedQuery struct {
+	Nodes []minimizedNode `graphql:"nodes(ids: $ids)"`
+}
+
+type minimizedNode struct {
+	IssueComment struct {
+		ID          githubql.ID
+		IsMinimized githubql.Boolean
+	} `graphql:"... on IssueComment"`
+}
+
+// withoutMinimized returns the comments that are not minimized yet, since the
+// REST API does not tell.
+func withoutMinimized(ctx context.Context, c Client, org string, comments []github.IssueComment, logger *log.Logger) ([]github.IssueComment, error) {
+	ids := make([]githubql.ID, 0, len(comments))
+	for _, comment := range comments {
+		if comment.NodeID != "" {
+			ids = append(ids, githubql.ID(comment.NodeID))
+		}
+	}
+	if len(ids) == 0 {
+		return comments, nil
+	}
+	var q minimizedQuery
+	if err := c.QueryWithGitHubAppsSupport(ctx, &q, map[string]interface{}{"ids": ids}, org); err != nil {
+		return nil, fmt.Errorf("failed to check for minimized comments: %w", err)
+	}
+	minimized := map[string]bool{}
+	for _, n := range q.Nodes {
+		if id, ok := n.IssueComment.ID.(string); ok && bool(n.IssueComment.IsMinimized) {
+			minimized[id] = true
+		}
+	}
+	var visible []github.IssueComment
+	for _, comment := range comments {
+		if minimized[comment.NodeID] {
+			logger.Printf("Previous comment %s is already minimized", comment.HTMLURL)
+			continue
+		}
+		visible = append(visible, comment)
+	}
+	return visible, nil
+}
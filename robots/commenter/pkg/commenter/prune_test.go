@@ -0,0 +1,218 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestPruneModeFlag(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected PruneMode
+		err      bool
+	}{
+		{expected: PruneOff},
+		{args: []string{"--prune-previous"}, expected: PruneDelete},
+		{args: []string{"--prune-previous=minimize"}, expected: PruneMinimize},
+		{args: []string{"--prune-previous=false"}, expected: PruneOff},
+		{args: []string{"--prune-previous=hide"}, err: true},
+	}
+	for _, tc := range cases {
+		var m PruneMode
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Var(&m, "prune-previous", "")
+		err := fs.Parse(tc.args)
+		if (err != nil) != tc.err {
+			t.Errorf("%v: expected error %t, got %v", tc.args, tc.err, err)
+		} else if m != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.args, tc.expected, m)
+		}
+	}
+}
+
+func TestParseClassifier(t *testing.T) {
+	for value, expected := range map[string]githubql.ReportedContentClassifiers{
+		"outdated":  githubql.ReportedContentClassifiersOutdated,
+		"OFF_TOPIC": githubql.ReportedContentClassifiersOffTopic,
+		"Resolved":  githubql.ReportedContentClassifiersResolved,
+	} {
+		if c, err := ParseClassifier(value); err != nil || c != expected {
+			t.Errorf("%s: expected %s, got %s, %v", value, expected, c, err)
+		}
+	}
+	if c, err := ParseClassifier("stale"); err == nil {
+		t.Errorf("expected an error for an unknown classifier, got %s", c)
+	}
+}
+
+func TestPrunePrevious(t *testing.T) {
+	bot := func(id int) github.IssueComment {
+		return github.IssueComment{
+			ID:      id,
+			NodeID:  fmt.Sprintf("node-%d", id),
+			Body:    withMarker("ping", "stale"),
+			User:    github.User{Login: "bot"},
+			HTMLURL: fmt.Sprintf("https://github.com/o/r/issues/1#issuecomment-%d", id),
+		}
+	}
+	human := github.IssueComment{ID: 100, Body: withMarker("quoting the bot", "stale"), User: github.User{Login: "alice"}}
+	unmarked := github.IssueComment{ID: 101, Body: "a different bot job", User: github.User{Login: "bot"}}
+	otherMarker := github.IssueComment{ID: 102, Body: withMarker("ping", "rotten"), User: github.User{Login: "bot"}}
+
+	cases := []struct {
+		name      string
+		comments  []github.IssueComment
+		minimized map[string]bool
+		mode      PruneMode
+		confirm   bool
+		pruned    int
+		deleted   []int
+		hidden    []string
+		err       bool
+	}{
+		{
+			name:     "no previous comments",
+			comments: []github.IssueComment{human, unmarked, otherMarker},
+			mode:     PruneDelete,
+			confirm:  true,
+		},
+		{
+			name:     "one previous comment",
+			comments: []github.IssueComment{human, bot(1), unmarked},
+			mode:     PruneDelete,
+			confirm:  true,
+			pruned:   1,
+			deleted:  []int{1},
+		},
+		{
+			name:     "many previous comments are capped",
+			comments: []github.IssueComment{bot(1), bot(2), human, bot(3), bot(4)},
+			mode:     PruneDelete,
+			confirm:  true,
+			pruned:   3,
+			deleted:  []int{1, 2, 3},
+		},
+		{
+			name:     "minimized rather than deleted",
+			comments: []github.IssueComment{bot(1), bot(2)},
+			mode:     PruneMinimize,
+			confirm:  true,
+			pruned:   2,
+			hidden:   []string{"node-1", "node-2"},
+		},
+		{
+			name:      "already minimized are skipped",
+			comments:  []github.IssueComment{bot(1), bot(2), bot(3), bot(4), bot(5)},
+			minimized: map[string]bool{"node-1": true, "node-3": true},
+			mode:      PruneMinimize,
+			confirm:   true,
+			pruned:    3,
+			hidden:    []string{"node-2", "node-4", "node-5"},
+		},
+		{
+			name:      "all already minimized",
+			comments:  []github.IssueComment{bot(1)},
+			minimized: map[string]bool{"node-1": true},
+			mode:      PruneMinimize,
+			confirm:   true,
+		},
+		{
+			name:     "dry run",
+			comments: []github.IssueComment{bot(1), bot(2)},
+			mode:     PruneDelete,
+		},
+		{
+			name:     "delete fails",
+			comments: []github.IssueComment{bot(1), bot(-1), bot(2)},
+			mode:     PruneDelete,
+			confirm:  true,
+			pruned:   1,
+			deleted:  []int{1},
+			err:      true,
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{existing: map[int][]github.IssueComment{1: tc.comments}, minimized: tc.minimized}
+		isBot, _ := c.BotUserChecker()
+		pruned, err := prunePrevious(context.Background(), &c, IssueRef{Org: "o", Repo: "r", Number: 1}, pruneOptions{
+			mode:    tc.mode,
+			max:     3,
+			marker:  "stale",
+			isBot:   isBot,
+			confirm: tc.confirm,
+			logger:  log.Default(),
+		})
+		if (err != nil) != tc.err {
+			t.Errorf("%s: expected error %t, got %v", tc.name, tc.err, err)
+		}
+		if pruned != tc.pruned {
+			t.Errorf("%s: expected %d pruned, got %d", tc.name, tc.pruned, pruned)
+		}
+		if !reflect.DeepEqual(c.deleted, tc.deleted) {
+			t.Errorf("%s: expected to delete %v, got %v", tc.name, tc.deleted, c.deleted)
+		}
+		var hidden []string
+		for _, m := range c.mutations {
+			input := m.(githubql.MinimizeCommentInput)
+			if input.Classifier != githubql.ReportedContentClassifiersOutdated {
+				t.Errorf("%s: expected comments to be hidden as outdated, got %s", tc.name, input.Classifier)
+			}
+			hidden = append(hidden, input.SubjectID.(string))
+		}
+		if !reflect.DeepEqual(hidden, tc.hidden) {
+			t.Errorf("%s: expected to hide %v, got %v", tc.name, tc.hidden, hidden)
+		}
+	}
+}
+
+func TestRunPrunePrevious(t *testing.T) {
+	previous := github.IssueComment{ID: 7, Body: withMarker("ping", "stale"), User: github.User{Login: "bot"}}
+	c := fakeClient{
+		issues:   []github.Issue{makeIssue("o", "r", 1, "prune"), makeIssue("o", "r", 2, "prune")},
+		existing: map[int][]github.IssueComment{1: {previous}},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("prune"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		Safeguards:    SafeguardOptions{Marker: "stale"},
+		Confirm:       true,
+		Prune:         PruneDelete,
+		PruneMax:      5,
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{7}; !reflect.DeepEqual(c.deleted, expected) {
+		t.Errorf("expected to delete %v, got %v", expected, c.deleted)
+	}
+	if expected := []int{1, 2}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+}
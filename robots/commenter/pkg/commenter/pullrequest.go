@@ -0,0 +1,240 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// PRFilterOptions are the filters that look at pull requests. Issues fail
+// every one that is set but SkipDrafts.
+type PRFilterOptions struct {
+	// OnlyConflicted skips everything but pull requests with merge conflicts.
+	OnlyConflicted bool
+	// SkipDrafts skips draft pull requests.
+	SkipDrafts bool
+	// Mergeable, if set, keeps only pull requests whose mergeability matches
+	// it. Those GitHub is still computing it for are fetched again after
+	// MergeableDelay, defaultMergeableDelay if 0.
+	Mergeable      *bool
+	MergeableDelay time.Duration
+	// MinCommits and MaxCommits, if set, skip pull requests with fewer or
+	// more commits.
+	MinCommits int
+	MaxCommits int
+	// DeploymentEnvironment, if set, skips pull requests whose head is not
+	// deployed to it, or whose latest deployment there is not in
+	// DeploymentState when that is set.
+	DeploymentEnvironment string
+	DeploymentState       string
+	// AllChecksPassed skips everything but pull requests whose head has
+	// check runs that all succeeded or were skipped.
+	AllChecksPassed bool
+	// PRStatus, if set, skips pull requests with another CI status.
+	PRStatus PRStatus
+	// Reviews, unless nil, skips pull requests outside its bounds.
+	Reviews *ReviewFilter
+}
+
+// prFilter is a filter that looks at the pull request of m. It returns why m
+// is skipped, or the empty string if it passes, and fails with an error that
+// completes "Failed to".
+type prFilter func(ctx context.Context, c Client, o Options, m *Meta) (string, error)
+
+// prFilters returns the filters set in o.PullRequests, in the order to apply
+// them, and the flags of those that issues cannot pass.
+func prFilters(o Options) ([]prFilter, []string) {
+	p := o.PullRequests
+	var filters []prFilter
+	var prOnly []string
+	only := func(flag string, f prFilter) {
+		filters = append(filters, f)
+		prOnly = append(prOnly, flag)
+	}
+	if p.OnlyConflicted {
+		only("--comment-if-pr-has-conflicts", filterConflicted)
+	}
+	if p.SkipDrafts {
+		// Issues are not drafts, so they pass.
+		filters = append(filters, filterDrafts)
+	}
+	if p.Mergeable != nil {
+		only("--pr-mergeable", filterMergeable)
+	}
+	if p.MinCommits > 0 || p.MaxCommits > 0 {
+		only("--pr-min-commits and --pr-max-commits", filterCommits)
+	}
+	if p.DeploymentEnvironment != "" {
+		only("--require-deployment-environment", filterDeployment)
+	}
+	if p.AllChecksPassed {
+		only("--all-checks-passed", filterChecksPassed)
+	}
+	if p.PRStatus != PRStatusAny {
+		only("--pr-status", filterPRStatus)
+	}
+	if p.Reviews != nil {
+		only("--pr-min-reviews and --pr-max-reviews", filterReviews)
+	}
+	return filters, prOnly
+}
+
+// prError describes the failure to do what for the pull request of m.
+func prError(what string, m *Meta, err error) error {
+	return fmt.Errorf("%s %s/%s#%d: %w", what, m.Org, m.Repo, m.Number, err)
+}
+
+// filterConflicted skips pull requests without merge conflicts.
+func filterConflicted(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	pr, err := c.GetPullRequest(m.Org, m.Repo, m.Number)
+	if err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	m.PR = pr
+	if pr.MergeableState != "dirty" {
+		return fmt.Sprintf("mergeable state is %q", pr.MergeableState), nil
+	}
+	return "", nil
+}
+
+// filterDrafts skips draft pull requests.
+func filterDrafts(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	if !m.IsPR {
+		return "", nil
+	}
+	draft, err := isDraft(c, m)
+	if err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	if draft {
+		return "draft pull request", nil
+	}
+	return "", nil
+}
+
+// filterMergeable skips pull requests whose mergeability is unknown or not
+// o.PullRequests.Mergeable.
+func filterMergeable(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	mergeable, err := mergeability(ctx, c, m, o.PullRequests.MergeableDelay, o.Logger)
+	if err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	switch {
+	case mergeable == nil:
+		return "mergeability still unknown", nil
+	case *mergeable != *o.PullRequests.Mergeable:
+		return fmt.Sprintf("mergeable is %t", *mergeable), nil
+	}
+	return "", nil
+}
+
+// filterCommits skips pull requests with fewer than o.PullRequests.MinCommits or more than
+// o.PullRequests.MaxCommits commits.
+func filterCommits(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	if err := loadPR(c, m); err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	return commitCountOutside(m.PR.Commits, o.PullRequests.MinCommits, o.PullRequests.MaxCommits), nil
+}
+
+// filterDeployment skips pull requests whose head commit was not deployed to
+// o.PullRequests.DeploymentEnvironment, or whose deployment is not in o.PullRequests.DeploymentState.
+func filterDeployment(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	if err := loadPR(c, m); err != nil {
+		return "", prError("get pull request", m, err)
+	}
+	sha := m.PR.Head.SHA
+	state, err := latestDeploymentState(ctx, c, m.Org, m.Repo, sha, o.PullRequests.DeploymentEnvironment)
+	if err != nil {
+		return "", prError("get deployments of", m, err)
+	}
+	switch {
+	case state == "":
+		return fmt.Sprintf("%s not deployed to %s", sha, o.PullRequests.DeploymentEnvironment), nil
+	case o.PullRequests.DeploymentState != "" && !strings.EqualFold(state, o.PullRequests.DeploymentState):
+		return fmt.Sprintf("deployment of %s to %s is %s", sha, o.PullRequests.DeploymentEnvironment, strings.ToLower(state)), nil
+	}
+	return "", nil
+}
+
+// loadPR sets m.PR unless an earlier filter already fetched it.
+func loadPR(c Client, m *Meta) error {
+	if m.PR != nil {
+		return nil
+	}
+	pr, err := c.GetPullRequest(m.Org, m.Repo, m.Number)
+	if err != nil {
+		return err
+	}
+	m.PR = pr
+	return nil
+}
+
+// mergeability returns whether the pull request of m is mergeable, or nil if
+// GitHub has yet to compute it. It computes it in the background once asked,
+// so the pull request is fetched again after delay when unknown.
+func mergeability(ctx context.Context, c Client, m *Meta, delay time.Duration, logger *log.Logger) (*bool, error) {
+	if err := loadPR(c, m); err != nil {
+		return nil, err
+	}
+	if m.PR.Mergable != nil {
+		return m.PR.Mergable, nil
+	}
+	if delay == 0 {
+		delay = defaultMergeableDelay
+	}
+	logger.Printf("Mergeability of %s/%s#%d is being computed, fetching it again in %s", m.Org, m.Repo, m.Number, delay)
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	pr, err := c.GetPullRequest(m.Org, m.Repo, m.Number)
+	if err != nil {
+		return nil, err
+	}
+	m.PR = pr
+	return pr.Mergable, nil
+}
+
+// isDraft returns whether the pull request of m is a draft, only fetching it
+// when the search result leaves the draft flag out.
+func isDraft(c Client, m *Meta) (bool, error) {
+	if m.Issue.Draft != nil {
+		return *m.Issue.Draft, nil
+	}
+	if err := loadPR(c, m); err != nil {
+		return false, err
+	}
+	return m.PR.Draft, nil
+}
+
+// commitCountOutside explains why n commits fall outside [minimum, maximum],
+// where a zero maximum is unlimited, or returns the empty string.
+func commitCountOutside(n, minimum, maximum int) string {
+	switch {
+	case n < minimum:
+		return fmt.Sprintf("%d commits, fewer than %d", n, minimum)
+	case maximum > 0 && n > maximum:
+		return fmt.Sprintf("%d commits, more than %d", n, maximum)
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunPRFilters(t *testing.T) {
+	draft := true
+	issues := []github.Issue{
+		makeIssue("o", "r", 1, "filters issue"),
+		makePR("o", "r", 2, "filters draft"),
+		makePR("o", "r", 3, "filters conflicted"),
+		makePR("o", "r", 4, "filters clean"),
+	}
+	issues[1].Draft = &draft
+	c := fakeClient{
+		issues: issues,
+		prs: map[int]github.PullRequest{
+			2: {MergeableState: "dirty"},
+			3: {MergeableState: "dirty"},
+			4: {MergeableState: "clean"},
+		},
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("filters"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hi", false),
+		PullRequests: PRFilterOptions{
+			SkipDrafts:     true,
+			OnlyConflicted: true,
+			Reviews:        &ReviewFilter{Max: -1},
+		},
+		Logger: log.New(&logs, "", 0),
+	})
+	if err != nil || len(res.Problems) > 0 {
+		t.Fatalf("unexpected error: %v %v", err, res.Problems)
+	}
+	if expected := []int{3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	for _, expected := range []string{
+		"Warning: skipping fake://localhost/o/r/issues/1: not a pull request, as required by --comment-if-pr-has-conflicts, --pr-min-reviews and --pr-max-reviews\n",
+		"Skipping fake://localhost/o/r/pull/2: draft pull request\n",
+		`Skipping fake://localhost/o/r/pull/4: mergeable state is "clean"`,
+	} {
+		if strings.Count(logs.String(), expected) != 1 {
+			t.Errorf("expected the log to contain %q once, got:\n%s", expected, logs.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// ErrRateLimited fails a run that starts with less of the core rate limit
+// left than --min-rate-limit.
+var ErrRateLimited = errors.New("rate limit too low")
+
+// RateGuard keeps Run from starting, or from going on, with less than min
+// of the core rate limit left. A nil RateGuard checks nothing.
+type RateGuard struct {
+	c   Client
+	min int
+	// wait waits for the limit to reset rather than failing a run that
+	// would start below min.
+	wait bool
+	// every is how many comments Run posts between checks, 0 to only check
+	// before the run.
+	every int
+	// sleep waits for d or until ctx is done, and now is the time; both are
+	// replaced in tests.
+	sleep func(ctx context.Context, d time.Duration) error
+	now   func() time.Time
+
+	mu       sync.Mutex
+	comments int
+	start    github.RateLimit
+}
+
+func NewRateGuard(c Client, min int, wait bool, every int) *RateGuard {
+	return &RateGuard{c: c, min: min, wait: wait, every: every, sleep: sleepContext, now: time.Now}
+}
+
+// sleepContext waits for d, returning early with the error of ctx once it is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *RateGuard) core() (github.RateLimit, error) {
+	limits, err := g.c.RateLimit()
+	if err != nil {
+		return github.RateLimit{}, fmt.Errorf("failed to get the rate limit: %w", err)
+	}
+	return limits.Resources.Core, nil
+}
+
+// waitForReset sleeps until the limit resets.
+func (g *RateGuard) waitForReset(ctx context.Context, l github.RateLimit) error {
+	d := time.Unix(l.Reset, 0).Sub(g.now())
+	if d < 0 {
+		d = 0
+	}
+	log.Printf("Core rate limit at %d of %d, below --min-rate-limit=%d; waiting %s for it to reset", l.Remaining, l.Limit, g.min, d.Round(time.Second))
+	return g.sleep(ctx, d)
+}
+
+// preflight checks the limit before the run starts, waiting for it to reset
+// if allowed to, and records it for report.
+func (g *RateGuard) preflight(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	for {
+		l, err := g.core()
+		if err != nil {
+			return err
+		}
+		if l.Remaining >= g.min {
+			g.start = l
+			return nil
+		}
+		if !g.wait {
+			return fmt.Errorf("%w: %d of %d left, fewer than --min-rate-limit=%d, until %s", ErrRateLimited, l.Remaining, l.Limit, g.min, time.Unix(l.Reset, 0).UTC().Format(time.RFC3339))
+		}
+		if err := g.waitForReset(ctx, l); err != nil {
+			return err
+		}
+	}
+}
+
+// commented counts a comment, checking the limit after every g.every of
+// them and pausing until it resets when it is below min. Workers that post
+// while another pauses wait for it here.
+func (g *RateGuard) commented(ctx context.Context) error {
+	if g == nil || g.every <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.comments++; g.comments%g.every != 0 {
+		return nil
+	}
+	l, err := g.core()
+	if err != nil {
+		return err
+	}
+	if l.Remaining < g.min {
+		return g.waitForReset(ctx, l)
+	}
+	return nil
+}
+
+// started returns the limit preflight found, if it checked it, so that Run
+// need not read it again to report the API usage.
+func (g *RateGuard) started() (github.RateLimit, bool) {
+	if g == nil || g.start.Limit == 0 {
+		return github.RateLimit{}, false
+	}
+	return g.start, true
+}
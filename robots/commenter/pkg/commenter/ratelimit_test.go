@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// fakeSleeps makes g record its sleeps instead of sleeping.
+func fakeSleeps(g *RateGuard, now time.Time) *[]time.Duration {
+	var slept []time.Duration
+	g.now = func() time.Time { return now }
+	g.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	return &slept
+}
+
+func TestRateGuardPreflight(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	low := github.RateLimit{Limit: 5000, Remaining: 10, Reset: now.Add(20 * time.Minute).Unix()}
+	high := github.RateLimit{Limit: 5000, Remaining: 4000, Reset: now.Add(time.Hour).Unix()}
+	cases := []struct {
+		name   string
+		limits []github.RateLimit
+		wait   bool
+		slept  []time.Duration
+		err    error
+	}{
+		{
+			name:   "enough left",
+			limits: []github.RateLimit{high},
+		},
+		{
+			name:   "too low",
+			limits: []github.RateLimit{low},
+			err:    ErrRateLimited,
+		},
+		{
+			name:   "waits for the reset",
+			limits: []github.RateLimit{low, high},
+			wait:   true,
+			slept:  []time.Duration{20 * time.Minute},
+		},
+	}
+	for _, tc := range cases {
+		c := &fakeClient{rateLimits: tc.limits}
+		g := NewRateGuard(c, 100, tc.wait, 0)
+		slept := fakeSleeps(g, now)
+		if err := g.preflight(context.Background()); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		if !reflect.DeepEqual(*slept, tc.slept) {
+			t.Errorf("%s: expected to sleep %v, slept %v", tc.name, tc.slept, *slept)
+		}
+		if tc.err == nil && g.start != high {
+			t.Errorf("%s: expected to start from %+v, got %+v", tc.name, high, g.start)
+		}
+	}
+
+	if err := NewRateGuard(&fakeClient{}, 100, true, 0).preflight(context.Background()); err == nil {
+		t.Error("failed to report the rate limit that could not be checked")
+	}
+	var nilGuard *RateGuard
+	if err := nilGuard.preflight(context.Background()); err != nil {
+		t.Errorf("expected a nil guard to check nothing, got %v", err)
+	}
+}
+
+func TestRateGuardCommented(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	high := github.RateLimit{Limit: 5000, Remaining: 4000, Reset: now.Add(time.Hour).Unix()}
+	low := github.RateLimit{Limit: 5000, Remaining: 10, Reset: now.Add(time.Hour).Unix()}
+	c := &fakeClient{rateLimits: []github.RateLimit{high, low, high}}
+	g := NewRateGuard(c, 100, false, 2)
+	slept := fakeSleeps(g, now)
+	for n := 0; n < 6; n++ {
+		if err := g.commented(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if c.rateLimitChecks != 3 {
+		t.Errorf("expected a check every 2 comments, checked %d times", c.rateLimitChecks)
+	}
+	if expected := []time.Duration{time.Hour}; !reflect.DeepEqual(*slept, expected) {
+		t.Errorf("expected to pause %v, paused %v", expected, *slept)
+	}
+}
+
+func TestRunRateLimited(t *testing.T) {
+	c := fakeClient{
+		issues:     []github.Issue{makeIssue("o", "r", 1, "limited")},
+		rateLimits: []github.RateLimit{{Limit: 5000, Remaining: 10}},
+	}
+	_, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("limited"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		RateLimit:     NewRateGuard(&c, 100, false, 0),
+	})
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected the run to be rate limited, got %v", err)
+	}
+	if len(c.comments) != 0 {
+		t.Errorf("expected no comments, got %v", c.comments)
+	}
+}
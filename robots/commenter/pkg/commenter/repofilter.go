@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RepoFilter skips issues by their org/repo, matched against glob patterns
+// such as kubernetes-sigs/* ignoring case.
+type RepoFilter struct {
+	// Include, if set, skips issues in repos matching none of its patterns.
+	Include []string
+	// Exclude skips issues in repos matching any of its patterns.
+	Exclude []string
+}
+
+// NewRepoFilter validates the patterns, which must be of the form org/repo
+// and must not be both included and excluded.
+func NewRepoFilter(include, exclude []string) (*RepoFilter, error) {
+	f := &RepoFilter{}
+	for _, p := range include {
+		if err := checkRepoPattern(p); err != nil {
+			return nil, err
+		}
+		f.Include = append(f.Include, strings.ToLower(p))
+	}
+	for _, p := range exclude {
+		if err := checkRepoPattern(p); err != nil {
+			return nil, err
+		}
+		for _, i := range f.Include {
+			if strings.EqualFold(i, p) {
+				return nil, fmt.Errorf("%s is both included and excluded", p)
+			}
+		}
+		f.Exclude = append(f.Exclude, strings.ToLower(p))
+	}
+	return f, nil
+}
+
+// checkRepoPattern returns why p is not a valid org/repo pattern, if it is not.
+func checkRepoPattern(p string) error {
+	org, repo, ok := strings.Cut(p, "/")
+	if !ok || org == "" || repo == "" || strings.Contains(repo, "/") {
+		return fmt.Errorf("%q is not of the form org/repo", p)
+	}
+	if _, err := path.Match(p, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %w", p, err)
+	}
+	return nil
+}
+
+// skip returns why issues in org/repo are skipped, or the empty string.
+func (f *RepoFilter) skip(org, repo string) string {
+	name := strings.ToLower(org + "/" + repo)
+	for _, p := range f.Exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return fmt.Sprintf("repo %s/%s matches --exclude-repo=%s", org, repo, p)
+		}
+	}
+	if len(f.Include) == 0 {
+		return ""
+	}
+	for _, p := range f.Include {
+		if ok, _ := path.Match(p, name); ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("repo %s/%s matches no --include-repo", org, repo)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestNewRepoFilter(t *testing.T) {
+	cases := []struct {
+		name    string
+		include []string
+		exclude []string
+		err     bool
+	}{
+		{
+			name:    "globs",
+			include: []string{"kubernetes-sigs/*", "kubernetes/test-infra"},
+			exclude: []string{"kubernetes-sigs/cluster-api*"},
+		},
+		{
+			name:    "same pattern included and excluded",
+			include: []string{"o/*"},
+			exclude: []string{"O/*"},
+			err:     true,
+		},
+		{
+			name:    "missing repo",
+			exclude: []string{"o"},
+			err:     true,
+		},
+		{
+			name:    "too many slashes",
+			include: []string{"o/r/x"},
+			err:     true,
+		},
+		{
+			name:    "bad glob",
+			include: []string{"o/[r"},
+			err:     true,
+		},
+	}
+	for _, tc := range cases {
+		_, err := NewRepoFilter(tc.include, tc.exclude)
+		if err != nil && !tc.err {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.err {
+			t.Errorf("%s: failed to produce an error", tc.name)
+		}
+	}
+}
+
+func TestRepoFilterSkip(t *testing.T) {
+	cases := []struct {
+		name    string
+		include []string
+		exclude []string
+		repo    string
+		skipped bool
+	}{
+		{
+			name: "no patterns",
+			repo: "o/r",
+		},
+		{
+			name:    "included by glob",
+			include: []string{"kubernetes-sigs/*"},
+			repo:    "kubernetes-sigs/kind",
+		},
+		{
+			name:    "not included",
+			include: []string{"kubernetes-sigs/*"},
+			repo:    "kubernetes/kubernetes",
+			skipped: true,
+		},
+		{
+			name:    "excluded ignoring case",
+			exclude: []string{"kubernetes/Test-*"},
+			repo:    "Kubernetes/test-infra",
+			skipped: true,
+		},
+		{
+			name:    "excluded despite being included",
+			include: []string{"kubernetes-sigs/*"},
+			exclude: []string{"kubernetes-sigs/cluster-api*"},
+			repo:    "kubernetes-sigs/cluster-api-provider-aws",
+			skipped: true,
+		},
+		{
+			name:    "org glob",
+			include: []string{"kubernetes*/kind"},
+			repo:    "kubernetes-sigs/kind",
+		},
+		{
+			name:    "glob does not cross the slash",
+			include: []string{"kubernetes/*"},
+			repo:    "kubernetes-sigs/kind",
+			skipped: true,
+		},
+	}
+	for _, tc := range cases {
+		f, err := NewRepoFilter(tc.include, tc.exclude)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		ref, err := ParseIssueRef(tc.repo + "#1")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if reason := f.skip(ref.Org, ref.Repo); (reason != "") != tc.skipped {
+			t.Errorf("%s: expected skipped %t, got %q", tc.name, tc.skipped, reason)
+		}
+	}
+}
+
+func TestRunRepoFilter(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "skipped", 1, "repos"),
+		makeIssue("o", "kept", 2, "repos"),
+		makeIssue("other", "r", 3, "repos"),
+		makeIssue("o", "kept", 4, "repos"),
+	}}
+	repos, err := NewRepoFilter([]string{"o/*"}, []string{"o/skip*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("repos"),
+		SamplePercent: 100,
+		Ceiling:       2,
+		Commenter:     MakeCommenter("ping", false),
+		Repos:         repos,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{2, 4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected the skipped repos to leave the ceiling to %v, got %v", expected, c.comments)
+	}
+	if res.Skipped != 2 {
+		t.Errorf("expected 2 skipped, got %d", res.Skipped)
+	}
+}
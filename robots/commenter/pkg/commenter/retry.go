@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// pendingComment is a rendered comment ready to be posted on an issue.
+type pendingComment struct {
+	issue github.Issue
+	meta  Meta
+	// ref is the issue commented on, target where the comment is posted.
+	ref     IssueRef
+	target  IssueRef
+	comment string
+	// labels are the AddLabels for the issue, rendered if need be.
+	labels []string
+	// err is why posting the comment last failed.
+	err error
+}
+
+// retryable returns whether a failed request is worth trying again: GitHub
+// answered with a server error, the connection broke or the call was
+// cancelled for timing out. Client errors, such as missing permissions or a
+// deleted issue, are not.
+func retryable(err error) bool {
+	var netErr net.Error
+	return github.IsServerError(err) ||
+		errors.Is(err, ErrCallTimeout) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// giveUp records that the comment of p could not be posted, with the reason
+// it is not retried any further.
+func giveUp(o Options, p pendingComment, reason string, problems *problemList) {
+	if o.titles != nil {
+		o.titles.release(p.issue.Title, p.issue.HTMLURL)
+	}
+	problems.add("Failed to apply comment to %s %s: %v", p.ref, reason, p.err)
+}
+
+// retryQueue collects the comments that failed with a retryable error.
+type retryQueue struct {
+	sync.Mutex
+	pending []pendingComment
+}
+
+func (q *retryQueue) add(p pendingComment) {
+	q.Lock()
+	defer q.Unlock()
+	q.pending = append(q.pending, p)
+}
+
+// retry makes up to o.Retries more attempts at posting the queued comments,
+// waiting longer before each, and reports the final outcome of every issue
+// queued to done. Comments still failing are recorded as problems.
+func (q *retryQueue) retry(ctx context.Context, c Client, o Options, problems *problemList, done func(github.Issue, Outcome)) {
+	q.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.Unlock()
+	// A comment being posted when ctx is done is still finished.
+	postCtx := context.WithoutCancel(ctx)
+	attempts := 0
+retries:
+	for attempts < o.Retries && len(pending) > 0 {
+		wait := o.RetryDelay * time.Duration(attempts+1)
+		o.Logger.Printf("Retrying %d failed comments in %s, attempt %d of %d", len(pending), wait, attempts+1, o.Retries)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			break retries
+		}
+		attempts++
+		var failed []pendingComment
+		for _, p := range pending {
+			if ctx.Err() != nil {
+				// Not started once ctx is done, and given up on below.
+				failed = append(failed, p)
+				continue
+			}
+			out, err := deliver(postCtx, c, o, p, problems)
+			if err == nil {
+				done(p.issue, out)
+				continue
+			}
+			if p.err = err; !retryable(err) {
+				giveUp(o, p, "(not retryable)", problems)
+				done(p.issue, OutcomeFailed)
+				continue
+			}
+			failed = append(failed, p)
+		}
+		pending = failed
+	}
+	reason := fmt.Sprintf("after %d retries", attempts)
+	if err := ctx.Err(); err != nil {
+		reason = fmt.Sprintf("after %d retries, stopped early: %v", attempts, err)
+	}
+	for _, p := range pending {
+		giveUp(o, p, reason, problems)
+		done(p.issue, OutcomeFailed)
+	}
+}
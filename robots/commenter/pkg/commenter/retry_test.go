@@ -0,0 +1,130 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "bad gateway",
+			err:      github.NewServerError(http.StatusBadGateway),
+			expected: true,
+		},
+		{
+			name:     "wrapped server error",
+			err:      fmt.Errorf("failed: %w", github.NewServerError(http.StatusInternalServerError)),
+			expected: true,
+		},
+		{
+			name:     "connection reset",
+			err:      fmt.Errorf("post: %w", syscall.ECONNRESET),
+			expected: true,
+		},
+		{
+			name:     "connection closed early",
+			err:      io.ErrUnexpectedEOF,
+			expected: true,
+		},
+		{
+			name: "not found",
+			err:  github.NewNotFound(),
+		},
+		{
+			name: "other error",
+			err:  errors.New("status code 403"),
+		},
+	}
+	for _, tc := range cases {
+		if actual := retryable(tc.err); actual != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "flaky"),
+			makeIssue("o", "r", 2, "flaky"),
+			makeIssue("o", "r", 3, "flaky"),
+			makeIssue("o", "error", 4, "flaky"),
+		},
+		outages: map[int]int{1: 1, 2: 5},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("flaky"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+		Retries:       2,
+		AddLabels:     []string{"retried"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []int{3, 1}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, c.comments)
+	}
+	if expected := []string{"o/r#3:retried", "o/r#1:retried"}; !reflect.DeepEqual(c.addedLabels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, c.addedLabels)
+	}
+	if res.Commented != 2 || res.Failed != 2 || len(res.Issues) != 4 {
+		t.Errorf("expected 2 issues commented on and 2 failed, got %+v", res)
+	}
+	if len(res.Problems) != 2 ||
+		!strings.HasPrefix(res.Problems[0], "Failed to apply comment to o/error#4 (not retryable): ") ||
+		!strings.HasPrefix(res.Problems[1], "Failed to apply comment to o/r#2 after 2 retries: ") {
+		t.Errorf("expected o/error#4 not to be retried and o/r#2 to fail after retries, got %q", res.Problems)
+	}
+	if c.outages[2] != 2 {
+		t.Errorf("expected 3 attempts on o/r#2, got %d", 5-c.outages[2])
+	}
+}
+
+func TestRunWithoutRetries(t *testing.T) {
+	c := fakeClient{
+		issues:  []github.Issue{makeIssue("o", "r", 1, "flaky")},
+		outages: map[int]int{1: 1},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("flaky"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("hello", false),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.comments) != 0 || res.Failed != 1 || len(res.Problems) != 1 {
+		t.Errorf("expected a single failure, got comments on %v and %+v", c.comments, res)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// CheckReviewer returns an error unless reviewer is a login or an org/team
+// slug.
+func CheckReviewer(reviewer string) error {
+	org, team, isTeam := strings.Cut(reviewer, "/")
+	switch {
+	case reviewer == "":
+		return fmt.Errorf("empty reviewer")
+	case strings.ContainsAny(reviewer, " \t\n@"):
+		return fmt.Errorf("reviewer %q must be a login or an org/team slug", reviewer)
+	case isTeam && (org == "" || team == "" || strings.Contains(team, "/")):
+		return fmt.Errorf("team %q must be an org/team slug", reviewer)
+	}
+	return nil
+}
+
+// reviewers returns whom to request a review of the pull request of m from:
+// the RequestReviewers and, with ReRequestExisting, those who reviewed it or
+// whose review is requested already, but never its author. Teams are org/team
+// slugs, as RequestReview takes them.
+func reviewers(c Client, o Options, m *Meta) ([]string, error) {
+	var logins []string
+	seen := map[string]bool{}
+	add := func(login string) {
+		key := github.NormLogin(login)
+		if login == "" || seen[key] || key == github.NormLogin(m.Issue.User.Login) {
+			return
+		}
+		seen[key] = true
+		logins = append(logins, login)
+	}
+	for _, r := range o.RequestReviewers {
+		add(r)
+	}
+	if !o.ReRequestExisting {
+		return logins, nil
+	}
+	reviews, err := c.ListReviews(m.Org, m.Repo, m.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews: %w", err)
+	}
+	for _, r := range reviews {
+		if o.isBot == nil || !o.isBot(r.User.Login) {
+			add(r.User.Login)
+		}
+	}
+	if err := loadPR(c, m); err != nil {
+		return nil, err
+	}
+	for _, u := range m.PR.RequestedReviewers {
+		add(u.Login)
+	}
+	for _, t := range m.PR.RequestedTeams {
+		add(m.Org + "/" + t.Slug)
+	}
+	return logins, nil
+}
+
+// requestReviews requests a review of the pull request of m from the
+// reviewers, or only logs them without Confirm. A login that cannot review,
+// such as one that is not a collaborator, fails the request of the issue.
+func requestReviews(c Client, o Options, m *Meta, url string) error {
+	ref := IssueRef{Org: m.Org, Repo: m.Repo, Number: m.Number}
+	logins, err := reviewers(c, o, m)
+	if err != nil {
+		return err
+	}
+	if len(logins) == 0 {
+		o.Logger.Printf("No reviewers to request on %s", url)
+		return nil
+	}
+	who := strings.Join(logins, ", ")
+	if !o.Confirm {
+		o.Logger.Printf("Would request reviews on %s from %s", url, who)
+		o.Safeguards.Audit.record(auditRequestReview, ref, "", who, nil)
+		return nil
+	}
+	err = c.RequestReview(m.Org, m.Repo, m.Number, logins)
+	o.Safeguards.Audit.record(auditRequestReview, ref, "", who, err)
+	if err != nil {
+		return err
+	}
+	o.Logger.Printf("Requested reviews on %s from %s", url, who)
+	return nil
+}
+
+// ReviewFilter bounds the number of reviews of a pull request.
+type ReviewFilter struct {
+	Min int
+	// max is -1 for no upper bound.
+	Max int
+	// state counts only reviews in that state, or every submitted review
+	// if empty.
+	State github.ReviewState
+}
+
+// countReviews returns how many of reviews are in state, or how many were
+// submitted if state is empty.
+func countReviews(reviews []github.Review, state github.ReviewState) int {
+	n := 0
+	for _, r := range reviews {
+		if state == "" && r.State != github.ReviewStatePending || r.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// filterReviews skips pull requests with fewer than o.PullRequests.Reviews.Min or more
+// than o.PullRequests.Reviews.Max reviews.
+func filterReviews(ctx context.Context, c Client, o Options, m *Meta) (string, error) {
+	reviews, err := c.ListReviews(m.Org, m.Repo, m.Number)
+	if err != nil {
+		return "", prError("list reviews of", m, err)
+	}
+	n := countReviews(reviews, o.PullRequests.Reviews.State)
+	switch {
+	case n < o.PullRequests.Reviews.Min:
+		return fmt.Sprintf("%d reviews, fewer than %d", n, o.PullRequests.Reviews.Min), nil
+	case o.PullRequests.Reviews.Max >= 0 && n > o.PullRequests.Reviews.Max:
+		return fmt.Sprintf("%d reviews, more than %d", n, o.PullRequests.Reviews.Max), nil
+	}
+	return "", nil
+}
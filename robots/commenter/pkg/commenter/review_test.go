@@ -0,0 +1,147 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunRequestReviewers(t *testing.T) {
+	pr := func(number int, author string) github.Issue {
+		i := makePR("o", "r", number, "waiting on review")
+		i.User.Login = author
+		return i
+	}
+	newClient := func() *fakeClient {
+		return &fakeClient{
+			issues: []github.Issue{
+				makeIssue("o", "r", 1, "waiting on review"),
+				pr(2, "alice"),
+				pr(3, "alice"),
+			},
+			reviews: map[int][]github.Review{
+				2: {{User: github.User{Login: "bob"}}, {User: github.User{Login: "bot"}}, {User: github.User{Login: "alice"}}},
+			},
+			prs: map[int]github.PullRequest{
+				2: {Number: 2, RequestedReviewers: []github.User{{Login: "carol"}, {Login: "Bob"}}, RequestedTeams: []github.Team{{Slug: "maintainers"}}},
+				3: {Number: 3},
+			},
+		}
+	}
+	cases := []struct {
+		name      string
+		reviewers []string
+		existing  bool
+		confirm   bool
+		requested map[int][]string
+		logs      []string
+		problems  []string
+	}{
+		{
+			name:      "fallback team",
+			reviewers: []string{"o/approvers"},
+			confirm:   true,
+			requested: map[int][]string{2: {"o/approvers"}, 3: {"o/approvers"}},
+			logs: []string{
+				"Warning: not requesting reviews on fake://localhost/o/r/issues/1: not a pull request",
+				"Requested reviews on fake://localhost/o/r/pull/2 from o/approvers",
+			},
+		},
+		{
+			name:      "existing reviewers again, without the author or the bot",
+			reviewers: []string{"dave"},
+			existing:  true,
+			confirm:   true,
+			requested: map[int][]string{2: {"dave", "bob", "carol", "o/maintainers"}, 3: {"dave"}},
+		},
+		{
+			name:      "nobody to request",
+			existing:  true,
+			confirm:   true,
+			requested: map[int][]string{2: {"bob", "carol", "o/maintainers"}},
+			logs:      []string{"No reviewers to request on fake://localhost/o/r/pull/3"},
+		},
+		{
+			name:      "dry run",
+			reviewers: []string{"dave", "o/approvers"},
+			existing:  true,
+			logs: []string{
+				"Would request reviews on fake://localhost/o/r/pull/2 from dave, o/approvers, bob, carol, o/maintainers",
+				"Would request reviews on fake://localhost/o/r/pull/3 from dave, o/approvers",
+			},
+		},
+		{
+			name:      "not a collaborator",
+			reviewers: []string{"outsider"},
+			confirm:   true,
+			problems: []string{
+				"Failed to request reviews on o/r#2: outsider is not a collaborator of o/r",
+				"Failed to request reviews on o/r#3: outsider is not a collaborator of o/r",
+			},
+		},
+	}
+	for _, tc := range cases {
+		c := newClient()
+		var logs bytes.Buffer
+		res, err := Run(context.Background(), c, Options{
+			Searches:          unscoped("waiting on review"),
+			SamplePercent:     100,
+			Commenter:         MakeCommenter("ping", false),
+			Confirm:           tc.confirm,
+			RequestReviewers:  tc.reviewers,
+			ReRequestExisting: tc.existing,
+			Logger:            log.New(&logs, "", 0),
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if res.Commented != 3 {
+			t.Errorf("%s: expected 3 issues commented on, got %d", tc.name, res.Commented)
+		}
+		if !reflect.DeepEqual(c.requested, tc.requested) {
+			t.Errorf("%s: expected reviews requested from %v, got %v", tc.name, tc.requested, c.requested)
+		}
+		if !reflect.DeepEqual(res.Problems, tc.problems) {
+			t.Errorf("%s: expected problems %q, got %q", tc.name, tc.problems, res.Problems)
+		}
+		for _, line := range tc.logs {
+			if !strings.Contains(logs.String(), line) {
+				t.Errorf("%s: expected %q in the logs, got:\n%s", tc.name, line, logs.String())
+			}
+		}
+	}
+}
+
+func TestCheckReviewer(t *testing.T) {
+	for _, good := range []string{"alice", "kubernetes/sig-testing-leads"} {
+		if err := CheckReviewer(good); err != nil {
+			t.Errorf("%q: unexpected error: %v", good, err)
+		}
+	}
+	for _, bad := range []string{"", "@alice", "a b", "/team", "org/", "org/team/extra"} {
+		if err := CheckReviewer(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// RollupGroup is how a Rollup splits the issues over digests.
+type RollupGroup string
+
+const (
+	// RollupSingle lists every issue in one digest.
+	RollupSingle RollupGroup = ""
+	// RollupByRepo lists the issues of each repo in a digest of its own.
+	RollupByRepo RollupGroup = "repo"
+	// RollupByOrg lists the issues of each org in a digest of its own.
+	RollupByOrg RollupGroup = "org"
+)
+
+func (g *RollupGroup) String() string {
+	return string(*g)
+}
+
+func (g *RollupGroup) Set(value string) error {
+	switch RollupGroup(value) {
+	case RollupSingle, RollupByRepo, RollupByOrg:
+		*g = RollupGroup(value)
+	default:
+		return fmt.Errorf("must be %s or %s", RollupByRepo, RollupByOrg)
+	}
+	return nil
+}
+
+// Rollup collects the issues a run would comment on to list them all in a
+// single issue instead, which Run counts them as commented on for.
+type Rollup struct {
+	Org   string
+	Repo  string
+	Title string
+	// GroupBy splits the issues over one digest per repo or org, titled
+	// "Title: org/repo" or "Title: org".
+	GroupBy RollupGroup
+
+	mu     sync.Mutex
+	issues []Meta
+}
+
+// NewRollup returns a Rollup that lists the issues in an open issue of
+// org/repo titled title, creating it if needed.
+func NewRollup(org, repo, title string) *Rollup {
+	return &Rollup{Org: org, Repo: repo, Title: title}
+}
+
+func (r *Rollup) add(m Meta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.issues = append(r.issues, m)
+}
+
+// title returns the title of the digest listing m.
+func (r *Rollup) title(m Meta) string {
+	switch r.GroupBy {
+	case RollupByRepo:
+		return fmt.Sprintf("%s: %s/%s", r.Title, m.Org, m.Repo)
+	case RollupByOrg:
+		return fmt.Sprintf("%s: %s", r.Title, m.Org)
+	}
+	return r.Title
+}
+
+// post renders commenter once per digest with its issues as Meta.Issues,
+// sorted by URL, and writes the result to the roll-up issue. A body too long
+// for a single issue is split over several, numbered in their titles. Without
+// confirm, it only logs the issues it would write and close.
+func (r *Rollup) post(c Client, commenter func(Meta) (string, error), opts SafeguardOptions, confirm bool, logger *log.Logger) error {
+	r.mu.Lock()
+	issues := append([]Meta(nil), r.issues...)
+	r.mu.Unlock()
+	if len(issues) == 0 {
+		logger.Printf("Not writing the roll-up %q: no issues to list", r.Title)
+		return nil
+	}
+	sort.Slice(issues, func(a, b int) bool {
+		return issues[a].Issue.HTMLURL < issues[b].Issue.HTMLURL
+	})
+	digests := map[string][]Meta{}
+	var titles []string
+	for _, m := range issues {
+		title := r.title(m)
+		if _, ok := digests[title]; !ok {
+			titles = append(titles, title)
+		}
+		digests[title] = append(digests[title], m)
+	}
+	sort.Strings(titles)
+	for _, title := range titles {
+		if err := r.postDigest(c, commenter, title, digests[title], opts, confirm, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postDigest writes the digest titled title listing issues, then closes the
+// parts left over from an earlier digest that was split differently.
+func (r *Rollup) postDigest(c Client, commenter func(Meta) (string, error), title string, issues []Meta, opts SafeguardOptions, confirm bool, logger *log.Logger) error {
+	body, err := commenter(Meta{Org: r.Org, Repo: r.Repo, Issues: issues})
+	if err != nil {
+		return fmt.Errorf("failed to create the roll-up %q: %w", title, err)
+	}
+	parts := chunkLines(body, opts.limit())
+	if !confirm {
+		logger.Printf("Would write the roll-up %q listing %d issues to %s/%s in %d parts", title, len(issues), r.Org, r.Repo, len(parts))
+	}
+	written := map[string]bool{}
+	for n, part := range parts {
+		partTitle := title
+		if len(parts) > 1 {
+			partTitle = fmt.Sprintf("%s (%d/%d)", title, n+1, len(parts))
+		}
+		written[partTitle] = true
+		if !confirm {
+			continue
+		}
+		if err := upsertIssue(c, r.Org, r.Repo, partTitle, part, opts.Audit, logger); err != nil {
+			return err
+		}
+	}
+	return closeStaleParts(c, r.Org, r.Repo, title, written, opts.Audit, confirm, logger)
+}
+
+// partSuffix ends the titles of the parts of a digest split over several
+// issues.
+var partSuffix = regexp.MustCompile(`^ \(\d+/\d+\)$`)
+
+// isPart returns whether an issue titled candidate holds all or part of the
+// digest titled title.
+func isPart(candidate, title string) bool {
+	suffix, ok := strings.CutPrefix(candidate, title)
+	return ok && (suffix == "" || partSuffix.MatchString(suffix))
+}
+
+// closeStaleParts closes the open issues of org/repo holding the digest
+// titled title that were not just written, such as "(3/3)" once the digest
+// fits in two parts, or the unnumbered issue once it needs several. Without
+// confirm, it only logs them.
+func closeStaleParts(c Client, org, repo, title string, written map[string]bool, audit *AuditLog, confirm bool, logger *log.Logger) error {
+	query := fmt.Sprintf("repo:%s/%s is:issue is:open in:title %q", org, repo, title)
+	issues, err := c.FindIssuesWithOrg(org, query, "created", true)
+	if err != nil {
+		return fmt.Errorf("failed to look for stale parts of %s/%s issue %q: %w", org, repo, title, err)
+	}
+	for _, i := range issues {
+		if written[i.Title] || !isPart(i.Title, title) {
+			continue
+		}
+		ref := IssueRef{Org: org, Repo: repo, Number: i.Number}
+		if !confirm {
+			logger.Printf("Would close %s (%s), which the roll-up no longer needs", ref, i.Title)
+			continue
+		}
+		err := c.CloseIssue(org, repo, i.Number)
+		audit.record(auditClose, ref, "", i.Title, err)
+		if err != nil {
+			return fmt.Errorf("failed to close %s: %w", ref, err)
+		}
+		logger.Printf("Closed %s (%s), which the roll-up no longer needs", ref, i.Title)
+	}
+	return nil
+}
+
+// chunkLines splits s into pieces of at most n bytes, breaking after a
+// newline where possible.
+func chunkLines(s string, n int) []string {
+	var chunks []string
+	for len(s) > n {
+		cut := strings.LastIndex(s[:n], "\n") + 1
+		if cut == 0 {
+			cut = len(truncateUTF8(s, n))
+		}
+		chunks = append(chunks, s[:cut])
+		s = s[cut:]
+	}
+	return append(chunks, s)
+}
+
+// findIssueByTitle returns the open issue of org/repo titled exactly title,
+// or nil if there is none.
+func findIssueByTitle(c Client, org, repo, title string) (*github.Issue, error) {
+	query := fmt.Sprintf("repo:%s/%s is:issue is:open in:title %q", org, repo, title)
+	issues, err := c.FindIssuesWithOrg(org, query, "created", true)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range issues {
+		if i.Title == title {
+			return &i, nil
+		}
+	}
+	return nil, nil
+}
+
+// upsertIssue sets the body of the open issue of org/repo titled title,
+// creating the issue if there is none.
+func upsertIssue(c Client, org, repo, title, body string, audit *AuditLog, logger *log.Logger) error {
+	existing, err := findIssueByTitle(c, org, repo, title)
+	if err != nil {
+		return fmt.Errorf("failed to look for %s/%s issue %q: %w", org, repo, title, err)
+	}
+	if existing != nil {
+		ref := IssueRef{Org: org, Repo: repo, Number: existing.Number}
+		_, err := c.EditIssue(org, repo, existing.Number, &github.Issue{Body: body})
+		audit.record(auditEditIssue, ref, body, title, err)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", ref, err)
+		}
+		logger.Printf("Updated %s (%s)", ref, title)
+		return nil
+	}
+	number, err := c.CreateIssue(org, repo, title, body, 0, nil, nil)
+	ref := IssueRef{Org: org, Repo: repo, Number: number}
+	audit.record(auditCreateIssue, ref, body, title, err)
+	if err != nil {
+		return fmt.Errorf("failed to create %s/%s issue %q: %w", org, repo, title, err)
+	}
+	logger.Printf("Created %s (%s)", ref, title)
+	return nil
+}
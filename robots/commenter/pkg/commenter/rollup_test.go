@@ -0,0 +1,257 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestChunkLines(t *testing.T) {
+	cases := []struct {
+		name     string
+		s        string
+		n        int
+		expected []string
+	}{
+		{
+			name:     "fits",
+			s:        "a\nb\n",
+			n:        10,
+			expected: []string{"a\nb\n"},
+		},
+		{
+			name:     "breaks after newlines",
+			s:        "aaa\nbbb\nccc\n",
+			n:        9,
+			expected: []string{"aaa\nbbb\n", "ccc\n"},
+		},
+		{
+			name:     "breaks long lines",
+			s:        "aaaaaa\nb",
+			n:        4,
+			expected: []string{"aaaa", "aa\nb"},
+		},
+		{
+			name:     "keeps runes whole",
+			s:        "ééé",
+			n:        3,
+			expected: []string{"é", "é", "é"},
+		},
+	}
+	for _, tc := range cases {
+		if actual := chunkLines(tc.s, tc.n); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+const rollupTemplate = "{{range .Issues}}- {{.Org}}/{{.Repo}}#{{.Number}}\n{{end}}"
+
+func TestRunRollup(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 2, "sweep"),
+			makeIssue("o", "r", 1, "sweep"),
+			makeIssue("o", "s", 3, "sweep"),
+		},
+	}
+	rollup := NewRollup("o", "tracking", "Sweep")
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter(rollupTemplate, true),
+		Confirm:       true,
+		Rollup:        rollup,
+	})
+	if err != nil || len(res.Problems) > 0 {
+		t.Fatalf("unexpected error: %v %v", err, res.Problems)
+	}
+	if len(c.comments) > 0 {
+		t.Errorf("expected no comments, got %v", c.comments)
+	}
+	expected := []github.Issue{{Number: 1000, Title: "Sweep", Body: "- o/r#1\n- o/r#2\n- o/s#3\n"}}
+	if !reflect.DeepEqual(c.created, expected) {
+		t.Errorf("expected to create %+v, created %+v", expected, c.created)
+	}
+	if res.Commented != 3 {
+		t.Errorf("expected 3 issues listed, got %d", res.Commented)
+	}
+}
+
+func TestRunRollupUpdatesAndSplits(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "sweep"),
+			makeIssue("o", "r", 2, "sweep"),
+		},
+		titled: []github.Issue{
+			{Number: 7, Title: "Sweep (1/2) and more"},
+			{Number: 8, Title: "Sweep (1/2)"},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter(rollupTemplate, true),
+		Confirm:       true,
+		Safeguards:    SafeguardOptions{MaxLength: len("- o/r#1\n")},
+		Rollup:        NewRollup("o", "tracking", "Sweep"),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := map[int]string{8: "- o/r#1\n"}; !reflect.DeepEqual(c.edited, expected) {
+		t.Errorf("expected to edit %v, edited %v", expected, c.edited)
+	}
+	if len(c.created) != 1 || c.created[0].Title != "Sweep (2/2)" || c.created[0].Body != "- o/r#2\n" {
+		t.Errorf("expected to create the second part, created %+v", c.created)
+	}
+
+	c = fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "sweep")}}
+	err = runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter(rollupTemplate, true),
+		Confirm:       true,
+		Rollup:        NewRollup("o", "error", "Sweep"),
+	}))
+	if err == nil || !strings.Contains(err.Error(), "roll-up") {
+		t.Errorf("expected the roll-up failure, got %v", err)
+	}
+}
+
+func TestRunRollupClosesStaleParts(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{makeIssue("o", "r", 1, "sweep")},
+		titled: []github.Issue{
+			{Number: 7, Title: "Sweep (1/2)"},
+			{Number: 8, Title: "Sweep (2/2)"},
+			{Number: 9, Title: "Sweep: o/r"},
+			{Number: 10, Title: "Sweep (2/2) and more"},
+		},
+	}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter(rollupTemplate, true),
+		Confirm:       true,
+		Rollup:        NewRollup("o", "tracking", "Sweep"),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.created) != 1 || c.created[0].Title != "Sweep" {
+		t.Errorf("expected to create the unnumbered digest, created %+v", c.created)
+	}
+	if expected := []int{7, 8}; !reflect.DeepEqual(c.closed, expected) {
+		t.Errorf("expected to close the stale parts %v, closed %v", expected, c.closed)
+	}
+}
+
+func TestRunRollupGroupBy(t *testing.T) {
+	cases := []struct {
+		by       RollupGroup
+		expected []github.Issue
+	}{
+		{
+			by: RollupByRepo,
+			expected: []github.Issue{
+				{Number: 1000, Title: "Sweep: o/r", Body: "- o/r#1\n- o/r#2\n"},
+				{Number: 1001, Title: "Sweep: o/s", Body: "- o/s#3\n"},
+				{Number: 1002, Title: "Sweep: p/t", Body: "- p/t#4\n"},
+			},
+		},
+		{
+			by: RollupByOrg,
+			expected: []github.Issue{
+				{Number: 1000, Title: "Sweep: o", Body: "- o/r#1\n- o/r#2\n- o/s#3\n"},
+				{Number: 1001, Title: "Sweep: p", Body: "- p/t#4\n"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{
+			issues: []github.Issue{
+				makeIssue("p", "t", 4, "sweep"),
+				makeIssue("o", "r", 2, "sweep"),
+				makeIssue("o", "s", 3, "sweep"),
+				makeIssue("o", "r", 1, "sweep"),
+			},
+		}
+		rollup := NewRollup("o", "tracking", "Sweep")
+		rollup.GroupBy = tc.by
+		err := runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("sweep"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter(rollupTemplate, true),
+			Confirm:       true,
+			Rollup:        rollup,
+		}))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.by, err)
+		}
+		if !reflect.DeepEqual(c.created, tc.expected) {
+			t.Errorf("%s: expected to create %+v, created %+v", tc.by, tc.expected, c.created)
+		}
+	}
+}
+
+func TestRunRollupDryRun(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "sweep"),
+			makeIssue("o", "r", 2, "sweep"),
+		},
+		titled: []github.Issue{
+			{Number: 7, Title: "Sweep (1/2)"},
+			{Number: 8, Title: "Sweep (3/3)"},
+		},
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("sweep"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter(rollupTemplate, true),
+		Safeguards:    SafeguardOptions{MaxLength: len("- o/r#1\n")},
+		Rollup:        NewRollup("o", "tracking", "Sweep"),
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil || len(res.Problems) > 0 {
+		t.Fatalf("unexpected error: %v %v", err, res.Problems)
+	}
+	if len(c.created) > 0 || len(c.edited) > 0 || len(c.closed) > 0 {
+		t.Errorf("expected a dry run to change nothing, created %+v, edited %v and closed %v", c.created, c.edited, c.closed)
+	}
+	for _, expected := range []string{
+		`Would write the roll-up "Sweep" listing 2 issues to o/tracking in 2 parts`,
+		"Would close o/tracking#8 (Sweep (3/3)), which the roll-up no longer needs",
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected the log to contain %q, got:\n%s", expected, logs.String())
+		}
+	}
+	if strings.Contains(logs.String(), "o/tracking#7") {
+		t.Errorf("expected only the parts no longer needed to be listed for closing, got:\n%s", logs.String())
+	}
+}
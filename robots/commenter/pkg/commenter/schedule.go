@@ -0,0 +1,187 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// scheduledCloseGrace is how long after the comment updates to the issue are
+// attributed to the commenter itself, e.g. adding --label-add.
+const scheduledCloseGrace = time.Minute
+
+// jsonDuration is a time.Duration written as a string like 168h0m0s.
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(parsed)
+	return nil
+}
+
+// scheduledAction closes IssueURL unless it is updated within CloseAfter of
+// CommentTime.
+type scheduledAction struct {
+	IssueURL    string       `json:"issue_url"`
+	CommentTime time.Time    `json:"comment_time"`
+	CloseAfter  jsonDuration `json:"close_after_duration"`
+}
+
+// due returns whether the action can be executed at now.
+func (a scheduledAction) due(now time.Time) bool {
+	return !now.Before(a.CommentTime.Add(time.Duration(a.CloseAfter)))
+}
+
+// ScheduleQueue collects the actions scheduled by a run.
+type ScheduleQueue struct {
+	sync.Mutex
+	CloseAfter time.Duration
+	actions    []scheduledAction
+}
+
+// add schedules closing url unless it is updated within CloseAfter of now.
+func (q *ScheduleQueue) add(url string, now time.Time) {
+	q.Lock()
+	defer q.Unlock()
+	q.actions = append(q.actions, scheduledAction{IssueURL: url, CommentTime: now.UTC(), CloseAfter: jsonDuration(q.CloseAfter)})
+}
+
+// take returns the queued actions and empties the queue.
+func (q *ScheduleQueue) Take() []scheduledAction {
+	q.Lock()
+	defer q.Unlock()
+	actions := q.actions
+	q.actions = nil
+	return actions
+}
+
+// loadScheduledActions reads the actions in path, which may not exist yet.
+func loadScheduledActions(path string) ([]scheduledAction, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var actions []scheduledAction
+	if err := json.Unmarshal(b, &actions); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return actions, nil
+}
+
+// saveScheduledActions atomically replaces path with actions.
+func saveScheduledActions(path string, actions []scheduledAction) error {
+	if actions == nil {
+		actions = []scheduledAction{}
+	}
+	b, err := json.MarshalIndent(actions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+// AppendScheduledActions adds actions to those in path. The file is reread
+// right before writing to keep what a concurrent --run-scheduled-actions did.
+func AppendScheduledActions(path string, actions []scheduledAction) error {
+	existing, err := loadScheduledActions(path)
+	if err != nil {
+		return err
+	}
+	return saveScheduledActions(path, append(existing, actions...))
+}
+
+// runScheduledActions closes the issues of the due actions that were not
+// updated since the comment, returning the actions left for a later run:
+// those not due yet and those that failed.
+func runScheduledActions(c Client, actions []scheduledAction, now time.Time, audit *AuditLog, problems *problemList) []scheduledAction {
+	var pending []scheduledAction
+	closed := 0
+	for _, a := range actions {
+		if !a.due(now) {
+			pending = append(pending, a)
+			continue
+		}
+		ref, err := ParseHTMLURL(a.IssueURL)
+		if err != nil {
+			problems.add("Dropping scheduled action for %s: %v", a.IssueURL, err)
+			continue
+		}
+		i, err := c.GetIssue(ref.Org, ref.Repo, ref.Number)
+		if err != nil {
+			problems.add("Failed to get %s: %v", ref, err)
+			pending = append(pending, a)
+			continue
+		}
+		if i.State == "closed" {
+			log.Printf("Not closing %s: already closed", a.IssueURL)
+			continue
+		}
+		if i.UpdatedAt.After(a.CommentTime.Add(scheduledCloseGrace)) {
+			log.Printf("Not closing %s: updated at %s, after the comment at %s", a.IssueURL, i.UpdatedAt.Format(time.RFC3339), a.CommentTime.Format(time.RFC3339))
+			continue
+		}
+		err = c.CloseIssue(ref.Org, ref.Repo, ref.Number)
+		audit.record(auditClose, ref, "", "", err)
+		if err != nil {
+			problems.add("Failed to close %s: %v", ref, err)
+			pending = append(pending, a)
+			continue
+		}
+		log.Printf("Closed %s, not updated for %s after the comment", a.IssueURL, time.Duration(a.CloseAfter))
+		closed++
+	}
+	log.Printf("Closed %d of %d scheduled issues, %d actions pending", closed, len(actions), len(pending))
+	return pending
+}
+
+// RunScheduledActionsFile runs the due actions of the scheduled actions file
+// at path and, when confirm is set, writes back the actions left pending.
+func RunScheduledActionsFile(c Client, path string, now time.Time, confirm bool, audit *AuditLog) error {
+	actions, err := loadScheduledActions(path)
+	if err != nil {
+		return err
+	}
+	problems := &problemList{logger: log.Default()}
+	pending := runScheduledActions(c, actions, now, audit, problems)
+	if !confirm {
+		log.Printf("Not writing %s without --confirm", path)
+	} else if err := saveScheduledActions(path, pending); err != nil {
+		problems.add("Failed to write %s: %v", path, err)
+	}
+	return Result{Problems: problems.sorted()}.err()
+}
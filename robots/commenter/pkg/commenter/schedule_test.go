@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestScheduledActionsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduled.json")
+	if actions, err := loadScheduledActions(path); err != nil || actions != nil {
+		t.Fatalf("expected a missing file to hold no actions, got %v, %v", actions, err)
+	}
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	first := scheduledAction{IssueURL: "first", CommentTime: now, CloseAfter: jsonDuration(time.Hour)}
+	second := scheduledAction{IssueURL: "second", CommentTime: now, CloseAfter: jsonDuration(2 * time.Hour)}
+	if err := AppendScheduledActions(path, []scheduledAction{first}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := AppendScheduledActions(path, []scheduledAction{second}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(b), `"close_after_duration": "2h0m0s"`) {
+		t.Errorf("expected durations as strings, got %s", b)
+	}
+	actions, err := loadScheduledActions(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []scheduledAction{first, second}; !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected %v, got %v", expected, actions)
+	}
+}
+
+func TestRunScheduledActions(t *testing.T) {
+	commented := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := commented.Add(48 * time.Hour)
+	issue := func(owner, repo string, number int, state string, updated time.Time) github.Issue {
+		i := makeIssue(owner, repo, number, "")
+		i.State = state
+		i.UpdatedAt = updated
+		return i
+	}
+	c := fakeClient{
+		issues: []github.Issue{
+			issue("o", "r", 1, "open", commented.Add(time.Second)),
+			issue("o", "r", 2, "open", commented.Add(time.Hour)),
+			issue("o", "r", 3, "closed", commented),
+			issue("o", "r", 4, "open", commented),
+			issue("o", "error", 5, "open", commented),
+		},
+	}
+	action := func(url string, after time.Duration) scheduledAction {
+		return scheduledAction{IssueURL: url, CommentTime: commented, CloseAfter: jsonDuration(after)}
+	}
+	notDue := action(makeIssue("o", "r", 4, "").HTMLURL, 72*time.Hour)
+	failed := action(makeIssue("o", "error", 5, "").HTMLURL, 24*time.Hour)
+	missing := action(makeIssue("o", "r", 6, "").HTMLURL, 24*time.Hour)
+	problems := &problemList{logger: log.Default()}
+	pending := runScheduledActions(&c, []scheduledAction{
+		action(makeIssue("o", "r", 1, "").HTMLURL, 24*time.Hour),
+		action(makeIssue("o", "r", 2, "").HTMLURL, 24*time.Hour),
+		action(makeIssue("o", "r", 3, "").HTMLURL, 24*time.Hour),
+		notDue,
+		failed,
+		missing,
+		action("not a url", 24*time.Hour),
+	}, now, nil, problems)
+	if expected := []int{1}; !reflect.DeepEqual(c.closed, expected) {
+		t.Errorf("expected to close %v, got %v", expected, c.closed)
+	}
+	if expected := []scheduledAction{notDue, failed, missing}; !reflect.DeepEqual(pending, expected) {
+		t.Errorf("expected pending %v, got %v", expected, pending)
+	}
+	if n := len(problems.sorted()); n != 3 {
+		t.Errorf("expected 3 problems, got %d: %v", n, problems.sorted())
+	}
+}
+
+func TestRunSchedulesClose(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{makeIssue("o", "r", 1, "stale"), makeIssue("o", "r", 2, "stale")},
+	}
+	schedule := &ScheduleQueue{CloseAfter: time.Hour}
+	if err := runErr(Run(context.Background(), &c, Options{
+		Searches:      unscoped("stale"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("closing soon", false),
+		Schedule:      schedule,
+	})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var urls []string
+	for _, a := range schedule.Take() {
+		if time.Duration(a.CloseAfter) != time.Hour || a.CommentTime.IsZero() {
+			t.Errorf("bad scheduled action %+v", a)
+		}
+		urls = append(urls, a.IssueURL)
+	}
+	if len(urls) != 2 {
+		t.Errorf("expected both issues to be scheduled, got %v", urls)
+	}
+	if actions := schedule.Take(); actions != nil {
+		t.Errorf("expected take to empty the queue, got %v", actions)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SlackSummary is what a run reports to the --slack-webhook-file.
+type SlackSummary struct {
+	Query     string
+	DryRun    bool
+	Matched   int
+	Commented int
+	Failed    int
+	// Issues are the first of the issues commented on, Omitted counts the rest.
+	Issues  []string
+	Omitted int
+	// Error is set when the run failed before commenting.
+	Error string
+}
+
+// NewSlackSummary summarizes res, listing at most maxIssues of the issues commented on.
+func NewSlackSummary(query string, dryRun bool, res Result, err error, maxIssues int) SlackSummary {
+	s := SlackSummary{
+		Query:     query,
+		DryRun:    dryRun,
+		Matched:   res.Matched,
+		Commented: res.Commented,
+		Failed:    res.Failed,
+		Issues:    res.CommentedOn,
+	}
+	if len(s.Issues) > maxIssues {
+		s.Omitted = len(s.Issues) - maxIssues
+		s.Issues = s.Issues[:maxIssues]
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	return s
+}
+
+// text renders the summary as a Slack message.
+func (s SlackSummary) text() string {
+	var b strings.Builder
+	if s.DryRun {
+		b.WriteString("[dry-run] ")
+	}
+	fmt.Fprintf(&b, "commenter `%s`", s.Query)
+	if s.Error != "" {
+		fmt.Fprintf(&b, " failed: %s", s.Error)
+		return b.String()
+	}
+	verb := "commented on"
+	if s.DryRun {
+		verb = "would have commented on"
+	}
+	fmt.Fprintf(&b, ": matched %d, %s %d, failed on %d", s.Matched, verb, s.Commented, s.Failed)
+	for _, i := range s.Issues {
+		fmt.Fprintf(&b, "\n• %s", i)
+	}
+	if s.Omitted > 0 {
+		fmt.Fprintf(&b, "\n…and %d more", s.Omitted)
+	}
+	return b.String()
+}
+
+// PostSlack sends s to the incoming webhook.
+func PostSlack(webhook string, s SlackSummary) error {
+	body, err := json.Marshal(struct {
+		Text string `json:"text"`
+	}{Text: s.text()})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: time.Minute}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// Drop the webhook URL, which is a secret, from the error.
+		if uerr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return nil
+}
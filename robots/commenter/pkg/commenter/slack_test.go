@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewSlackSummary(t *testing.T) {
+	res := Result{
+		Matched:     5,
+		Commented:   3,
+		Failed:      1,
+		CommentedOn: []string{"https://github.com/o/r/issues/1", "https://github.com/o/r/issues/2", "https://github.com/o/r/issues/3"},
+	}
+	cases := []struct {
+		name      string
+		maxIssues int
+		issues    []string
+		omitted   int
+	}{
+		{
+			name:      "all issues fit",
+			maxIssues: 3,
+			issues:    res.CommentedOn,
+		},
+		{
+			name:      "truncated",
+			maxIssues: 2,
+			issues:    res.CommentedOn[:2],
+			omitted:   1,
+		},
+		{
+			name:      "no issues listed",
+			maxIssues: 0,
+			issues:    []string{},
+			omitted:   3,
+		},
+	}
+	for _, tc := range cases {
+		s := NewSlackSummary("is:open", false, res, nil, tc.maxIssues)
+		if !reflect.DeepEqual(s.Issues, tc.issues) || s.Omitted != tc.omitted {
+			t.Errorf("%s: expected issues %v and %d omitted, got %v and %d", tc.name, tc.issues, tc.omitted, s.Issues, s.Omitted)
+		}
+		if s.Matched != 5 || s.Commented != 3 || s.Failed != 1 {
+			t.Errorf("%s: counts not copied: %+v", tc.name, s)
+		}
+	}
+}
+
+func TestSlackSummaryText(t *testing.T) {
+	cases := []struct {
+		name     string
+		summary  SlackSummary
+		expected string
+	}{
+		{
+			name:     "confirmed",
+			summary:  SlackSummary{Query: "is:open", Matched: 4, Commented: 2, Issues: []string{"a", "b"}},
+			expected: "commenter `is:open`: matched 4, commented on 2, failed on 0\n• a\n• b",
+		},
+		{
+			name:     "dry run with omitted issues",
+			summary:  SlackSummary{Query: "is:open", DryRun: true, Matched: 4, Commented: 3, Issues: []string{"a"}, Omitted: 2},
+			expected: "[dry-run] commenter `is:open`: matched 4, would have commented on 3, failed on 0\n• a\n…and 2 more",
+		},
+		{
+			name:     "failed run",
+			summary:  SlackSummary{Query: "is:open", Error: "search failed"},
+			expected: "commenter `is:open` failed: search failed",
+		},
+	}
+	for _, tc := range cases {
+		if actual := tc.summary.text(); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestPostSlack(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "invalid_token", http.StatusForbidden)
+			return
+		}
+		var payload struct{ Text string }
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = payload.Text
+	}))
+	defer server.Close()
+
+	s := NewSlackSummary("is:open", true, Result{}, errors.New("boom"), 10)
+	if err := PostSlack(server.URL+"/hook", s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if received != s.text() {
+		t.Errorf("expected %q, got %q", s.text(), received)
+	}
+	err := PostSlack(server.URL+"/broken", s)
+	if err == nil || !strings.Contains(err.Error(), "invalid_token") {
+		t.Errorf("expected the response body in the error, got %v", err)
+	}
+	err = PostSlack("http://127.0.0.1:0/secret-hook", s)
+	if err == nil || strings.Contains(err.Error(), "secret-hook") {
+		t.Errorf("expected an error without the webhook URL, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// ProcessedState remembers which issues were commented on across runs.
+type ProcessedState struct {
+	sync.Mutex
+	path      string
+	commented map[string]bool
+}
+
+// stateJSON is the on-disk format of a --state-file.
+type stateJSON struct {
+	Commented []string `json:"commented"`
+}
+
+// LoadState reads the state file at path. A missing file starts fresh, as
+// does a corrupt one when reset is set.
+func LoadState(path string, reset bool) (*ProcessedState, error) {
+	s := &ProcessedState{path: path, commented: map[string]bool{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("State file %s does not exist, starting fresh", path)
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var sj stateJSON
+	if err := json.Unmarshal(b, &sj); err != nil {
+		if reset {
+			log.Printf("Ignoring corrupt state file %s: %v", path, err)
+			return s, nil
+		}
+		return nil, fmt.Errorf("parse %s (use --state-reset to start fresh): %w", path, err)
+	}
+	for _, u := range sj.Commented {
+		s.commented[u] = true
+	}
+	return s, nil
+}
+
+// has returns whether url was already commented on.
+func (s *ProcessedState) has(url string) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.commented[url]
+}
+
+// add records that url was commented on.
+func (s *ProcessedState) add(url string) {
+	s.Lock()
+	defer s.Unlock()
+	s.commented[url] = true
+}
+
+// save atomically writes the state by renaming a temporary file over the
+// state file, so an interrupted write never leaves a truncated file.
+func (s *ProcessedState) Save() error {
+	s.Lock()
+	sj := stateJSON{Commented: make([]string, 0, len(s.commented))}
+	for u := range s.commented {
+		sj.Commented = append(sj.Commented, u)
+	}
+	s.Unlock()
+	sort.Strings(sj.Commented)
+	b, err := json.MarshalIndent(sj, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, b)
+}
+
+// writeFileAtomic replaces path with b through a temporary file in the same
+// directory.
+func writeFileAtomic(path string, b []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
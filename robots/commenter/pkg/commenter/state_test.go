@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestLoadState(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  *string
+		reset    bool
+		expected map[string]bool
+		err      bool
+	}{
+		{
+			name:     "missing file starts fresh",
+			expected: map[string]bool{},
+		},
+		{
+			name:     "valid file",
+			content:  stringPtr(`{"commented": ["a", "b"]}`),
+			expected: map[string]bool{"a": true, "b": true},
+		},
+		{
+			name:    "corrupt file errors",
+			content: stringPtr(`{"commented": [`),
+			err:     true,
+		},
+		{
+			name:     "corrupt file with reset starts fresh",
+			content:  stringPtr(`{"commented": [`),
+			reset:    true,
+			expected: map[string]bool{},
+		},
+	}
+
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), "state.json")
+		if tc.content != nil {
+			if err := os.WriteFile(path, []byte(*tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s, err := LoadState(path, tc.reset)
+		if err != nil {
+			if !tc.err {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if tc.err {
+			t.Errorf("%s: failed to receive an error", tc.name)
+			continue
+		}
+		if !reflect.DeepEqual(s.commented, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, s.commented)
+		}
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestStateAcrossRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	c := fakeClient{issues: []github.Issue{
+		makeIssue("o", "r", 1, "stateful"),
+		makeIssue("o", "error", 2, "stateful"),
+		makeIssue("o", "r", 3, "stateful"),
+		makeIssue("o", "r", 4, "stateful"),
+	}}
+	runOnce := func(ceiling int) error {
+		s, err := LoadState(path, false)
+		if err != nil {
+			t.Fatalf("unexpected error loading state: %v", err)
+		}
+		err = runErr(Run(context.Background(), &c, Options{
+			Searches:      unscoped("stateful"),
+			SamplePercent: 100,
+			Ceiling:       ceiling,
+			Commenter:     MakeCommenter("hello", false),
+			State:         s,
+		}))
+		if err := s.Save(); err != nil {
+			t.Fatalf("unexpected error saving state: %v", err)
+		}
+		return err
+	}
+
+	if err := runOnce(3); err == nil {
+		t.Error("first run: failed to receive an error for the failed comment")
+	}
+	if expected := []int{1, 3}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("first run: expected comments on %v, got %v", expected, c.comments)
+	}
+
+	c.comments = nil
+	if err := runOnce(0); err == nil {
+		t.Error("second run: failed to receive an error for the failed comment")
+	}
+	if expected := []int{4}; !reflect.DeepEqual(c.comments, expected) {
+		t.Errorf("second run: expected comments on %v, got %v", expected, c.comments)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "commented": [
+    "fake://localhost/o/r/issues/1",
+    "fake://localhost/o/r/issues/3",
+    "fake://localhost/o/r/issues/4"
+  ]
+}`
+	if string(b) != expected {
+		t.Errorf("expected state file %s, got %s", expected, b)
+	}
+	if matches, _ := filepath.Glob(path + ".tmp*"); len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
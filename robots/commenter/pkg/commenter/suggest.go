@@ -0,0 +1,93 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// equivalentQualifiers are pairs of qualifiers that match the same issues.
+var equivalentQualifiers = [][2]string{
+	{"is:issue", "type:issue"},
+	{"is:pr", "type:pr"},
+	{"is:open", "state:open"},
+	{"is:closed", "state:closed"},
+}
+
+// broadQualifiers are the qualifiers that scope a search or, like those
+// MakeQuery adds, only narrow it by state, without telling which issues of
+// the scope are meant.
+var broadQualifiers = []string{"repo:", "org:", "user:", "is:", "state:", "type:", "archived:", "updated:"}
+
+// SuggestQuery returns advice on common mistakes in a query built by
+// MakeQuery, for people still learning GitHub's search syntax. It never
+// changes the query.
+func SuggestQuery(query string) []string {
+	var suggestions []string
+	terms := queryTerms(query)
+	count := map[string]int{}
+	for _, term := range terms {
+		count[strings.ToLower(term)]++
+	}
+	reported := map[string]bool{}
+	for _, term := range terms {
+		lower := strings.ToLower(term)
+		if count[lower] > 1 && !reported[lower] && !isOperator(term) {
+			reported[lower] = true
+			suggestions = append(suggestions, fmt.Sprintf("%s appears %d times, once is enough", term, count[lower]))
+		}
+	}
+	for _, pair := range equivalentQualifiers {
+		if count[pair[0]] > 0 && count[pair[1]] > 0 {
+			suggestions = append(suggestions, fmt.Sprintf("%s and %s mean the same, keep one", pair[0], pair[1]))
+		}
+	}
+	if count["is:open"]+count["state:open"]+count["is:closed"]+count["state:closed"] == 0 {
+		suggestions = append(suggestions, "closed issues match too, add is:open unless they are meant to")
+	}
+	scoped, narrowed := false, false
+	for _, term := range terms {
+		lower := strings.ToLower(term)
+		if strings.HasPrefix(lower, "repo:") || strings.HasPrefix(lower, "org:") || strings.HasPrefix(lower, "user:") {
+			scoped = true
+		}
+		if !isOperator(term) && !hasAnyPrefix(lower, broadQualifiers) {
+			narrowed = true
+		}
+	}
+	switch {
+	case !scoped:
+		suggestions = append(suggestions, "without repo:, org: or user: the search covers all of GitHub, of which it returns at most 1000 results")
+	case !narrowed:
+		suggestions = append(suggestions, "only the scope and state are given, so the search may match more than the 1000 results it returns; narrow it with keywords, label: or author:")
+	}
+	return suggestions
+}
+
+func isOperator(term string) bool {
+	return term == "AND" || term == "OR" || term == "NOT"
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
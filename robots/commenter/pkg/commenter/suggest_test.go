@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestQuery(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{
+			name:  "nothing to suggest",
+			query: "org:o label:bug is:open",
+		},
+		{
+			name:  "repeated qualifier",
+			query: "org:o label:bug is:open Is:open",
+			expected: []string{
+				"is:open appears 2 times, once is enough",
+			},
+		},
+		{
+			name:  "equivalent qualifiers",
+			query: "repo:o/r label:bug is:pr type:pr state:open",
+			expected: []string{
+				"is:pr and type:pr mean the same, keep one",
+			},
+		},
+		{
+			name:  "closed issues match",
+			query: "org:o label:bug",
+			expected: []string{
+				"closed issues match too, add is:open unless they are meant to",
+			},
+		},
+		{
+			name:  "unscoped",
+			query: "label:bug is:open",
+			expected: []string{
+				"without repo:, org: or user: the search covers all of GitHub, of which it returns at most 1000 results",
+			},
+		},
+		{
+			name:  "only scope and state",
+			query: "org:o is:open archived:false is:issue",
+			expected: []string{
+				"only the scope and state are given, so the search may match more than the 1000 results it returns; narrow it with keywords, label: or author:",
+			},
+		},
+		{
+			name:  "operators are not repeats",
+			query: "org:o is:open flake OR flaky OR flaking",
+		},
+	}
+	for _, tc := range cases {
+		if actual := SuggestQuery(tc.query); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
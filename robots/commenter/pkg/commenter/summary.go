@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// summaryEntry is an issue Run processed, for the --summary-markdown.
+type summaryEntry struct {
+	ref     IssueRef
+	issue   github.Issue
+	outcome Outcome
+	// comment is what was rendered for the issue, if it got that far.
+	comment string
+}
+
+// SummaryLog collects what Run did with each issue. A nil SummaryLog
+// collects nothing.
+type SummaryLog struct {
+	sync.Mutex
+	comments map[string]string
+	entries  []summaryEntry
+}
+
+func NewSummaryLog() *SummaryLog {
+	return &SummaryLog{comments: map[string]string{}}
+}
+
+// rendered records the comment about to be posted on the issue at url.
+func (s *SummaryLog) rendered(url, comment string) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.comments[url] = comment
+}
+
+// add records the outcome of issue, which is skipped if its URL is invalid.
+func (s *SummaryLog) add(issue github.Issue, out Outcome) {
+	if s == nil {
+		return
+	}
+	ref, _, err := issueRef(issue)
+	if err != nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.entries = append(s.entries, summaryEntry{ref: ref, issue: issue, outcome: out, comment: s.comments[issue.HTMLURL]})
+}
+
+// SummaryHeader describes the run at the top of the summary.
+type SummaryHeader struct {
+	Query  string
+	DryRun bool
+	// cutoff is the --updated cutoff, if any.
+	Cutoff  time.Time
+	Ceiling int
+	Now     time.Time
+}
+
+// describe returns what out means for an issue, in the mood of the run.
+func (h SummaryHeader) describe(out Outcome) string {
+	switch out {
+	case OutcomeCommented:
+		if h.DryRun {
+			return "would comment"
+		}
+		return "commented"
+	case OutcomeDuplicate:
+		return "already commented"
+	case OutcomeFailed, OutcomeInvalid:
+		return "failed"
+	case OutcomeStopped:
+		return "stopped"
+	}
+	return "skipped"
+}
+
+// writeSummary writes a Markdown checklist of the entries, grouped by repo,
+// with the comment for each issue in a collapsed block. Issues are only
+// checked off once commented on for real.
+func writeSummary(w io.Writer, h SummaryHeader, res Result, entries []summaryEntry) error {
+	var b strings.Builder
+	mode := "confirm"
+	if h.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(&b, "# Commenter %s summary\n\n", mode)
+	fmt.Fprintf(&b, "- Query: `%s`\n", strings.ReplaceAll(h.Query, "`", "'"))
+	fmt.Fprintf(&b, "- Run at: %s\n", h.Now.UTC().Format(time.RFC3339))
+	if !h.Cutoff.IsZero() {
+		fmt.Fprintf(&b, "- Updated before: %s\n", h.Cutoff.UTC().Format(time.RFC3339))
+	}
+	if h.Ceiling > 0 {
+		fmt.Fprintf(&b, "- Ceiling: %d\n", h.Ceiling)
+	}
+	fmt.Fprintf(&b, "- Matched %d, %s %d, skipped %d, failed on %d\n", res.Matched, h.describe(OutcomeCommented), res.Commented, res.Skipped, res.Failed)
+
+	entries = sortedEntries(entries)
+	repo := ""
+	for _, e := range entries {
+		if r := e.ref.Org + "/" + e.ref.Repo; r != repo {
+			repo = r
+			fmt.Fprintf(&b, "\n## %s\n\n", repo)
+		}
+		check := " "
+		if e.outcome == OutcomeCommented && !h.DryRun {
+			check = "x"
+		}
+		fmt.Fprintf(&b, "- [%s] [#%d](%s) %s (%s", check, e.ref.Number, e.issue.HTMLURL, e.issue.Title, h.describe(e.outcome))
+		if days := daysSince(e.issue.CreatedAt, h.Now); days != unknownDays {
+			fmt.Fprintf(&b, ", opened %d days ago", days)
+		}
+		if days := daysSince(e.issue.UpdatedAt, h.Now); days != unknownDays {
+			fmt.Fprintf(&b, ", updated %d days ago", days)
+		}
+		b.WriteString(")\n")
+		if e.comment != "" {
+			f := fence(e.comment)
+			fmt.Fprintf(&b, "  <details><summary>Comment</summary>\n\n  %smarkdown\n%s\n  %s\n  </details>\n", f, indent(e.comment, "  "), f)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Save writes the summary of res to path, or to stdout if path is -.
+func (s *SummaryLog) Save(path string, h SummaryHeader, res Result) error {
+	s.Lock()
+	entries := s.entries
+	s.Unlock()
+	if path == "-" {
+		return writeSummary(os.Stdout, h, res, entries)
+	}
+	var buf bytes.Buffer
+	if err := writeSummary(&buf, h, res, entries); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// sortedEntries returns a copy of entries sorted by repo, then number.
+func sortedEntries(entries []summaryEntry) []summaryEntry {
+	entries = append([]summaryEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].ref, entries[j].ref
+		if a.Org+"/"+a.Repo != b.Org+"/"+b.Repo {
+			return a.Org+"/"+a.Repo < b.Org+"/"+b.Repo
+		}
+		return a.Number < b.Number
+	})
+	return entries
+}
+
+// fence returns a code fence longer than any run of backticks in s.
+func fence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		if run++; run > longest {
+			longest = run
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
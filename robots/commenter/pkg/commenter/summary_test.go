@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestWriteSummary(t *testing.T) {
+	now := time.Date(2023, 6, 10, 0, 0, 0, 0, time.UTC)
+	issue := func(owner, repo string, number int, title string) github.Issue {
+		i := makeIssue(owner, repo, number, title)
+		i.CreatedAt = now.Add(-30 * 24 * time.Hour)
+		i.UpdatedAt = now.Add(-7 * 24 * time.Hour)
+		return i
+	}
+	entry := func(i github.Issue, out Outcome, comment string) summaryEntry {
+		ref, _ := ParseHTMLURL(i.HTMLURL)
+		return summaryEntry{ref: ref, issue: i, outcome: out, comment: comment}
+	}
+	entries := []summaryEntry{
+		entry(issue("o", "b", 2, "Second"), OutcomeCommented, "Still happening?\n```\nlogs\n```"),
+		entry(issue("o", "a", 3, "Third"), OutcomeSkipped, ""),
+		entry(issue("o", "a", 1, "First"), OutcomeCommented, "ping"),
+	}
+	res := Result{Matched: 4, Commented: 2, Skipped: 1}
+	h := SummaryHeader{Query: "is:issue `stale`", DryRun: true, Cutoff: now.Add(-7 * 24 * time.Hour), Ceiling: 10, Now: now}
+
+	var b strings.Builder
+	if err := writeSummary(&b, h, res, entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "# Commenter dry run summary\n\n" +
+		"- Query: `is:issue 'stale'`\n" +
+		"- Run at: 2023-06-10T00:00:00Z\n" +
+		"- Updated before: 2023-06-03T00:00:00Z\n" +
+		"- Ceiling: 10\n" +
+		"- Matched 4, would comment 2, skipped 1, failed on 0\n" +
+		"\n## o/a\n\n" +
+		"- [ ] [#1](fake://localhost/o/a/issues/1) First (would comment, opened 30 days ago, updated 7 days ago)\n" +
+		"  <details><summary>Comment</summary>\n\n  ```markdown\n  ping\n  ```\n  </details>\n" +
+		"- [ ] [#3](fake://localhost/o/a/issues/3) Third (skipped, opened 30 days ago, updated 7 days ago)\n" +
+		"\n## o/b\n\n" +
+		"- [ ] [#2](fake://localhost/o/b/issues/2) Second (would comment, opened 30 days ago, updated 7 days ago)\n" +
+		"  <details><summary>Comment</summary>\n\n  ````markdown\n  Still happening?\n  ```\n  logs\n  ```\n  ````\n  </details>\n"
+	if actual := b.String(); actual != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, actual)
+	}
+
+	b.Reset()
+	h.DryRun = false
+	if err := writeSummary(&b, h, res, entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{"# Commenter confirm summary", "- [x] [#1]", "(commented,", "- [ ] [#3]"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected %q in:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestRunRecordsSummary(t *testing.T) {
+	c := fakeClient{
+		issues: []github.Issue{
+			makeIssue("o", "r", 1, "summary"),
+			makeIssue("o", "r", 2, "summary"),
+			makeIssue("o", "error", 3, "summary"),
+		},
+	}
+	summary := NewSummaryLog()
+	_, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("summary"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("#{{.Number}}", true),
+		Summary:       summary,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := map[int]summaryEntry{}
+	for _, e := range summary.entries {
+		got[e.ref.Number] = e
+	}
+	for number, out := range map[int]Outcome{1: OutcomeCommented, 2: OutcomeCommented, 3: OutcomeFailed} {
+		if e := got[number]; e.outcome != out || e.comment != fmt.Sprintf("#%d", number) {
+			t.Errorf("#%d: expected outcome %v with its comment, got %+v", number, out, e)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/config/org"
+)
+
+// reposPerSearch is how many repo: qualifiers a search of Targets holds, to
+// keep queries short.
+const reposPerSearch = 10
+
+// Targets are the orgs and repos that a config enumerates for the searches.
+type Targets struct {
+	// Orgs are searched whole, except for their Excluded repos.
+	Orgs []string
+	// Repos are org/repo names searched on their own.
+	Repos []string
+	// Excluded are the org/repo names left out of the searches of Orgs.
+	Excluded []string
+}
+
+// LoadOrgsConfig reads the targets of an orgs.yaml of peribolos: the repos
+// listed for each org except the archived ones, or the whole org if it lists
+// none.
+func LoadOrgsConfig(path string) (Targets, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Targets{}, err
+	}
+	var cfg org.FullConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return Targets{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	var t Targets
+	for name, o := range cfg.Orgs {
+		if len(o.Repos) == 0 {
+			t.Orgs = append(t.Orgs, name)
+			continue
+		}
+		for repo, r := range o.Repos {
+			if r.Archived != nil && *r.Archived {
+				continue
+			}
+			t.Repos = append(t.Repos, name+"/"+repo)
+		}
+	}
+	return t.normalized(), nil
+}
+
+// LoadProwConfig reads the targets of the Tide queries of a Prow config,
+// including the repos they exclude.
+func LoadProwConfig(path string) (Targets, error) {
+	cfg, err := config.Load(path, "", nil, "")
+	if err != nil {
+		return Targets{}, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	var t Targets
+	for _, q := range cfg.Tide.Queries {
+		t.Orgs = append(t.Orgs, q.Orgs...)
+		t.Repos = append(t.Repos, q.Repos...)
+		t.Excluded = append(t.Excluded, q.ExcludedRepos...)
+	}
+	return t.normalized(), nil
+}
+
+// Merge returns the targets of both t and other.
+func (t Targets) Merge(other Targets) Targets {
+	return Targets{
+		Orgs:     append(append([]string(nil), t.Orgs...), other.Orgs...),
+		Repos:    append(append([]string(nil), t.Repos...), other.Repos...),
+		Excluded: append(append([]string(nil), t.Excluded...), other.Excluded...),
+	}.normalized()
+}
+
+// Filter keeps the orgs and repos whose name matches re, matching orgs by
+// their name alone.
+func (t Targets) Filter(re *regexp.Regexp) Targets {
+	kept := Targets{Excluded: t.Excluded}
+	for _, o := range t.Orgs {
+		if re.MatchString(o) {
+			kept.Orgs = append(kept.Orgs, o)
+		}
+	}
+	for _, r := range t.Repos {
+		if re.MatchString(r) {
+			kept.Repos = append(kept.Repos, r)
+		}
+	}
+	return kept
+}
+
+// Empty reports whether t leaves nothing to search.
+func (t Targets) Empty() bool {
+	return len(t.Orgs) == 0 && len(t.Repos) == 0
+}
+
+// String summarizes t for logs.
+func (t Targets) String() string {
+	return fmt.Sprintf("%d orgs and %d repos, excluding %d", len(t.Orgs), len(t.Repos), len(t.Excluded))
+}
+
+// normalized returns t lowercased, sorted and without duplicates, leaving out
+// the repos that are excluded or already searched as part of their org.
+func (t Targets) normalized() Targets {
+	orgs := map[string]bool{}
+	for _, o := range t.Orgs {
+		orgs[strings.ToLower(o)] = true
+	}
+	excluded := map[string]bool{}
+	for _, r := range t.Excluded {
+		excluded[strings.ToLower(r)] = true
+	}
+	repos := map[string]bool{}
+	for _, r := range t.Repos {
+		r = strings.ToLower(r)
+		o, _, _ := strings.Cut(r, "/")
+		if !excluded[r] && !orgs[o] {
+			repos[r] = true
+		}
+	}
+	return Targets{Orgs: sortedKeys(orgs), Repos: sortedKeys(repos), Excluded: sortedKeys(excluded)}
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TargetScope is the part of a search that limits it to some of the targets.
+type TargetScope struct {
+	// Org is the org of every repo searched.
+	Org string
+	// Qualifiers are the org: or repo: qualifiers to prepend to the query.
+	Qualifiers string
+}
+
+// Scopes returns the scopes of the searches of t: one for each org, leaving
+// out the excluded repos, and one for every few repos of an org.
+func (t Targets) Scopes() []TargetScope {
+	var scopes []TargetScope
+	for _, o := range t.Orgs {
+		q := []string{"org:" + o}
+		for _, r := range t.Excluded {
+			if strings.HasPrefix(r, o+"/") {
+				q = append(q, "-repo:"+r)
+			}
+		}
+		scopes = append(scopes, TargetScope{Org: o, Qualifiers: strings.Join(q, " ")})
+	}
+	byOrg := map[string][]string{}
+	var orgs []string
+	for _, r := range t.Repos {
+		o, _, _ := strings.Cut(r, "/")
+		if byOrg[o] == nil {
+			orgs = append(orgs, o)
+		}
+		byOrg[o] = append(byOrg[o], "repo:"+r)
+	}
+	for _, o := range orgs {
+		repos := byOrg[o]
+		for len(repos) > 0 {
+			n := len(repos)
+			if n > reposPerSearch {
+				n = reposPerSearch
+			}
+			scopes = append(scopes, TargetScope{Org: o, Qualifiers: strings.Join(repos[:n], " ")})
+			repos = repos[n:]
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func TestLoadOrgsConfig(t *testing.T) {
+	path := writeConfig(t, "orgs.yaml", `orgs:
+  kubernetes-sigs:
+    admins: [alice]
+  kubernetes:
+    repos:
+      test-infra:
+        description: Test infrastructure
+      Website: {}
+      old:
+        archived: true
+`)
+	actual, err := LoadOrgsConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Targets{Orgs: []string{"kubernetes-sigs"}, Repos: []string{"kubernetes/test-infra", "kubernetes/website"}}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	if _, err := LoadOrgsConfig(writeConfig(t, "orgs.yaml", "orgs: [not, a, map]")); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
+
+func TestLoadProwConfig(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `tide:
+  queries:
+  - orgs: [kubernetes]
+    excludedRepos: [kubernetes/kubernetes]
+    labels: [lgtm]
+  - repos: [kubernetes-sigs/kind, kubernetes/test-infra]
+`)
+	actual, err := LoadProwConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Targets{
+		Orgs:     []string{"kubernetes"},
+		Repos:    []string{"kubernetes-sigs/kind"},
+		Excluded: []string{"kubernetes/kubernetes"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	if _, err := LoadProwConfig(writeConfig(t, "config.yaml", "tide: [")); err == nil {
+		t.Error("expected an error for a config that does not parse")
+	}
+}
+
+func TestTargetsScopes(t *testing.T) {
+	targets := Targets{Orgs: []string{"kubernetes"}, Excluded: []string{"kubernetes/kubernetes", "kubernetes/website"}}
+	var repos []string
+	for n := 1; n <= reposPerSearch+2; n++ {
+		repos = append(repos, fmt.Sprintf("kubernetes-sigs/repo-%02d", n))
+	}
+	targets = targets.Merge(Targets{Repos: append(repos, "kubernetes/enhancements", "other/one")})
+	actual := targets.Scopes()
+	expected := []TargetScope{
+		{Org: "kubernetes", Qualifiers: "org:kubernetes -repo:kubernetes/kubernetes -repo:kubernetes/website"},
+		{Org: "kubernetes-sigs", Qualifiers: "repo:" + strings.Join(repos[:reposPerSearch], " repo:")},
+		{Org: "kubernetes-sigs", Qualifiers: "repo:" + strings.Join(repos[reposPerSearch:], " repo:")},
+		{Org: "other", Qualifiers: "repo:other/one"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, actual)
+	}
+
+	filtered := targets.Filter(regexp.MustCompile(`^kubernetes-sigs/repo-0[12]$|^other`))
+	expected = []TargetScope{
+		{Org: "kubernetes-sigs", Qualifiers: "repo:kubernetes-sigs/repo-01 repo:kubernetes-sigs/repo-02"},
+		{Org: "other", Qualifiers: "repo:other/one"},
+	}
+	if actual := filtered.Scopes(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, actual)
+	}
+	if !targets.Filter(regexp.MustCompile("^nothing$")).Empty() {
+		t.Error("expected no targets to match")
+	}
+}
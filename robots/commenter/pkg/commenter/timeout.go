@@ -0,0 +1,340 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// DefaultCallTimeout is how long a single GitHub call may take by default.
+const DefaultCallTimeout = 30 * time.Second
+
+// maxSearchPages is the most pages a search returns, GitHub stopping at 1000
+// results of 100 per page.
+const maxSearchPages = 10
+
+// ErrCallTimeout is returned for calls that WithCallTimeout cancelled because
+// they took longer than the timeout. Comments failing with it are retried
+// like those failing with a server error.
+var ErrCallTimeout = errors.New("call timed out")
+
+// timeoutClient cancels every call to Client after timeout.
+type timeoutClient struct {
+	Client
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// WithCallTimeout returns a client that cancels every call of c taking longer
+// than timeout, failing it with ErrCallTimeout, so that a hung request cannot
+// stall a run. Searches get the timeout once for each page they may return.
+// Only the calls c has a context variant of, as the prow and GitLab clients
+// do, can be cancelled; the others are passed through untimed. Each call
+// gets its deadline from ctx, but is not cancelled with it, for the run to
+// finish what it started.
+//
+// Wrapped by NewGraphQLClient, every page of a GraphQL search and every
+// mutation is timed on its own.
+func WithCallTimeout(ctx context.Context, c Client, timeout time.Duration) Client {
+	return &timeoutClient{Client: c, ctx: context.WithoutCancel(ctx), timeout: timeout}
+}
+
+// timed runs f with a context that is cancelled after budget.
+func timed[T any](c *timeoutClient, name string, budget time.Duration, f func(ctx context.Context) (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, budget)
+	defer cancel()
+	v, err := f(ctx)
+	return v, timedOut(ctx, name, budget, err)
+}
+
+// timedOut returns ErrCallTimeout for a call that failed because ctx ran out
+// of its budget, which cancelled it, and err otherwise.
+func timedOut(ctx context.Context, name string, budget time.Duration, err error) error {
+	if err != nil && ctx.Err() != nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: %w after %s: %v", name, ErrCallTimeout, budget, err)
+	}
+	return err
+}
+
+// call is timed for calls that only return an error.
+func (c *timeoutClient) call(name string, f func(ctx context.Context) error) error {
+	_, err := timed(c, name, c.timeout, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, f(ctx)
+	})
+	return err
+}
+
+func (c *timeoutClient) CreateComment(owner, repo string, number int, comment string) error {
+	return c.call("CreateComment", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			CreateCommentWithContext(ctx context.Context, org, repo string, number int, comment string) error
+		}); ok {
+			return cc.CreateCommentWithContext(ctx, owner, repo, number, comment)
+		}
+		return c.Client.CreateComment(owner, repo, number, comment)
+	})
+}
+
+func (c *timeoutClient) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	return timed(c, "FindIssuesWithOrg", maxSearchPages*c.timeout, func(ctx context.Context) ([]github.Issue, error) {
+		if cc, ok := c.Client.(interface {
+			FindIssuesWithOrgWithContext(ctx context.Context, org, query, sort string, asc bool) ([]github.Issue, error)
+		}); ok {
+			return cc.FindIssuesWithOrgWithContext(ctx, org, query, sort, asc)
+		}
+		return c.Client.FindIssuesWithOrg(org, query, sort, asc)
+	})
+}
+
+func (c *timeoutClient) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	return timed(c, "GetIssue", c.timeout, func(ctx context.Context) (*github.Issue, error) {
+		if cc, ok := c.Client.(interface {
+			GetIssueWithContext(ctx context.Context, org, repo string, number int) (*github.Issue, error)
+		}); ok {
+			return cc.GetIssueWithContext(ctx, org, repo, number)
+		}
+		return c.Client.GetIssue(org, repo, number)
+	})
+}
+
+func (c *timeoutClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	return timed(c, "GetPullRequest", c.timeout, func(ctx context.Context) (*github.PullRequest, error) {
+		if cc, ok := c.Client.(interface {
+			GetPullRequestWithContext(ctx context.Context, org, repo string, number int) (*github.PullRequest, error)
+		}); ok {
+			return cc.GetPullRequestWithContext(ctx, org, repo, number)
+		}
+		return c.Client.GetPullRequest(org, repo, number)
+	})
+}
+
+func (c *timeoutClient) GetRepo(owner, name string) (github.FullRepo, error) {
+	return timed(c, "GetRepo", c.timeout, func(ctx context.Context) (github.FullRepo, error) {
+		if cc, ok := c.Client.(interface {
+			GetRepoWithContext(ctx context.Context, owner, name string) (github.FullRepo, error)
+		}); ok {
+			return cc.GetRepoWithContext(ctx, owner, name)
+		}
+		return c.Client.GetRepo(owner, name)
+	})
+}
+
+func (c *timeoutClient) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	return timed(c, "ListIssueComments", c.timeout, func(ctx context.Context) ([]github.IssueComment, error) {
+		if cc, ok := c.Client.(interface {
+			ListIssueCommentsWithContext(ctx context.Context, org, repo string, number int) ([]github.IssueComment, error)
+		}); ok {
+			return cc.ListIssueCommentsWithContext(ctx, org, repo, number)
+		}
+		return c.Client.ListIssueComments(org, repo, number)
+	})
+}
+
+func (c *timeoutClient) QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return timedOut(ctx, "Query", c.timeout, c.Client.QueryWithGitHubAppsSupport(ctx, q, vars, org))
+}
+
+func (c *timeoutClient) MutateWithGitHubAppsSupport(ctx context.Context, m interface{}, input githubql.Input, vars map[string]interface{}, org string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return timedOut(ctx, "Mutate", c.timeout, c.Client.MutateWithGitHubAppsSupport(ctx, m, input, vars, org))
+}
+
+func (c *timeoutClient) CreateGist(description, content string) (string, error) {
+	return timed(c, "CreateGist", c.timeout, func(ctx context.Context) (string, error) {
+		if cc, ok := c.Client.(interface {
+			CreateGistWithContext(ctx context.Context, description, content string) (string, error)
+		}); ok {
+			return cc.CreateGistWithContext(ctx, description, content)
+		}
+		return c.Client.CreateGist(description, content)
+	})
+}
+
+func (c *timeoutClient) BotUserChecker() (func(candidate string) bool, error) {
+	return timed(c, "BotUserChecker", c.timeout, func(ctx context.Context) (func(candidate string) bool, error) {
+		if cc, ok := c.Client.(interface {
+			BotUserCheckerWithContext(ctx context.Context) (func(candidate string) bool, error)
+		}); ok {
+			return cc.BotUserCheckerWithContext(ctx)
+		}
+		return c.Client.BotUserChecker()
+	})
+}
+
+func (c *timeoutClient) AddLabels(org, repo string, number int, labels ...string) error {
+	return c.call("AddLabels", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			AddLabelsWithContext(ctx context.Context, org, repo string, number int, labels ...string) error
+		}); ok {
+			return cc.AddLabelsWithContext(ctx, org, repo, number, labels...)
+		}
+		return c.Client.AddLabels(org, repo, number, labels...)
+	})
+}
+
+func (c *timeoutClient) GetRepoLabels(org, repo string) ([]github.Label, error) {
+	return timed(c, "GetRepoLabels", c.timeout, func(ctx context.Context) ([]github.Label, error) {
+		if cc, ok := c.Client.(interface {
+			GetRepoLabelsWithContext(ctx context.Context, org, repo string) ([]github.Label, error)
+		}); ok {
+			return cc.GetRepoLabelsWithContext(ctx, org, repo)
+		}
+		return c.Client.GetRepoLabels(org, repo)
+	})
+}
+
+func (c *timeoutClient) AddRepoLabel(org, repo, label, description, color string) error {
+	return c.call("AddRepoLabel", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			AddRepoLabelWithContext(ctx context.Context, org, repo, label, description, color string) error
+		}); ok {
+			return cc.AddRepoLabelWithContext(ctx, org, repo, label, description, color)
+		}
+		return c.Client.AddRepoLabel(org, repo, label, description, color)
+	})
+}
+
+func (c *timeoutClient) CloseIssue(org, repo string, number int) error {
+	return c.call("CloseIssue", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			CloseIssueWithContext(ctx context.Context, org, repo string, number int) error
+		}); ok {
+			return cc.CloseIssueWithContext(ctx, org, repo, number)
+		}
+		return c.Client.CloseIssue(org, repo, number)
+	})
+}
+
+func (c *timeoutClient) DeleteComment(org, repo string, id int) error {
+	return c.call("DeleteComment", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			DeleteCommentWithContext(ctx context.Context, org, repo string, id int) error
+		}); ok {
+			return cc.DeleteCommentWithContext(ctx, org, repo, id)
+		}
+		return c.Client.DeleteComment(org, repo, id)
+	})
+}
+
+func (c *timeoutClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	return timed(c, "ListReviews", c.timeout, func(ctx context.Context) ([]github.Review, error) {
+		if cc, ok := c.Client.(interface {
+			ListReviewsWithContext(ctx context.Context, org, repo string, number int) ([]github.Review, error)
+		}); ok {
+			return cc.ListReviewsWithContext(ctx, org, repo, number)
+		}
+		return c.Client.ListReviews(org, repo, number)
+	})
+}
+
+func (c *timeoutClient) ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error) {
+	return timed(c, "ListIssueEvents", c.timeout, func(ctx context.Context) ([]github.ListedIssueEvent, error) {
+		if cc, ok := c.Client.(interface {
+			ListIssueEventsWithContext(ctx context.Context, org, repo string, num int) ([]github.ListedIssueEvent, error)
+		}); ok {
+			return cc.ListIssueEventsWithContext(ctx, org, repo, num)
+		}
+		return c.Client.ListIssueEvents(org, repo, num)
+	})
+}
+
+func (c *timeoutClient) RateLimit() (github.RateLimits, error) {
+	return timed(c, "RateLimit", c.timeout, func(ctx context.Context) (github.RateLimits, error) {
+		if cc, ok := c.Client.(interface {
+			RateLimitWithContext(ctx context.Context) (github.RateLimits, error)
+		}); ok {
+			return cc.RateLimitWithContext(ctx)
+		}
+		return c.Client.RateLimit()
+	})
+}
+
+func (c *timeoutClient) CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error) {
+	return timed(c, "CreateIssue", c.timeout, func(ctx context.Context) (int, error) {
+		if cc, ok := c.Client.(interface {
+			CreateIssueWithContext(ctx context.Context, org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
+		}); ok {
+			return cc.CreateIssueWithContext(ctx, org, repo, title, body, milestone, labels, assignees)
+		}
+		return c.Client.CreateIssue(org, repo, title, body, milestone, labels, assignees)
+	})
+}
+
+func (c *timeoutClient) ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error) {
+	return timed(c, "ListCheckRuns", c.timeout, func(ctx context.Context) (*github.CheckRunList, error) {
+		if cc, ok := c.Client.(interface {
+			ListCheckRunsWithContext(ctx context.Context, org, repo, ref string) (*github.CheckRunList, error)
+		}); ok {
+			return cc.ListCheckRunsWithContext(ctx, org, repo, ref)
+		}
+		return c.Client.ListCheckRuns(org, repo, ref)
+	})
+}
+
+func (c *timeoutClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	return timed(c, "GetCombinedStatus", c.timeout, func(ctx context.Context) (*github.CombinedStatus, error) {
+		if cc, ok := c.Client.(interface {
+			GetCombinedStatusWithContext(ctx context.Context, org, repo, ref string) (*github.CombinedStatus, error)
+		}); ok {
+			return cc.GetCombinedStatusWithContext(ctx, org, repo, ref)
+		}
+		return c.Client.GetCombinedStatus(org, repo, ref)
+	})
+}
+
+func (c *timeoutClient) EditIssue(org, repo string, number int, issue *github.Issue) (*github.Issue, error) {
+	return timed(c, "EditIssue", c.timeout, func(ctx context.Context) (*github.Issue, error) {
+		if cc, ok := c.Client.(interface {
+			EditIssueWithContext(ctx context.Context, org, repo string, number int, issue *github.Issue) (*github.Issue, error)
+		}); ok {
+			return cc.EditIssueWithContext(ctx, org, repo, number, issue)
+		}
+		return c.Client.EditIssue(org, repo, number, issue)
+	})
+}
+
+func (c *timeoutClient) RequestReview(org, repo string, number int, logins []string) error {
+	return c.call("RequestReview", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			RequestReviewWithContext(ctx context.Context, org, repo string, number int, logins []string) error
+		}); ok {
+			return cc.RequestReviewWithContext(ctx, org, repo, number, logins)
+		}
+		return c.Client.RequestReview(org, repo, number, logins)
+	})
+}
+
+func (c *timeoutClient) RemoveLabel(org, repo string, number int, label string) error {
+	return c.call("RemoveLabel", func(ctx context.Context) error {
+		if cc, ok := c.Client.(interface {
+			RemoveLabelWithContext(ctx context.Context, org, repo string, number int, label string) error
+		}); ok {
+			return cc.RemoveLabelWithContext(ctx, org, repo, number, label)
+		}
+		return c.Client.RemoveLabel(org, repo, number, label)
+	})
+}
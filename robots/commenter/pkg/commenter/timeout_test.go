@@ -0,0 +1,190 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// hangingClient hangs on the first hangs comments on each issue until they
+// are cancelled, like a request stuck behind a proxy.
+type hangingClient struct {
+	fakeClient
+	hangs map[int]int
+}
+
+func (c *hangingClient) CreateCommentWithContext(ctx context.Context, owner, repo string, number int, comment string) error {
+	c.Lock()
+	hang := c.hangs[number] > 0
+	if hang {
+		c.hangs[number]--
+	}
+	c.Unlock()
+	if hang {
+		<-ctx.Done()
+		return fmt.Errorf("post: %w", ctx.Err())
+	}
+	return c.fakeClient.CreateComment(owner, repo, number, comment)
+}
+
+func TestRunCallTimeout(t *testing.T) {
+	hc := hangingClient{
+		fakeClient: fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "hung"), makeIssue("o", "r", 2, "hung")}},
+		hangs:      map[int]int{1: 1, 2: 5},
+	}
+	c := WithCallTimeout(context.Background(), &hc, 100*time.Millisecond)
+	done := make(chan struct{})
+	var res Result
+	var err error
+	go func() {
+		defer close(done)
+		res, err = Run(context.Background(), c, Options{
+			Searches:      unscoped("hung"),
+			SamplePercent: 100,
+			Commenter:     MakeCommenter("hello", false),
+			Retries:       1,
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the run hung on the comments")
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The comment on #1 hangs once and is retried, the one on #2 for longer.
+	if expected := []int{1}; !reflect.DeepEqual(hc.comments, expected) {
+		t.Errorf("expected comments on %v, got %v", expected, hc.comments)
+	}
+	if res.Commented != 1 || res.Failed != 1 || len(res.Problems) != 1 {
+		t.Errorf("expected a comment and a failure, got %+v", res)
+	}
+}
+
+// contextClient blocks on the comments posted with a context until it is
+// done, and takes delay to search.
+type contextClient struct {
+	fakeClient
+	cancelled chan error
+	delay     time.Duration
+}
+
+func (c *contextClient) CreateCommentWithContext(ctx context.Context, org, repo string, number int, comment string) error {
+	<-ctx.Done()
+	c.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func (c *contextClient) FindIssuesWithOrgWithContext(ctx context.Context, org, query, sort string, asc bool) ([]github.Issue, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(c.delay):
+		return c.fakeClient.FindIssuesWithOrg(org, query, sort, asc)
+	}
+}
+
+// lateClient comments after delay, ignoring any deadline.
+type lateClient struct {
+	fakeClient
+	delay time.Duration
+}
+
+func (c *lateClient) CreateComment(org, repo string, number int, comment string) error {
+	time.Sleep(c.delay)
+	return c.fakeClient.CreateComment(org, repo, number, comment)
+}
+
+func TestWithCallTimeout(t *testing.T) {
+	cc := contextClient{
+		fakeClient: fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "quick")}},
+		cancelled:  make(chan error, 1),
+		delay:      200 * time.Millisecond,
+	}
+	c := WithCallTimeout(context.Background(), &cc, 100*time.Millisecond)
+	if err := c.CreateComment("o", "r", 1, "hello"); !errors.Is(err, ErrCallTimeout) || !retryable(err) {
+		t.Errorf("expected a retryable ErrCallTimeout, got %v", err)
+	}
+	select {
+	case err := <-cc.cancelled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the call to be cancelled at the deadline, got %v", err)
+		}
+	default:
+		t.Error("expected the call to be cancelled before returning")
+	}
+	if i, err := c.GetIssue("o", "r", 1); err != nil || i.Title != "quick" {
+		t.Errorf("expected calls in time to pass through, got %v, %v", i, err)
+	}
+	if _, err := c.GetIssue("o", "r", 2); err == nil || errors.Is(err, ErrCallTimeout) {
+		t.Errorf("expected the error of the client, got %v", err)
+	}
+	// A search gets the timeout for each page it may return.
+	if issues, err := c.FindIssuesWithOrg("", "quick", "", false); err != nil || len(issues) != 1 {
+		t.Errorf("expected a search longer than one timeout to pass, got %v, %v", issues, err)
+	}
+
+	// Calls that cannot be cancelled are left to finish.
+	lc := lateClient{delay: 200 * time.Millisecond}
+	c = WithCallTimeout(context.Background(), &lc, 100*time.Millisecond)
+	if err := c.CreateComment("o", "r", 1, "hello"); err != nil || len(lc.comments) != 1 {
+		t.Errorf("expected a call that cannot be cancelled to finish, got %v", err)
+	}
+}
+
+func TestWithCallTimeoutCancelsRequests(t *testing.T) {
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-hung:
+		}
+	}))
+	defer server.Close()
+	defer close(hung)
+
+	token := func() []byte { return []byte("token") }
+	gh, err := github.NewClient(token, func(b []byte) []byte { return b }, server.URL+"/graphql", server.URL)
+	if err != nil {
+		t.Fatalf("failed to construct the GitHub client: %v", err)
+	}
+	timeout := 100 * time.Millisecond
+	clients := map[string]Client{
+		"github":  WithCallTimeout(context.Background(), gh, timeout),
+		"graphql": NewGraphQLClient(WithCallTimeout(context.Background(), gh, timeout), false, nil),
+		"gitlab":  WithCallTimeout(context.Background(), NewGitLabClient(server.URL, token, false), timeout),
+	}
+	for name, c := range clients {
+		start := time.Now()
+		if err := c.CreateComment("o", "r", 1, "hello"); !errors.Is(err, ErrCallTimeout) {
+			t.Errorf("%s: expected ErrCallTimeout, got %v", name, err)
+		}
+		if took := time.Since(start); took > 5*time.Second {
+			t.Errorf("%s: expected the request to be cancelled, it took %s", name, took)
+		}
+	}
+}
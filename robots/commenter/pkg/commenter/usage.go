@@ -0,0 +1,142 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// APIUsage is how much of the GitHub API a run used.
+type APIUsage struct {
+	// CoreUsed is how much of the core rate limit the run used, -1 when it
+	// could not be read or reset during the run. The token may be shared, so
+	// it includes the requests of others.
+	CoreUsed int `json:"core_used"`
+	// CoreRemaining is what was left of the core rate limit after the run,
+	// -1 when it could not be read.
+	CoreRemaining int `json:"core_remaining"`
+	SearchPages   int `json:"search_pages"`
+	// IssueFetches are the requests for single issues and what is attached
+	// to them, such as comments, reviews and pull requests.
+	IssueFetches int `json:"issue_fetches"`
+}
+
+// String describes the usage for the run summary.
+func (u APIUsage) String() string {
+	used := "an unknown amount"
+	if u.CoreUsed >= 0 {
+		used = fmt.Sprintf("%d", u.CoreUsed)
+	}
+	left := ""
+	if u.CoreRemaining >= 0 {
+		left = fmt.Sprintf(", %d left", u.CoreRemaining)
+	}
+	return fmt.Sprintf("used %s of the core rate limit%s, with %d search pages and %d issue fetches", used, left, u.SearchPages, u.IssueFetches)
+}
+
+// searchResultsPerPage is the page size of FindIssuesWithOrg.
+const searchResultsPerPage = 100
+
+// usageClient counts the search pages and issue fetches made through Client.
+type usageClient struct {
+	Client
+	searchPages  int64
+	issueFetches int64
+}
+
+func (c *usageClient) FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error) {
+	issues, err := c.Client.FindIssuesWithOrg(org, query, sort, asc)
+	pages := (len(issues) + searchResultsPerPage - 1) / searchResultsPerPage
+	if pages == 0 {
+		pages = 1
+	}
+	atomic.AddInt64(&c.searchPages, int64(pages))
+	return issues, err
+}
+
+func (c *usageClient) fetched() {
+	atomic.AddInt64(&c.issueFetches, 1)
+}
+
+func (c *usageClient) GetIssue(org, repo string, number int) (*github.Issue, error) {
+	c.fetched()
+	return c.Client.GetIssue(org, repo, number)
+}
+
+func (c *usageClient) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	c.fetched()
+	return c.Client.GetPullRequest(org, repo, number)
+}
+
+func (c *usageClient) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
+	c.fetched()
+	return c.Client.ListIssueComments(org, repo, number)
+}
+
+func (c *usageClient) ListIssueEvents(org, repo string, num int) ([]github.ListedIssueEvent, error) {
+	c.fetched()
+	return c.Client.ListIssueEvents(org, repo, num)
+}
+
+func (c *usageClient) ListReviews(org, repo string, number int) ([]github.Review, error) {
+	c.fetched()
+	return c.Client.ListReviews(org, repo, number)
+}
+
+func (c *usageClient) ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error) {
+	c.fetched()
+	return c.Client.ListCheckRuns(org, repo, ref)
+}
+
+func (c *usageClient) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error) {
+	c.fetched()
+	return c.Client.GetCombinedStatus(org, repo, ref)
+}
+
+// coreLimit reads the core rate limit, logging rather than failing when it
+// cannot since the usage is only reported.
+func coreLimit(c Client, logger *log.Logger) (github.RateLimit, bool) {
+	limits, err := c.RateLimit()
+	if err != nil {
+		logger.Printf("Failed to read the rate limit for the API usage: %v", err)
+		return github.RateLimit{}, false
+	}
+	return limits.Resources.Core, true
+}
+
+// usage returns the API usage since start, which ok says was read.
+func (c *usageClient) usage(start github.RateLimit, ok bool, logger *log.Logger) APIUsage {
+	u := APIUsage{
+		CoreUsed:      -1,
+		CoreRemaining: -1,
+		SearchPages:   int(atomic.LoadInt64(&c.searchPages)),
+		IssueFetches:  int(atomic.LoadInt64(&c.issueFetches)),
+	}
+	end, endOK := coreLimit(c.Client, logger)
+	if !endOK {
+		return u
+	}
+	u.CoreRemaining = end.Remaining
+	if ok && end.Reset == start.Reset {
+		u.CoreUsed = start.Remaining - end.Remaining
+	}
+	return u
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestRunAPIUsage(t *testing.T) {
+	var issues []github.Issue
+	for n := 1; n <= 150; n++ {
+		issues = append(issues, makeIssue("o", "r", n, "costly"))
+	}
+	cases := []struct {
+		name       string
+		rateLimits []github.RateLimit
+		expected   APIUsage
+		log        string
+	}{
+		{
+			name:       "usage",
+			rateLimits: []github.RateLimit{{Limit: 5000, Remaining: 4000, Reset: 1}, {Limit: 5000, Remaining: 3700, Reset: 1}},
+			expected:   APIUsage{CoreUsed: 300, CoreRemaining: 3700, SearchPages: 2, IssueFetches: 3},
+			log:        "The run used 300 of the core rate limit, 3700 left, with 2 search pages and 3 issue fetches",
+		},
+		{
+			name:       "limit reset during the run",
+			rateLimits: []github.RateLimit{{Limit: 5000, Remaining: 10, Reset: 1}, {Limit: 5000, Remaining: 4990, Reset: 2}},
+			expected:   APIUsage{CoreUsed: -1, CoreRemaining: 4990, SearchPages: 2, IssueFetches: 3},
+			log:        "The run used an unknown amount of the core rate limit, 4990 left",
+		},
+		{
+			name:     "rate limit cannot be read",
+			expected: APIUsage{CoreUsed: -1, CoreRemaining: -1, SearchPages: 2, IssueFetches: 3},
+			log:      "Failed to read the rate limit for the API usage",
+		},
+	}
+	for _, tc := range cases {
+		c := fakeClient{issues: issues, rateLimits: tc.rateLimits}
+		var logs bytes.Buffer
+		metrics := &MetricsLog{}
+		res, err := Run(context.Background(), &c, Options{
+			Searches:      unscoped("costly"),
+			SamplePercent: 100,
+			Ceiling:       3,
+			Commenter:     MakeCommenter("ping", false),
+			Metrics:       metrics,
+			Logger:        log.New(&logs, "", 0),
+		})
+		if err := runErr(res, err); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if res.API != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, res.API)
+		}
+		if !strings.Contains(logs.String(), tc.log) {
+			t.Errorf("%s: expected %q in the logs, got:\n%s", tc.name, tc.log, logs.String())
+		}
+		path := filepath.Join(t.TempDir(), "metrics.json")
+		if err := metrics.Save(path); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		var report metricsReport
+		if err := json.Unmarshal(b, &report); err != nil {
+			t.Fatalf("%s: bad report %s: %v", tc.name, b, err)
+		}
+		if report.API == nil || *report.API != tc.expected {
+			t.Errorf("%s: expected the usage %+v in the metrics, got %s", tc.name, tc.expected, b)
+		}
+	}
+}
+
+func TestRunAPIUsageWithRateGuard(t *testing.T) {
+	c := fakeClient{
+		issues:     []github.Issue{makeIssue("o", "r", 1, "guarded")},
+		rateLimits: []github.RateLimit{{Limit: 5000, Remaining: 4000, Reset: 1}, {Limit: 5000, Remaining: 3990, Reset: 1}},
+	}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("guarded"),
+		SamplePercent: 100,
+		Commenter:     MakeCommenter("ping", false),
+		RateLimit:     NewRateGuard(&c, 100, false, 0),
+	})
+	if err := runErr(res, err); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The limit checked before the run is reused rather than read again.
+	if res.API.CoreUsed != 10 {
+		t.Errorf("expected 10 of the core rate limit used, got %+v", res.API)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// variantMarkerPrefix starts the hidden marker naming the comment variant, so
+// that responses can later be attributed to it.
+const variantMarkerPrefix = "<!-- commenter-variant: "
+
+// variantMarker returns the marker of variant n, counted from 1.
+func variantMarker(n int) string {
+	return fmt.Sprintf("%s%d -->", variantMarkerPrefix, n)
+}
+
+// commentVariant returns the variant the comment was rendered from, or 0 if
+// it has no variant marker.
+func commentVariant(comment string) int {
+	start := strings.LastIndex(comment, variantMarkerPrefix)
+	if start < 0 {
+		return 0
+	}
+	rest := comment[start+len(variantMarkerPrefix):]
+	end := strings.Index(rest, " -->")
+	if end < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(rest[:end])
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// MakeVariantCommenter returns a commenter that renders one of the comments,
+// chosen with r for every issue, and marks it with the variant used. A single
+// comment is rendered like MakeCommenter, without a marker.
+func MakeVariantCommenter(comments []string, useTemplate bool, r *rand.Rand) func(Meta) (string, error) {
+	if len(comments) == 1 {
+		return MakeCommenter(comments[0], useTemplate)
+	}
+	var variants []func(Meta) (string, error)
+	for _, comment := range comments {
+		variants = append(variants, MakeCommenter(comment, useTemplate))
+	}
+	// r is shared by the workers.
+	var mu sync.Mutex
+	return func(m Meta) (string, error) {
+		mu.Lock()
+		n := r.Intn(len(variants))
+		mu.Unlock()
+		comment, err := variants[n](m)
+		if err != nil {
+			return "", err
+		}
+		return comment + "\n\n" + variantMarker(n+1), nil
+	}
+}
+
+// variantLog records the comment variant used for each issue. A nil
+// variantLog records nothing.
+type variantLog struct {
+	sync.Mutex
+	variants map[string]int
+}
+
+func newVariantLog() *variantLog {
+	return &variantLog{variants: map[string]int{}}
+}
+
+// add records that the issue at url was commented on with variant n.
+func (v *variantLog) add(url string, n int) {
+	if v == nil {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.variants[url] = n
+}
+
+// of returns the variant recorded for url, or 0.
+func (v *variantLog) of(url string) int {
+	if v == nil {
+		return 0
+	}
+	v.Lock()
+	defer v.Unlock()
+	return v.variants[url]
+}
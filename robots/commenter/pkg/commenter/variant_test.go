@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestMakeVariantCommenter(t *testing.T) {
+	m := Meta{Number: 7}
+	single := MakeVariantCommenter([]string{"#{{.Number}}"}, true, rand.New(rand.NewSource(1)))
+	if comment, err := single(m); err != nil || comment != "#7" {
+		t.Errorf("expected a single comment to render as is, got %q, %v", comment, err)
+	}
+
+	variants := MakeVariantCommenter([]string{"friendly #{{.Number}}", "direct #{{.Number}}"}, true, rand.New(rand.NewSource(1)))
+	seen := map[int]bool{}
+	for n := 0; n < 50; n++ {
+		comment, err := variants(m)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		v := commentVariant(comment)
+		expected := map[int]string{1: "friendly #7", 2: "direct #7"}[v] + "\n\n" + variantMarker(v)
+		if comment != expected {
+			t.Fatalf("expected %q, got %q", expected, comment)
+		}
+		seen[v] = true
+	}
+	if !seen[1] || !seen[2] {
+		t.Errorf("expected both variants to be used, got %v", seen)
+	}
+
+	// The same seed picks the same variants.
+	a := MakeVariantCommenter([]string{"a", "b", "c"}, false, rand.New(rand.NewSource(42)))
+	b := MakeVariantCommenter([]string{"a", "b", "c"}, false, rand.New(rand.NewSource(42)))
+	for n := 0; n < 10; n++ {
+		x, _ := a(m)
+		y, _ := b(m)
+		if x != y {
+			t.Fatalf("expected the same variants for the same seed, got %q and %q", x, y)
+		}
+	}
+}
+
+func TestCommentVariant(t *testing.T) {
+	cases := map[string]int{
+		"plain":                                 0,
+		"text\n\n<!-- commenter-variant: 3 -->": 3,
+		"<!-- commenter-variant: 1 -->\n\nfooter":   1,
+		"<!-- commenter-variant: x -->":             0,
+		"<!-- commenter-variant: 0 -->":             0,
+		"<!-- commenter-variant: 2":                 0,
+		"quoted <!-- commenter-variant: 1 --> then": 1,
+	}
+	for comment, expected := range cases {
+		if actual := commentVariant(comment); actual != expected {
+			t.Errorf("%q: expected variant %d, got %d", comment, expected, actual)
+		}
+	}
+}
+
+func TestRunCommentVariants(t *testing.T) {
+	c := fakeClient{}
+	for n := 1; n <= 6; n++ {
+		c.issues = append(c.issues, makeIssue("o", "r", n, "nag"))
+	}
+	var logs bytes.Buffer
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("nag"),
+		SamplePercent: 100,
+		Commenter:     MakeVariantCommenter([]string{"friendly", "direct"}, false, rand.New(rand.NewSource(3))),
+		Confirm:       true,
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err := runErr(res, err); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res.Issues) != 6 || len(c.bodies) != 6 {
+		t.Fatalf("expected 6 issues commented on, got %+v and %q", res.Issues, c.bodies)
+	}
+	byVariant := map[int]int{}
+	for _, i := range res.Issues {
+		if i.Variant != 1 && i.Variant != 2 {
+			t.Errorf("%s: expected variant 1 or 2, got %d", i.URL, i.Variant)
+		}
+		byVariant[i.Variant]++
+		if line := fmt.Sprintf("Using comment variant %d for %s", i.Variant, i.URL); !strings.Contains(logs.String(), line) {
+			t.Errorf("expected %q in the logs, got:\n%s", line, logs.String())
+		}
+	}
+	for _, body := range c.bodies {
+		byVariant[commentVariant(body)]--
+	}
+	for v, n := range byVariant {
+		if n != 0 {
+			t.Errorf("variant %d: the results and the comments posted disagree by %d", v, n)
+		}
+	}
+	report := NewRunReport("nag", false, res, nil)
+	for n, i := range report.Issues {
+		if i.Variant != res.Issues[n].Variant {
+			t.Errorf("%s: expected variant %d in the report, got %d", i.URL, res.Issues[n].Variant, i.Variant)
+		}
+	}
+}
+
+func TestRunSingleCommentHasNoVariant(t *testing.T) {
+	c := fakeClient{issues: []github.Issue{makeIssue("o", "r", 1, "nag")}}
+	res, err := Run(context.Background(), &c, Options{
+		Searches:      unscoped("nag"),
+		SamplePercent: 100,
+		Commenter:     MakeVariantCommenter([]string{"only"}, false, rand.New(rand.NewSource(3))),
+		Confirm:       true,
+	})
+	if err := runErr(res, err); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.bodies) != 1 || c.bodies[0] != "only" || res.Issues[0].Variant != 0 {
+		t.Errorf("expected the comment without a variant, got %q and %+v", c.bodies, res.Issues)
+	}
+}
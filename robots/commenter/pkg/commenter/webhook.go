@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// reportTimeout bounds each attempt to post to the --report-webhook-url-file.
+	reportTimeout = 10 * time.Second
+	// reportRetries is how many times a post failing with a 5xx is retried.
+	reportRetries = 3
+)
+
+// reportRetryDelay is waited before the first retry, and doubled for the next.
+var reportRetryDelay = time.Second
+
+// RunReport is the JSON a run posts to the --report-webhook-url-file.
+type RunReport struct {
+	Query       string        `json:"query"`
+	DryRun      bool          `json:"dry_run"`
+	Matched     int           `json:"matched"`
+	Commented   int           `json:"commented"`
+	Skipped     int           `json:"skipped"`
+	Failed      int           `json:"failed"`
+	CommentedOn []string      `json:"commented_on"`
+	Issues      []reportIssue `json:"issues"`
+	Problems    []string      `json:"problems"`
+	API         APIUsage      `json:"api"`
+	// FewMatches is set when the searches matched fewer issues than
+	// expected, see Result.
+	FewMatches bool `json:"few_matches,omitempty"`
+	// Error is set when the run failed before commenting.
+	Error string `json:"error,omitempty"`
+}
+
+// reportIssue is the outcome of an issue in a RunReport.
+type reportIssue struct {
+	URL     string `json:"url"`
+	Outcome string `json:"outcome"`
+	// Variant is the comment variant used, if the comment has variants.
+	Variant int `json:"variant,omitempty"`
+}
+
+// NewRunReport reports res, or err if the run failed.
+func NewRunReport(query string, dryRun bool, res Result, err error) RunReport {
+	r := RunReport{
+		Query:       query,
+		DryRun:      dryRun,
+		Matched:     res.Matched,
+		Commented:   res.Commented,
+		Skipped:     res.Skipped,
+		Failed:      res.Failed,
+		CommentedOn: append([]string{}, res.CommentedOn...),
+		Issues:      []reportIssue{},
+		Problems:    append([]string{}, res.Problems...),
+		API:         res.API,
+		FewMatches:  res.FewMatches,
+	}
+	for _, i := range res.Issues {
+		r.Issues = append(r.Issues, reportIssue{URL: i.URL, Outcome: i.Outcome.String(), Variant: i.Variant})
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// ParseReportHeaders parses "Name: value" headers for the report webhook.
+func ParseReportHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%q is not of the form Name: value", header)
+		}
+		h.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return h, nil
+}
+
+// PostReport posts r as JSON to the webhook with the headers, retrying a few
+// times if the server fails with a 5xx.
+func PostReport(webhook string, headers http.Header, r RunReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: reportTimeout}
+	delay := reportRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := postReport(&client, webhook, headers, body)
+		if err == nil || !retry || attempt == reportRetries {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// postReport makes a single attempt at posting body, returning whether a
+// failure is worth retrying.
+func postReport(client *http.Client, webhook string, headers http.Header, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		// Drop the webhook URL, which is a secret, from the error.
+		if uerr, ok := err.(*url.Error); ok {
+			return false, fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+		}
+		return false, fmt.Errorf("invalid webhook URL")
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		if uerr, ok := err.(*url.Error); ok {
+			return false, fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode >= 500, fmt.Errorf("%s: %s", resp.Status, msg)
+	}
+	return false, nil
+}
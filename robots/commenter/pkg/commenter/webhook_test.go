@@ -0,0 +1,165 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostReport(t *testing.T) {
+	defer func(delay time.Duration) { reportRetryDelay = delay }(reportRetryDelay)
+	reportRetryDelay = 0
+	res := Result{
+		Matched:     3,
+		Commented:   1,
+		Skipped:     1,
+		Failed:      1,
+		CommentedOn: []string{"https://github.com/o/r/issues/1"},
+		Issues: []IssueResult{
+			{URL: "https://github.com/o/r/issues/1", Outcome: OutcomeCommented},
+			{URL: "https://github.com/o/r/issues/2", Outcome: OutcomeSkipped},
+			{URL: "https://github.com/o/r/issues/3", Outcome: OutcomeFailed},
+		},
+		Problems: []string{"Failed to apply comment to o/r#3: boom"},
+		API:      APIUsage{CoreUsed: 12, CoreRemaining: 4988, SearchPages: 1, IssueFetches: 3},
+	}
+	headers, err := ParseReportHeaders([]string{"Authorization: Bearer s3cret", "x-team:  triage "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		name     string
+		statuses []int
+		attempts int
+		err      string
+	}{
+		{
+			name:     "posted",
+			statuses: []int{http.StatusOK},
+			attempts: 1,
+		},
+		{
+			name:     "retried on 5xx",
+			statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusAccepted},
+			attempts: 3,
+		},
+		{
+			name:     "gives up after the retries",
+			statuses: []int{http.StatusInternalServerError},
+			attempts: reportRetries + 1,
+			err:      "500 Internal Server Error",
+		},
+		{
+			name:     "4xx is not retried",
+			statuses: []int{http.StatusUnauthorized},
+			attempts: 1,
+			err:      "401 Unauthorized",
+		},
+	}
+	for _, tc := range cases {
+		attempts := 0
+		var bodies []RunReport
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if r.Method != http.MethodPost {
+				t.Errorf("%s: expected a POST, got %s", tc.name, r.Method)
+			}
+			for name, value := range map[string]string{"Authorization": "Bearer s3cret", "X-Team": "triage", "Content-Type": "application/json"} {
+				if actual := r.Header.Get(name); actual != value {
+					t.Errorf("%s: expected header %s: %q, got %q", tc.name, name, value, actual)
+				}
+			}
+			var report RunReport
+			if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+				t.Errorf("%s: bad payload: %v", tc.name, err)
+			}
+			bodies = append(bodies, report)
+			status := tc.statuses[len(tc.statuses)-1]
+			if attempts <= len(tc.statuses) {
+				status = tc.statuses[attempts-1]
+			}
+			w.WriteHeader(status)
+		}))
+		err := PostReport(server.URL, headers, NewRunReport("is:issue stale", true, res, nil))
+		server.Close()
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+		}
+		if attempts != tc.attempts {
+			t.Errorf("%s: expected %d attempts, got %d", tc.name, tc.attempts, attempts)
+		}
+		expected := RunReport{
+			Query:       "is:issue stale",
+			DryRun:      true,
+			Matched:     3,
+			Commented:   1,
+			Skipped:     1,
+			Failed:      1,
+			CommentedOn: []string{"https://github.com/o/r/issues/1"},
+			Issues: []reportIssue{
+				{URL: "https://github.com/o/r/issues/1", Outcome: "commented"},
+				{URL: "https://github.com/o/r/issues/2", Outcome: "skipped"},
+				{URL: "https://github.com/o/r/issues/3", Outcome: "failed"},
+			},
+			Problems: []string{"Failed to apply comment to o/r#3: boom"},
+			API:      APIUsage{CoreUsed: 12, CoreRemaining: 4988, SearchPages: 1, IssueFetches: 3},
+		}
+		for _, actual := range bodies {
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("%s: expected payload %+v, got %+v", tc.name, expected, actual)
+			}
+		}
+	}
+}
+
+func TestNewRunReportError(t *testing.T) {
+	r := NewRunReport("q", false, Result{}, errors.New("search failed"))
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, s := range []string{`"error":"search failed"`, `"issues":[]`, `"problems":[]`, `"commented_on":[]`} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("expected %s in %s", s, b)
+		}
+	}
+}
+
+func TestParseReportHeaders(t *testing.T) {
+	for _, bad := range []string{"Authorization", ": value", "Bad Name: value", "X-Token: a\nb"} {
+		if _, err := ParseReportHeaders([]string{bad}); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+	h, err := ParseReportHeaders([]string{"x-a: 1", "X-A: 2", "X-Empty:"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := http.Header{"X-A": {"1", "2"}, "X-Empty": {""}}
+	if !reflect.DeepEqual(h, expected) {
+		t.Errorf("expected %v, got %v", expected, h)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// stalenessWeights returns the weight of each of issues for weightedShuffle:
+// one more than the days since it was updated, so that fresh issues can still
+// be picked. Issues without a timestamp get the mean weight of the others, or
+// all the same weight when none has one.
+func stalenessWeights(issues []github.Issue, now time.Time) []float64 {
+	weights := make([]float64, len(issues))
+	var sum float64
+	known := 0
+	for n, i := range issues {
+		if i.UpdatedAt.IsZero() {
+			continue
+		}
+		weights[n] = math.Max(now.Sub(i.UpdatedAt).Hours()/24, 0) + 1
+		sum += weights[n]
+		known++
+	}
+	fallback := 1.0
+	if known > 0 {
+		fallback = sum / float64(known)
+	}
+	for n, i := range issues {
+		if i.UpdatedAt.IsZero() {
+			weights[n] = fallback
+		}
+	}
+	return weights
+}
+
+// weightedShuffle orders issues at random with the chance of coming first
+// proportional to their staleness weights, sampling without replacement so
+// that the ceiling takes a weighted sample of those first.
+func weightedShuffle(issues []github.Issue, now time.Time, r *rand.Rand) {
+	weights := stalenessWeights(issues, now)
+	// Efraimidis and Spirakis: the issues with the largest u^(1/w) keys, for u
+	// uniform in (0, 1], are a weighted sample. Logarithms keep the keys apart.
+	keys := make([]float64, len(issues))
+	for n := range issues {
+		keys[n] = math.Log(1-r.Float64()) / weights[n]
+	}
+	order := make([]int, len(issues))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return keys[order[a]] > keys[order[b]]
+	})
+	shuffled := make([]github.Issue, len(issues))
+	for n, from := range order {
+		shuffled[n] = issues[from]
+	}
+	copy(issues, shuffled)
+}
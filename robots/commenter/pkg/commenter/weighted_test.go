@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package commenter
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// agedIssues returns an issue for each of days, updated that many days before now.
+func agedIssues(now time.Time, days ...int) []github.Issue {
+	var issues []github.Issue
+	for n, d := range days {
+		i := makeIssue("o", "r", n+1, "aged")
+		i.UpdatedAt = now.Add(-time.Duration(d) * 24 * time.Hour)
+		issues = append(issues, i)
+	}
+	return issues
+}
+
+func numbers(issues []github.Issue) []int {
+	var out []int
+	for _, i := range issues {
+		ref, err := ParseHTMLURL(i.HTMLURL)
+		if err != nil {
+			panic(err)
+		}
+		out = append(out, ref.Number)
+	}
+	return out
+}
+
+func TestWeightedShuffle(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	// Issue 1 is the freshest and issue 4 the stalest.
+	days := []int{3, 30, 300, 1000}
+	order := func(seed int64) []int {
+		issues := agedIssues(now, days...)
+		weightedShuffle(issues, now, rand.New(rand.NewSource(seed)))
+		return numbers(issues)
+	}
+	if a, b := order(42), order(42); !reflect.DeepEqual(a, b) {
+		t.Errorf("expected the same order with the same seed, got %v and %v", a, b)
+	}
+
+	const trials = 2000
+	r := rand.New(rand.NewSource(1))
+	first := map[int]int{}
+	position := map[int]int{}
+	for n := 0; n < trials; n++ {
+		issues := agedIssues(now, days...)
+		weightedShuffle(issues, now, r)
+		for p, number := range numbers(issues) {
+			position[number] += p
+		}
+		first[numbers(issues)[0]]++
+	}
+	for number := 1; number < len(days); number++ {
+		if first[number] >= first[number+1] {
+			t.Errorf("expected issue %d, staler than %d, to come first more often, got %v", number+1, number, first)
+		}
+		if position[number] <= position[number+1] {
+			t.Errorf("expected issue %d, staler than %d, to come earlier on average, got total positions %v", number+1, number, position)
+		}
+	}
+	if first[1] == 0 {
+		t.Errorf("expected the freshest issue to still come first sometimes, got %v", first)
+	}
+}
+
+func TestStalenessWeights(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	issues := agedIssues(now, 0, 9, 2)
+	issues[2].UpdatedAt = time.Time{}
+	if got, expected := stalenessWeights(issues, now), []float64{1, 10, 5.5}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected weights %v, got %v", expected, got)
+	}
+	issues[0].UpdatedAt, issues[1].UpdatedAt = time.Time{}, time.Time{}
+	if got, expected := stalenessWeights(issues, now), []float64{1, 1, 1}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected uniform weights without timestamps, got %v", got)
+	}
+}
+
+func TestRunRandomWeighted(t *testing.T) {
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	expected := agedIssues(now, 3, 30, 300, 1000)
+	weightedShuffle(expected, now, rand.New(rand.NewSource(7)))
+	c := fakeClient{issues: agedIssues(now, 3, 30, 300, 1000)}
+	err := runErr(Run(context.Background(), &c, Options{
+		Searches:       unscoped("aged"),
+		SamplePercent:  100,
+		Commenter:      MakeCommenter("hi", false),
+		Ceiling:        2,
+		RandomWeighted: true,
+		Rand:           rand.New(rand.NewSource(7)),
+		Clock:          clocktesting.NewFakePassiveClock(now),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := c.comments; !reflect.DeepEqual(got, numbers(expected)[:2]) {
+		t.Errorf("expected comments on the first 2 of %v, got %v", numbers(expected), got)
+	}
+}